@@ -0,0 +1,373 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+const (
+	// alertHistorySize is the number of cleared alerts kept per cluster
+	alertHistorySize = 100
+
+	// clusterStatusMetric is the metric of the availability alerts raised by
+	// the cluster prober rather than by evaluating collected metrics
+	clusterStatusMetric = "cluster_status"
+)
+
+// ErrAlertNotFound is returned when an alert ID doesn't match a stored alert
+var ErrAlertNotFound = errors.New("alert not found")
+
+// AlertNotifier is told about alerts that became active
+type AlertNotifier interface {
+	Notify(alert *models.Alert)
+}
+
+// AlertManager keeps the alerts raised for each cluster across collection
+// cycles. Repeated detections of the same condition update a single alert, so
+// acknowledging or resolving it sticks until the condition clears. Alerts
+// raised together on a primary and its replicas are correlated into one
+// incident.
+type AlertManager struct {
+	analyzer  *PerformanceAnalyzer
+	mu        sync.Mutex
+	alerts    map[string]map[string]*models.Alert // clusterID -> alert ID -> alert
+	primaries map[string]string                   // replica clusterID -> primary clusterID
+	history   map[string][]*models.Alert          // clusterID -> cleared alerts, oldest first
+	notifiers []AlertNotifier
+}
+
+// NewAlertManager creates an AlertManager evaluating metrics with analyzer
+func NewAlertManager(analyzer *PerformanceAnalyzer) *AlertManager {
+	return &AlertManager{
+		analyzer:  analyzer,
+		alerts:    make(map[string]map[string]*models.Alert),
+		primaries: make(map[string]string),
+		history:   make(map[string][]*models.Alert),
+	}
+}
+
+// SetPrimary records the cluster a replica replicates from. An empty
+// primaryID marks the cluster as a primary.
+func (am *AlertManager) SetPrimary(clusterID, primaryID string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if primaryID == "" {
+		delete(am.primaries, clusterID)
+		return
+	}
+	am.primaries[clusterID] = primaryID
+}
+
+// AddNotifier registers a notifier for alerts that become active. Notifiers
+// must be added before the manager starts observing metrics.
+func (am *AlertManager) AddNotifier(notifier AlertNotifier) {
+	am.notifiers = append(am.notifiers, notifier)
+}
+
+// Export evaluates a collection cycle's metrics, so the manager can be added
+// as a metrics collector sink
+func (am *AlertManager) Export(ctx context.Context, metrics *models.Metrics) error {
+	am.Observe(metrics)
+	return nil
+}
+
+// Observe evaluates metrics and updates the cluster's alerts. Known conditions
+// keep their ID, first-seen time and status; conditions that are no longer
+// detected are resolved and moved to the cluster's history. The alerts that
+// became active are sent to the notifiers and returned, after correlation
+// with the rest of the replication topology.
+func (am *AlertManager) Observe(metrics *models.Metrics) []*models.Alert {
+	activated := am.update(am.analyzer.AnalyzeMetrics(metrics), metrics.ClusterID)
+
+	for _, alert := range activated {
+		for _, notifier := range am.notifiers {
+			notifier.Notify(alert)
+		}
+	}
+
+	return activated
+}
+
+// update stores a cluster's detected alerts and returns copies of the new ones
+func (am *AlertManager) update(detected []*models.Alert, clusterID string) []*models.Alert {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	previous := am.alerts[clusterID]
+	current := make(map[string]*models.Alert, len(detected))
+	activated := make([]*models.Alert, 0)
+
+	for _, alert := range detected {
+		if existing, exists := previous[alert.ID]; exists {
+			existing.Severity = alert.Severity
+			existing.Description = alert.Description
+			existing.Threshold = alert.Threshold
+			existing.CurrentValue = alert.CurrentValue
+			existing.Metadata = alert.Metadata
+			existing.Actions = alert.Actions
+			current[alert.ID] = existing
+			continue
+		}
+
+		current[alert.ID] = alert
+		activated = append(activated, alert)
+	}
+
+	for id, alert := range previous {
+		if _, stillDetected := current[id]; stillDetected {
+			continue
+		}
+		// The prober raises and clears these, metrics don't cover them
+		if alert.Metric == clusterStatusMetric {
+			current[id] = alert
+			continue
+		}
+		if alert.Status != "resolved" {
+			alert.Resolve()
+		}
+		am.recordHistory(clusterID, alert)
+	}
+
+	am.alerts[clusterID] = current
+	root, _ := am.rootCluster(clusterID)
+	am.correlate(root)
+
+	for i, alert := range activated {
+		activated[i] = copyAlert(alert)
+	}
+
+	return activated
+}
+
+// ClusterStatusChanged raises an availability alert when the prober finds a
+// cluster unhealthy or unreachable, and resolves it once the cluster is
+// healthy again, so the manager can be added as a cluster status observer
+func (am *AlertManager) ClusterStatusChanged(clusterID, status string, err error) {
+	const title = "Cluster Unavailable"
+	id := models.AlertID(clusterID, models.AlertTypeAvailability, clusterStatusMetric, title)
+
+	if status == "healthy" {
+		am.mu.Lock()
+		defer am.mu.Unlock()
+
+		if alert, exists := am.alerts[clusterID][id]; exists {
+			if alert.Status != "resolved" {
+				alert.Resolve()
+			}
+			delete(am.alerts[clusterID], id)
+			am.recordHistory(clusterID, alert)
+			root, _ := am.rootCluster(clusterID)
+			am.correlate(root)
+		}
+		return
+	}
+
+	severity := models.AlertSeverityHigh
+	if status == "unreachable" {
+		severity = models.AlertSeverityCritical
+	}
+	alert := models.NewAlert(
+		models.AlertTypeAvailability,
+		severity,
+		clusterID,
+		clusterStatusMetric,
+		title,
+		fmt.Sprintf("Cluster is %s: %v", status, err),
+	)
+	alert.Metadata = map[string]interface{}{
+		"status": status,
+	}
+	alert.AddAction("Check that the server is running and accepting connections")
+	alert.AddAction("Check network connectivity and credentials from the observer to the server")
+
+	if activated := am.raise(clusterID, alert); activated != nil {
+		for _, notifier := range am.notifiers {
+			notifier.Notify(activated)
+		}
+	}
+}
+
+// raise stores one alert of a cluster next to its other alerts, updating it
+// if it is already active. It returns a copy of the alert if it is new.
+func (am *AlertManager) raise(clusterID string, alert *models.Alert) *models.Alert {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	if am.alerts[clusterID] == nil {
+		am.alerts[clusterID] = make(map[string]*models.Alert)
+	}
+	if existing, exists := am.alerts[clusterID][alert.ID]; exists {
+		existing.Severity = alert.Severity
+		existing.Description = alert.Description
+		existing.Metadata = alert.Metadata
+		return nil
+	}
+
+	am.alerts[clusterID][alert.ID] = alert
+	root, _ := am.rootCluster(clusterID)
+	am.correlate(root)
+
+	return copyAlert(alert)
+}
+
+// recordHistory appends a cleared alert to a cluster's bounded history
+func (am *AlertManager) recordHistory(clusterID string, alert *models.Alert) {
+	history := append(am.history[clusterID], alert)
+	if len(history) > alertHistorySize {
+		history = history[len(history)-alertHistorySize:]
+	}
+	am.history[clusterID] = history
+}
+
+// rootCluster follows replica relationships up to the primary at the top,
+// returning it with the number of replication hops to reach it
+func (am *AlertManager) rootCluster(clusterID string) (string, int) {
+	root, depth := clusterID, 0
+	for depth <= len(am.primaries) {
+		primary, isReplica := am.primaries[root]
+		if !isReplica {
+			break
+		}
+		root = primary
+		depth++
+	}
+	return root, depth
+}
+
+// correlate links the unresolved alerts of a primary and its replicas. When
+// more than one cluster of the topology has alerts they share a correlation ID,
+// the ID of the root cause: the oldest alert closest to the primary.
+func (am *AlertManager) correlate(root string) {
+	related := make([]*models.Alert, 0)
+	clusters := make(map[string]bool)
+
+	for clusterID, alerts := range am.alerts {
+		if clusterRoot, _ := am.rootCluster(clusterID); clusterRoot != root {
+			continue
+		}
+		for _, alert := range alerts {
+			if alert.Status == "resolved" {
+				continue
+			}
+			related = append(related, alert)
+			clusters[clusterID] = true
+		}
+	}
+
+	if len(clusters) < 2 {
+		for _, alert := range related {
+			alert.CorrelationID = ""
+		}
+		return
+	}
+
+	var rootCause *models.Alert
+	for _, alert := range related {
+		if rootCause == nil || am.causes(alert, rootCause) {
+			rootCause = alert
+		}
+	}
+
+	for _, alert := range related {
+		alert.CorrelationID = rootCause.ID
+	}
+}
+
+// causes reports whether alert a is a likelier root cause than alert b:
+// it is raised closer to the primary, or earlier on the same level
+func (am *AlertManager) causes(a, b *models.Alert) bool {
+	_, depthA := am.rootCluster(a.ClusterID)
+	_, depthB := am.rootCluster(b.ClusterID)
+	if depthA != depthB {
+		return depthA < depthB
+	}
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	return a.ID < b.ID
+}
+
+// Alerts returns the current alerts of a cluster, oldest first
+func (am *AlertManager) Alerts(clusterID string) []*models.Alert {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	alerts := make([]*models.Alert, 0, len(am.alerts[clusterID]))
+	for _, alert := range am.alerts[clusterID] {
+		alerts = append(alerts, copyAlert(alert))
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if !alerts[i].Timestamp.Equal(alerts[j].Timestamp) {
+			return alerts[i].Timestamp.Before(alerts[j].Timestamp)
+		}
+		return alerts[i].ID < alerts[j].ID
+	})
+
+	return alerts
+}
+
+// History returns the cleared alerts of a cluster, most recent first
+func (am *AlertManager) History(clusterID string) []*models.Alert {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	history := am.history[clusterID]
+	alerts := make([]*models.Alert, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		alerts = append(alerts, copyAlert(history[i]))
+	}
+
+	return alerts
+}
+
+// Acknowledge marks a cluster's alert as acknowledged
+func (am *AlertManager) Acknowledge(clusterID, alertID, by string) (*models.Alert, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	alert, exists := am.alerts[clusterID][alertID]
+	if !exists {
+		return nil, ErrAlertNotFound
+	}
+
+	alert.Acknowledge(by)
+	return copyAlert(alert), nil
+}
+
+// Resolve marks a cluster's alert as resolved. It stays resolved while the
+// condition is still detected; a later recurrence raises a new alert.
+func (am *AlertManager) Resolve(clusterID, alertID string) (*models.Alert, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	alert, exists := am.alerts[clusterID][alertID]
+	if !exists {
+		return nil, ErrAlertNotFound
+	}
+
+	alert.Resolve()
+	return copyAlert(alert), nil
+}
+
+// Forget drops every alert of a cluster
+func (am *AlertManager) Forget(clusterID string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	delete(am.alerts, clusterID)
+	delete(am.primaries, clusterID)
+	delete(am.history, clusterID)
+}
+
+// copyAlert returns a copy of an alert that is safe to use outside the lock
+func copyAlert(alert *models.Alert) *models.Alert {
+	copied := *alert
+	return &copied
+}
@@ -0,0 +1,130 @@
+package analyzer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// recordingNotifier records the alerts it is told about
+type recordingNotifier []*models.Alert
+
+func (rn *recordingNotifier) Notify(alert *models.Alert) {
+	*rn = append(*rn, alert)
+}
+
+func TestClusterStatusChangedRaisesAvailabilityAlert(t *testing.T) {
+	am := NewAlertManager(NewPerformanceAnalyzer())
+	notified := &recordingNotifier{}
+	am.AddNotifier(notified)
+
+	am.ClusterStatusChanged("main", "unhealthy", errors.New("connection refused"))
+	am.ClusterStatusChanged("main", "unreachable", errors.New("connection refused"))
+
+	alerts := am.Alerts("main")
+	if len(alerts) != 1 || alerts[0].Type != models.AlertTypeAvailability {
+		t.Fatalf("alerts = %+v, want one availability alert", alerts)
+	}
+	if alerts[0].Severity != models.AlertSeverityCritical {
+		t.Errorf("severity = %s, want critical once unreachable", alerts[0].Severity)
+	}
+	if len(*notified) != 1 {
+		t.Errorf("notified %d times, want once", len(*notified))
+	}
+
+	// Metric cycles don't probe the cluster, so they keep the alert
+	am.Observe(models.NewMetrics("main"))
+	if len(am.Alerts("main")) != 1 {
+		t.Error("metrics without the probed condition cleared the availability alert")
+	}
+
+	am.ClusterStatusChanged("main", "healthy", nil)
+	if alerts := am.Alerts("main"); len(alerts) != 0 {
+		t.Errorf("alerts = %+v, want none once healthy", alerts)
+	}
+	if history := am.History("main"); len(history) != 1 || history[0].Status != "resolved" {
+		t.Errorf("history = %+v, want the resolved availability alert", history)
+	}
+}
+
+func TestAcknowledgedAlertKeptWhenDetectedAgain(t *testing.T) {
+	am := NewAlertManager(NewPerformanceAnalyzer())
+	notified := &recordingNotifier{}
+	am.AddNotifier(notified)
+
+	metrics := models.NewMetrics("main")
+	metrics.CacheHitRatio = 80
+	metrics.MarkCollected(models.MetricGroupCache)
+
+	activated := am.Observe(metrics)
+	if len(activated) != 1 {
+		t.Fatalf("activated %d alerts, want the cache hit ratio alert", len(activated))
+	}
+	if _, err := am.Acknowledge("main", activated[0].ID, "oncall"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next collection detects the same condition
+	if activated := am.Observe(metrics); len(activated) != 0 {
+		t.Errorf("activated %+v again, want the acknowledged alert kept", activated)
+	}
+
+	alerts := am.Alerts("main")
+	if len(alerts) != 1 || alerts[0].ID != activated[0].ID {
+		t.Fatalf("alerts = %+v, want the one acknowledged alert", alerts)
+	}
+	if alerts[0].Status != "acknowledged" || alerts[0].AcknowledgedBy != "oncall" {
+		t.Errorf("status = %s by %q, want acknowledged by oncall", alerts[0].Status, alerts[0].AcknowledgedBy)
+	}
+	if len(*notified) != 1 {
+		t.Errorf("notified %d times, want once", len(*notified))
+	}
+}
+
+func TestPrimaryAndReplicaAlertsCorrelated(t *testing.T) {
+	am := NewAlertManager(NewPerformanceAnalyzer())
+	am.SetPrimary("replica", "primary")
+	notified := &recordingNotifier{}
+	am.AddNotifier(notified)
+
+	// Heavy writes on the primary, and the replica falling behind on them
+	primary := models.NewMetrics("primary")
+	primary.CPUUsage = 97
+	primary.MarkCollected(models.MetricGroupResources)
+	replica := models.NewMetrics("replica")
+	replica.ReplicationLag = 45000
+	replica.MarkCollected(models.MetricGroupReplication)
+	unrelated := models.NewMetrics("other")
+	unrelated.ReplicationLag = 45000
+	unrelated.MarkCollected(models.MetricGroupReplication)
+
+	am.Observe(primary)
+	am.Observe(replica)
+	am.Observe(unrelated)
+
+	primaryAlerts, replicaAlerts := am.Alerts("primary"), am.Alerts("replica")
+	if len(primaryAlerts) != 1 || len(replicaAlerts) != 1 {
+		t.Fatalf("alerts = %+v on the primary and %+v on the replica, want one each", primaryAlerts, replicaAlerts)
+	}
+
+	// The primary's alert is the root cause of the incident
+	rootCause := primaryAlerts[0].ID
+	if primaryAlerts[0].CorrelationID != rootCause || replicaAlerts[0].CorrelationID != rootCause {
+		t.Errorf("correlation IDs = %q and %q, want both %q", primaryAlerts[0].CorrelationID, replicaAlerts[0].CorrelationID, rootCause)
+	}
+	if otherAlerts := am.Alerts("other"); len(otherAlerts) != 1 || otherAlerts[0].CorrelationID != "" {
+		t.Errorf("alerts of an unrelated cluster = %+v, want one without a correlation ID", otherAlerts)
+	}
+
+	// The replica's notification references the root cause
+	if len(*notified) != 3 || (*notified)[1].ClusterID != "replica" || (*notified)[1].CorrelationID != rootCause {
+		t.Errorf("notifications = %+v, want the replica's to carry correlation ID %q", *notified, rootCause)
+	}
+
+	// Once the primary recovers the replica's alert stands alone
+	am.Observe(models.NewMetrics("primary"))
+	if alerts := am.Alerts("replica"); len(alerts) != 1 || alerts[0].CorrelationID != "" {
+		t.Errorf("replica alerts after the primary recovered = %+v, want no correlation ID", alerts)
+	}
+}
@@ -0,0 +1,107 @@
+package analyzer
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// DefaultCacheSize is the default number of analyses kept in the cache
+const DefaultCacheSize = 1000
+
+// CacheStats reports the state and effectiveness of the analysis cache
+type CacheStats struct {
+	Size      int     `json:"size"`
+	Capacity  int     `json:"capacity"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Evictions int64   `json:"evictions"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+// analysisCache is a size-bounded LRU cache of query analyses, safe for concurrent use
+type analysisCache struct {
+	mu        sync.Mutex
+	capacity  int
+	entries   map[string]*list.Element
+	order     *list.List // front is most recently used
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// cacheEntry is a single cached analysis
+type cacheEntry struct {
+	key      string
+	analysis *models.QueryAnalysis
+}
+
+// newAnalysisCache creates a cache holding at most capacity analyses
+func newAnalysisCache(capacity int) *analysisCache {
+	if capacity <= 0 {
+		capacity = DefaultCacheSize
+	}
+
+	return &analysisCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns a cached analysis and marks it as recently used
+func (c *analysisCache) Get(key string) (*models.QueryAnalysis, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).analysis, true
+}
+
+// Put stores an analysis, evicting the least recently used entry when full
+func (c *analysisCache) Put(key string, analysis *models.QueryAnalysis) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		elem.Value.(*cacheEntry).analysis = analysis
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, analysis: analysis})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.evictions++
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *analysisCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Size:      c.order.Len(),
+		Capacity:  c.capacity,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		stats.HitRate = float64(c.hits) / float64(lookups)
+	}
+
+	return stats
+}
@@ -0,0 +1,120 @@
+package analyzer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestAnalysisCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newAnalysisCache(2)
+	cache.Put("a", models.NewQueryAnalysis("a"))
+	cache.Put("b", models.NewQueryAnalysis("b"))
+
+	// Using a makes b the least recently used entry
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("a missing before eviction")
+	}
+	cache.Put("c", models.NewQueryAnalysis("c"))
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("%s was evicted", key)
+		}
+	}
+
+	stats := cache.Stats()
+	if stats.Size != 2 || stats.Capacity != 2 || stats.Evictions != 1 {
+		t.Errorf("stats = %+v, want size 2, capacity 2, 1 eviction", stats)
+	}
+}
+
+func TestAnalyzeSharesCacheEntryAcrossLiterals(t *testing.T) {
+	qa := NewQueryAnalyzerWithCacheSize(10)
+
+	first, err := qa.Analyze("SELECT name FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := qa.Analyze("select name  from users where id = 42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := qa.CacheStats()
+	if stats.Size != 1 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("stats = %+v, want 1 entry hit once", stats)
+	}
+	if second.Query != "select name  from users where id = 42" {
+		t.Errorf("cached analysis has query %q", second.Query)
+	}
+	if !slices.Equal(first.Tables, second.Tables) || first.Complexity != second.Complexity {
+		t.Errorf("shared analyses differ: %+v, %+v", first, second)
+	}
+}
+
+func TestAnalyzeLiteralFindingsNotShared(t *testing.T) {
+	tests := []struct {
+		name    string
+		flagged string
+		other   string // same fingerprint as flagged, without its warning
+		warning string
+	}{
+		{
+			name:    "constant condition",
+			flagged: "SELECT id FROM t WHERE 1 = 2",
+			other:   "SELECT id FROM t WHERE 1 = 1",
+			warning: "1 = 2",
+		},
+		{
+			name:    "contradictory range",
+			flagged: "SELECT id FROM t WHERE x > 5 AND x < 3",
+			other:   "SELECT id FROM t WHERE x > 5 AND x < 10",
+			warning: "x < 3",
+		},
+		{
+			name:    "leading wildcard",
+			flagged: "SELECT id FROM t WHERE name LIKE '%foo'",
+			other:   "SELECT id FROM t WHERE name LIKE 'foo%'",
+			warning: "wildcard",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qa := NewQueryAnalyzer()
+
+			// Analyze the flagged query first so the other one hits its entry
+			flagged, err := qa.Analyze(tt.flagged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := qa.Analyze(tt.other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if qa.CacheStats().Hits != 1 {
+				t.Fatalf("queries don't share a cache entry: %+v", qa.CacheStats())
+			}
+
+			if !hasWarning(flagged, tt.warning) {
+				t.Errorf("%q: no warning containing %q in %q", tt.flagged, tt.warning, flagged.Warnings)
+			}
+			if hasWarning(other, tt.warning) {
+				t.Errorf("%q: unexpected warning containing %q in %q", tt.other, tt.warning, other.Warnings)
+			}
+		})
+	}
+}
+
+// hasWarning reports whether any warning of an analysis contains text
+func hasWarning(analysis *models.QueryAnalysis, text string) bool {
+	return slices.ContainsFunc(analysis.Warnings, func(warning string) bool {
+		return strings.Contains(warning, text)
+	})
+}
@@ -0,0 +1,52 @@
+package analyzer
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// AnalyzeBatch analyzes queries in parallel on up to GOMAXPROCS workers,
+// returning their results in the order of the queries. A query that fails
+// to parse gets an error in its result without affecting the others.
+func (qa *QueryAnalyzer) AnalyzeBatch(ctx context.Context, queries []string) []models.BatchAnalysisResult {
+	results := make([]models.BatchAnalysisResult, len(queries))
+	workers := min(runtime.GOMAXPROCS(0), len(queries))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = qa.analyzeBatchQuery(ctx, queries[i])
+			}
+		}()
+	}
+
+	for i := range queries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results
+}
+
+// analyzeBatchQuery analyzes one query of a batch
+func (qa *QueryAnalyzer) analyzeBatchQuery(ctx context.Context, query string) models.BatchAnalysisResult {
+	if query == "" {
+		return models.BatchAnalysisResult{Error: "query is empty"}
+	}
+
+	analysis, err := qa.AnalyzeContext(ctx, query)
+	if err != nil {
+		return models.BatchAnalysisResult{Error: err.Error()}
+	}
+
+	return models.BatchAnalysisResult{Analysis: analysis}
+}
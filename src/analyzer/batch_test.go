@@ -0,0 +1,46 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeBatchMixedQueries(t *testing.T) {
+	queries := []string{
+		"SELECT name FROM users WHERE id = 1",
+		"SELEC broken",
+		"",
+		"UPDATE orders SET status = 'shipped' WHERE id = 2",
+		"SELECT 1; SELECT 2",
+		"DELETE FROM sessions WHERE id = 3",
+	}
+
+	results := NewQueryAnalyzer().AnalyzeBatch(context.Background(), queries)
+	if len(results) != len(queries) {
+		t.Fatalf("got %d results for %d queries", len(results), len(queries))
+	}
+
+	wantTypes := []string{"SELECT", "", "", "UPDATE", "", "DELETE"}
+	for i, result := range results {
+		if wantTypes[i] == "" {
+			if result.Error == "" || result.Analysis != nil {
+				t.Errorf("result %d = %+v, want an error for %q", i, result, queries[i])
+			}
+			continue
+		}
+
+		if result.Error != "" || result.Analysis == nil {
+			t.Errorf("result %d has error %q, want an analysis of %q", i, result.Error, queries[i])
+			continue
+		}
+		if result.Analysis.Query != queries[i] || result.Analysis.QueryType != wantTypes[i] {
+			t.Errorf("result %d is a %s analysis of %q, want a %s analysis of %q",
+				i, result.Analysis.QueryType, result.Analysis.Query, wantTypes[i], queries[i])
+		}
+	}
+
+	if !strings.Contains(results[2].Error, "empty") {
+		t.Errorf("empty query error = %q", results[2].Error)
+	}
+}
@@ -0,0 +1,214 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// checkCartesianProduct flags tables and subqueries listed in FROM,
+// separated by commas, that no WHERE condition links to the others, which
+// joins every row of one with every row of the others. Explicit CROSS JOINs
+// are intended, and functions and subqueries returning a single row are
+// left out. A LATERAL subquery is linked to the items it references.
+func (qa *QueryAnalyzer) checkCartesianProduct(stmt *pg_query.SelectStmt, analysis *models.QueryAnalysis) {
+	// Each FROM item is a group of the names its columns are qualified by
+	groups := make([][]string, 0, len(stmt.FromClause))
+	groupOf := make(map[string]int)
+	lateral := make(map[int]*pg_query.RangeSubselect)
+	for _, item := range stmt.FromClause {
+		names := fromItemNames(item)
+		if len(names) == 0 {
+			continue
+		}
+		if subselect := item.GetRangeSubselect(); subselect != nil && subselect.Lateral {
+			lateral[len(groups)] = subselect
+		}
+		for _, name := range names {
+			groupOf[name] = len(groups)
+		}
+		groups = append(groups, names)
+	}
+	if len(groups) < 2 {
+		return
+	}
+
+	// Conditions referencing columns of several groups join them
+	linked := newUnionFind(len(groups))
+	for i, subselect := range lateral {
+		qualifiers, _ := columnQualifiers(subselect.Subquery)
+		for _, qualifier := range qualifiers {
+			if group, known := groupOf[qualifier]; known {
+				linked.union(i, group)
+			}
+		}
+	}
+	for _, condition := range whereConjuncts(stmt.WhereClause) {
+		qualifiers, unqualified := columnQualifiers(condition)
+		if unqualified > 0 && unqualified+len(qualifiers) > 1 {
+			// Unqualified columns could belong to any table, so this may be the join
+			return
+		}
+
+		first := -1
+		for _, qualifier := range qualifiers {
+			group, known := groupOf[qualifier]
+			if !known {
+				continue
+			}
+			if first < 0 {
+				first = group
+			}
+			linked.union(first, group)
+		}
+	}
+
+	// Tables joined with each other are named together, as in "(a, b) and c"
+	components := make(map[int][]string)
+	roots := make([]int, 0)
+	for i, names := range groups {
+		root := linked.find(i)
+		if _, exists := components[root]; !exists {
+			roots = append(roots, root)
+		}
+		components[root] = append(components[root], names...)
+	}
+	if len(roots) < 2 {
+		return
+	}
+
+	unjoined := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if names := components[root]; len(names) > 1 {
+			unjoined = append(unjoined, "("+strings.Join(names, ", ")+")")
+		} else {
+			unjoined = append(unjoined, names[0])
+		}
+	}
+
+	tables := joinNames(unjoined)
+	analysis.AddWarning(fmt.Sprintf("No condition joins %s, so every combination of their rows is returned (a Cartesian product)", tables))
+	analysis.AddSuggestion(
+		"join",
+		"high",
+		fmt.Sprintf("Add the missing join condition between %s, or write CROSS JOIN if the Cartesian product is intended", tables),
+		"The result grows with the product of the table sizes",
+		0.85,
+	)
+}
+
+// fromItemNames returns the names the columns of a FROM item are qualified
+// by: the alias or name of a table, the alias of a subquery returning more
+// than one row, or those of every table and subquery of a join
+func fromItemNames(node *pg_query.Node) []string {
+	switch item := node.Node.(type) {
+	case *pg_query.Node_RangeSubselect:
+		if item.RangeSubselect.Alias == nil || item.RangeSubselect.Alias.Aliasname == "" {
+			return nil
+		}
+		if sel := item.RangeSubselect.Subquery.GetSelectStmt(); sel == nil || returnsSingleRow(sel) {
+			return nil
+		}
+		return []string{item.RangeSubselect.Alias.Aliasname}
+	case *pg_query.Node_RangeVar:
+		if item.RangeVar.Alias != nil && item.RangeVar.Alias.Aliasname != "" {
+			return []string{item.RangeVar.Alias.Aliasname}
+		}
+		return []string{item.RangeVar.Relname}
+	case *pg_query.Node_JoinExpr:
+		names := make([]string, 0)
+		if item.JoinExpr.Larg != nil {
+			names = append(names, fromItemNames(item.JoinExpr.Larg)...)
+		}
+		if item.JoinExpr.Rarg != nil {
+			names = append(names, fromItemNames(item.JoinExpr.Rarg)...)
+		}
+		if item.JoinExpr.Alias != nil && item.JoinExpr.Alias.Aliasname != "" {
+			names = append(names, item.JoinExpr.Alias.Aliasname)
+		}
+		return names
+	}
+	return nil
+}
+
+// returnsSingleRow reports whether a SELECT returns at most one row: it
+// has no FROM, is limited to one row, or only aggregates without GROUP BY
+func returnsSingleRow(sel *pg_query.SelectStmt) bool {
+	if len(sel.FromClause) == 0 && len(sel.ValuesLists) == 0 && sel.Op == pg_query.SetOperation_SETOP_NONE {
+		return true
+	}
+	if limit, ok := integerConst(sel.LimitCount); ok && limit <= 1 {
+		return true
+	}
+	if len(sel.GroupClause) > 0 || len(sel.TargetList) == 0 {
+		return false
+	}
+	for _, target := range sel.TargetList {
+		fn := target.GetResTarget().GetVal().GetFuncCall()
+		if fn == nil || fn.Over != nil || len(fn.Funcname) == 0 || !aggregateFuncs[fn.Funcname[len(fn.Funcname)-1].GetString_().GetSval()] {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregateFuncs are the common aggregates returning one row without GROUP BY
+var aggregateFuncs = map[string]bool{
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+	"bool_and": true, "bool_or": true, "array_agg": true, "string_agg": true, "json_agg": true, "jsonb_agg": true,
+}
+
+// columnQualifiers returns the table qualifiers of the columns an expression
+// references, including in subqueries, and the number of unqualified columns
+func columnQualifiers(node *pg_query.Node) ([]string, int) {
+	qualifiers := make([]string, 0)
+	unqualified := 0
+
+	walkTree(node.ProtoReflect(), func(msg protoreflect.Message) {
+		ref, ok := msg.Interface().(*pg_query.ColumnRef)
+		if !ok {
+			return
+		}
+		if len(ref.Fields) < 2 {
+			unqualified++
+			return
+		}
+		qualifiers = append(qualifiers, ref.Fields[len(ref.Fields)-2].GetString_().GetSval())
+	})
+
+	return qualifiers, unqualified
+}
+
+// joinNames lists two or more names as "a, b and c"
+func joinNames(names []string) string {
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// unionFind tracks which of n items are connected
+type unionFind []int
+
+// newUnionFind creates a unionFind of n unconnected items
+func newUnionFind(n int) unionFind {
+	uf := make(unionFind, n)
+	for i := range uf {
+		uf[i] = i
+	}
+	return uf
+}
+
+// find returns the representative of an item's connected set
+func (uf unionFind) find(i int) int {
+	for uf[i] != i {
+		uf[i] = uf[uf[i]]
+		i = uf[i]
+	}
+	return i
+}
+
+// union connects two items
+func (uf unionFind) union(a, b int) {
+	uf[uf.find(a)] = uf.find(b)
+}
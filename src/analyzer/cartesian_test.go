@@ -0,0 +1,41 @@
+package analyzer
+
+import "testing"
+
+func TestCheckCartesianProducts(t *testing.T) {
+	tests := []struct {
+		query   string
+		flagged bool
+	}{
+		{"SELECT * FROM a, b", true},
+		{"SELECT * FROM a, b WHERE a.id = b.a_id", false},
+		{"SELECT * FROM a JOIN b ON a.id = b.a_id", false},
+		{"SELECT * FROM (SELECT id FROM a) x, (SELECT a_id FROM b) y", true},
+		{"SELECT * FROM (SELECT id FROM a) x, (SELECT a_id FROM b) y WHERE x.id = y.a_id", false},
+		{"SELECT * FROM a, (SELECT a_id FROM b) y", true},
+		{"SELECT * FROM a, (SELECT count(*) FROM b) totals", false},
+		{"SELECT * FROM a, (SELECT now() AS ts) t", false},
+		{"SELECT * FROM a, LATERAL (SELECT * FROM b WHERE b.a_id = a.id) y", false},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		analysis, err := qa.Analyze(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if got := hasWarning(analysis, "Cartesian product"); got != tt.flagged {
+			t.Errorf("%q: Cartesian product flagged = %v, want %v (warnings %q)", tt.query, got, tt.flagged, analysis.Warnings)
+		}
+	}
+}
+
+func TestCartesianProductNamesSubqueries(t *testing.T) {
+	analysis, err := NewQueryAnalyzer().Analyze("SELECT * FROM (SELECT id FROM a) recent, (SELECT a_id FROM b) totals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasWarning(analysis, "recent and totals") {
+		t.Errorf("warnings = %q, want the subquery aliases named", analysis.Warnings)
+	}
+}
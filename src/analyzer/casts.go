@@ -0,0 +1,77 @@
+package analyzer
+
+import (
+	"fmt"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// checkTypeMismatches flags comparisons whose types visibly differ. Without
+// the catalog the column types are unknown, so only a cast column in a WHERE
+// or JOIN ON comparison is flagged, as in id::text = $1 or
+// a.id::bigint = b.a_id, which a plain index on the column can't serve.
+// Literals are left alone: PostgreSQL reads a quoted value as the column's
+// type, and a number compared with a text column fails rather than casts.
+func (qa *QueryAnalyzer) checkTypeMismatches(stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	mismatches := make([]string, 0)
+
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			scope := statementScope(msg.Interface())
+			if scope == nil {
+				return
+			}
+
+			for _, condition := range scope.conditions {
+				walkCondition(condition, func(msg protoreflect.Message) {
+					expr, ok := msg.Interface().(*pg_query.A_Expr)
+					if !ok || !isComparison(expr) {
+						return
+					}
+
+					for _, side := range []*pg_query.Node{expr.Lexpr, expr.Rexpr} {
+						ref := castColumn(side)
+						if ref == nil {
+							continue
+						}
+						if text, ok := exprString(&pg_query.Node{Node: &pg_query.Node_AExpr{AExpr: expr}}); ok {
+							column, _ := scope.resolve(ref)
+							mismatches = append(mismatches, fmt.Sprintf("%s casts %s", text, column))
+						}
+					}
+				})
+			}
+		})
+	}
+
+	if len(mismatches) == 0 {
+		return
+	}
+
+	for _, mismatch := range mismatches {
+		analysis.AddWarning(mismatch + ", so the compared types may not match")
+	}
+	analysis.AddSuggestion(
+		"types",
+		"info",
+		"Verify the compared columns and values have the same type. Declare joined columns with the same type and pass values of the column's type, since a cast on the column keeps a plain index on it from being used",
+		"Comparisons without casts on the column can use its indexes",
+		0.6,
+	)
+}
+
+// castColumn returns the column of an expression casting a column, as in
+// id::text, or nil for anything else
+func castColumn(node *pg_query.Node) *pg_query.ColumnRef {
+	cast := node.GetTypeCast()
+	if cast == nil {
+		return nil
+	}
+	return cast.Arg.GetColumnRef()
+}
@@ -0,0 +1,29 @@
+package analyzer
+
+import "testing"
+
+func TestCheckTypeMismatches(t *testing.T) {
+	tests := []struct {
+		query   string
+		flagged bool
+	}{
+		{"SELECT * FROM users WHERE id::text = $1", true},
+		{"SELECT * FROM orders o JOIN customers c ON o.customer_id::bigint = c.id", true},
+		{"SELECT * FROM users WHERE CAST(email AS varchar) = 'a@example.com'", true},
+		{"SELECT * FROM users WHERE id = $1::int", false},
+		{"SELECT * FROM users WHERE id = '42'", false},
+		{"SELECT * FROM users WHERE id = 1 OR id = '2'", false},
+		{"SELECT id::text FROM users WHERE id = 1", false},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		analysis, err := qa.Analyze(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if got := hasWarning(analysis, "types may not match"); got != tt.flagged {
+			t.Errorf("%q: type mismatch flagged = %v, want %v (warnings %q)", tt.query, got, tt.flagged, analysis.Warnings)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// predicateScope is what a statement's WHERE and JOIN ON conditions can
+// refer to: its tables by alias or name, and the conditions themselves
+type predicateScope struct {
+	relations  map[string]string // alias or name -> table name
+	tables     []string
+	conditions []*pg_query.Node
+}
+
+// tableIndex is the index suggested for one of a query's tables, on the
+// columns the query filters and joins it on
+type tableIndex struct {
+	table   string
+	columns []string
+}
+
+// statement returns the CREATE INDEX statement of the index
+func (ti tableIndex) statement() string {
+	return fmt.Sprintf("CREATE INDEX ON %s (%s)", ti.table, strings.Join(ti.columns, ", "))
+}
+
+// collectPredicateColumns records the columns the statements filter and join
+// on in the analysis Columns, as table.column when the table is known, and
+// returns an index per table of the statements on those columns. The id
+// column a join equality references, as in o.customer_id = c.id, is left
+// out of the indexes: it is the other table's primary key, already indexed.
+func (qa *QueryAnalyzer) collectPredicateColumns(stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) []tableIndex {
+	indexes := make([]tableIndex, 0)
+	indexOf := make(map[string]int)
+
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			scope := statementScope(msg.Interface())
+			if scope == nil {
+				return
+			}
+
+			for _, condition := range scope.conditions {
+				referenced := scope.referencedKeys(condition)
+				for _, column := range scope.columns(condition) {
+					if !slices.Contains(analysis.Columns, column) {
+						analysis.Columns = append(analysis.Columns, column)
+					}
+
+					table, name, qualified := strings.Cut(column, ".")
+					if !qualified || !scope.hasTable(table) || referenced[column] {
+						continue
+					}
+					i, exists := indexOf[table]
+					if !exists {
+						i = len(indexes)
+						indexOf[table] = i
+						indexes = append(indexes, tableIndex{table: table})
+					}
+					if !slices.Contains(indexes[i].columns, name) {
+						indexes[i].columns = append(indexes[i].columns, name)
+					}
+				}
+			}
+		})
+	}
+
+	return indexes
+}
+
+// referencedKeys returns the id columns that equalities of a condition join
+// a column of another table to, as c.id in o.customer_id = c.id
+func (ps *predicateScope) referencedKeys(condition *pg_query.Node) map[string]bool {
+	referenced := make(map[string]bool)
+
+	walkCondition(condition, func(msg protoreflect.Message) {
+		expr, ok := msg.Interface().(*pg_query.A_Expr)
+		if !ok || !isComparison(expr) || expr.Name[0].GetString_().GetSval() != "=" {
+			return
+		}
+		leftRef, rightRef := expr.Lexpr.GetColumnRef(), expr.Rexpr.GetColumnRef()
+		if leftRef == nil || rightRef == nil {
+			return
+		}
+		left, leftOK := ps.resolve(leftRef)
+		right, rightOK := ps.resolve(rightRef)
+		if !leftOK || !rightOK {
+			return
+		}
+		leftTable, leftColumn, _ := strings.Cut(left, ".")
+		rightTable, rightColumn, _ := strings.Cut(right, ".")
+		if leftTable == rightTable {
+			return
+		}
+		if leftColumn == "id" {
+			referenced[left] = true
+		}
+		if rightColumn == "id" {
+			referenced[right] = true
+		}
+	})
+
+	return referenced
+}
+
+// statementScope returns the scope of a SELECT, UPDATE or DELETE statement,
+// or nil for any other node
+func statementScope(node any) *predicateScope {
+	scope := &predicateScope{relations: make(map[string]string)}
+
+	switch stmt := node.(type) {
+	case *pg_query.SelectStmt:
+		scope.addFromItems(stmt.FromClause)
+		scope.addCondition(stmt.WhereClause)
+	case *pg_query.UpdateStmt:
+		scope.addFromItems(append([]*pg_query.Node{{Node: &pg_query.Node_RangeVar{RangeVar: stmt.Relation}}}, stmt.FromClause...))
+		scope.addCondition(stmt.WhereClause)
+	case *pg_query.DeleteStmt:
+		scope.addFromItems(append([]*pg_query.Node{{Node: &pg_query.Node_RangeVar{RangeVar: stmt.Relation}}}, stmt.UsingClause...))
+		scope.addCondition(stmt.WhereClause)
+	default:
+		return nil
+	}
+
+	return scope
+}
+
+// addFromItems adds the tables of FROM items, and the ON conditions of their joins
+func (ps *predicateScope) addFromItems(items []*pg_query.Node) {
+	for _, item := range items {
+		switch from := item.Node.(type) {
+		case *pg_query.Node_RangeVar:
+			if from.RangeVar == nil || from.RangeVar.Relname == "" {
+				continue
+			}
+			name := from.RangeVar.Relname
+			ps.relations[name] = name
+			if from.RangeVar.Alias != nil && from.RangeVar.Alias.Aliasname != "" {
+				ps.relations[from.RangeVar.Alias.Aliasname] = name
+			}
+			if !slices.Contains(ps.tables, name) {
+				ps.tables = append(ps.tables, name)
+			}
+		case *pg_query.Node_JoinExpr:
+			if from.JoinExpr == nil {
+				continue
+			}
+			ps.addFromItems([]*pg_query.Node{from.JoinExpr.Larg, from.JoinExpr.Rarg})
+			ps.addCondition(from.JoinExpr.Quals)
+		}
+	}
+}
+
+// addCondition adds a WHERE or ON condition
+func (ps *predicateScope) addCondition(condition *pg_query.Node) {
+	if condition != nil {
+		ps.conditions = append(ps.conditions, condition)
+	}
+}
+
+// columns returns the columns a condition references, resolved to
+// table.column when possible
+func (ps *predicateScope) columns(condition *pg_query.Node) []string {
+	columns := make([]string, 0)
+
+	walkCondition(condition, func(msg protoreflect.Message) {
+		if ref, ok := msg.Interface().(*pg_query.ColumnRef); ok {
+			if column, ok := ps.resolve(ref); ok {
+				columns = append(columns, column)
+			}
+		}
+	})
+
+	return columns
+}
+
+// walkCondition visits every message of a condition except those of its
+// subqueries, which belong to the subquery's own scope
+func walkCondition(condition *pg_query.Node, visit func(protoreflect.Message)) {
+	nested := make(map[protoreflect.ProtoMessage]bool)
+	walkTree(condition.ProtoReflect(), func(msg protoreflect.Message) {
+		if _, ok := msg.Interface().(*pg_query.SelectStmt); ok {
+			walkTree(msg, func(inner protoreflect.Message) {
+				nested[inner.Interface()] = true
+			})
+		}
+	})
+
+	walkTree(condition.ProtoReflect(), func(msg protoreflect.Message) {
+		if !nested[msg.Interface()] {
+			visit(msg)
+		}
+	})
+}
+
+// resolve names a column reference as table.column, replacing an alias with
+// its table and qualifying a bare column when the statement has one table
+func (ps *predicateScope) resolve(ref *pg_query.ColumnRef) (string, bool) {
+	if len(ref.Fields) == 0 {
+		return "", false
+	}
+	column := ref.Fields[len(ref.Fields)-1].GetString_().GetSval()
+	if column == "" {
+		return "", false // a * or an unsupported field
+	}
+
+	if len(ref.Fields) == 1 {
+		if len(ps.tables) == 1 {
+			return ps.tables[0] + "." + column, true
+		}
+		return column, true
+	}
+
+	qualifier := ref.Fields[len(ref.Fields)-2].GetString_().GetSval()
+	if table, known := ps.relations[qualifier]; known {
+		return table + "." + column, true
+	}
+	return qualifier + "." + column, true
+}
+
+// hasTable reports whether a table is one of the statement's own tables
+func (ps *predicateScope) hasTable(table string) bool {
+	return slices.Contains(ps.tables, table)
+}
@@ -0,0 +1,167 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// CompositeRule raises a single alert when a combination of metric conditions
+// holds: all of them, any of them, or, with the "score" operator, enough of
+// them that the weights of the matched conditions add up to MinScore
+type CompositeRule struct {
+	Name       string
+	Operator   string  // "and", "or" or "score"
+	MinScore   float64 // weight the matched conditions must reach for "score"
+	Severity   models.AlertSeverity
+	Conditions []Condition
+}
+
+// Condition compares a single metric against a threshold
+type Condition struct {
+	Metric    string
+	Operator  string // >, >=, <, <=
+	Threshold float64
+	Weight    float64 // counted towards a "score" rule's MinScore, 1 when unset
+}
+
+// Validate checks that the rule only references known metrics and operators
+func (r CompositeRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("composite rule name is required")
+	}
+	switch r.Operator {
+	case "and", "or":
+	case "score":
+		if r.MinScore <= 0 {
+			return fmt.Errorf("composite rule %s: min score must be positive, got %g", r.Name, r.MinScore)
+		}
+	default:
+		return fmt.Errorf("composite rule %s: operator must be and, or or score, got %q", r.Name, r.Operator)
+	}
+	if len(r.Conditions) == 0 {
+		return fmt.Errorf("composite rule %s: at least one condition is required", r.Name)
+	}
+
+	for _, cond := range r.Conditions {
+		if !models.IsNamedMetric(cond.Metric) {
+			return fmt.Errorf("composite rule %s: unknown metric %q", r.Name, cond.Metric)
+		}
+		switch cond.Operator {
+		case ">", ">=", "<", "<=":
+		default:
+			return fmt.Errorf("composite rule %s: invalid operator %q for metric %s", r.Name, cond.Operator, cond.Metric)
+		}
+		if cond.Weight < 0 {
+			return fmt.Errorf("composite rule %s: negative weight %g for metric %s", r.Name, cond.Weight, cond.Metric)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate reports whether the rule holds and describes each matched
+// condition, along with the weight of the matched conditions. Conditions on
+// metrics that weren't collected this cycle never match.
+func (r CompositeRule) Evaluate(metrics *models.Metrics) (bool, []string, float64) {
+	matched := make([]string, 0, len(r.Conditions))
+	score := 0.0
+
+	for _, cond := range r.Conditions {
+		value, collected := metrics.NamedMetric(cond.Metric)
+		if !collected {
+			continue
+		}
+
+		if cond.matches(value) {
+			matched = append(matched, fmt.Sprintf("%s %.2f %s %.2f", cond.Metric, value, cond.Operator, cond.Threshold))
+			score += cond.weight()
+		}
+	}
+
+	switch r.Operator {
+	case "and":
+		return len(matched) == len(r.Conditions), matched, score
+	case "score":
+		return score >= r.MinScore, matched, score
+	default:
+		return len(matched) > 0, matched, score
+	}
+}
+
+// weight returns the condition's weight, 1 when unset
+func (c Condition) weight() float64 {
+	if c.Weight == 0 {
+		return 1
+	}
+	return c.Weight
+}
+
+// matches compares a value against the condition threshold
+func (c Condition) matches(value float64) bool {
+	switch c.Operator {
+	case ">":
+		return value > c.Threshold
+	case ">=":
+		return value >= c.Threshold
+	case "<":
+		return value < c.Threshold
+	case "<=":
+		return value <= c.Threshold
+	default:
+		return false
+	}
+}
+
+// AddCompositeRule registers a composite rule evaluated by AnalyzeMetrics
+func (pa *PerformanceAnalyzer) AddCompositeRule(rule CompositeRule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	if rule.Severity == "" {
+		rule.Severity = models.AlertSeverityHigh
+	}
+
+	pa.compositeRules = append(pa.compositeRules, rule)
+	return nil
+}
+
+// evaluateCompositeRules generates one alert per composite rule that holds
+func (pa *PerformanceAnalyzer) evaluateCompositeRules(metrics *models.Metrics) []*models.Alert {
+	alerts := make([]*models.Alert, 0)
+
+	for _, rule := range pa.compositeRules {
+		fired, matched, score := rule.Evaluate(metrics)
+		if !fired {
+			continue
+		}
+
+		message := fmt.Sprintf("Composite condition met: %s", strings.Join(matched, " "+strings.ToUpper(rule.Operator)+" "))
+		if rule.Operator == "score" {
+			message = fmt.Sprintf("Composite score %.2f reached %.2f: %s", score, rule.MinScore, strings.Join(matched, ", "))
+		}
+
+		alert := models.NewAlert(
+			models.AlertTypePerformance,
+			rule.Severity,
+			metrics.ClusterID,
+			"composite:"+rule.Name,
+			rule.Name,
+			message,
+		)
+		alert.Metadata = map[string]interface{}{
+			"operator":   rule.Operator,
+			"conditions": matched,
+		}
+		if rule.Operator == "score" {
+			alert.CurrentValue = score
+			alert.Threshold = rule.MinScore
+		}
+		alert.AddAction("Investigate the combined conditions together - they indicate a correlated problem")
+		alerts = append(alerts, alert)
+	}
+
+	return alerts
+}
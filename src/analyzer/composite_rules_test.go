@@ -0,0 +1,60 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestCompositeRuleScore(t *testing.T) {
+	rule := CompositeRule{
+		Name:     "Write Pressure",
+		Operator: "score",
+		MinScore: 3,
+		Conditions: []Condition{
+			{Metric: "disk_io_write", Operator: ">", Threshold: 1000, Weight: 2},
+			{Metric: "lock_waits", Operator: ">", Threshold: 20},
+			{Metric: "replication_lag", Operator: ">", Threshold: 10000},
+		},
+	}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := models.NewMetrics("main")
+	metrics.MarkCollected(models.MetricGroupDiskIO)
+	metrics.MarkCollected(models.MetricGroupLocks)
+	metrics.MarkCollected(models.MetricGroupReplication)
+	metrics.DiskIOWrite = 5000
+
+	if fired, _, score := rule.Evaluate(metrics); fired || score != 2 {
+		t.Errorf("Evaluate() = %v with score %g, want not fired with 2", fired, score)
+	}
+
+	metrics.LockWaits = 50
+	if fired, matched, score := rule.Evaluate(metrics); !fired || score != 3 || len(matched) != 2 {
+		t.Errorf("Evaluate() = %v with score %g and %q, want fired with 3 from two conditions", fired, score, matched)
+	}
+}
+
+func TestCompositeRuleValidate(t *testing.T) {
+	condition := Condition{Metric: "lock_waits", Operator: ">", Threshold: 10}
+	tests := []struct {
+		name  string
+		rule  CompositeRule
+		valid bool
+	}{
+		{"and", CompositeRule{Name: "r", Operator: "and", Conditions: []Condition{condition}}, true},
+		{"score", CompositeRule{Name: "r", Operator: "score", MinScore: 1, Conditions: []Condition{condition}}, true},
+		{"score without min", CompositeRule{Name: "r", Operator: "score", Conditions: []Condition{condition}}, false},
+		{"unknown metric", CompositeRule{Name: "r", Operator: "or", Conditions: []Condition{{Metric: "lock_wait", Operator: ">"}}}, false},
+		{"unknown operator", CompositeRule{Name: "r", Operator: "or", Conditions: []Condition{{Metric: "lock_waits", Operator: "=="}}}, false},
+		{"negative weight", CompositeRule{Name: "r", Operator: "or", Conditions: []Condition{{Metric: "lock_waits", Operator: ">", Weight: -1}}}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.rule.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	// largeSeqScanRows is the estimated row count above which a sequential scan is flagged
+	largeSeqScanRows = 10000
+
+	// rowMisestimateFactor is how far planned and actual rows may diverge before
+	// the estimate is flagged
+	rowMisestimateFactor = 10
+
+	// minMisestimateRows keeps small row counts from being flagged as misestimates
+	minMisestimateRows = 1000
+
+	// spillWorkMemFactor is how much more work_mem than its disk usage a spilled
+	// operation is suggested, since in-memory sorts and hash tables take more
+	// space than their on-disk form
+	spillWorkMemFactor = 2
+
+	// explainTimeout caps how long an explained statement may run, below
+	// the API's default write timeout
+	explainTimeout = 10 * time.Second
+)
+
+// ErrAnalyzeNotReadOnly is returned when EXPLAIN ANALYZE is requested for a
+// statement that may modify data without forcing it
+var ErrAnalyzeNotReadOnly = errors.New("EXPLAIN ANALYZE executes the query and is only allowed for plain SELECT statements without side effects unless forced")
+
+// Explain runs EXPLAIN (FORMAT JSON) for a single statement on a cluster and
+// parses the plan. It runs in a read-only transaction that is always rolled
+// back, under a statement timeout. With analyze the statement is executed,
+// so it is refused for anything but a read-only SELECT unless force is set,
+// which also allows writes in the transaction.
+func (qa *QueryAnalyzer) Explain(ctx context.Context, pool *pgxpool.Pool, query string, analyze, force bool) (*models.ExplainPlan, error) {
+	parseResult, err := pg_query.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", newSyntaxError(query, err))
+	}
+	if len(parseResult.Stmts) > 1 {
+		return nil, fmt.Errorf("%w: found %d statements", ErrMultipleStatements, len(parseResult.Stmts))
+	}
+	if len(parseResult.Stmts) == 0 {
+		return nil, fmt.Errorf("query contains no statement to explain")
+	}
+	if analyze && !force && !isReadOnlySelect(parseResult.Stmts[0]) {
+		return nil, ErrAnalyzeNotReadOnly
+	}
+
+	// BUFFERS requires ANALYZE before PostgreSQL 13
+	options := "FORMAT JSON"
+	if analyze {
+		options += ", ANALYZE, BUFFERS"
+	}
+
+	accessMode := pgx.ReadOnly
+	if analyze && force {
+		accessMode = pgx.ReadWrite
+	}
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{AccessMode: accessMode})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", explainTimeout.Milliseconds())); err != nil {
+		return nil, fmt.Errorf("failed to set statement timeout: %w", err)
+	}
+
+	var planJSON []byte
+	if err := tx.QueryRow(ctx, fmt.Sprintf("EXPLAIN (%s) %s", options, query)).Scan(&planJSON); err != nil {
+		return nil, fmt.Errorf("failed to explain query: %w", err)
+	}
+
+	queryID, _ := pg_query.Fingerprint(query)
+	return ParseExplainPlan(queryID, query, planJSON)
+}
+
+// AnalyzeWithCost analyzes a query like AnalyzeContext and fills its
+// EstimatedCost with the total cost of its plan on a cluster. The plan comes
+// from EXPLAIN without ANALYZE, so the query isn't executed. When the query
+// can't be explained, e.g. because it takes parameters, the static analysis
+// is returned with a warning instead.
+func (qa *QueryAnalyzer) AnalyzeWithCost(ctx context.Context, pool *pgxpool.Pool, query string) (*models.QueryAnalysis, error) {
+	analysis, err := qa.AnalyzeContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := qa.Explain(ctx, pool, query, false, false)
+	if err != nil {
+		analysis.AddWarning(fmt.Sprintf("Could not estimate the query's cost: %v", err))
+		return analysis, nil
+	}
+	analysis.EstimatedCost = plan.TotalCost
+
+	return analysis, nil
+}
+
+// sideEffectFunctions are functions whose effects a read-only transaction
+// doesn't prevent and a rollback doesn't undo
+var sideEffectFunctions = map[string]bool{
+	"pg_terminate_backend":        true,
+	"pg_cancel_backend":           true,
+	"pg_reload_conf":              true,
+	"pg_rotate_logfile":           true,
+	"pg_advisory_lock":            true,
+	"pg_advisory_lock_shared":     true,
+	"pg_try_advisory_lock":        true,
+	"pg_try_advisory_lock_shared": true,
+	"setval":                      true,
+	"nextval":                     true,
+	"dblink":                      true,
+	"dblink_exec":                 true,
+	"dblink_send_query":           true,
+}
+
+// isReadOnlySelect reports whether a statement is a SELECT without locking
+// clauses, data-modifying CTEs or calls to side-effecting functions
+func isReadOnlySelect(stmt *pg_query.RawStmt) bool {
+	if stmt.Stmt == nil || stmt.Stmt.GetSelectStmt() == nil {
+		return false
+	}
+
+	readOnly := true
+	walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+		switch node := msg.Interface().(type) {
+		case *pg_query.InsertStmt, *pg_query.UpdateStmt, *pg_query.DeleteStmt, *pg_query.MergeStmt:
+			readOnly = false
+		case *pg_query.SelectStmt:
+			if len(node.LockingClause) > 0 || node.IntoClause != nil {
+				readOnly = false
+			}
+		case *pg_query.FuncCall:
+			if len(node.Funcname) > 0 && sideEffectFunctions[node.Funcname[len(node.Funcname)-1].GetString_().GetSval()] {
+				readOnly = false
+			}
+		}
+	})
+
+	return readOnly
+}
+
+// ParseExplainPlan builds an ExplainPlan from EXPLAIN (FORMAT JSON) output
+func ParseExplainPlan(queryID, query string, planJSON []byte) (*models.ExplainPlan, error) {
+	var output []map[string]interface{}
+	if err := json.Unmarshal(planJSON, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse explain output: %w", err)
+	}
+	if len(output) == 0 {
+		return nil, fmt.Errorf("explain output contains no plan")
+	}
+
+	return buildExplainPlan(queryID, query, output[0])
+}
+
+// buildExplainPlan builds an ExplainPlan from the top-level object of
+// EXPLAIN JSON output, holding the plan tree and timings
+func buildExplainPlan(queryID, query string, output map[string]interface{}) (*models.ExplainPlan, error) {
+	root, ok := output["Plan"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("explain output contains no plan")
+	}
+
+	plan := models.NewExplainPlan(queryID, query)
+	plan.Plan = root
+	plan.NodeType, _ = root["Node Type"].(string)
+	plan.TotalCost = planNumber(root, "Total Cost")
+	plan.PlannedRows = int64(planNumber(root, "Plan Rows"))
+	plan.ActualRows = int64(planNumber(root, "Actual Rows"))
+	plan.BuffersSharedHit = int64(planNumber(root, "Shared Hit Blocks"))
+	plan.BuffersSharedRead = int64(planNumber(root, "Shared Read Blocks"))
+	plan.PlanningTime = planNumber(output, "Planning Time")
+	plan.ExecutionTime = planNumber(output, "Execution Time")
+
+	countScans(root, plan)
+	checkPlanNodes(root, plan)
+
+	return plan, nil
+}
+
+// countScans walks a plan node and its children counting sequential and index scans
+func countScans(node map[string]interface{}, plan *models.ExplainPlan) {
+	switch node["Node Type"] {
+	case "Seq Scan":
+		plan.SequentialScans++
+	case "Index Scan", "Index Only Scan", "Bitmap Index Scan":
+		plan.IndexScans++
+	}
+
+	children, _ := node["Plans"].([]interface{})
+	for _, child := range children {
+		if childNode, ok := child.(map[string]interface{}); ok {
+			countScans(childNode, plan)
+		}
+	}
+}
+
+// checkPlanNodes walks a plan node and its children flagging sequential scans
+// over many rows and row estimates far from the actual row counts
+func checkPlanNodes(node map[string]interface{}, plan *models.ExplainPlan) {
+	plannedRows := planNumber(node, "Plan Rows")
+
+	if node["Node Type"] == "Seq Scan" && plannedRows >= largeSeqScanRows {
+		plan.AddWarning(fmt.Sprintf("%s is estimated to read %.0f rows; an index on the filtered columns may avoid the full scan",
+			planNodeLabel(node), plannedRows))
+	}
+
+	checkRowEstimate(node, plan)
+	checkDiskSpill(node, plan)
+
+	children, _ := node["Plans"].([]interface{})
+	for _, child := range children {
+		if childNode, ok := child.(map[string]interface{}); ok {
+			checkPlanNodes(childNode, plan)
+		}
+	}
+}
+
+// checkRowEstimate flags an executed node whose actual rows diverge sharply
+// from the planner's estimate, which usually means stale statistics or
+// correlated columns the planner assumes to be independent
+func checkRowEstimate(node map[string]interface{}, plan *models.ExplainPlan) {
+	actualRows, analyzed := node["Actual Rows"].(float64)
+	if !analyzed || planNumber(node, "Actual Loops") == 0 {
+		return
+	}
+
+	plannedRows := planNumber(node, "Plan Rows")
+	low, high := math.Min(plannedRows, actualRows), math.Max(plannedRows, actualRows)
+	factor := high / math.Max(low, 1)
+	if high < minMisestimateRows || factor < rowMisestimateFactor {
+		return
+	}
+
+	nodeType, _ := node["Node Type"].(string)
+	relation, _ := node["Relation Name"].(string)
+
+	var suggestion string
+	switch {
+	case relation != "" && hasMultipleConditions(node):
+		suggestion = fmt.Sprintf("Run ANALYZE %s; if the estimate stays off, the filtered columns are likely correlated, so CREATE STATISTICS (dependencies, mcv) on them", relation)
+	case relation != "":
+		suggestion = fmt.Sprintf("Run ANALYZE %s to refresh its statistics", relation)
+	default:
+		suggestion = "Run ANALYZE on the tables feeding this node; CREATE STATISTICS on correlated filter or join columns if the estimate stays off"
+	}
+
+	plan.Misestimates = append(plan.Misestimates, models.PlanMisestimate{
+		NodeType:      nodeType,
+		Relation:      relation,
+		PlannedRows:   int64(plannedRows),
+		ActualRows:    int64(actualRows),
+		Factor:        math.Round(factor*10) / 10,
+		Underestimate: actualRows > plannedRows,
+		Suggestion:    suggestion,
+	})
+	plan.AddWarning(fmt.Sprintf("%s row estimate is off by %.0fx (planned %.0f, actual %.0f). %s",
+		planNodeLabel(node), factor, plannedRows, actualRows, suggestion))
+}
+
+// checkDiskSpill flags a Sort or HashAggregate node that spilled to disk
+// because it didn't fit in work_mem, suggesting a work_mem for the query that
+// would keep it in memory
+func checkDiskSpill(node map[string]interface{}, plan *models.ExplainPlan) {
+	nodeType, _ := node["Node Type"].(string)
+
+	var strategy string
+	var diskKB float64
+	switch nodeType {
+	case "Sort":
+		if node["Sort Space Type"] != "Disk" {
+			return
+		}
+		strategy, _ = node["Sort Method"].(string)
+		diskKB = planNumber(node, "Sort Space Used")
+	case "Aggregate", "HashAggregate":
+		// JSON plans report hash aggregates as Aggregate nodes with a strategy,
+		// text plans by name
+		if nodeType == "Aggregate" && node["Strategy"] != "Hashed" && node["Strategy"] != "Mixed" {
+			return
+		}
+		diskKB = planNumber(node, "Disk Usage")
+		if batches := planNumber(node, "HashAgg Batches"); batches > 1 {
+			strategy = fmt.Sprintf("%.0f batches", batches)
+		}
+	default:
+		return
+	}
+	if diskKB <= 0 {
+		return
+	}
+
+	// Round the suggestion up to whole megabytes
+	suggestedMB := int64(math.Ceil(diskKB * spillWorkMemFactor / 1024))
+	suggestion := fmt.Sprintf("Raise work_mem for this query, e.g. SET LOCAL work_mem = '%dMB', to keep it in memory", suggestedMB)
+
+	label := planNodeLabel(node)
+	if nodeType == "Aggregate" {
+		label = "HashAggregate"
+	}
+
+	plan.DiskSpills = append(plan.DiskSpills, models.PlanDiskSpill{
+		NodeType:           label,
+		Strategy:           strategy,
+		DiskKB:             int64(diskKB),
+		SuggestedWorkMemKB: suggestedMB * 1024,
+		Suggestion:         suggestion,
+	})
+	plan.AddWarning(fmt.Sprintf("%s spilled %s to disk because it exceeded work_mem. %s",
+		label, formatKB(diskKB), suggestion))
+}
+
+// formatKB formats a size in kilobytes for a warning
+func formatKB(kb float64) string {
+	if kb >= 1024 {
+		return fmt.Sprintf("%.1f MB", kb/1024)
+	}
+	return fmt.Sprintf("%.0f kB", kb)
+}
+
+// hasMultipleConditions reports whether a node filters on more than one condition
+func hasMultipleConditions(node map[string]interface{}) bool {
+	conditions := 0
+	for _, key := range []string{"Filter", "Index Cond", "Recheck Cond"} {
+		if condition, ok := node[key].(string); ok {
+			conditions += strings.Count(strings.ToUpper(condition), " AND ") + 1
+		}
+	}
+	return conditions > 1
+}
+
+// planNodeLabel describes a plan node by its type and relation
+func planNodeLabel(node map[string]interface{}) string {
+	nodeType, _ := node["Node Type"].(string)
+	if relation, ok := node["Relation Name"].(string); ok {
+		return fmt.Sprintf("%s on %s", nodeType, relation)
+	}
+	return nodeType
+}
+
+// planNumber returns a numeric plan property, or 0 when it's absent
+func planNumber(node map[string]interface{}, key string) float64 {
+	value, _ := node[key].(float64)
+	return value
+}
@@ -0,0 +1,178 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+
+	"github.com/zvdy/pgao/src/pgtest"
+)
+
+// nestedPlanJSON is EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) output of a hash
+// join between a sequential scan and a nested loop over two index scans
+const nestedPlanJSON = `[{
+	"Plan": {
+		"Node Type": "Hash Join",
+		"Total Cost": 1520.5,
+		"Plan Rows": 100,
+		"Actual Rows": 95,
+		"Shared Hit Blocks": 40,
+		"Shared Read Blocks": 12,
+		"Plans": [
+			{"Node Type": "Seq Scan", "Relation Name": "orders", "Plan Rows": 50000, "Actual Rows": 48000},
+			{"Node Type": "Hash", "Plan Rows": 10, "Actual Rows": 10, "Plans": [
+				{"Node Type": "Nested Loop", "Plan Rows": 10, "Actual Rows": 10, "Plans": [
+					{"Node Type": "Index Scan", "Relation Name": "customers", "Plan Rows": 10, "Actual Rows": 10},
+					{"Node Type": "Index Only Scan", "Relation Name": "regions", "Plan Rows": 1, "Actual Rows": 1}
+				]}
+			]}
+		]
+	},
+	"Planning Time": 0.25,
+	"Execution Time": 12.5
+}]`
+
+func TestParseExplainPlanNestedNodes(t *testing.T) {
+	plan, err := ParseExplainPlan("q1", "SELECT 1", []byte(nestedPlanJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.NodeType != "Hash Join" || plan.TotalCost != 1520.5 {
+		t.Errorf("root = %s costing %g, want Hash Join costing 1520.5", plan.NodeType, plan.TotalCost)
+	}
+	if plan.PlannedRows != 100 || plan.ActualRows != 95 {
+		t.Errorf("rows = %d planned, %d actual, want 100 and 95", plan.PlannedRows, plan.ActualRows)
+	}
+	if plan.BuffersSharedHit != 40 || plan.BuffersSharedRead != 12 {
+		t.Errorf("buffers = %d hit, %d read, want 40 and 12", plan.BuffersSharedHit, plan.BuffersSharedRead)
+	}
+	if plan.PlanningTime != 0.25 || plan.ExecutionTime != 12.5 {
+		t.Errorf("times = %g planning, %g execution, want 0.25 and 12.5", plan.PlanningTime, plan.ExecutionTime)
+	}
+	if plan.SequentialScans != 1 || plan.IndexScans != 2 {
+		t.Errorf("scans = %d sequential, %d index, want 1 and 2", plan.SequentialScans, plan.IndexScans)
+	}
+	if len(plan.Warnings) != 1 {
+		t.Errorf("warnings = %q, want one for the large sequential scan", plan.Warnings)
+	}
+}
+
+func TestIsReadOnlySelect(t *testing.T) {
+	tests := []struct {
+		query    string
+		readOnly bool
+	}{
+		{"SELECT * FROM users WHERE id = 1", true},
+		{"SELECT count(*) FROM orders JOIN users ON users.id = orders.user_id", true},
+		{"SELECT * FROM users FOR UPDATE", false},
+		{"SELECT * INTO copy FROM users", false},
+		{"WITH gone AS (DELETE FROM users RETURNING id) SELECT * FROM gone", false},
+		{"SELECT pg_terminate_backend(pid) FROM pg_stat_activity", false},
+		{"SELECT setval('users_id_seq', 1)", false},
+		{"SELECT dblink_exec('remote', 'DROP TABLE users')", false},
+		{"UPDATE users SET name = 'x'", false},
+	}
+
+	for _, tt := range tests {
+		result, err := pg_query.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if got := isReadOnlySelect(result.Stmts[0]); got != tt.readOnly {
+			t.Errorf("isReadOnlySelect(%q) = %v, want %v", tt.query, got, tt.readOnly)
+		}
+	}
+}
+
+func TestRowMisestimates(t *testing.T) {
+	plan, err := ParseExplainPlan("q1", "SELECT 1", []byte(`[{"Plan": {
+		"Node Type": "Nested Loop", "Plan Rows": 10, "Actual Rows": 12, "Actual Loops": 1,
+		"Plans": [
+			{"Node Type": "Seq Scan", "Relation Name": "orders", "Filter": "((status = 'open') AND (region = 'eu'))",
+				"Plan Rows": 50, "Actual Rows": 9000, "Actual Loops": 1},
+			{"Node Type": "Index Scan", "Relation Name": "customers", "Index Cond": "(id = o.customer_id)",
+				"Plan Rows": 20000, "Actual Rows": 1, "Actual Loops": 1},
+			{"Node Type": "Index Scan", "Relation Name": "regions", "Plan Rows": 5, "Actual Rows": 500, "Actual Loops": 1},
+			{"Node Type": "Seq Scan", "Relation Name": "archive", "Plan Rows": 1, "Actual Rows": 0, "Actual Loops": 0}
+		]
+	}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// regions is off by 100x but too small to matter, and archive never ran
+	if len(plan.Misestimates) != 2 {
+		t.Fatalf("misestimates = %+v, want orders and customers", plan.Misestimates)
+	}
+
+	orders := plan.Misestimates[0]
+	if orders.Relation != "orders" || !orders.Underestimate || orders.Factor != 180 {
+		t.Errorf("orders misestimate = %+v, want an underestimate by 180x", orders)
+	}
+	if !strings.Contains(orders.Suggestion, "CREATE STATISTICS") {
+		t.Errorf("orders suggestion = %q, want extended statistics for its correlated filters", orders.Suggestion)
+	}
+
+	customers := plan.Misestimates[1]
+	if customers.Relation != "customers" || customers.Underestimate || customers.Factor != 20000 {
+		t.Errorf("customers misestimate = %+v, want an overestimate by 20000x", customers)
+	}
+	if customers.Suggestion != "Run ANALYZE customers to refresh its statistics" {
+		t.Errorf("customers suggestion = %q", customers.Suggestion)
+	}
+
+	if len(plan.Warnings) != 2 {
+		t.Errorf("warnings = %q, want one per misestimate", plan.Warnings)
+	}
+}
+
+func TestAnalyzeWithCost(t *testing.T) {
+	server := pgtest.NewServer(t)
+	server.Handle("customer_id = 42", pgtest.Result{Columns: []string{"QUERY PLAN"}, Rows: [][]any{{nestedPlanJSON}}})
+	pool, err := pgxpool.New(context.Background(), fmt.Sprintf("postgres://pgao@%s:%d/app?sslmode=disable", server.Host(), server.Port()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	qa := NewQueryAnalyzer()
+	query := "SELECT * FROM orders WHERE customer_id = 42"
+	withCost, err := qa.AnalyzeWithCost(context.Background(), pool, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	static, err := qa.Analyze(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if withCost.EstimatedCost != 1520.5 {
+		t.Errorf("cost = %g, want the plan's total cost", withCost.EstimatedCost)
+	}
+	if static.EstimatedCost != 0 {
+		t.Errorf("static cost = %g, want none without a plan", static.EstimatedCost)
+	}
+	if !slices.Equal(withCost.Warnings, static.Warnings) || !slices.Equal(withCost.Suggestions, static.Suggestions) {
+		t.Errorf("findings with cost = %q, %+v, want the static %q, %+v", withCost.Warnings, withCost.Suggestions, static.Warnings, static.Suggestions)
+	}
+	for _, query := range server.Queries() {
+		if strings.Contains(query.SQL, "ANALYZE") {
+			t.Errorf("sent %q, want the query explained without running it", query.SQL)
+		}
+	}
+
+	// Parameterized queries can't be explained, so only the static analysis is returned
+	withoutCost, err := qa.AnalyzeWithCost(context.Background(), pool, "SELECT * FROM orders WHERE customer_id = $1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withoutCost.EstimatedCost != 0 || !hasWarning(withoutCost, "Could not estimate the query's cost") {
+		t.Errorf("analysis = %+v, want no cost and a warning", withoutCost)
+	}
+}
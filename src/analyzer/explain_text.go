@@ -0,0 +1,206 @@
+package analyzer
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+)
+
+var (
+	textNodeDetailsPattern = regexp.MustCompile(`\s+\((?:cost=|actual |never executed)`)
+	textCostPattern        = regexp.MustCompile(`\(cost=([\d.]+)\.\.([\d.]+) rows=(\d+) width=(\d+)\)`)
+	textActualPattern      = regexp.MustCompile(`\(actual (?:time=([\d.]+)\.\.([\d.]+) )?rows=([\d.]+) loops=(\d+)\)`)
+	textSharedHitPattern   = regexp.MustCompile(`shared(?: [a-z]+=\d+)*? hit=(\d+)`)
+	textSharedReadPattern  = regexp.MustCompile(`shared(?: [a-z]+=\d+)*? read=(\d+)`)
+	textTimingPattern      = regexp.MustCompile(`^(Planning|Execution) [Tt]ime: ([\d.]+) ms`)
+	textFooterPattern      = regexp.MustCompile(`^\(\d+ rows?\)$`)
+	textSortMethodPattern  = regexp.MustCompile(`^Sort Method: (.+?)\s+(Memory|Disk): (\d+)kB`)
+	textHashAggPattern     = regexp.MustCompile(`^Batches: (\d+)(?:\s+Memory Usage: (\d+)kB)?(?:\s+Disk Usage: (\d+)kB)?`)
+)
+
+// textPlanNode is a parsed node with the indentation of its line, used to find
+// the parent of the nodes that follow
+type textPlanNode struct {
+	indent int
+	node   map[string]interface{}
+}
+
+// ParseExplainText parses pasted text EXPLAIN output, identifying the plan by
+// the fingerprint of the query when it is given
+func (qa *QueryAnalyzer) ParseExplainText(query, text string) (*models.ExplainPlan, error) {
+	queryID := ""
+	if query != "" {
+		queryID, _ = pg_query.Fingerprint(query)
+	}
+	return ParseTextExplainPlan(queryID, query, text)
+}
+
+// ParseTextExplainPlan builds an ExplainPlan from the default text output of
+// EXPLAIN or EXPLAIN ANALYZE, as copied from psql. Nodes are converted to the
+// same structure as EXPLAIN (FORMAT JSON) so both go through the same checks.
+func ParseTextExplainPlan(queryID, query, text string) (*models.ExplainPlan, error) {
+	output := make(map[string]interface{})
+	var stack []textPlanNode
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		content := strings.TrimSpace(line)
+
+		// Skip the psql header, separator and row count footer
+		if content == "" || content == "QUERY PLAN" || strings.Trim(content, "-+") == "" || textFooterPattern.MatchString(content) {
+			continue
+		}
+
+		if match := textTimingPattern.FindStringSubmatch(content); match != nil {
+			value, _ := strconv.ParseFloat(match[2], 64)
+			output[match[1]+" Time"] = value
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		isNode := output["Plan"] == nil
+		if strings.HasPrefix(content, "->") {
+			isNode = true
+			content = strings.TrimSpace(strings.TrimPrefix(content, "->"))
+		}
+
+		if !isNode {
+			if len(stack) > 0 {
+				addTextNodeDetail(stack[len(stack)-1].node, content)
+			}
+			continue
+		}
+
+		node := parseTextPlanNode(content)
+		if output["Plan"] == nil {
+			output["Plan"] = node
+			stack = append(stack, textPlanNode{indent: indent, node: node})
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("line %d: plan node is not nested under the root node", lineNum)
+		}
+
+		parent := stack[len(stack)-1].node
+		children, _ := parent["Plans"].([]interface{})
+		parent["Plans"] = append(children, node)
+		stack = append(stack, textPlanNode{indent: indent, node: node})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read explain output: %w", err)
+	}
+
+	if output["Plan"] == nil {
+		return nil, fmt.Errorf("explain output contains no plan")
+	}
+
+	return buildExplainPlan(queryID, query, output)
+}
+
+// parseTextPlanNode parses a node line such as
+// "Index Scan using users_pkey on users u  (cost=0.29..8.30 rows=1 width=4)"
+func parseTextPlanNode(content string) map[string]interface{} {
+	node := make(map[string]interface{})
+
+	label := content
+	if loc := textNodeDetailsPattern.FindStringIndex(content); loc != nil {
+		label = content[:loc[0]]
+	}
+
+	if strings.HasPrefix(label, "Parallel ") {
+		node["Parallel Aware"] = true
+		label = strings.TrimPrefix(label, "Parallel ")
+	}
+
+	nodeType, target := label, ""
+	if before, after, found := strings.Cut(label, " using "); found {
+		nodeType = before
+		indexName, relation, _ := strings.Cut(after, " on ")
+		node["Index Name"] = indexName
+		target = relation
+	} else if before, after, found := strings.Cut(label, " on "); found {
+		nodeType, target = before, after
+	}
+	node["Node Type"] = nodeType
+
+	if fields := strings.Fields(target); len(fields) > 0 {
+		if nodeType == "Bitmap Index Scan" {
+			node["Index Name"] = fields[0]
+		} else {
+			node["Relation Name"] = fields[0]
+			if len(fields) > 1 {
+				node["Alias"] = fields[1]
+			}
+		}
+	}
+
+	if match := textCostPattern.FindStringSubmatch(content); match != nil {
+		node["Startup Cost"], _ = strconv.ParseFloat(match[1], 64)
+		node["Total Cost"], _ = strconv.ParseFloat(match[2], 64)
+		node["Plan Rows"], _ = strconv.ParseFloat(match[3], 64)
+		node["Plan Width"], _ = strconv.ParseFloat(match[4], 64)
+	}
+
+	if match := textActualPattern.FindStringSubmatch(content); match != nil {
+		if match[1] != "" {
+			node["Actual Startup Time"], _ = strconv.ParseFloat(match[1], 64)
+			node["Actual Total Time"], _ = strconv.ParseFloat(match[2], 64)
+		}
+		node["Actual Rows"], _ = strconv.ParseFloat(match[3], 64)
+		node["Actual Loops"], _ = strconv.ParseFloat(match[4], 64)
+	} else if strings.Contains(content, "(never executed)") {
+		node["Actual Rows"] = float64(0)
+		node["Actual Loops"] = float64(0)
+	}
+
+	return node
+}
+
+// addTextNodeDetail records the detail lines of a node that the plan checks use
+func addTextNodeDetail(node map[string]interface{}, content string) {
+	for _, key := range []string{"Filter", "Index Cond", "Recheck Cond"} {
+		if condition, found := strings.CutPrefix(content, key+": "); found {
+			node[key] = condition
+			return
+		}
+	}
+
+	if match := textSortMethodPattern.FindStringSubmatch(content); match != nil {
+		node["Sort Method"] = match[1]
+		node["Sort Space Type"] = match[2]
+		node["Sort Space Used"], _ = strconv.ParseFloat(match[3], 64)
+		return
+	}
+
+	if match := textHashAggPattern.FindStringSubmatch(content); match != nil {
+		node["HashAgg Batches"], _ = strconv.ParseFloat(match[1], 64)
+		if match[2] != "" {
+			node["Peak Memory Usage"], _ = strconv.ParseFloat(match[2], 64)
+		}
+		if match[3] != "" {
+			node["Disk Usage"], _ = strconv.ParseFloat(match[3], 64)
+		}
+		return
+	}
+
+	if !strings.HasPrefix(content, "Buffers:") {
+		return
+	}
+
+	if match := textSharedHitPattern.FindStringSubmatch(content); match != nil {
+		node["Shared Hit Blocks"], _ = strconv.ParseFloat(match[1], 64)
+	}
+	if match := textSharedReadPattern.FindStringSubmatch(content); match != nil {
+		node["Shared Read Blocks"], _ = strconv.ParseFloat(match[1], 64)
+	}
+}
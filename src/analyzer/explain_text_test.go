@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// textPlan is EXPLAIN (ANALYZE, BUFFERS) output as copied from psql
+const textPlan = `                                                          QUERY PLAN
+-------------------------------------------------------------------------------------------------------------------------------
+ Hash Join  (cost=8.45..1520.50 rows=100 width=36) (actual time=0.120..12.300 rows=95 loops=1)
+   Hash Cond: (o.customer_id = c.id)
+   Buffers: shared hit=40 read=12
+   ->  Seq Scan on orders o  (cost=0.00..1200.00 rows=50000 width=20) (actual time=0.010..6.100 rows=48000 loops=1)
+         Filter: (status = 'open'::text)
+         Buffers: shared hit=30 read=12
+   ->  Hash  (cost=8.30..8.30 rows=10 width=20) (actual time=0.050..0.051 rows=10 loops=1)
+         ->  Index Scan using customers_pkey on customers c  (cost=0.29..8.30 rows=10 width=20) (actual time=0.010..0.020 rows=10 loops=1)
+               Index Cond: (id = ANY ('{1,2,3}'::integer[]))
+ Planning Time: 0.250 ms
+ Execution Time: 12.500 ms
+(11 rows)
+`
+
+func TestParseExplainText(t *testing.T) {
+	plan, err := NewQueryAnalyzer().ParseExplainText("SELECT * FROM orders o JOIN customers c ON o.customer_id = c.id", textPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.QueryID == "" {
+		t.Error("plan has no query ID")
+	}
+	if plan.NodeType != "Hash Join" || plan.TotalCost != 1520.5 {
+		t.Errorf("root = %s costing %g, want Hash Join costing 1520.5", plan.NodeType, plan.TotalCost)
+	}
+	if plan.PlannedRows != 100 || plan.ActualRows != 95 {
+		t.Errorf("rows = %d planned, %d actual, want 100 and 95", plan.PlannedRows, plan.ActualRows)
+	}
+	if plan.BuffersSharedHit != 40 || plan.BuffersSharedRead != 12 {
+		t.Errorf("buffers = %d hit, %d read, want 40 and 12", plan.BuffersSharedHit, plan.BuffersSharedRead)
+	}
+	if plan.PlanningTime != 0.25 || plan.ExecutionTime != 12.5 {
+		t.Errorf("times = %g planning, %g execution, want 0.25 and 12.5", plan.PlanningTime, plan.ExecutionTime)
+	}
+	if plan.SequentialScans != 1 || plan.IndexScans != 1 {
+		t.Errorf("scans = %d sequential, %d index, want 1 and 1", plan.SequentialScans, plan.IndexScans)
+	}
+
+	// The indentation nests the index scan under the hash, next to the sequential scan
+	children, _ := plan.Plan["Plans"].([]interface{})
+	if len(children) != 2 {
+		t.Fatalf("root has %d children, want 2", len(children))
+	}
+	seqScan := children[0].(map[string]interface{})
+	if seqScan["Relation Name"] != "orders" || seqScan["Alias"] != "o" || seqScan["Filter"] != "(status = 'open'::text)" {
+		t.Errorf("sequential scan = %v", seqScan)
+	}
+	hash := children[1].(map[string]interface{})
+	hashChildren, _ := hash["Plans"].([]interface{})
+	if hash["Node Type"] != "Hash" || len(hashChildren) != 1 {
+		t.Fatalf("hash = %v, want one child", hash)
+	}
+	indexScan := hashChildren[0].(map[string]interface{})
+	if indexScan["Node Type"] != "Index Scan" || indexScan["Index Name"] != "customers_pkey" || indexScan["Relation Name"] != "customers" {
+		t.Errorf("index scan = %v", indexScan)
+	}
+
+	if len(plan.Warnings) != 1 {
+		t.Errorf("warnings = %q, want one for the large sequential scan", plan.Warnings)
+	}
+}
+
+func TestParseExplainTextWithoutPlan(t *testing.T) {
+	if _, err := ParseTextExplainPlan("", "", "QUERY PLAN\n----------\n(0 rows)\n"); err == nil {
+		t.Error("ParseTextExplainPlan() accepted output without a plan")
+	}
+}
+
+func TestDiskSpills(t *testing.T) {
+	plan, err := ParseTextExplainPlan("", "", `
+ Sort  (cost=9000.00..9100.00 rows=40000 width=40) (actual time=80.000..95.000 rows=40000 loops=1)
+   Sort Key: o.created_at
+   Sort Method: external merge  Disk: 3000kB
+   ->  HashAggregate  (cost=5000.00..6000.00 rows=40000 width=40) (actual time=30.000..60.000 rows=40000 loops=1)
+         Group Key: o.customer_id
+         Batches: 5  Memory Usage: 4145kB  Disk Usage: 10240kB
+         ->  Sort  (cost=100.00..110.00 rows=500 width=8) (actual time=1.000..1.200 rows=500 loops=1)
+               Sort Method: quicksort  Memory: 50kB
+               ->  Index Only Scan using orders_customer_id_idx on orders o  (cost=0.29..90.00 rows=500 width=8) (actual time=0.010..0.500 rows=500 loops=1)
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The in-memory quicksort isn't a spill
+	if len(plan.DiskSpills) != 2 {
+		t.Fatalf("disk spills = %+v, want the external sort and the hash aggregate", plan.DiskSpills)
+	}
+
+	sort := plan.DiskSpills[0]
+	if sort.NodeType != "Sort" || sort.Strategy != "external merge" || sort.DiskKB != 3000 || sort.SuggestedWorkMemKB != 6*1024 {
+		t.Errorf("sort spill = %+v, want 3000 kB on disk and 6MB suggested", sort)
+	}
+
+	agg := plan.DiskSpills[1]
+	if agg.NodeType != "HashAggregate" || agg.Strategy != "5 batches" || agg.DiskKB != 10240 || agg.SuggestedWorkMemKB != 20*1024 {
+		t.Errorf("hash aggregate spill = %+v, want 10240 kB on disk in 5 batches and 20MB suggested", agg)
+	}
+	if !hasPlanWarning(plan.Warnings, "spilled 10.0 MB to disk") {
+		t.Errorf("warnings = %q, want the hash aggregate spill size", plan.Warnings)
+	}
+}
+
+// hasPlanWarning reports whether a plan warning contains text
+func hasPlanWarning(warnings []string, text string) bool {
+	return slices.ContainsFunc(warnings, func(warning string) bool {
+		return strings.Contains(warning, text)
+	})
+}
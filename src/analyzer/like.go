@@ -0,0 +1,83 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// checkLeadingWildcards flags LIKE and ILIKE filters, negated or not, whose
+// pattern starts with a wildcard. A btree index only helps patterns with a
+// fixed prefix, so these scan every row.
+func (qa *QueryAnalyzer) checkLeadingWildcards(stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	columns := make([]string, 0)
+	seen := make(map[*pg_query.A_Expr]bool)
+
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			var where *pg_query.Node
+			switch node := msg.Interface().(type) {
+			case *pg_query.SelectStmt:
+				where = node.WhereClause
+			case *pg_query.UpdateStmt:
+				where = node.WhereClause
+			case *pg_query.DeleteStmt:
+				where = node.WhereClause
+			}
+			if where == nil {
+				return
+			}
+
+			// Subqueries in the clause are also visited as statements of their own
+			walkTree(where.ProtoReflect(), func(msg protoreflect.Message) {
+				expr, ok := msg.Interface().(*pg_query.A_Expr)
+				if !ok || seen[expr] || !isLeadingWildcardMatch(expr) {
+					return
+				}
+				seen[expr] = true
+
+				text, ok := exprString(&pg_query.Node{Node: &pg_query.Node_AExpr{AExpr: expr}})
+				if !ok {
+					return
+				}
+				analysis.AddWarning(fmt.Sprintf("%s starts with a wildcard, so it can't use a btree index and scans every row", text))
+
+				if column, ok := exprString(expr.Lexpr); ok && !slices.Contains(columns, column) {
+					columns = append(columns, column)
+				}
+			})
+		})
+	}
+
+	if len(columns) == 0 {
+		return
+	}
+
+	analysis.Suggestions = append(analysis.Suggestions, models.QuerySuggestion{
+		Type:        "index",
+		Severity:    "medium",
+		Message:     fmt.Sprintf("Index %s with a pg_trgm GIN index, or use full-text search, to match patterns that start with a wildcard", strings.Join(columns, ", ")),
+		Impact:      "Trigram indexes serve LIKE and ILIKE with any pattern instead of a sequential scan",
+		Confidence:  0.8,
+		Recommended: fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS pg_trgm; CREATE INDEX ON <table> USING gin (%s gin_trgm_ops)", columns[0]),
+	})
+}
+
+// isLeadingWildcardMatch reports whether an expression is a LIKE or ILIKE
+// match against a constant pattern starting with % or _
+func isLeadingWildcardMatch(expr *pg_query.A_Expr) bool {
+	if expr.Kind != pg_query.A_Expr_Kind_AEXPR_LIKE && expr.Kind != pg_query.A_Expr_Kind_AEXPR_ILIKE {
+		return false
+	}
+
+	pattern, ok := stringConst(expr.Rexpr)
+	return ok && (strings.HasPrefix(pattern, "%") || strings.HasPrefix(pattern, "_"))
+}
@@ -0,0 +1,27 @@
+package analyzer
+
+import "testing"
+
+func TestCheckLeadingWildcards(t *testing.T) {
+	tests := []struct {
+		query   string
+		flagged bool
+	}{
+		{"SELECT id FROM users WHERE name LIKE '%foo'", true},
+		{"SELECT id FROM users WHERE name LIKE 'foo%'", false},
+		{"SELECT id FROM users WHERE name LIKE '%foo%'", true},
+		{"SELECT id FROM users WHERE name ILIKE '%foo'", true},
+		{"SELECT id FROM users WHERE name NOT LIKE '%foo'", true},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		analysis, err := qa.Analyze(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if got := hasWarning(analysis, "starts with a wildcard"); got != tt.flagged {
+			t.Errorf("%q: leading wildcard flagged = %v, want %v (warnings %q)", tt.query, got, tt.flagged, analysis.Warnings)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package analyzer
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxOrColumns is the number of different columns an OR condition may test
+// before it is flagged
+const maxOrColumns = 3
+
+// checkOrChains flags WHERE conditions that OR together tests of more than
+// maxOrColumns different columns. No single index serves them, so they
+// usually end in a sequential scan, or at best a BitmapOr of one index per
+// column.
+func (qa *QueryAnalyzer) checkOrChains(stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			var where *pg_query.Node
+			switch node := msg.Interface().(type) {
+			case *pg_query.SelectStmt:
+				where = node.WhereClause
+			case *pg_query.UpdateStmt:
+				where = node.WhereClause
+			case *pg_query.DeleteStmt:
+				where = node.WhereClause
+			}
+
+			for _, condition := range whereConjuncts(where) {
+				branches := orBranches(condition)
+				columns := orColumns(branches)
+				if len(columns) <= maxOrColumns {
+					continue
+				}
+
+				analysis.AddWarning(fmt.Sprintf("WHERE condition ORs %d conditions on different columns (%s), which usually can't use an index",
+					len(branches), strings.Join(columns, ", ")))
+
+				suggestion := models.QuerySuggestion{
+					Type:       "optimization",
+					Severity:   "medium",
+					Message:    "Rewrite the OR condition as a UNION of one query per branch, each able to use its own index, or index every column so the planner can combine them with a BitmapOr. UNION also drops duplicate rows, so select a key to keep them",
+					Impact:     "Avoids a sequential scan for conditions spread over several columns",
+					Confidence: 0.7,
+				}
+				if selectStmt, ok := msg.Interface().(*pg_query.SelectStmt); ok && selectStmt == stmt.Stmt.GetSelectStmt() {
+					if rewritten, ok := unionRewrite(selectStmt, condition, branches); ok {
+						suggestion.Recommended = rewritten
+					}
+				}
+				analysis.Suggestions = append(analysis.Suggestions, suggestion)
+			}
+		})
+	}
+}
+
+// orBranches splits a condition into the conditions joined by OR, or returns
+// nil when it isn't an OR
+func orBranches(node *pg_query.Node) []*pg_query.Node {
+	expr := node.GetBoolExpr()
+	if expr == nil || expr.Boolop != pg_query.BoolExprType_OR_EXPR {
+		return nil
+	}
+
+	branches := make([]*pg_query.Node, 0, len(expr.Args))
+	for _, arg := range expr.Args {
+		if nested := orBranches(arg); nested != nil {
+			branches = append(branches, nested...)
+		} else {
+			branches = append(branches, arg)
+		}
+	}
+	return branches
+}
+
+// orColumns returns the different columns tested by OR branches, in order
+func orColumns(branches []*pg_query.Node) []string {
+	columns := make([]string, 0)
+	for _, branch := range branches {
+		walkCondition(branch, func(msg protoreflect.Message) {
+			ref, ok := msg.Interface().(*pg_query.ColumnRef)
+			if !ok {
+				return
+			}
+			column, ok := exprString(&pg_query.Node{Node: &pg_query.Node_ColumnRef{ColumnRef: ref}})
+			if ok && !slices.Contains(columns, column) {
+				columns = append(columns, column)
+			}
+		})
+	}
+	return columns
+}
+
+// unionRewrite rewrites a plain SELECT with an OR condition as a UNION of
+// one SELECT per branch, keeping its other conditions in every branch. It
+// gives up on statements whose ordering, limits, locking or DISTINCT don't
+// carry over to the branches.
+func unionRewrite(stmt *pg_query.SelectStmt, condition *pg_query.Node, branches []*pg_query.Node) (string, bool) {
+	if stmt.Op != pg_query.SetOperation_SETOP_NONE || stmt.WithClause != nil || len(stmt.SortClause) > 0 ||
+		stmt.LimitCount != nil || stmt.LimitOffset != nil || len(stmt.LockingClause) > 0 || len(stmt.DistinctClause) > 0 {
+		return "", false
+	}
+
+	var union *pg_query.SelectStmt
+	for _, branch := range branches {
+		arm := proto.Clone(stmt).(*pg_query.SelectStmt)
+		conditions := make([]*pg_query.Node, 0)
+		for _, conjunct := range whereConjuncts(stmt.WhereClause) {
+			if conjunct == condition {
+				conditions = append(conditions, branch)
+			} else {
+				conditions = append(conditions, conjunct)
+			}
+		}
+		arm.WhereClause = conditions[0]
+		if len(conditions) > 1 {
+			arm.WhereClause = pg_query.MakeBoolExprNode(pg_query.BoolExprType_AND_EXPR, conditions, -1)
+		}
+
+		if union == nil {
+			union = arm
+			continue
+		}
+		union = &pg_query.SelectStmt{Op: pg_query.SetOperation_SETOP_UNION, Larg: union, Rarg: arm}
+	}
+
+	tree := &pg_query.ParseResult{Stmts: []*pg_query.RawStmt{{
+		Stmt: &pg_query.Node{Node: &pg_query.Node_SelectStmt{SelectStmt: union}},
+	}}}
+	rewritten, err := pg_query.Deparse(tree)
+	if err != nil {
+		return "", false
+	}
+	return rewritten, true
+}
@@ -0,0 +1,56 @@
+package analyzer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestCheckOrChains(t *testing.T) {
+	tests := []struct {
+		query   string
+		flagged bool
+	}{
+		{"SELECT id FROM t WHERE a = 1 OR b = 2 OR c = 3 OR d = 4", true},
+		{"SELECT id FROM t WHERE status = 'open' AND (a = 1 OR b = 2 OR c = 3 OR d = 4)", true},
+		{"DELETE FROM t WHERE a = 1 OR b = 2 OR c = 3 OR d = 4", true},
+		{"SELECT id FROM t WHERE a IN (1, 2, 3, 4, 5)", false},
+		{"SELECT id FROM t WHERE a = 1 OR a = 2 OR a = 3 OR a = 4", false},
+		{"SELECT id FROM t WHERE a = 1 OR b = 2 OR c = 3", false},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		analysis, err := qa.Analyze(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if got := hasWarning(analysis, "ORs"); got != tt.flagged {
+			t.Errorf("%q: OR chain flagged = %v, want %v (warnings %q)", tt.query, got, tt.flagged, analysis.Warnings)
+		}
+	}
+}
+
+func TestOrChainUnionRewrite(t *testing.T) {
+	analysis, err := NewQueryAnalyzer().Analyze("SELECT id FROM t WHERE a = 1 OR b = 2 OR c = 3 OR d = 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := slices.IndexFunc(analysis.Suggestions, func(s models.QuerySuggestion) bool {
+		return strings.Contains(s.Message, "UNION")
+	})
+	if index < 0 {
+		t.Fatalf("suggestions = %+v, want a UNION rewrite", analysis.Suggestions)
+	}
+
+	suggestion := analysis.Suggestions[index]
+	if suggestion.Severity != "medium" {
+		t.Errorf("severity = %s, want medium", suggestion.Severity)
+	}
+	if strings.Count(suggestion.Recommended, "UNION") != 3 {
+		t.Errorf("recommended rewrite = %q, want one query per branch", suggestion.Recommended)
+	}
+}
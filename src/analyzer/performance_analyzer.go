@@ -2,6 +2,7 @@ package analyzer
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/zvdy/pgao/src/models"
@@ -9,64 +10,137 @@ import (
 
 // PerformanceAnalyzer analyzes database performance metrics
 type PerformanceAnalyzer struct {
-	thresholds PerformanceThresholds
+	thresholds        PerformanceThresholds
+	mu                sync.RWMutex
+	clusterThresholds map[string]PerformanceThresholds
+	compositeRules    []CompositeRule
 }
 
 // PerformanceThresholds defines performance thresholds
 type PerformanceThresholds struct {
-	MaxConnectionsPercent float64
-	MinCacheHitRatio      float64
-	MaxCPUPercent         float64
-	MaxMemoryPercent      float64
-	MaxReplicationLagMs   int64
-	MaxSlowQueryTimeMs    float64
-	MaxTableBloatPercent  float64
+	MaxConnectionsPercent  float64
+	MinCacheHitRatio       float64
+	MaxCPUPercent          float64
+	MaxMemoryPercent       float64
+	MaxReplicationLagMs    int64
+	MaxLogicalSlotLagBytes int64
+	MaxSlowQueryTimeMs     float64
+	MaxTableBloatPercent   float64
+	MaxPoolWaitStreak      int     // consecutive cycles with waiting pool acquires
+	MaxPoolAcquireWaitMs   float64 // average pool acquire time
+	MaxStatsStaleness      float64 // rows modified since the last ANALYZE per live row
+	MaxOrphanedTempTables  int     // temporary tables left behind by backends that are gone
 }
 
 // DefaultThresholds returns default performance thresholds
 func DefaultThresholds() PerformanceThresholds {
 	return PerformanceThresholds{
-		MaxConnectionsPercent: 80.0,
-		MinCacheHitRatio:      95.0,
-		MaxCPUPercent:         80.0,
-		MaxMemoryPercent:      85.0,
-		MaxReplicationLagMs:   10000,  // 10 seconds
-		MaxSlowQueryTimeMs:    1000.0, // 1 second
-		MaxTableBloatPercent:  20.0,
+		MaxConnectionsPercent:  80.0,
+		MinCacheHitRatio:       95.0,
+		MaxCPUPercent:          80.0,
+		MaxMemoryPercent:       85.0,
+		MaxReplicationLagMs:    10000,   // 10 seconds
+		MaxLogicalSlotLagBytes: 1 << 30, // 1 GiB
+		MaxSlowQueryTimeMs:     1000.0,  // 1 second
+		MaxTableBloatPercent:   20.0,
+		MaxPoolWaitStreak:      3,
+		MaxPoolAcquireWaitMs:   10.0,
+		MaxStatsStaleness:      0.2,
+		MaxOrphanedTempTables:  10,
 	}
 }
 
 // NewPerformanceAnalyzer creates a new PerformanceAnalyzer instance
 func NewPerformanceAnalyzer() *PerformanceAnalyzer {
 	return &PerformanceAnalyzer{
-		thresholds: DefaultThresholds(),
+		thresholds:        DefaultThresholds(),
+		clusterThresholds: make(map[string]PerformanceThresholds),
 	}
 }
 
 // NewPerformanceAnalyzerWithThresholds creates a new analyzer with custom thresholds
 func NewPerformanceAnalyzerWithThresholds(thresholds PerformanceThresholds) *PerformanceAnalyzer {
 	return &PerformanceAnalyzer{
-		thresholds: thresholds,
+		thresholds:        thresholds,
+		clusterThresholds: make(map[string]PerformanceThresholds),
 	}
 }
 
-// AnalyzeMetrics analyzes cluster metrics and generates alerts
+// SetClusterThresholds overrides the thresholds used for one cluster
+func (pa *PerformanceAnalyzer) SetClusterThresholds(clusterID string, thresholds PerformanceThresholds) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	pa.clusterThresholds[clusterID] = thresholds
+}
+
+// ClearClusterThresholds makes a cluster fall back to the default thresholds
+func (pa *PerformanceAnalyzer) ClearClusterThresholds(clusterID string) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	delete(pa.clusterThresholds, clusterID)
+}
+
+// Thresholds returns the analyzer's default thresholds
+func (pa *PerformanceAnalyzer) Thresholds() PerformanceThresholds {
+	return pa.thresholds
+}
+
+// ThresholdsFor returns the thresholds of a cluster, or the defaults when it has none of its own
+func (pa *PerformanceAnalyzer) ThresholdsFor(clusterID string) PerformanceThresholds {
+	pa.mu.RLock()
+	defer pa.mu.RUnlock()
+
+	if thresholds, exists := pa.clusterThresholds[clusterID]; exists {
+		return thresholds
+	}
+	return pa.thresholds
+}
+
+// AnalyzeMetrics analyzes cluster metrics and generates alerts using the
+// thresholds of the cluster the metrics belong to
 func (pa *PerformanceAnalyzer) AnalyzeMetrics(metrics *models.Metrics) []*models.Alert {
+	return pa.AnalyzeMetricsForCluster(metrics.ClusterID, metrics)
+}
+
+// AnalyzeMetricsForCluster analyzes metrics against a cluster's thresholds and generates alerts
+func (pa *PerformanceAnalyzer) AnalyzeMetricsForCluster(clusterID string, metrics *models.Metrics) []*models.Alert {
+	thresholds := pa.ThresholdsFor(clusterID)
 	alerts := make([]*models.Alert, 0)
 
+	// Report a server restart, which also reset the cumulative statistics
+	if metrics.IsCollected(models.MetricGroupUptime) && metrics.Restarted {
+		alert := models.NewAlert(
+			models.AlertTypeAvailability,
+			models.AlertSeverityInfo,
+			metrics.ClusterID,
+			"cluster_restarted",
+			"Cluster Restarted",
+			fmt.Sprintf("Server restarted at %s", metrics.ServerStartTime.Format(time.RFC3339)),
+		)
+		alert.CurrentValue = float64(metrics.UptimeSeconds)
+		alert.Metadata = map[string]interface{}{
+			"started_at": metrics.ServerStartTime,
+		}
+		alert.AddAction("Check the server log for the reason of the restart if it wasn't planned")
+		alert.AddAction("Expect cumulative statistics and rates to start over from the restart")
+		alerts = append(alerts, alert)
+	}
+
 	// Check connection usage
-	if metrics.ConnectionsTotal > 0 {
+	if metrics.IsCollected(models.MetricGroupConnections) && metrics.ConnectionsTotal > 0 {
 		connPercent := (float64(metrics.ConnectionsActive) / float64(metrics.ConnectionsTotal)) * 100
-		if connPercent > pa.thresholds.MaxConnectionsPercent {
+		if connPercent > thresholds.MaxConnectionsPercent {
 			alert := models.NewAlert(
 				models.AlertTypeConnection,
-				pa.getSeverity(connPercent, pa.thresholds.MaxConnectionsPercent, 90.0, 95.0),
+				pa.getSeverity(connPercent, thresholds.MaxConnectionsPercent, 90.0, 95.0),
 				metrics.ClusterID,
+				"connections_active",
 				"High Connection Usage",
 				fmt.Sprintf("Active connections at %.1f%% of maximum capacity", connPercent),
 			)
-			alert.Metric = "connections_active"
-			alert.Threshold = pa.thresholds.MaxConnectionsPercent
+			alert.Threshold = thresholds.MaxConnectionsPercent
 			alert.CurrentValue = connPercent
 			alert.AddAction("Consider increasing max_connections or optimizing connection pooling")
 			alerts = append(alerts, alert)
@@ -74,16 +148,16 @@ func (pa *PerformanceAnalyzer) AnalyzeMetrics(metrics *models.Metrics) []*models
 	}
 
 	// Check cache hit ratio
-	if metrics.CacheHitRatio < pa.thresholds.MinCacheHitRatio {
+	if metrics.IsCollected(models.MetricGroupCache) && metrics.CacheHitRatio < thresholds.MinCacheHitRatio {
 		alert := models.NewAlert(
 			models.AlertTypePerformance,
-			pa.getSeverityBelow(metrics.CacheHitRatio, pa.thresholds.MinCacheHitRatio, 90.0, 85.0),
+			pa.getSeverityBelow(metrics.CacheHitRatio, thresholds.MinCacheHitRatio, 90.0, 85.0),
 			metrics.ClusterID,
+			"cache_hit_ratio",
 			"Low Cache Hit Ratio",
-			fmt.Sprintf("Cache hit ratio at %.1f%%, below recommended %.1f%%", metrics.CacheHitRatio, pa.thresholds.MinCacheHitRatio),
+			fmt.Sprintf("Cache hit ratio at %.1f%%, below recommended %.1f%%", metrics.CacheHitRatio, thresholds.MinCacheHitRatio),
 		)
-		alert.Metric = "cache_hit_ratio"
-		alert.Threshold = pa.thresholds.MinCacheHitRatio
+		alert.Threshold = thresholds.MinCacheHitRatio
 		alert.CurrentValue = metrics.CacheHitRatio
 		alert.AddAction("Consider increasing shared_buffers")
 		alert.AddAction("Review query patterns for optimization")
@@ -91,16 +165,16 @@ func (pa *PerformanceAnalyzer) AnalyzeMetrics(metrics *models.Metrics) []*models
 	}
 
 	// Check CPU usage
-	if metrics.CPUUsage > pa.thresholds.MaxCPUPercent {
+	if metrics.IsCollected(models.MetricGroupResources) && metrics.CPUUsage > thresholds.MaxCPUPercent {
 		alert := models.NewAlert(
 			models.AlertTypePerformance,
-			pa.getSeverity(metrics.CPUUsage, pa.thresholds.MaxCPUPercent, 90.0, 95.0),
+			pa.getSeverity(metrics.CPUUsage, thresholds.MaxCPUPercent, 90.0, 95.0),
 			metrics.ClusterID,
+			"cpu_usage",
 			"High CPU Usage",
 			fmt.Sprintf("CPU usage at %.1f%%", metrics.CPUUsage),
 		)
-		alert.Metric = "cpu_usage"
-		alert.Threshold = pa.thresholds.MaxCPUPercent
+		alert.Threshold = thresholds.MaxCPUPercent
 		alert.CurrentValue = metrics.CPUUsage
 		alert.AddAction("Identify and optimize expensive queries")
 		alert.AddAction("Consider scaling up the instance")
@@ -108,16 +182,16 @@ func (pa *PerformanceAnalyzer) AnalyzeMetrics(metrics *models.Metrics) []*models
 	}
 
 	// Check memory usage
-	if metrics.MemoryUsage > pa.thresholds.MaxMemoryPercent {
+	if metrics.IsCollected(models.MetricGroupResources) && metrics.MemoryUsage > thresholds.MaxMemoryPercent {
 		alert := models.NewAlert(
 			models.AlertTypeCapacity,
-			pa.getSeverity(metrics.MemoryUsage, pa.thresholds.MaxMemoryPercent, 90.0, 95.0),
+			pa.getSeverity(metrics.MemoryUsage, thresholds.MaxMemoryPercent, 90.0, 95.0),
 			metrics.ClusterID,
+			"memory_usage",
 			"High Memory Usage",
 			fmt.Sprintf("Memory usage at %.1f%%", metrics.MemoryUsage),
 		)
-		alert.Metric = "memory_usage"
-		alert.Threshold = pa.thresholds.MaxMemoryPercent
+		alert.Threshold = thresholds.MaxMemoryPercent
 		alert.CurrentValue = metrics.MemoryUsage
 		alert.AddAction("Review and optimize memory-intensive queries")
 		alert.AddAction("Consider increasing available memory")
@@ -125,32 +199,92 @@ func (pa *PerformanceAnalyzer) AnalyzeMetrics(metrics *models.Metrics) []*models
 	}
 
 	// Check replication lag
-	if metrics.ReplicationLag > pa.thresholds.MaxReplicationLagMs {
+	if metrics.IsCollected(models.MetricGroupReplication) && metrics.ReplicationLag > thresholds.MaxReplicationLagMs {
 		alert := models.NewAlert(
 			models.AlertTypeReplication,
-			pa.getSeverityLag(metrics.ReplicationLag, pa.thresholds.MaxReplicationLagMs, 30000, 60000),
+			pa.getSeverityLag(metrics.ReplicationLag, thresholds.MaxReplicationLagMs, 30000, 60000),
 			metrics.ClusterID,
+			"replication_lag",
 			"High Replication Lag",
 			fmt.Sprintf("Replication lag at %dms", metrics.ReplicationLag),
 		)
-		alert.Metric = "replication_lag"
-		alert.Threshold = float64(pa.thresholds.MaxReplicationLagMs)
+		alert.Threshold = float64(thresholds.MaxReplicationLagMs)
 		alert.CurrentValue = float64(metrics.ReplicationLag)
 		alert.AddAction("Check network connectivity between primary and replica")
 		alert.AddAction("Review write load on primary")
 		alerts = append(alerts, alert)
 	}
 
+	// Check logical replication slots for stalled consumers
+	for _, slot := range metrics.ReplicationSlots {
+		if slot.SlotType != "logical" || slot.LagBytes <= thresholds.MaxLogicalSlotLagBytes {
+			continue
+		}
+
+		maxLag := thresholds.MaxLogicalSlotLagBytes
+		alert := models.NewAlert(
+			models.AlertTypeReplication,
+			pa.getSeverityLag(slot.LagBytes, maxLag, maxLag*4, maxLag*10),
+			metrics.ClusterID,
+			"logical_slot_lag:"+slot.SlotName,
+			"Logical Replication Slot Lagging",
+			fmt.Sprintf("Logical slot %s is %d bytes behind and retaining WAL", slot.SlotName, slot.LagBytes),
+		)
+		alert.Threshold = float64(maxLag)
+		alert.CurrentValue = float64(slot.LagBytes)
+		alert.Metadata = map[string]interface{}{
+			"slot_name": slot.SlotName,
+			"database":  slot.Database,
+			"active":    slot.Active,
+		}
+		alert.AddAction("Check that the CDC consumer for this slot is running and confirming its position")
+		alert.AddAction("Drop the slot if its consumer has been decommissioned")
+		alerts = append(alerts, alert)
+	}
+
+	// Check for temporary tables orphaned by crashed backends
+	if metrics.IsCollected(models.MetricGroupTempSchemas) {
+		if tables, size := metrics.OrphanedTempTables(); tables > thresholds.MaxOrphanedTempTables {
+			schemas := make([]string, 0)
+			var oldestXIDAge int64
+			for _, schema := range metrics.TempSchemas {
+				if schema.Orphaned {
+					schemas = append(schemas, schema.Schema)
+					oldestXIDAge = max(oldestXIDAge, schema.OldestXIDAge)
+				}
+			}
+
+			alert := models.NewAlert(
+				models.AlertTypeCapacity,
+				models.AlertSeverityMedium,
+				metrics.ClusterID,
+				"orphaned_temp_tables",
+				"Orphaned Temporary Tables",
+				fmt.Sprintf("%d orphaned temporary tables in %d temp schemas use %d bytes", tables, len(schemas), size),
+			)
+			alert.Threshold = float64(thresholds.MaxOrphanedTempTables)
+			alert.CurrentValue = float64(tables)
+			alert.Metadata = map[string]interface{}{
+				"schemas":        schemas,
+				"size_bytes":     size,
+				"oldest_xid_age": oldestXIDAge,
+			}
+			alert.AddAction("Check the server log for crashed backends that left the temp schemas behind")
+			alert.AddAction("Drop the orphaned tables, or let autovacuum remove them once they near wraparound")
+			alerts = append(alerts, alert)
+		}
+	}
+
 	// Check for lock waits
-	if metrics.LockWaits > 100 {
+	if metrics.IsCollected(models.MetricGroupLocks) && metrics.LockWaits > 100 {
 		alert := models.NewAlert(
 			models.AlertTypePerformance,
 			models.AlertSeverityMedium,
 			metrics.ClusterID,
+			"lock_waits",
 			"High Lock Waits",
 			fmt.Sprintf("%d queries waiting for locks", metrics.LockWaits),
 		)
-		alert.Metric = "lock_waits"
 		alert.CurrentValue = float64(metrics.LockWaits)
 		alert.AddAction("Review long-running transactions")
 		alert.AddAction("Optimize query access patterns")
@@ -158,15 +292,15 @@ func (pa *PerformanceAnalyzer) AnalyzeMetrics(metrics *models.Metrics) []*models
 	}
 
 	// Check for deadlocks
-	if metrics.DeadlockCount > 0 {
+	if metrics.IsCollected(models.MetricGroupLocks) && metrics.DeadlockCount > 0 {
 		alert := models.NewAlert(
 			models.AlertTypePerformance,
 			models.AlertSeverityHigh,
 			metrics.ClusterID,
+			"deadlock_count",
 			"Deadlocks Detected",
-			fmt.Sprintf("%d deadlocks detected", metrics.DeadlockCount),
+			fmt.Sprintf("%d deadlocks detected since the previous collection", metrics.DeadlockCount),
 		)
-		alert.Metric = "deadlock_count"
 		alert.CurrentValue = float64(metrics.DeadlockCount)
 		alert.AddAction("Review transaction ordering")
 		alert.AddAction("Consider implementing retry logic")
@@ -174,36 +308,74 @@ func (pa *PerformanceAnalyzer) AnalyzeMetrics(metrics *models.Metrics) []*models
 	}
 
 	// Check table bloat
-	if metrics.TableBloat > pa.thresholds.MaxTableBloatPercent {
+	if metrics.IsCollected(models.MetricGroupBloat) && metrics.TableBloat > thresholds.MaxTableBloatPercent {
 		alert := models.NewAlert(
 			models.AlertTypeCapacity,
-			pa.getSeverity(metrics.TableBloat, pa.thresholds.MaxTableBloatPercent, 30.0, 40.0),
+			pa.getSeverity(metrics.TableBloat, thresholds.MaxTableBloatPercent, 30.0, 40.0),
 			metrics.ClusterID,
+			"table_bloat",
 			"High Table Bloat",
 			fmt.Sprintf("Table bloat at %.1f%%", metrics.TableBloat),
 		)
-		alert.Metric = "table_bloat"
-		alert.Threshold = pa.thresholds.MaxTableBloatPercent
+		alert.Threshold = thresholds.MaxTableBloatPercent
 		alert.CurrentValue = metrics.TableBloat
 		alert.AddAction("Run VACUUM ANALYZE")
 		alert.AddAction("Consider VACUUM FULL for heavily bloated tables")
 		alerts = append(alerts, alert)
 	}
 
+	// Check for sustained starvation of pgao's connection pool
+	if metrics.IsCollected(models.MetricGroupPool) {
+		streakHigh := metrics.PoolEmptyAcquireStreak >= thresholds.MaxPoolWaitStreak
+		waitHigh := metrics.PoolAcquireWaitMs > thresholds.MaxPoolAcquireWaitMs
+		if streakHigh || waitHigh {
+			severity := models.AlertSeverityMedium
+			if streakHigh && waitHigh {
+				severity = models.AlertSeverityHigh
+			}
+			alert := models.NewAlert(
+				models.AlertTypeConnection,
+				severity,
+				metrics.ClusterID,
+				"pool_saturation",
+				"Connection Pool Saturated",
+				fmt.Sprintf("Pool acquires had to wait for %d consecutive cycles, averaging %.1fms", metrics.PoolEmptyAcquireStreak, metrics.PoolAcquireWaitMs),
+			)
+			if waitHigh {
+				alert.Threshold = thresholds.MaxPoolAcquireWaitMs
+				alert.CurrentValue = metrics.PoolAcquireWaitMs
+			} else {
+				alert.Threshold = float64(thresholds.MaxPoolWaitStreak)
+				alert.CurrentValue = float64(metrics.PoolEmptyAcquireStreak)
+			}
+			alert.Metadata = map[string]interface{}{
+				"empty_acquire_streak": metrics.PoolEmptyAcquireStreak,
+				"max_wait_streak":      thresholds.MaxPoolWaitStreak,
+			}
+			alert.AddAction("Check the pool recommendation endpoint for a new max_connections")
+			alert.AddAction("Raise the cluster's max_connections in the pgao configuration")
+			alerts = append(alerts, alert)
+		}
+	}
+
+	// Check composite rules
+	alerts = append(alerts, pa.evaluateCompositeRules(metrics)...)
+
 	return alerts
 }
 
 // AnalyzeQueryPerformance analyzes query performance
 func (pa *PerformanceAnalyzer) AnalyzeQueryPerformance(qm *models.QueryMetrics) []*models.Alert {
+	thresholds := pa.ThresholdsFor(qm.ClusterID)
 	alerts := make([]*models.Alert, 0)
 
 	// Check slow queries
-	if qm.ExecutionTime > pa.thresholds.MaxSlowQueryTimeMs {
+	if qm.ExecutionTime > thresholds.MaxSlowQueryTimeMs {
 		severity := models.AlertSeverityMedium
-		if qm.ExecutionTime > pa.thresholds.MaxSlowQueryTimeMs*5 {
+		if qm.ExecutionTime > thresholds.MaxSlowQueryTimeMs*5 {
 			severity = models.AlertSeverityHigh
 		}
-		if qm.ExecutionTime > pa.thresholds.MaxSlowQueryTimeMs*10 {
+		if qm.ExecutionTime > thresholds.MaxSlowQueryTimeMs*10 {
 			severity = models.AlertSeverityCritical
 		}
 
@@ -211,11 +383,11 @@ func (pa *PerformanceAnalyzer) AnalyzeQueryPerformance(qm *models.QueryMetrics)
 			models.AlertTypeQuery,
 			severity,
 			qm.ClusterID,
+			"execution_time",
 			"Slow Query Detected",
 			fmt.Sprintf("Query took %.2fms to execute", qm.ExecutionTime),
 		)
-		alert.Metric = "execution_time"
-		alert.Threshold = pa.thresholds.MaxSlowQueryTimeMs
+		alert.Threshold = thresholds.MaxSlowQueryTimeMs
 		alert.CurrentValue = qm.ExecutionTime
 		alert.Metadata = map[string]interface{}{
 			"query_id": qm.QueryID,
@@ -233,6 +405,7 @@ func (pa *PerformanceAnalyzer) AnalyzeQueryPerformance(qm *models.QueryMetrics)
 			models.AlertTypePerformance,
 			models.AlertSeverityMedium,
 			qm.ClusterID,
+			"temp_blocks",
 			"High Temp Block Usage",
 			fmt.Sprintf("Query using excessive temp blocks (read: %d, written: %d)", qm.TempBlocksRead, qm.TempBlocksWritten),
 		)
@@ -251,6 +424,7 @@ func (pa *PerformanceAnalyzer) AnalyzeQueryPerformance(qm *models.QueryMetrics)
 
 // GenerateHealthStatus generates overall health status for a cluster
 func (pa *PerformanceAnalyzer) GenerateHealthStatus(clusterID string, metrics *models.Metrics, alerts []*models.Alert) *models.HealthStatus {
+	thresholds := pa.ThresholdsFor(clusterID)
 	health := models.NewHealthStatus(clusterID)
 
 	// Count alerts by severity
@@ -273,11 +447,11 @@ func (pa *PerformanceAnalyzer) GenerateHealthStatus(clusterID string, metrics *m
 		LastChecked: time.Now(),
 	})
 
-	if metrics.ConnectionsTotal > 0 {
+	if metrics.IsCollected(models.MetricGroupConnections) && metrics.ConnectionsTotal > 0 {
 		connPercent := (float64(metrics.ConnectionsActive) / float64(metrics.ConnectionsTotal)) * 100
 		status := "ok"
 		message := fmt.Sprintf("%.1f%% connections in use", connPercent)
-		if connPercent > pa.thresholds.MaxConnectionsPercent {
+		if connPercent > thresholds.MaxConnectionsPercent {
 			status = "warning"
 		}
 		health.AddCheck(models.HealthCheck{
@@ -289,41 +463,45 @@ func (pa *PerformanceAnalyzer) GenerateHealthStatus(clusterID string, metrics *m
 		})
 	}
 
-	cacheStatus := "ok"
-	if metrics.CacheHitRatio < pa.thresholds.MinCacheHitRatio {
-		cacheStatus = "warning"
+	if metrics.IsCollected(models.MetricGroupCache) {
+		cacheStatus := "ok"
+		if metrics.CacheHitRatio < thresholds.MinCacheHitRatio {
+			cacheStatus = "warning"
+		}
+		health.AddCheck(models.HealthCheck{
+			Name:        "Cache Performance",
+			Status:      cacheStatus,
+			Message:     fmt.Sprintf("%.1f%% cache hit ratio", metrics.CacheHitRatio),
+			LastChecked: time.Now(),
+			Value:       metrics.CacheHitRatio,
+		})
 	}
-	health.AddCheck(models.HealthCheck{
-		Name:        "Cache Performance",
-		Status:      cacheStatus,
-		Message:     fmt.Sprintf("%.1f%% cache hit ratio", metrics.CacheHitRatio),
-		LastChecked: time.Now(),
-		Value:       metrics.CacheHitRatio,
-	})
 
-	cpuStatus := "ok"
-	if metrics.CPUUsage > pa.thresholds.MaxCPUPercent {
-		cpuStatus = "warning"
-	}
-	health.AddCheck(models.HealthCheck{
-		Name:        "CPU Usage",
-		Status:      cpuStatus,
-		Message:     fmt.Sprintf("%.1f%% CPU usage", metrics.CPUUsage),
-		LastChecked: time.Now(),
-		Value:       metrics.CPUUsage,
-	})
+	if metrics.IsCollected(models.MetricGroupResources) {
+		cpuStatus := "ok"
+		if metrics.CPUUsage > thresholds.MaxCPUPercent {
+			cpuStatus = "warning"
+		}
+		health.AddCheck(models.HealthCheck{
+			Name:        "CPU Usage",
+			Status:      cpuStatus,
+			Message:     fmt.Sprintf("%.1f%% CPU usage", metrics.CPUUsage),
+			LastChecked: time.Now(),
+			Value:       metrics.CPUUsage,
+		})
 
-	memStatus := "ok"
-	if metrics.MemoryUsage > pa.thresholds.MaxMemoryPercent {
-		memStatus = "warning"
+		memStatus := "ok"
+		if metrics.MemoryUsage > thresholds.MaxMemoryPercent {
+			memStatus = "warning"
+		}
+		health.AddCheck(models.HealthCheck{
+			Name:        "Memory Usage",
+			Status:      memStatus,
+			Message:     fmt.Sprintf("%.1f%% memory usage", metrics.MemoryUsage),
+			LastChecked: time.Now(),
+			Value:       metrics.MemoryUsage,
+		})
 	}
-	health.AddCheck(models.HealthCheck{
-		Name:        "Memory Usage",
-		Status:      memStatus,
-		Message:     fmt.Sprintf("%.1f%% memory usage", metrics.MemoryUsage),
-		LastChecked: time.Now(),
-		Value:       metrics.MemoryUsage,
-	})
 
 	return health
 }
@@ -0,0 +1,122 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestLogicalSlotAlertsPerSlot(t *testing.T) {
+	metrics := models.NewMetrics("main")
+	metrics.ReplicationSlots = []models.ReplicationSlot{
+		{SlotName: "cdc_orders", SlotType: "logical", LagBytes: 2 << 30},
+		{SlotName: "cdc_users", SlotType: "logical", LagBytes: 3 << 30},
+		{SlotName: "standby", SlotType: "physical", LagBytes: 5 << 30},
+	}
+
+	ids := make(map[string]string)
+	for _, alert := range NewPerformanceAnalyzer().AnalyzeMetrics(metrics) {
+		if alert.Title == "Logical Replication Slot Lagging" {
+			ids[alert.Metric] = alert.ID
+		}
+	}
+
+	if len(ids) != 2 || ids["logical_slot_lag:cdc_orders"] == "" || ids["logical_slot_lag:cdc_users"] == "" {
+		t.Fatalf("slot alert metrics = %v, want one per logical slot", ids)
+	}
+	if ids["logical_slot_lag:cdc_orders"] == ids["logical_slot_lag:cdc_users"] {
+		t.Error("slot alerts share an ID")
+	}
+}
+
+func TestPoolSaturationThresholdThatFired(t *testing.T) {
+	tests := []struct {
+		name          string
+		streak        int
+		waitMs        float64
+		wantThreshold float64
+		wantValue     float64
+	}{
+		{"wait", 0, 25, 10, 25},
+		{"streak", 5, 2, 3, 5},
+		{"both", 5, 25, 10, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := models.NewMetrics("main")
+			metrics.MarkCollected(models.MetricGroupPool)
+			metrics.PoolEmptyAcquireStreak = tt.streak
+			metrics.PoolAcquireWaitMs = tt.waitMs
+
+			for _, alert := range NewPerformanceAnalyzer().AnalyzeMetrics(metrics) {
+				if alert.Metric != "pool_saturation" {
+					continue
+				}
+				if alert.Threshold != tt.wantThreshold || alert.CurrentValue != tt.wantValue {
+					t.Errorf("threshold %g, value %g, want %g and %g", alert.Threshold, alert.CurrentValue, tt.wantThreshold, tt.wantValue)
+				}
+				return
+			}
+			t.Error("no pool saturation alert")
+		})
+	}
+}
+
+func TestClusterThresholdsOverrideDefaults(t *testing.T) {
+	pa := NewPerformanceAnalyzer()
+	thresholds := DefaultThresholds()
+	thresholds.MaxReplicationLagMs = 120000
+	pa.SetClusterThresholds("reporting", thresholds)
+
+	lagAlerts := func(clusterID string) int {
+		metrics := models.NewMetrics(clusterID)
+		metrics.ReplicationLag = 45000
+		metrics.MarkCollected(models.MetricGroupReplication)
+
+		count := 0
+		for _, alert := range pa.AnalyzeMetrics(metrics) {
+			if alert.Metric == "replication_lag" {
+				count++
+			}
+		}
+		return count
+	}
+
+	// 45s is over the default 10s but under the reporting replica's 2 minutes
+	if n := lagAlerts("reporting"); n != 0 {
+		t.Errorf("reporting raised %d lag alerts, want none under its own threshold", n)
+	}
+	if n := lagAlerts("main"); n != 1 {
+		t.Errorf("main raised %d lag alerts, want one under the default threshold", n)
+	}
+
+	pa.ClearClusterThresholds("reporting")
+	if n := lagAlerts("reporting"); n != 1 {
+		t.Errorf("reporting raised %d lag alerts after clearing its thresholds, want one", n)
+	}
+}
+
+func TestUncollectedCacheHitRatioRaisesNoAlert(t *testing.T) {
+	hasCacheAlert := func(metrics *models.Metrics) bool {
+		for _, alert := range NewPerformanceAnalyzer().AnalyzeMetrics(metrics) {
+			if alert.Metric == "cache_hit_ratio" {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A failed collection leaves the ratio at zero
+	failed := models.NewMetrics("main")
+	if hasCacheAlert(failed) {
+		t.Error("a cache hit ratio that wasn't collected raised an alert")
+	}
+
+	low := models.NewMetrics("main")
+	low.CacheHitRatio = 70
+	low.MarkCollected(models.MetricGroupCache)
+	if !hasCacheAlert(low) {
+		t.Error("a collected cache hit ratio of 70% raised no alert")
+	}
+}
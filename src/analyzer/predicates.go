@@ -0,0 +1,269 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// rangeBound is the tightest lower or upper bound the conditions of a WHERE
+// clause put on a column
+type rangeBound struct {
+	value     float64
+	inclusive bool
+	set       bool
+	condition string
+}
+
+// columnRange collects the bounds of one column
+type columnRange struct {
+	lower, upper rangeBound
+}
+
+// checkPredicates flags WHERE conditions that are constant, repeated or
+// contradict each other, as generated SQL often has them. A condition that is
+// always false, or a contradiction, means the statement matches no rows.
+func (qa *QueryAnalyzer) checkPredicates(stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			switch node := msg.Interface().(type) {
+			case *pg_query.SelectStmt:
+				checkWhereClause(node.WhereClause, analysis)
+			case *pg_query.UpdateStmt:
+				checkWhereClause(node.WhereClause, analysis)
+			case *pg_query.DeleteStmt:
+				checkWhereClause(node.WhereClause, analysis)
+			}
+		})
+	}
+}
+
+// checkWhereClause checks the conditions joined by AND in one WHERE clause
+func checkWhereClause(where *pg_query.Node, analysis *models.QueryAnalysis) {
+	seen := make(map[string]bool)
+	ranges := make(map[string]*columnRange)
+	columns := make([]string, 0)
+
+	for _, condition := range whereConjuncts(where) {
+		text, ok := exprString(condition)
+		if !ok {
+			continue
+		}
+
+		if seen[text] {
+			analysis.AddWarning(fmt.Sprintf("WHERE condition %s is repeated", text))
+			continue
+		}
+		seen[text] = true
+
+		if value, constant := constantPredicate(condition); constant {
+			if value {
+				analysis.AddWarning(fmt.Sprintf("WHERE condition %s is always true and can be removed", text))
+			} else {
+				analysis.AddWarning(fmt.Sprintf("WHERE condition %s is always false, so the statement matches no rows - likely a bug", text))
+			}
+			continue
+		}
+
+		column, op, value, ok := columnComparison(condition)
+		if !ok {
+			continue
+		}
+		r, exists := ranges[column]
+		if !exists {
+			r = &columnRange{}
+			ranges[column] = r
+			columns = append(columns, column)
+		}
+		r.add(op, value, text)
+	}
+
+	for _, column := range columns {
+		if r := ranges[column]; r.empty() {
+			analysis.AddWarning(fmt.Sprintf("WHERE conditions %s and %s on %s contradict each other, so the statement matches no rows - likely a bug",
+				r.lower.condition, r.upper.condition, column))
+		}
+	}
+}
+
+// add narrows the range with a comparison of the column against a constant
+func (r *columnRange) add(op string, value float64, condition string) {
+	switch op {
+	case "=":
+		r.lower.narrow(value, true, condition, true)
+		r.upper.narrow(value, true, condition, false)
+	case ">":
+		r.lower.narrow(value, false, condition, true)
+	case ">=":
+		r.lower.narrow(value, true, condition, true)
+	case "<":
+		r.upper.narrow(value, false, condition, false)
+	case "<=":
+		r.upper.narrow(value, true, condition, false)
+	}
+}
+
+// narrow replaces the bound when the new one is tighter. A lower bound is
+// tighter when higher, an upper bound when lower, and an exclusive bound is
+// tighter than an inclusive one on the same value.
+func (b *rangeBound) narrow(value float64, inclusive bool, condition string, lower bool) {
+	tighter := !b.set ||
+		(lower && value > b.value) || (!lower && value < b.value) ||
+		(value == b.value && b.inclusive && !inclusive)
+	if tighter {
+		*b = rangeBound{value: value, inclusive: inclusive, set: true, condition: condition}
+	}
+}
+
+// empty reports whether no value satisfies both bounds
+func (r *columnRange) empty() bool {
+	if !r.lower.set || !r.upper.set {
+		return false
+	}
+	if r.lower.value != r.upper.value {
+		return r.lower.value > r.upper.value
+	}
+	return !r.lower.inclusive || !r.upper.inclusive
+}
+
+// constantPredicate evaluates a condition that only involves constants, such
+// as 1 = 1 or a bare true, reporting whether it could
+func constantPredicate(node *pg_query.Node) (bool, bool) {
+	if constant := node.GetAConst(); constant != nil {
+		if boolval, ok := constant.Val.(*pg_query.A_Const_Boolval); ok {
+			return boolval.Boolval.GetBoolval(), true
+		}
+		return false, false
+	}
+
+	expr := node.GetAExpr()
+	if expr == nil || expr.Kind != pg_query.A_Expr_Kind_AEXPR_OP || len(expr.Name) != 1 {
+		return false, false
+	}
+	op := expr.Name[0].GetString_().GetSval()
+
+	if left, ok := numericConst(expr.Lexpr); ok {
+		if right, ok := numericConst(expr.Rexpr); ok {
+			return compareNumbers(left, op, right)
+		}
+	}
+
+	// Strings are only compared for equality, since their order depends on the collation
+	left, leftOK := stringConst(expr.Lexpr)
+	right, rightOK := stringConst(expr.Rexpr)
+	if leftOK && rightOK {
+		switch op {
+		case "=":
+			return left == right, true
+		case "<>", "!=":
+			return left != right, true
+		}
+	}
+
+	return false, false
+}
+
+// columnComparison returns the column, operator and constant of a condition
+// comparing a plain column with a number, with the column on the left
+func columnComparison(node *pg_query.Node) (string, string, float64, bool) {
+	expr := node.GetAExpr()
+	if expr == nil || expr.Kind != pg_query.A_Expr_Kind_AEXPR_OP || len(expr.Name) != 1 {
+		return "", "", 0, false
+	}
+	op := expr.Name[0].GetString_().GetSval()
+
+	columnSide, constantSide := expr.Lexpr, expr.Rexpr
+	if expr.Lexpr.GetColumnRef() == nil {
+		// Rewrite "5 < x" as "x > 5"
+		columnSide, constantSide = expr.Rexpr, expr.Lexpr
+		op = map[string]string{"<": ">", ">": "<", "<=": ">=", ">=": "<=", "=": "="}[op]
+	}
+
+	if columnSide.GetColumnRef() == nil || op == "" {
+		return "", "", 0, false
+	}
+	value, ok := numericConst(constantSide)
+	if !ok {
+		return "", "", 0, false
+	}
+	column, ok := exprString(columnSide)
+	if !ok {
+		return "", "", 0, false
+	}
+
+	return column, op, value, true
+}
+
+// compareNumbers evaluates a comparison between two numbers
+func compareNumbers(left float64, op string, right float64) (bool, bool) {
+	switch op {
+	case "=":
+		return left == right, true
+	case "<>", "!=":
+		return left != right, true
+	case "<":
+		return left < right, true
+	case "<=":
+		return left <= right, true
+	case ">":
+		return left > right, true
+	case ">=":
+		return left >= right, true
+	}
+	return false, false
+}
+
+// numericConst returns the value of an integer or decimal constant node
+func numericConst(node *pg_query.Node) (float64, bool) {
+	constant := node.GetAConst()
+	if constant == nil || constant.Isnull {
+		return 0, false
+	}
+
+	switch val := constant.Val.(type) {
+	case *pg_query.A_Const_Ival:
+		return float64(val.Ival.GetIval()), true
+	case *pg_query.A_Const_Fval:
+		value, err := strconv.ParseFloat(val.Fval.GetFval(), 64)
+		return value, err == nil
+	}
+	return 0, false
+}
+
+// stringConst returns the value of a string constant node
+func stringConst(node *pg_query.Node) (string, bool) {
+	constant := node.GetAConst()
+	if constant == nil || constant.Isnull {
+		return "", false
+	}
+
+	sval, ok := constant.Val.(*pg_query.A_Const_Sval)
+	if !ok {
+		return "", false
+	}
+	return sval.Sval.GetSval(), true
+}
+
+// exprString deparses an expression, which also normalizes its formatting
+// so equal expressions compare equal
+func exprString(node *pg_query.Node) (string, bool) {
+	tree := &pg_query.ParseResult{Stmts: []*pg_query.RawStmt{{
+		Stmt: &pg_query.Node{Node: &pg_query.Node_SelectStmt{SelectStmt: &pg_query.SelectStmt{WhereClause: node}}},
+	}}}
+
+	output, err := pg_query.Deparse(tree)
+	if err != nil {
+		return "", false
+	}
+
+	text, ok := strings.CutPrefix(output, "SELECT WHERE ")
+	return text, ok
+}
@@ -0,0 +1,33 @@
+package analyzer
+
+import "testing"
+
+func TestCheckPredicates(t *testing.T) {
+	tests := []struct {
+		query   string
+		warning string // empty when the query has no predicate warning
+	}{
+		{"SELECT id FROM t WHERE 1 = 1 AND x = 2", "1 = 1 is always true"},
+		{"SELECT id FROM t WHERE 1 = 2", "1 = 2 is always false"},
+		{"SELECT id FROM t WHERE x > 5 AND x < 3", "x > 5 and x < 3 on x contradict each other"},
+		{"SELECT id FROM t WHERE x = 2 AND x = 2", "x = 2 is repeated"},
+		{"SELECT id FROM t WHERE x > 5 AND x < 10", ""},
+		{"SELECT id FROM t WHERE x = 2 AND y = 2", ""},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		analysis, err := qa.Analyze(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+
+		if tt.warning == "" {
+			if hasWarning(analysis, "WHERE condition") {
+				t.Errorf("%q: unexpected warnings %q", tt.query, analysis.Warnings)
+			}
+		} else if !hasWarning(analysis, tt.warning) {
+			t.Errorf("%q: no warning containing %q in %q", tt.query, tt.warning, analysis.Warnings)
+		}
+	}
+}
@@ -1,75 +1,273 @@
 package analyzer
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/pganalyze/pg_query_go/v6/parser"
 	"github.com/zvdy/pgao/src/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-// QueryAnalyzer is responsible for analyzing SQL queries
+const (
+	// maxBindParameters is the PostgreSQL wire protocol limit on bind parameters
+	maxBindParameters = 65535
+
+	// bindParameterWarnRatio is the fraction of the limit at which we start warning
+	bindParameterWarnRatio = 0.8
+)
+
+// QueryAnalyzer is responsible for analyzing SQL queries. It is safe for
+// concurrent use.
 type QueryAnalyzer struct {
 	// Cache for parsed queries
-	cache map[string]*models.QueryAnalysis
+	cache *analysisCache
+
+	// Fingerprints of accepted query shapes whose findings are suppressed
+	baselineMu sync.RWMutex
+	baseline   map[string]bool
 }
 
 // NewQueryAnalyzer creates a new QueryAnalyzer instance
 func NewQueryAnalyzer() *QueryAnalyzer {
+	return NewQueryAnalyzerWithCacheSize(DefaultCacheSize)
+}
+
+// NewQueryAnalyzerWithCacheSize creates a new analyzer whose cache holds at most cacheSize analyses
+func NewQueryAnalyzerWithCacheSize(cacheSize int) *QueryAnalyzer {
 	return &QueryAnalyzer{
-		cache: make(map[string]*models.QueryAnalysis),
+		cache:    newAnalysisCache(cacheSize),
+		baseline: make(map[string]bool),
+	}
+}
+
+// CacheStats returns statistics for the analysis cache
+func (qa *QueryAnalyzer) CacheStats() CacheStats {
+	return qa.cache.Stats()
+}
+
+// AddBaselineFingerprints marks query fingerprints as already reviewed so
+// their warnings and suggestions are suppressed
+func (qa *QueryAnalyzer) AddBaselineFingerprints(fingerprints ...string) {
+	qa.baselineMu.Lock()
+	defer qa.baselineMu.Unlock()
+
+	for _, fingerprint := range fingerprints {
+		qa.baseline[fingerprint] = true
 	}
 }
 
-// Analyze takes a SQL query as input and returns a comprehensive analysis
+// LoadBaselineFile reads query fingerprints from a file, one per line.
+// Blank lines and lines starting with # are ignored.
+func LoadBaselineFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file: %w", err)
+	}
+
+	fingerprints := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fingerprints = append(fingerprints, line)
+	}
+
+	return fingerprints, nil
+}
+
+// ErrMultipleStatements is returned when a query passed to Analyze holds
+// more than one statement
+var ErrMultipleStatements = errors.New("query contains more than one statement")
+
+// SyntaxError is returned when a query fails to parse, locating where the
+// parser gave up
+type SyntaxError struct {
+	Message  string
+	Position int    // 1-based character offset into the query, 0 when unknown
+	Line     int    // 1-based line of Position
+	Near     string // token the parser gave up at, empty at the end of the input
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Message
+}
+
+// newSyntaxError locates a pg_query parse error in its query, returning any
+// other error unchanged
+func newSyntaxError(query string, err error) error {
+	var parseErr *parser.Error
+	if !errors.As(err, &parseErr) {
+		return err
+	}
+
+	syntaxErr := &SyntaxError{Message: parseErr.Message, Position: parseErr.Cursorpos, Line: 1}
+	if _, near, found := strings.Cut(parseErr.Message, `at or near "`); found {
+		syntaxErr.Near = strings.TrimSuffix(near, `"`)
+	}
+
+	// The position counts characters, not bytes
+	offset := 0
+	for _, r := range query {
+		if offset++; offset >= syntaxErr.Position {
+			break
+		}
+		if r == '\n' {
+			syntaxErr.Line++
+		}
+	}
+
+	return syntaxErr
+}
+
+// Analyze takes a single SQL statement as input and returns a comprehensive analysis
 func (qa *QueryAnalyzer) Analyze(query string) (*models.QueryAnalysis, error) {
-	// Create cache key
-	cacheKey := qa.generateCacheKey(query)
+	return qa.AnalyzeContext(context.Background(), query)
+}
 
-	// Check cache
-	if cached, exists := qa.cache[cacheKey]; exists {
-		return cached, nil
+// AnalyzeScript analyzes every statement of a SQL script separately,
+// returning one analysis per statement in script order
+func (qa *QueryAnalyzer) AnalyzeScript(sql string) ([]*models.QueryAnalysis, error) {
+	parseResult, err := pg_query.Parse(sql)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse script: %w", err)
 	}
 
-	analysis := models.NewQueryAnalysis(query)
+	analyses := make([]*models.QueryAnalysis, 0, len(parseResult.Stmts))
+	for i, stmt := range parseResult.Stmts {
+		// Locations are byte offsets, and a length of 0 runs to the end of the script
+		end := len(sql)
+		if stmt.StmtLen > 0 {
+			end = int(stmt.StmtLocation + stmt.StmtLen)
+		}
+
+		analysis, err := qa.Analyze(strings.TrimSpace(sql[stmt.StmtLocation:end]))
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		analyses = append(analyses, analysis)
+	}
+
+	return analyses, nil
+}
 
+// AnalyzeContext is Analyze with a context, which parents the trace span of
+// parsing the query
+func (qa *QueryAnalyzer) AnalyzeContext(ctx context.Context, query string) (*models.QueryAnalysis, error) {
 	// Parse the SQL query
+	_, span := otel.Tracer("github.com/zvdy/pgao/src/analyzer").Start(ctx, "pg_query.Parse")
 	parseResult, err := pg_query.Parse(query)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse query: %w", err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, fmt.Errorf("failed to parse query: %w", newSyntaxError(query, err))
+	}
+	span.End()
+
+	if len(parseResult.Stmts) > 1 {
+		return nil, fmt.Errorf("%w: found %d statements", ErrMultipleStatements, len(parseResult.Stmts))
+	}
+
+	fingerprint, err := pg_query.Fingerprint(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint query: %w", err)
+	}
+
+	// Queries differing only in literals, parameters and formatting share a
+	// fingerprint, and so the cached analysis of their shape. The checks
+	// reading literals or quoting the query run for each query.
+	shape, cached := qa.cache.Get(fingerprint)
+	if !cached {
+		shape = qa.analyzeShape(parseResult.Stmts, fingerprint)
+		qa.cache.Put(fingerprint, shape)
 	}
 
+	analysis := *shape
+	analysis.Query = query
+	analysis.Warnings = slices.Clone(shape.Warnings)
+	analysis.Suggestions = slices.Clone(shape.Suggestions)
+	analysis.Timestamp = time.Now()
+
 	// Get normalized query
-	normalized, err := pg_query.Normalize(query)
-	if err == nil {
+	if normalized, err := pg_query.Normalize(query); err == nil {
 		analysis.Normalized = normalized
 	}
 
-	// Analyze the parse tree
-	if len(parseResult.Stmts) > 0 {
-		qa.analyzeStatements(parseResult.Stmts, analysis)
+	qa.checkLiterals(query, parseResult.Stmts, &analysis)
+
+	// Suppress findings for baselined query shapes
+	qa.baselineMu.RLock()
+	baselined := qa.baseline[fingerprint]
+	qa.baselineMu.RUnlock()
+	if baselined {
+		analysis.Baselined = true
+		analysis.Warnings = make([]string, 0)
+		analysis.Suggestions = make([]models.QuerySuggestion, 0)
 	}
 
-	// Fingerprint the query
-	fingerprint, err := pg_query.Fingerprint(query)
-	if err == nil {
-		analysis.ParsedTree = map[string]interface{}{
-			"fingerprint": fingerprint,
-		}
+	return &analysis, nil
+}
+
+// analyzeShape analyzes what a query's fingerprint determines: its statement
+// type, tables, joins, filtered columns and complexity, and the suggestions
+// following from them
+func (qa *QueryAnalyzer) analyzeShape(stmts []*pg_query.RawStmt, fingerprint string) *models.QueryAnalysis {
+	analysis := models.NewQueryAnalysis("")
+	analysis.ParsedTree = map[string]interface{}{
+		"fingerprint": fingerprint,
 	}
 
+	// Analyze the parse tree
+	qa.analyzeStatements(stmts, analysis)
+
+	// Collect the columns filtered and joined on, for index suggestions
+	indexes := qa.collectPredicateColumns(stmts, analysis)
+
 	// Determine complexity
 	qa.calculateComplexity(analysis)
 
 	// Generate optimization suggestions
-	qa.generateSuggestions(analysis)
+	qa.generateSuggestions(analysis, indexes)
+
+	return analysis
+}
+
+// checkLiterals runs the checks whose findings depend on a query's literal
+// values, parameters or text, which queries sharing a fingerprint may not share
+func (qa *QueryAnalyzer) checkLiterals(query string, stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	// Check bind parameter usage
+	qa.checkParameterLimits(stmts, analysis)
+
+	// Check for count(*) used as an existence test
+	qa.checkCountExistence(stmts, analysis)
+
+	// Check for NOT IN, which mishandles NULLs
+	qa.checkNotIn(query, stmts, analysis)
+
+	// Check for constant, repeated and contradictory WHERE conditions
+	qa.checkPredicates(stmts, analysis)
+
+	// Check for LIKE patterns starting with a wildcard, which can't use btree indexes
+	qa.checkLeadingWildcards(stmts, analysis)
 
-	// Cache the result
-	qa.cache[cacheKey] = analysis
+	// Check for functions applied to columns in comparisons, which can't use plain indexes
+	qa.checkWrappedColumns(stmts, analysis)
 
-	return analysis, nil
+	// Check for OR conditions spread over many columns
+	qa.checkOrChains(stmts, analysis)
+
+	// Check for casts and literals that don't match the compared column's type
+	qa.checkTypeMismatches(stmts, analysis)
 }
 
 // analyzeStatements processes parsed statements
@@ -93,6 +291,9 @@ func (qa *QueryAnalyzer) analyzeStatements(stmts []*pg_query.RawStmt, analysis *
 		case *pg_query.Node_DeleteStmt:
 			analysis.QueryType = "DELETE"
 			qa.analyzeDeleteStmt(node.DeleteStmt, analysis)
+		case *pg_query.Node_AlterTableStmt:
+			analysis.QueryType = "ALTER"
+			qa.analyzeAlterTableStmt(node.AlterTableStmt, analysis)
 		default:
 			analysis.QueryType = "OTHER"
 		}
@@ -104,6 +305,18 @@ func (qa *QueryAnalyzer) analyzeSelectStmt(stmt *pg_query.SelectStmt, analysis *
 	// Check for JOINs
 	if len(stmt.FromClause) > 0 {
 		qa.analyzeFromClause(stmt.FromClause, analysis)
+		qa.checkCartesianProduct(stmt, analysis)
+
+		// Tables listed with commas are joined as well
+		analysis.JoinCount += len(stmt.FromClause) - 1
+
+		// Common table expressions are referenced like tables but aren't any
+		if stmt.WithClause != nil {
+			for _, cte := range stmt.WithClause.Ctes {
+				name := cte.GetCommonTableExpr().GetCtename()
+				analysis.Tables = slices.DeleteFunc(analysis.Tables, func(table string) bool { return table == name })
+			}
+		}
 	}
 
 	// Check for subqueries
@@ -127,7 +340,8 @@ func (qa *QueryAnalyzer) analyzeSelectStmt(stmt *pg_query.SelectStmt, analysis *
 	}
 }
 
-// analyzeFromClause analyzes FROM clause for tables and joins
+// analyzeFromClause analyzes FROM clause for tables and joins, recursing
+// into nested joins. A table joined more than once is listed once.
 func (qa *QueryAnalyzer) analyzeFromClause(fromClause []*pg_query.Node, analysis *models.QueryAnalysis) {
 	for _, node := range fromClause {
 		if node == nil {
@@ -136,11 +350,12 @@ func (qa *QueryAnalyzer) analyzeFromClause(fromClause []*pg_query.Node, analysis
 
 		switch from := node.Node.(type) {
 		case *pg_query.Node_RangeVar:
-			if from.RangeVar != nil && from.RangeVar.Relname != "" {
+			if from.RangeVar != nil && from.RangeVar.Relname != "" && !slices.Contains(analysis.Tables, from.RangeVar.Relname) {
 				analysis.Tables = append(analysis.Tables, from.RangeVar.Relname)
 			}
 		case *pg_query.Node_JoinExpr:
 			analysis.HasJoin = true
+			analysis.JoinCount++
 			if from.JoinExpr != nil {
 				qa.analyzeJoinExpr(from.JoinExpr, analysis)
 			}
@@ -202,6 +417,520 @@ func (qa *QueryAnalyzer) analyzeDeleteStmt(stmt *pg_query.DeleteStmt, analysis *
 	}
 }
 
+// volatileFunctions are common volatile functions; a column default calling
+// one is evaluated per row, forcing a table rewrite
+var volatileFunctions = map[string]bool{
+	"random":              true,
+	"gen_random_uuid":     true,
+	"uuid_generate_v1":    true,
+	"uuid_generate_v4":    true,
+	"clock_timestamp":     true,
+	"timeofday":           true,
+	"nextval":             true,
+	"statement_timestamp": true,
+}
+
+// serialTypes are the pseudo-types that add a sequence-backed default
+var serialTypes = map[string]bool{
+	"serial": true, "serial4": true, "bigserial": true, "serial8": true, "smallserial": true, "serial2": true,
+}
+
+// analyzeAlterTableStmt warns about ALTER TABLE commands that rewrite the
+// table under an ACCESS EXCLUSIVE lock
+func (qa *QueryAnalyzer) analyzeAlterTableStmt(stmt *pg_query.AlterTableStmt, analysis *models.QueryAnalysis) {
+	table := ""
+	if stmt.Relation != nil && stmt.Relation.Relname != "" {
+		table = stmt.Relation.Relname
+		analysis.Tables = append(analysis.Tables, table)
+	}
+
+	rewrites := false
+
+	for _, node := range stmt.Cmds {
+		cmd := node.GetAlterTableCmd()
+		if cmd == nil {
+			continue
+		}
+
+		switch cmd.Subtype {
+		case pg_query.AlterTableType_AT_AddColumn:
+			col := cmd.Def.GetColumnDef()
+			if col == nil {
+				continue
+			}
+
+			if reason := columnRewriteReason(col); reason != "" {
+				analysis.AddWarning(fmt.Sprintf("Adding column %s to %s %s - this rewrites the whole table while holding an ACCESS EXCLUSIVE lock", col.Colname, table, reason))
+				rewrites = true
+			} else if columnNotNull(col) && columnDefault(col) == nil {
+				analysis.AddWarning(fmt.Sprintf("Adding NOT NULL column %s to %s without a DEFAULT fails if the table has any rows", col.Colname, table))
+			}
+		case pg_query.AlterTableType_AT_AlterColumnType:
+			analysis.AddWarning(fmt.Sprintf("Changing the type of column %s on %s rewrites the table and its indexes under an ACCESS EXCLUSIVE lock unless the new type is binary coercible (e.g. widening varchar)", cmd.Name, table))
+			rewrites = true
+		}
+	}
+
+	if rewrites {
+		analysis.Suggestions = append(analysis.Suggestions, models.QuerySuggestion{
+			Type:        "ddl",
+			Severity:    "high",
+			Message:     "Add the column with a constant default or none, backfill it in batches, then add the constraint or default",
+			Impact:      "Table rewrites block all reads and writes for their whole duration",
+			Confidence:  0.85,
+			Recommended: "ALTER TABLE t ADD COLUMN c uuid; UPDATE t SET c = gen_random_uuid() WHERE id BETWEEN ... ; ALTER TABLE t ALTER COLUMN c SET DEFAULT gen_random_uuid()",
+		})
+	}
+}
+
+// columnRewriteReason explains why adding a column forces a table rewrite, or returns ""
+func columnRewriteReason(col *pg_query.ColumnDef) string {
+	if col.TypeName != nil && len(col.TypeName.Names) > 0 {
+		typeName := col.TypeName.Names[len(col.TypeName.Names)-1].GetString_().GetSval()
+		if serialTypes[typeName] {
+			return fmt.Sprintf("as %s fills every row from a sequence", typeName)
+		}
+	}
+
+	for _, node := range col.Constraints {
+		switch node.GetConstraint().GetContype() {
+		case pg_query.ConstrType_CONSTR_IDENTITY:
+			return "as an identity column fills every row from a sequence"
+		case pg_query.ConstrType_CONSTR_GENERATED:
+			return "as a stored generated column computes every row"
+		}
+	}
+
+	if def := columnDefault(col); def != nil {
+		volatile := ""
+		walkTree(def.ProtoReflect(), func(msg protoreflect.Message) {
+			if fn, ok := msg.Interface().(*pg_query.FuncCall); ok && len(fn.Funcname) > 0 {
+				name := fn.Funcname[len(fn.Funcname)-1].GetString_().GetSval()
+				if volatileFunctions[name] && volatile == "" {
+					volatile = name
+				}
+			}
+		})
+		if volatile != "" {
+			return fmt.Sprintf("with a volatile default %s()", volatile)
+		}
+	}
+
+	return ""
+}
+
+// columnDefault returns the DEFAULT expression of a column definition
+func columnDefault(col *pg_query.ColumnDef) *pg_query.Node {
+	if col.RawDefault != nil {
+		return col.RawDefault
+	}
+	for _, node := range col.Constraints {
+		if c := node.GetConstraint(); c != nil && c.Contype == pg_query.ConstrType_CONSTR_DEFAULT {
+			return c.RawExpr
+		}
+	}
+	return nil
+}
+
+// columnNotNull reports whether a column definition is declared NOT NULL
+func columnNotNull(col *pg_query.ColumnDef) bool {
+	if col.IsNotNull {
+		return true
+	}
+	for _, node := range col.Constraints {
+		if node.GetConstraint().GetContype() == pg_query.ConstrType_CONSTR_NOTNULL {
+			return true
+		}
+	}
+	return false
+}
+
+// checkParameterLimits warns when a query approaches the bind parameter limit
+func (qa *QueryAnalyzer) checkParameterLimits(stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	maxParam := 0
+	valuesItems := 0
+
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			switch node := msg.Interface().(type) {
+			case *pg_query.ParamRef:
+				if int(node.Number) > maxParam {
+					maxParam = int(node.Number)
+				}
+			case *pg_query.SelectStmt:
+				for _, list := range node.ValuesLists {
+					if l, ok := list.Node.(*pg_query.Node_List); ok && l.List != nil {
+						valuesItems += len(l.List.Items)
+					}
+				}
+			}
+		})
+	}
+
+	analysis.ParameterCount = maxParam
+
+	warnAt := int(maxBindParameters * bindParameterWarnRatio)
+
+	switch {
+	case maxParam > maxBindParameters:
+		analysis.AddWarning(fmt.Sprintf("Query uses %d bind parameters, exceeding the PostgreSQL limit of %d", maxParam, maxBindParameters))
+	case maxParam >= warnAt:
+		analysis.AddWarning(fmt.Sprintf("Query uses %d bind parameters, approaching the PostgreSQL limit of %d", maxParam, maxBindParameters))
+	case maxParam == 0 && valuesItems >= warnAt:
+		analysis.AddWarning(fmt.Sprintf("VALUES lists contain %d items - a parameterized version of this query would hit the %d bind parameter limit", valuesItems, maxBindParameters))
+		analysis.ParameterCount = valuesItems
+	}
+
+	// Suggest batching for queries near the bind parameter limit
+	if analysis.ParameterCount >= warnAt {
+		analysis.Suggestions = append(analysis.Suggestions, models.QuerySuggestion{
+			Type:        "parameters",
+			Severity:    "high",
+			Message:     "Split the statement into smaller batches or pass arrays with unnest() instead of one parameter per value",
+			Impact:      "Statements over 65535 bind parameters fail at execution time",
+			Confidence:  0.95,
+			Recommended: "INSERT INTO t (a, b) SELECT * FROM unnest($1::int[], $2::text[])",
+		})
+	}
+}
+
+// checkCountExistence suggests EXISTS where count() is only compared against zero
+func (qa *QueryAnalyzer) checkCountExistence(stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	found := false
+
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			sel, ok := msg.Interface().(*pg_query.SelectStmt)
+			if !ok {
+				return
+			}
+
+			// HAVING count(...) = 0 over groups is a legitimate filter, so only
+			// the target list and WHERE clause are checked
+			clauses := append([]*pg_query.Node{sel.WhereClause}, sel.TargetList...)
+			for _, clause := range clauses {
+				if clause == nil {
+					continue
+				}
+				walkTree(clause.ProtoReflect(), func(msg protoreflect.Message) {
+					if expr, ok := msg.Interface().(*pg_query.A_Expr); ok && isCountExistenceCheck(expr) {
+						found = true
+					}
+				})
+			}
+		})
+	}
+
+	if !found {
+		return
+	}
+
+	analysis.AddWarning("count() is only used to test whether rows exist - it still counts every matching row")
+	analysis.Suggestions = append(analysis.Suggestions, models.QuerySuggestion{
+		Type:        "existence",
+		Severity:    "medium",
+		Message:     "Use EXISTS instead of comparing count() with 0 or 1",
+		Impact:      "EXISTS stops at the first matching row instead of scanning all of them",
+		Confidence:  0.85,
+		Recommended: "SELECT EXISTS (SELECT 1 FROM t WHERE ...)",
+	})
+}
+
+// isCountExistenceCheck reports whether an expression compares count() with 0 or 1 in a way that only tests for existence
+func isCountExistenceCheck(expr *pg_query.A_Expr) bool {
+	if expr.Kind != pg_query.A_Expr_Kind_AEXPR_OP || len(expr.Name) != 1 {
+		return false
+	}
+
+	op := expr.Name[0].GetString_().GetSval()
+	constant, countSide := expr.Rexpr, expr.Lexpr
+	if isCountExpr(expr.Rexpr) {
+		// Rewrite "0 < count(*)" as "count(*) > 0"
+		constant, countSide = expr.Lexpr, expr.Rexpr
+		op = map[string]string{"<": ">", ">": "<", "<=": ">=", ">=": "<=", "=": "=", "<>": "<>"}[op]
+	}
+
+	if !isCountExpr(countSide) {
+		return false
+	}
+
+	value, ok := integerConst(constant)
+	if !ok {
+		return false
+	}
+
+	switch value {
+	case 0:
+		return op == ">" || op == "<>" || op == "="
+	case 1:
+		return op == ">=" || op == "<"
+	default:
+		return false
+	}
+}
+
+// isCountExpr reports whether a node is an ungrouped count() call or a scalar subquery selecting one
+func isCountExpr(node *pg_query.Node) bool {
+	if node == nil {
+		return false
+	}
+
+	if sublink := node.GetSubLink(); sublink != nil {
+		if sublink.SubLinkType != pg_query.SubLinkType_EXPR_SUBLINK {
+			return false
+		}
+		sel := sublink.Subselect.GetSelectStmt()
+		if sel == nil || len(sel.GroupClause) > 0 || len(sel.TargetList) != 1 {
+			return false
+		}
+		return isCountExpr(sel.TargetList[0].GetResTarget().GetVal())
+	}
+
+	fn := node.GetFuncCall()
+	if fn == nil || fn.Over != nil || len(fn.Funcname) == 0 {
+		return false
+	}
+
+	return fn.Funcname[len(fn.Funcname)-1].GetString_().GetSval() == "count"
+}
+
+// integerConst returns the value of an integer constant node
+func integerConst(node *pg_query.Node) (int32, bool) {
+	constant := node.GetAConst()
+	if constant == nil || constant.Isnull {
+		return 0, false
+	}
+
+	ival, ok := constant.Val.(*pg_query.A_Const_Ival)
+	if !ok {
+		return 0, false
+	}
+
+	return ival.Ival.GetIval(), true
+}
+
+// checkNotIn flags NOT IN, which never matches once a NULL is involved. With a
+// subquery it is also planned as a subplan instead of an anti-join, so a NOT
+// EXISTS rewrite is suggested, including the rewritten query when it is safe.
+func (qa *QueryAnalyzer) checkNotIn(query string, stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	subqueries, lists := 0, 0
+
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			switch node := msg.Interface().(type) {
+			case *pg_query.BoolExpr:
+				if notInSubLink(node) != nil {
+					subqueries++
+				}
+			case *pg_query.A_Expr:
+				if node.Kind == pg_query.A_Expr_Kind_AEXPR_IN && len(node.Name) == 1 && node.Name[0].GetString_().GetSval() == "<>" {
+					lists++
+				}
+			}
+		})
+	}
+
+	if lists > 0 {
+		analysis.AddWarning("NOT IN with a value list matches no rows if the list contains NULL, and never matches rows where the tested value is NULL")
+	}
+	if subqueries == 0 {
+		return
+	}
+
+	analysis.AddWarning("NOT IN (SELECT ...) returns no rows at all once the subquery yields a NULL, and can't be planned as an anti-join")
+	suggestion := models.QuerySuggestion{
+		Type:       "not_in",
+		Severity:   "high",
+		Message:    "Rewrite NOT IN (SELECT ...) as NOT EXISTS. NOT EXISTS ignores NULLs returned by the subquery, so it returns rows where NOT IN returned none - make sure that is the intended result",
+		Impact:     "NOT EXISTS is planned as an anti-join, while NOT IN re-scans the subquery per row when its result doesn't fit in work_mem",
+		Confidence: 0.9,
+	}
+	if rewritten, ok := rewriteNotIn(query, subqueries); ok {
+		suggestion.Recommended = rewritten
+	}
+	analysis.Suggestions = append(analysis.Suggestions, suggestion)
+}
+
+// notInSubLink returns the subquery of a "x NOT IN (SELECT ...)" expression
+func notInSubLink(expr *pg_query.BoolExpr) *pg_query.SubLink {
+	if expr == nil || expr.Boolop != pg_query.BoolExprType_NOT_EXPR || len(expr.Args) != 1 {
+		return nil
+	}
+
+	sublink := expr.Args[0].GetSubLink()
+	if sublink == nil || sublink.SubLinkType != pg_query.SubLinkType_ANY_SUBLINK || len(sublink.OperName) > 0 {
+		return nil
+	}
+
+	return sublink
+}
+
+// rewriteNotIn returns the query with every NOT IN subquery turned into NOT
+// EXISTS. It only succeeds when all expected subqueries are top-level WHERE
+// conditions comparing plain columns of single tables, so the correlation
+// condition can be qualified without changing which columns it refers to.
+func rewriteNotIn(query string, expected int) (string, bool) {
+	tree, err := pg_query.Parse(query)
+	if err != nil {
+		return "", false
+	}
+
+	rewritten := 0
+	for _, stmt := range tree.Stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			sel, ok := msg.Interface().(*pg_query.SelectStmt)
+			if !ok {
+				return
+			}
+			for _, condition := range whereConjuncts(sel.WhereClause) {
+				if sublink := notInSubLink(condition.GetBoolExpr()); sublink != nil && rewriteNotInSubLink(sel, sublink) {
+					rewritten++
+				}
+			}
+		})
+	}
+
+	if rewritten != expected {
+		return "", false
+	}
+
+	output, err := pg_query.Deparse(tree)
+	if err != nil {
+		return "", false
+	}
+
+	return output, true
+}
+
+// rewriteNotInSubLink turns the subquery of a NOT IN condition of outer into
+// an EXISTS subquery correlated on the compared columns, reporting whether it could
+func rewriteNotInSubLink(outer *pg_query.SelectStmt, sublink *pg_query.SubLink) bool {
+	sub := sublink.Subselect.GetSelectStmt()
+	if sub == nil || sub.Op != pg_query.SetOperation_SETOP_NONE || sub.WithClause != nil ||
+		len(sub.TargetList) != 1 || len(sub.GroupClause) > 0 || sub.HavingClause != nil ||
+		len(sub.DistinctClause) > 0 || sub.LimitCount != nil || sub.LimitOffset != nil {
+		return false
+	}
+
+	subRelation := singleRelationName(sub.FromClause)
+	subColumn := qualifiedColumn(sub.TargetList[0].GetResTarget().GetVal(), subRelation)
+	outerColumn := qualifiedColumn(sublink.Testexpr, singleRelationName(outer.FromClause))
+	if subRelation == "" || subColumn == nil || outerColumn == nil {
+		return false
+	}
+
+	// The subquery's table would shadow an outer reference with the same name
+	if outerColumn.GetColumnRef().Fields[0].GetString_().GetSval() == subRelation {
+		return false
+	}
+
+	correlation := pg_query.MakeAExprNode(pg_query.A_Expr_Kind_AEXPR_OP, []*pg_query.Node{pg_query.MakeStrNode("=")}, subColumn, outerColumn, -1)
+	if sub.WhereClause == nil {
+		sub.WhereClause = correlation
+	} else {
+		sub.WhereClause = pg_query.MakeBoolExprNode(pg_query.BoolExprType_AND_EXPR, []*pg_query.Node{sub.WhereClause, correlation}, -1)
+	}
+	sub.TargetList = []*pg_query.Node{pg_query.MakeResTargetNodeWithVal(pg_query.MakeAConstIntNode(1, -1), -1)}
+
+	sublink.SubLinkType = pg_query.SubLinkType_EXISTS_SUBLINK
+	sublink.Testexpr = nil
+
+	return true
+}
+
+// whereConjuncts splits a WHERE clause into the conditions joined by AND
+func whereConjuncts(node *pg_query.Node) []*pg_query.Node {
+	if node == nil {
+		return nil
+	}
+
+	expr := node.GetBoolExpr()
+	if expr == nil || expr.Boolop != pg_query.BoolExprType_AND_EXPR {
+		return []*pg_query.Node{node}
+	}
+
+	conjuncts := make([]*pg_query.Node, 0, len(expr.Args))
+	for _, arg := range expr.Args {
+		conjuncts = append(conjuncts, whereConjuncts(arg)...)
+	}
+	return conjuncts
+}
+
+// singleRelationName returns the alias or name of the only table in a FROM
+// clause, or "" when it holds anything else
+func singleRelationName(fromClause []*pg_query.Node) string {
+	if len(fromClause) != 1 {
+		return ""
+	}
+
+	rangeVar := fromClause[0].GetRangeVar()
+	if rangeVar == nil {
+		return ""
+	}
+	if rangeVar.Alias != nil && rangeVar.Alias.Aliasname != "" {
+		return rangeVar.Alias.Aliasname
+	}
+	return rangeVar.Relname
+}
+
+// qualifiedColumn returns a column reference qualified by its table, adding
+// relation as the qualifier when it has none. It returns nil for anything but
+// a plain column, or an unqualified column without a relation to qualify it by.
+func qualifiedColumn(node *pg_query.Node, relation string) *pg_query.Node {
+	ref := node.GetColumnRef()
+	if ref == nil || len(ref.Fields) == 0 || ref.Fields[len(ref.Fields)-1].GetString_() == nil {
+		return nil
+	}
+	if len(ref.Fields) > 1 {
+		return node
+	}
+	if relation == "" {
+		return nil
+	}
+
+	return pg_query.MakeColumnRefNode([]*pg_query.Node{pg_query.MakeStrNode(relation), ref.Fields[0]}, ref.Location)
+}
+
+// walkTree visits every message in a parse tree depth first
+func walkTree(msg protoreflect.Message, visit func(protoreflect.Message)) {
+	if !msg.IsValid() {
+		return
+	}
+
+	visit(msg)
+
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			// Parse trees don't use maps
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				walkTree(list.Get(i).Message(), visit)
+			}
+		case fd.Message() != nil:
+			walkTree(v.Message(), visit)
+		}
+		return true
+	})
+}
+
 // hasSelectAll checks if the query uses SELECT *
 func (qa *QueryAnalyzer) hasSelectAll(stmt *pg_query.SelectStmt) bool {
 	if len(stmt.TargetList) == 0 {
@@ -233,8 +962,8 @@ func (qa *QueryAnalyzer) hasSelectAll(stmt *pg_query.SelectStmt) bool {
 func (qa *QueryAnalyzer) calculateComplexity(analysis *models.QueryAnalysis) {
 	score := 0
 
-	if analysis.HasJoin {
-		score += 2
+	if analysis.JoinCount > 0 {
+		score += 1 + analysis.JoinCount
 	}
 	if analysis.HasSubquery {
 		score += 3
@@ -260,9 +989,21 @@ func (qa *QueryAnalyzer) calculateComplexity(analysis *models.QueryAnalysis) {
 }
 
 // generateSuggestions generates optimization suggestions
-func (qa *QueryAnalyzer) generateSuggestions(analysis *models.QueryAnalysis) {
-	// Suggest indexes for tables
-	if len(analysis.Tables) > 0 && !analysis.HasJoin {
+func (qa *QueryAnalyzer) generateSuggestions(analysis *models.QueryAnalysis, indexes []tableIndex) {
+	// Suggest an index per table on the columns the query filters and joins
+	// it on, or indexes in general when it names none
+	if len(indexes) > 0 && analysis.QueryType != "ALTER" {
+		for _, index := range indexes {
+			analysis.Suggestions = append(analysis.Suggestions, models.QuerySuggestion{
+				Type:        "index",
+				Severity:    "info",
+				Message:     fmt.Sprintf("Consider indexing the columns the query filters or joins %s on, unless an index already covers them", index.table),
+				Impact:      "Can significantly improve query performance",
+				Confidence:  0.7,
+				Recommended: index.statement(),
+			})
+		}
+	} else if len(analysis.Tables) > 0 && !analysis.HasJoin && analysis.QueryType != "ALTER" {
 		analysis.AddSuggestion(
 			"index",
 			"info",
@@ -316,10 +1057,3 @@ func (qa *QueryAnalyzer) generateSuggestions(analysis *models.QueryAnalysis) {
 		)
 	}
 }
-
-// generateCacheKey generates a cache key for the query
-func (qa *QueryAnalyzer) generateCacheKey(query string) string {
-	normalized := strings.TrimSpace(strings.ToLower(query))
-	hash := md5.Sum([]byte(normalized))
-	return hex.EncodeToString(hash[:])
-}
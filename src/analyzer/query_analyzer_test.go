@@ -0,0 +1,404 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestAnalyzeScript(t *testing.T) {
+	qa := NewQueryAnalyzer()
+
+	analyses, err := qa.AnalyzeScript("INSERT INTO orders (id) VALUES (1); SELECT name FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analyses) != 2 {
+		t.Fatalf("got %d analyses, want 2", len(analyses))
+	}
+
+	for i, want := range []struct{ queryType, table string }{{"INSERT", "orders"}, {"SELECT", "users"}} {
+		if analyses[i].QueryType != want.queryType {
+			t.Errorf("statement %d type = %s, want %s", i, analyses[i].QueryType, want.queryType)
+		}
+		if len(analyses[i].Tables) != 1 || analyses[i].Tables[0] != want.table {
+			t.Errorf("statement %d tables = %v, want [%s]", i, analyses[i].Tables, want.table)
+		}
+	}
+}
+
+func TestAnalyzeRejectsMultipleStatements(t *testing.T) {
+	_, err := NewQueryAnalyzer().Analyze("SELECT 1; SELECT 2")
+	if !errors.Is(err, ErrMultipleStatements) {
+		t.Errorf("Analyze() = %v, want ErrMultipleStatements", err)
+	}
+}
+
+func TestAnalyzeSyntaxErrorPosition(t *testing.T) {
+	query := "SELECT id\nFROM users WHERE id = = 1"
+
+	_, err := NewQueryAnalyzer().Analyze(query)
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Analyze() = %v, want a *SyntaxError", err)
+	}
+
+	// The second = is the offending token
+	want := strings.LastIndex(query, "=") + 1
+	if syntaxErr.Position != want || syntaxErr.Line != 2 || syntaxErr.Near != "=" {
+		t.Errorf("error at position %d, line %d, near %q, want position %d, line 2, near \"=\"",
+			syntaxErr.Position, syntaxErr.Line, syntaxErr.Near, want)
+	}
+}
+
+func TestAnalyzeConcurrently(t *testing.T) {
+	qa := NewQueryAnalyzerWithCacheSize(2)
+	queries := []string{
+		"SELECT * FROM users WHERE id = 1",
+		"SELECT name FROM orders WHERE status = 'open'",
+		"UPDATE accounts SET balance = 0",
+		"DELETE FROM sessions WHERE expires_at < now()",
+	}
+	wantTypes := []string{"SELECT", "SELECT", "UPDATE", "DELETE"}
+
+	// The small cache keeps evicting shapes while a baseline is added, so the
+	// cache and the baseline are both read and written from every goroutine
+	var wg sync.WaitGroup
+	for g := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 50 {
+				n := (g + i) % len(queries)
+				analysis, err := qa.Analyze(queries[n])
+				if err != nil {
+					t.Errorf("Analyze(%q) = %v", queries[n], err)
+					return
+				}
+				if analysis.QueryType != wantTypes[n] || analysis.Query != queries[n] {
+					t.Errorf("Analyze(%q) returned a %s analysis of %q", queries[n], analysis.QueryType, analysis.Query)
+				}
+				if i == 25 {
+					fingerprint, _ := pg_query.Fingerprint(queries[n])
+					qa.AddBaselineFingerprints(fingerprint)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBaselineSuppressesFindings(t *testing.T) {
+	qa := NewQueryAnalyzer()
+	baselined := "SELECT * FROM users WHERE id = 1"
+
+	analysis, err := qa.Analyze(baselined)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Baselined || !hasWarning(analysis, "SELECT *") {
+		t.Fatalf("analysis before baselining: baselined %v, warnings %q", analysis.Baselined, analysis.Warnings)
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline")
+	fingerprint, _ := pg_query.Fingerprint(baselined)
+	if err := os.WriteFile(path, []byte("# reviewed\n\n"+fingerprint+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fingerprints, err := LoadBaselineFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(fingerprints, []string{fingerprint}) {
+		t.Fatalf("LoadBaselineFile() = %q, want [%s]", fingerprints, fingerprint)
+	}
+	qa.AddBaselineFingerprints(fingerprints...)
+
+	// The fingerprint covers the query shape, so other literals are baselined too
+	analysis, err = qa.Analyze("SELECT * FROM users WHERE id = 42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !analysis.Baselined || len(analysis.Warnings) != 0 || len(analysis.Suggestions) != 0 {
+		t.Errorf("baselined analysis: baselined %v, warnings %q, %d suggestions", analysis.Baselined, analysis.Warnings, len(analysis.Suggestions))
+	}
+
+	analysis, err = qa.Analyze("SELECT * FROM orders WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analysis.Baselined || !hasWarning(analysis, "SELECT *") {
+		t.Errorf("other query: baselined %v, warnings %q", analysis.Baselined, analysis.Warnings)
+	}
+}
+
+func TestIndexSuggestionsPerTable(t *testing.T) {
+	analysis, err := NewQueryAnalyzer().Analyze(`
+		SELECT o.id, c.name
+		FROM orders o
+		JOIN customers c ON o.customer_id = c.id
+		WHERE o.status = 'open' AND (c.region = 'eu' OR c.tier = 'gold')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantColumns := []string{"orders.customer_id", "customers.id", "orders.status", "customers.region", "customers.tier"}
+	if !slices.Equal(analysis.Columns, wantColumns) {
+		t.Errorf("columns = %v, want %v", analysis.Columns, wantColumns)
+	}
+
+	indexes := make([]string, 0)
+	for _, suggestion := range analysis.Suggestions {
+		if suggestion.Type == "index" {
+			indexes = append(indexes, suggestion.Recommended)
+		}
+	}
+	// customers.id is the primary key the join references
+	want := []string{"CREATE INDEX ON orders (customer_id, status)", "CREATE INDEX ON customers (region, tier)"}
+	if !slices.Equal(indexes, want) {
+		t.Errorf("index suggestions = %q, want %q", indexes, want)
+	}
+}
+
+// insertWithParams returns an INSERT whose VALUES rows use bind parameters $1 to $n
+func insertWithParams(n int) string {
+	rows := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		rows = append(rows, fmt.Sprintf("($%d)", i))
+	}
+	return "INSERT INTO events (id) VALUES " + strings.Join(rows, ", ")
+}
+
+func TestCheckParameterLimits(t *testing.T) {
+	literals := make([]string, 0, 52428)
+	for i := range 52428 {
+		literals = append(literals, fmt.Sprintf("(%d)", i))
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		params     int
+		warning    string
+		suggestion bool
+	}{
+		{"few parameters", insertWithParams(100), 100, "", false},
+		{"below the warning ratio", insertWithParams(52427), 52427, "", false},
+		{"near the limit", insertWithParams(52428), 52428, "approaching the PostgreSQL limit of 65535", true},
+		{"over the limit", insertWithParams(65536), 65536, "exceeding the PostgreSQL limit of 65535", true},
+		{"literal values", "INSERT INTO events (id) VALUES " + strings.Join(literals, ", "), 52428, "would hit the 65535 bind parameter limit", true},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := qa.Analyze(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if analysis.ParameterCount != tt.params {
+				t.Errorf("ParameterCount = %d, want %d", analysis.ParameterCount, tt.params)
+			}
+			if tt.warning == "" && hasWarning(analysis, "bind parameter") {
+				t.Errorf("unexpected warnings %q", analysis.Warnings)
+			}
+			if tt.warning != "" && !hasWarning(analysis, tt.warning) {
+				t.Errorf("warnings %q, want one containing %q", analysis.Warnings, tt.warning)
+			}
+			hasSuggestion := slices.ContainsFunc(analysis.Suggestions, func(s models.QuerySuggestion) bool { return s.Type == "parameters" })
+			if hasSuggestion != tt.suggestion {
+				t.Errorf("batching suggested = %v, want %v", hasSuggestion, tt.suggestion)
+			}
+		})
+	}
+}
+
+func TestCheckCountExistence(t *testing.T) {
+	tests := []struct {
+		query   string
+		flagged bool
+	}{
+		{"SELECT count(*) > 0 FROM orders WHERE customer_id = 1", true},
+		{"SELECT 0 < count(*) FROM orders WHERE customer_id = 1", true},
+		{"SELECT count(*) >= 1 FROM orders WHERE customer_id = 1", true},
+		{"SELECT id FROM customers c WHERE (SELECT count(*) FROM orders o WHERE o.customer_id = c.id) = 0", true},
+		{"SELECT count(*) FROM orders WHERE customer_id = 1", false},
+		{"SELECT count(*) > 5 FROM orders WHERE customer_id = 1", false},
+		{"SELECT customer_id FROM orders GROUP BY customer_id HAVING count(*) > 0", false},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		analysis, err := qa.Analyze(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if got := hasWarning(analysis, "only used to test whether rows exist"); got != tt.flagged {
+			t.Errorf("%q: count existence check flagged = %v, want %v (warnings %q)", tt.query, got, tt.flagged, analysis.Warnings)
+		}
+	}
+}
+
+func TestAnalyzeAlterTableRewrites(t *testing.T) {
+	tests := []struct {
+		query    string
+		warning  string
+		rewrites bool
+	}{
+		{"ALTER TABLE orders ADD COLUMN status text DEFAULT 'new'", "", false},
+		{"ALTER TABLE orders ADD COLUMN created_at timestamptz NOT NULL DEFAULT now()", "", false},
+		{"ALTER TABLE orders ADD COLUMN token uuid DEFAULT gen_random_uuid()", "volatile default gen_random_uuid()", true},
+		{"ALTER TABLE orders ADD COLUMN seq bigserial", "as bigserial fills every row", true},
+		{"ALTER TABLE orders ADD COLUMN note text NOT NULL", "without a DEFAULT fails", false},
+		{"ALTER TABLE orders ALTER COLUMN total TYPE numeric(12,2)", "Changing the type of column total on orders", true},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		analysis, err := qa.Analyze(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+
+		suggested := slices.ContainsFunc(analysis.Suggestions, func(s models.QuerySuggestion) bool { return s.Type == "ddl" })
+		if suggested != tt.rewrites {
+			t.Errorf("%q: rewrite suggestion = %v, want %v", tt.query, suggested, tt.rewrites)
+		}
+
+		if tt.warning == "" {
+			if len(analysis.Warnings) != 0 {
+				t.Errorf("%q: unexpected warnings %q", tt.query, analysis.Warnings)
+			}
+			continue
+		}
+		if !hasWarning(analysis, tt.warning) {
+			t.Errorf("%q: warnings %q, want one containing %q", tt.query, analysis.Warnings, tt.warning)
+		}
+	}
+}
+
+func TestCheckNotIn(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		warning     string
+		recommended string
+	}{
+		{
+			"subquery",
+			"SELECT id FROM customers WHERE id NOT IN (SELECT customer_id FROM orders WHERE status = 'open')",
+			"NOT IN (SELECT ...) returns no rows",
+			"SELECT id FROM customers WHERE NOT EXISTS (SELECT 1 FROM orders WHERE status = 'open' AND orders.customer_id = customers.id)",
+		},
+		{
+			"literal list",
+			"SELECT id FROM customers WHERE region NOT IN ('eu', 'us')",
+			"NOT IN with a value list",
+			"",
+		},
+		{
+			"IN subquery",
+			"SELECT id FROM customers WHERE id IN (SELECT customer_id FROM orders)",
+			"",
+			"",
+		},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := qa.Analyze(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.warning == "" && hasWarning(analysis, "NOT IN") {
+				t.Errorf("unexpected warnings %q", analysis.Warnings)
+			}
+			if tt.warning != "" && !hasWarning(analysis, tt.warning) {
+				t.Errorf("warnings %q, want one containing %q", analysis.Warnings, tt.warning)
+			}
+
+			// Only subqueries get a NOT EXISTS rewrite
+			index := slices.IndexFunc(analysis.Suggestions, func(s models.QuerySuggestion) bool { return s.Type == "not_in" })
+			if tt.recommended == "" {
+				if index >= 0 {
+					t.Errorf("unexpected suggestion %+v", analysis.Suggestions[index])
+				}
+				return
+			}
+			if index < 0 {
+				t.Fatal("no NOT EXISTS suggestion")
+			}
+			if got := analysis.Suggestions[index].Recommended; got != tt.recommended {
+				t.Errorf("recommended rewrite =\n%s\nwant\n%s", got, tt.recommended)
+			}
+		})
+	}
+}
+
+func TestNestedJoinTablesAndCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		tables []string
+		joins  int
+	}{
+		{
+			"five nested joins",
+			`SELECT o.id FROM orders o
+				JOIN (customers c JOIN (regions r JOIN countries co ON co.id = r.country_id) ON r.id = c.region_id) ON c.id = o.customer_id
+				LEFT JOIN shipments s ON s.order_id = o.id`,
+			[]string{"orders", "customers", "regions", "countries", "shipments"},
+			4,
+		},
+		{
+			"self join",
+			"SELECT e.name, m.name FROM employees e JOIN employees m ON m.id = e.manager_id",
+			[]string{"employees"},
+			1,
+		},
+		{
+			"comma join",
+			"SELECT 1 FROM orders o, customers c JOIN regions r ON r.id = c.region_id WHERE c.id = o.customer_id",
+			[]string{"orders", "customers", "regions"},
+			2,
+		},
+	}
+
+	qa := NewQueryAnalyzer()
+	complexity := make(map[string]int)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analysis, err := qa.Analyze(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tables := slices.Clone(analysis.Tables)
+			slices.Sort(tables)
+			want := slices.Clone(tt.tables)
+			slices.Sort(want)
+			if !slices.Equal(tables, want) {
+				t.Errorf("tables = %v, want %v", analysis.Tables, tt.tables)
+			}
+			if analysis.JoinCount != tt.joins {
+				t.Errorf("JoinCount = %d, want %d", analysis.JoinCount, tt.joins)
+			}
+			complexity[tt.name] = complexityRank[analysis.Complexity]
+		})
+	}
+
+	// Each join adds to the complexity
+	if complexity["five nested joins"] <= complexity["self join"] {
+		t.Errorf("five joins aren't rated more complex than one: %v", complexity)
+	}
+}
@@ -0,0 +1,81 @@
+package analyzer
+
+import (
+	"fmt"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// complexityRank orders complexity levels from simplest to most complex
+var complexityRank = map[string]int{
+	"simple":       0,
+	"moderate":     1,
+	"complex":      2,
+	"very_complex": 3,
+}
+
+// Diff analyzes two versions of a query and reports what changed between them
+func (qa *QueryAnalyzer) Diff(before, after string) (*models.QueryAnalysisDiff, error) {
+	beforeAnalysis, err := qa.Analyze(before)
+	if err != nil {
+		return nil, fmt.Errorf("before: %w", err)
+	}
+
+	afterAnalysis, err := qa.Analyze(after)
+	if err != nil {
+		return nil, fmt.Errorf("after: %w", err)
+	}
+
+	diff := &models.QueryAnalysisDiff{
+		Before:             beforeAnalysis,
+		After:              afterAnalysis,
+		TablesAdded:        difference(afterAnalysis.Tables, beforeAnalysis.Tables),
+		TablesRemoved:      difference(beforeAnalysis.Tables, afterAnalysis.Tables),
+		WarningsIntroduced: difference(afterAnalysis.Warnings, beforeAnalysis.Warnings),
+		WarningsResolved:   difference(beforeAnalysis.Warnings, afterAnalysis.Warnings),
+		JoinTypeBefore:     beforeAnalysis.JoinType,
+		JoinTypeAfter:      afterAnalysis.JoinType,
+		JoinChanged:        beforeAnalysis.HasJoin != afterAnalysis.HasJoin || beforeAnalysis.JoinType != afterAnalysis.JoinType,
+	}
+
+	switch rankBefore, rankAfter := complexityRank[beforeAnalysis.Complexity], complexityRank[afterAnalysis.Complexity]; {
+	case rankAfter < rankBefore:
+		diff.ComplexityChange = "improved"
+	case rankAfter > rankBefore:
+		diff.ComplexityChange = "worsened"
+	default:
+		diff.ComplexityChange = "unchanged"
+	}
+
+	beforeSuggestions := suggestionMessages(beforeAnalysis)
+	afterSuggestions := suggestionMessages(afterAnalysis)
+	diff.SuggestionsResolved = len(difference(beforeSuggestions, afterSuggestions))
+	diff.SuggestionsAdded = len(difference(afterSuggestions, beforeSuggestions))
+
+	return diff, nil
+}
+
+// suggestionMessages returns the messages of an analysis's suggestions
+func suggestionMessages(analysis *models.QueryAnalysis) []string {
+	messages := make([]string, 0, len(analysis.Suggestions))
+	for _, suggestion := range analysis.Suggestions {
+		messages = append(messages, suggestion.Message)
+	}
+	return messages
+}
+
+// difference returns the items of a that are not in b
+func difference(a, b []string) []string {
+	seen := make(map[string]bool, len(b))
+	for _, item := range b {
+		seen[item] = true
+	}
+
+	result := make([]string, 0)
+	for _, item := range a {
+		if !seen[item] {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffSelectStarToColumnList(t *testing.T) {
+	diff, err := NewQueryAnalyzer().Diff(
+		"SELECT * FROM orders WHERE customer_id = 1",
+		"SELECT id, total FROM orders WHERE customer_id = 1",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.WarningsResolved) != 1 || !strings.Contains(diff.WarningsResolved[0], "SELECT *") {
+		t.Errorf("warnings resolved = %q, want the SELECT * warning", diff.WarningsResolved)
+	}
+	if len(diff.WarningsIntroduced) != 0 {
+		t.Errorf("warnings introduced = %q, want none", diff.WarningsIntroduced)
+	}
+	if len(diff.TablesAdded) != 0 || len(diff.TablesRemoved) != 0 {
+		t.Errorf("tables added %v and removed %v, want none", diff.TablesAdded, diff.TablesRemoved)
+	}
+	if diff.JoinChanged {
+		t.Error("join reported as changed")
+	}
+
+	// Going the other way introduces the warning instead
+	diff, err = NewQueryAnalyzer().Diff(
+		"SELECT id, total FROM orders WHERE customer_id = 1",
+		"SELECT * FROM orders WHERE customer_id = 1",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.WarningsIntroduced) != 1 || len(diff.WarningsResolved) != 0 {
+		t.Errorf("warnings introduced %q and resolved %q, want the SELECT * warning introduced", diff.WarningsIntroduced, diff.WarningsResolved)
+	}
+}
+
+func TestDiffSyntaxErrorNamesTheVersion(t *testing.T) {
+	_, err := NewQueryAnalyzer().Diff("SELECT id FROM orders", "SELEC id FROM orders")
+	if err == nil || !strings.HasPrefix(err.Error(), "after: ") {
+		t.Errorf("Diff() = %v, want an error for the after query", err)
+	}
+}
@@ -0,0 +1,109 @@
+package analyzer
+
+import (
+	"fmt"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/zvdy/pgao/src/models"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// checkWrappedColumns flags comparisons that apply a function to a column,
+// as in lower(email) = $1 or date(created_at) = $1. A plain index on the
+// column can't serve them, only an index on the same expression.
+func (qa *QueryAnalyzer) checkWrappedColumns(stmts []*pg_query.RawStmt, analysis *models.QueryAnalysis) {
+	for _, stmt := range stmts {
+		if stmt.Stmt == nil {
+			continue
+		}
+
+		walkTree(stmt.Stmt.ProtoReflect(), func(msg protoreflect.Message) {
+			scope := statementScope(msg.Interface())
+			if scope == nil {
+				return
+			}
+
+			for _, condition := range scope.conditions {
+				walkCondition(condition, func(msg protoreflect.Message) {
+					expr, ok := msg.Interface().(*pg_query.A_Expr)
+					if !ok || !isComparison(expr) {
+						return
+					}
+
+					for _, side := range []*pg_query.Node{expr.Lexpr, expr.Rexpr} {
+						if call, column := wrappedColumn(side); call != nil {
+							qa.reportWrappedColumn(expr, call, column, scope, analysis)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+// reportWrappedColumn adds the warning and expression index suggestion for a
+// function applied to a column in a comparison
+func (qa *QueryAnalyzer) reportWrappedColumn(expr *pg_query.A_Expr, call *pg_query.FuncCall, column *pg_query.ColumnRef, scope *predicateScope, analysis *models.QueryAnalysis) {
+	condition, ok := exprString(&pg_query.Node{Node: &pg_query.Node_AExpr{AExpr: expr}})
+	if !ok {
+		return
+	}
+
+	// The index expression names the column without its table
+	indexCall := proto.Clone(call).(*pg_query.FuncCall)
+	for _, arg := range indexCall.Args {
+		if ref := arg.GetColumnRef(); ref != nil && len(ref.Fields) > 1 {
+			ref.Fields = ref.Fields[len(ref.Fields)-1:]
+		}
+	}
+	expression, ok := exprString(&pg_query.Node{Node: &pg_query.Node_FuncCall{FuncCall: indexCall}})
+	if !ok {
+		return
+	}
+
+	name, _ := scope.resolve(column)
+	analysis.AddWarning(fmt.Sprintf("%s applies a function to %s, so a plain index on the column can't be used", condition, name))
+
+	suggestion := models.QuerySuggestion{
+		Type:       "index",
+		Severity:   "medium",
+		Message:    fmt.Sprintf("Create an index on the expression %s, or rewrite the condition to compare %s itself, e.g. as a range instead of date(column) = value", expression, name),
+		Impact:     "Lets the condition use an index instead of evaluating the function for every row",
+		Confidence: 0.8,
+	}
+	if table, _, qualified := strings.Cut(name, "."); qualified && scope.hasTable(table) {
+		suggestion.Recommended = fmt.Sprintf("CREATE INDEX ON %s (%s)", table, expression)
+	}
+	analysis.Suggestions = append(analysis.Suggestions, suggestion)
+}
+
+// isComparison reports whether an expression compares two values
+func isComparison(expr *pg_query.A_Expr) bool {
+	if expr.Kind != pg_query.A_Expr_Kind_AEXPR_OP || len(expr.Name) != 1 {
+		return false
+	}
+
+	switch expr.Name[0].GetString_().GetSval() {
+	case "=", "<>", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// wrappedColumn returns a function call taking a column as an argument, and
+// the column, or nil when the node is anything else
+func wrappedColumn(node *pg_query.Node) (*pg_query.FuncCall, *pg_query.ColumnRef) {
+	call := node.GetFuncCall()
+	if call == nil {
+		return nil, nil
+	}
+
+	for _, arg := range call.Args {
+		if ref := arg.GetColumnRef(); ref != nil {
+			return call, ref
+		}
+	}
+	return nil, nil
+}
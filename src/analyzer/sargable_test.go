@@ -0,0 +1,25 @@
+package analyzer
+
+import "testing"
+
+func TestCheckWrappedColumns(t *testing.T) {
+	tests := []struct {
+		query   string
+		flagged bool
+	}{
+		{"SELECT id FROM users WHERE lower(name) = 'x'", true},
+		{"SELECT id FROM users WHERE date(created_at) = $1", true},
+		{"SELECT id FROM users WHERE name = lower('x')", false},
+	}
+
+	qa := NewQueryAnalyzer()
+	for _, tt := range tests {
+		analysis, err := qa.Analyze(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if got := hasWarning(analysis, "applies a function to"); got != tt.flagged {
+			t.Errorf("%q: wrapped column flagged = %v, want %v (warnings %q)", tt.query, got, tt.flagged, analysis.Warnings)
+		}
+	}
+}
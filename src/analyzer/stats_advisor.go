@@ -0,0 +1,57 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// minStaleModifications keeps small tables, where a few writes make up a large
+// share of the rows, from being recommended for ANALYZE
+const minStaleModifications = 1000
+
+// RecommendAnalyze returns ANALYZE recommendations for the tables whose rows
+// modified since the last ANALYZE exceed the cluster's MaxStatsStaleness
+// share of their live rows, most stale first
+func (pa *PerformanceAnalyzer) RecommendAnalyze(clusterID string, tables []*models.TableMetrics) []models.AnalyzeRecommendation {
+	thresholds := pa.ThresholdsFor(clusterID)
+	recommendations := make([]models.AnalyzeRecommendation, 0)
+
+	for _, table := range tables {
+		staleness := table.StalenessRatio()
+		if table.ModsSinceAnalyze < minStaleModifications || staleness < thresholds.MaxStatsStaleness {
+			continue
+		}
+
+		reason := fmt.Sprintf("%d rows modified since statistics were last gathered, %.0f%% of the %d live rows",
+			table.ModsSinceAnalyze, staleness*100, table.LiveTuples)
+		if table.LastAnalyzed() == nil {
+			reason = fmt.Sprintf("Never analyzed, with %d rows modified", table.ModsSinceAnalyze)
+		}
+
+		recommendations = append(recommendations, models.AnalyzeRecommendation{
+			ClusterID:        clusterID,
+			Schema:           table.Schema,
+			Table:            table.Table,
+			ModsSinceAnalyze: table.ModsSinceAnalyze,
+			LiveTuples:       table.LiveTuples,
+			StatsStaleness:   staleness,
+			LastAnalyzed:     table.LastAnalyzed(),
+			Reason:           reason,
+			Command:          fmt.Sprintf("ANALYZE %s.%s", quoteIdentifier(table.Schema), quoteIdentifier(table.Table)),
+		})
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		return recommendations[i].StatsStaleness > recommendations[j].StatsStaleness
+	})
+
+	return recommendations
+}
+
+// quoteIdentifier quotes a PostgreSQL identifier for use in a statement
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
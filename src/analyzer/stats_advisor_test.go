@@ -0,0 +1,58 @@
+package analyzer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestRecommendAnalyze(t *testing.T) {
+	analyzed := time.Now().Add(-time.Hour)
+	tables := []*models.TableMetrics{
+		// 10% modified, under the default 20%
+		{Schema: "public", Table: "customers", LiveTuples: 100000, ModsSinceAnalyze: 10000, LastAnalyze: &analyzed},
+		// 50% modified
+		{Schema: "public", Table: "orders", LiveTuples: 100000, ModsSinceAnalyze: 50000, LastAutoanalyze: &analyzed},
+		// 300% modified, but too few rows to matter
+		{Schema: "public", Table: "settings", LiveTuples: 100, ModsSinceAnalyze: 300},
+		// Never analyzed, 200% modified
+		{Schema: "Sales", Table: `q"1`, LiveTuples: 5000, ModsSinceAnalyze: 10000},
+	}
+
+	recommendations := NewPerformanceAnalyzer().RecommendAnalyze("main", tables)
+	if len(recommendations) != 2 {
+		t.Fatalf("got %d recommendations, want orders and the never analyzed table", len(recommendations))
+	}
+
+	// Most stale first
+	never, orders := recommendations[0], recommendations[1]
+	if never.Table != `q"1` || never.StatsStaleness != 2 || never.LastAnalyzed != nil {
+		t.Errorf("first recommendation = %+v, want the never analyzed table at 200%%", never)
+	}
+	if never.Command != `ANALYZE "Sales"."q""1"` {
+		t.Errorf("command = %s, want quoted identifiers", never.Command)
+	}
+	if never.Reason != "Never analyzed, with 10000 rows modified" {
+		t.Errorf("reason = %q", never.Reason)
+	}
+
+	if orders.Table != "orders" || orders.StatsStaleness != 0.5 || orders.LastAnalyzed == nil || !orders.LastAnalyzed.Equal(analyzed) {
+		t.Errorf("second recommendation = %+v, want orders at 50%% last analyzed by autovacuum", orders)
+	}
+}
+
+func TestRecommendAnalyzeClusterThreshold(t *testing.T) {
+	pa := NewPerformanceAnalyzer()
+	thresholds := DefaultThresholds()
+	thresholds.MaxStatsStaleness = 0.05
+	pa.SetClusterThresholds("reporting", thresholds)
+
+	tables := []*models.TableMetrics{{Schema: "public", Table: "customers", LiveTuples: 100000, ModsSinceAnalyze: 10000}}
+	if got := pa.RecommendAnalyze("main", tables); len(got) != 0 {
+		t.Errorf("main got %+v, want nothing at 10%% staleness", got)
+	}
+	if got := pa.RecommendAnalyze("reporting", tables); len(got) != 1 {
+		t.Errorf("reporting got %d recommendations, want one over its 5%% threshold", len(got))
+	}
+}
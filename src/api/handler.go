@@ -2,9 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"github.com/zvdy/pgao/src/analyzer"
 	"github.com/zvdy/pgao/src/collector"
@@ -17,8 +26,13 @@ type Handler struct {
 	pool                *db.ConnectionPool
 	queryAnalyzer       *analyzer.QueryAnalyzer
 	performanceAnalyzer *analyzer.PerformanceAnalyzer
+	alertManager        *analyzer.AlertManager
 	metricsCollector    *collector.MetricsCollector
 	clusterCollector    *collector.ClusterCollector
+	requestMetrics      *RequestMetrics
+	apiKeys             []string
+	cors                *CORSOptions
+	analyzeLimiter      *rateLimiter
 	log                 *logrus.Logger
 }
 
@@ -27,22 +41,68 @@ func NewHandler(
 	pool *db.ConnectionPool,
 	queryAnalyzer *analyzer.QueryAnalyzer,
 	performanceAnalyzer *analyzer.PerformanceAnalyzer,
+	alertManager *analyzer.AlertManager,
 	metricsCollector *collector.MetricsCollector,
 	clusterCollector *collector.ClusterCollector,
+	latencyBuckets []float64,
 	log *logrus.Logger,
 ) *Handler {
 	return &Handler{
 		pool:                pool,
 		queryAnalyzer:       queryAnalyzer,
 		performanceAnalyzer: performanceAnalyzer,
+		alertManager:        alertManager,
 		metricsCollector:    metricsCollector,
 		clusterCollector:    clusterCollector,
+		requestMetrics:      NewRequestMetrics(prometheus.DefaultRegisterer, latencyBuckets),
 		log:                 log,
 	}
 }
 
-// RegisterRoutes registers all API routes
-func (h *Handler) RegisterRoutes(r *mux.Router) {
+// InFlightRequests returns the number of API requests currently being served
+func (h *Handler) InFlightRequests() int64 {
+	return h.requestMetrics.InFlight()
+}
+
+// RequireAPIKeys makes /api/v1 routes require one of keys as a bearer token.
+// It must be called before RegisterRoutes.
+func (h *Handler) RequireAPIKeys(keys []string) {
+	h.apiKeys = keys
+}
+
+// AllowCORS makes the API answer CORS preflight requests and send CORS
+// headers to the allowed origins. It must be called before RegisterRoutes.
+func (h *Handler) AllowCORS(options CORSOptions) {
+	h.cors = &options
+}
+
+// LimitAnalyzeRate limits each client to rate query analyses per second,
+// with bursts of up to burst. It must be called before RegisterRoutes.
+func (h *Handler) LimitAnalyzeRate(rate float64, burst int) {
+	h.analyzeLimiter = newRateLimiter(rate, burst)
+}
+
+// RegisterRoutes registers all API routes on r, which is root or a base path
+// subrouter of it
+func (h *Handler) RegisterRoutes(root, r *mux.Router) {
+	r.Use(loggingMiddleware(h.log), h.requestMetrics.Middleware, tracingMiddleware)
+	if h.cors != nil {
+		r.Use(corsMiddleware(*h.cors))
+	}
+	if len(h.apiKeys) > 0 {
+		r.Use(h.apiKeyMiddleware(h.apiKeys))
+	}
+
+	// Middleware only runs for matched routes, so unknown paths and methods
+	// are logged here. Requests a subrouter doesn't match, including ones
+	// outside its base path, fall through to the root router's handlers.
+	if root.NotFoundHandler == nil {
+		root.NotFoundHandler = loggingMiddleware(h.log)(http.NotFoundHandler())
+	}
+	if root.MethodNotAllowedHandler == nil {
+		root.MethodNotAllowedHandler = loggingMiddleware(h.log)(http.HandlerFunc(methodNotAllowed))
+	}
+
 	// Health check
 	r.HandleFunc("/health", h.HealthCheck).Methods("GET")
 	r.HandleFunc("/ready", h.ReadinessCheck).Methods("GET")
@@ -52,37 +112,80 @@ func (h *Handler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api/v1/clusters/{id}", h.GetCluster).Methods("GET")
 	r.HandleFunc("/api/v1/clusters/{id}/metrics", h.GetClusterMetrics).Methods("GET")
 	r.HandleFunc("/api/v1/clusters/{id}/health", h.GetClusterHealth).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/pool", h.GetPoolStats).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/pool/recommendation", h.GetPoolRecommendation).Methods("GET")
+	r.HandleFunc("/api/v1/pools", h.GetAllPoolStats).Methods("GET")
 
 	// Query analysis endpoints
-	r.HandleFunc("/api/v1/analyze", h.AnalyzeQuery).Methods("POST")
+	r.Handle("/api/v1/analyze", h.rateLimited(h.analyzeLimiter, h.AnalyzeQuery)).Methods("POST")
+	r.HandleFunc("/api/v1/analyze/batch", h.AnalyzeBatch).Methods("POST")
+	r.HandleFunc("/api/v1/analyze/diff", h.DiffQueries).Methods("POST")
+	r.HandleFunc("/api/v1/explain/parse", h.ParseExplain).Methods("POST")
+	r.HandleFunc("/api/v1/clusters/{id}/explain", h.ExplainQuery).Methods("POST")
 	r.HandleFunc("/api/v1/clusters/{id}/queries", h.GetSlowQueries).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/queries/roles", h.GetRoleQueryStats).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/queries/io", h.GetQueryIOStats).Methods("GET")
+
+	// Debug endpoints
+	r.HandleFunc("/api/v1/debug/analyzer/cache", h.GetAnalyzerCacheStats).Methods("GET")
 
 	// Metrics endpoints
 	r.HandleFunc("/api/v1/clusters/{id}/tables", h.GetTableMetrics).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/tables/toast", h.GetToastMetrics).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/tables/temp", h.GetTempSchemas).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/tables/recommendations", h.GetTableRecommendations).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/indexes", h.GetIndexMetrics).Methods("GET")
 	r.HandleFunc("/api/v1/clusters/{id}/alerts", h.GetAlerts).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/alerts/history", h.GetAlertHistory).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/alerts/{alertID}/ack", h.AcknowledgeAlert).Methods("POST")
+	r.HandleFunc("/api/v1/clusters/{id}/alerts/{alertID}/resolve", h.ResolveAlert).Methods("POST")
+	r.HandleFunc("/api/v1/clusters/{id}/locks", h.GetLockWaits).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/waits", h.GetWaitEvents).Methods("GET")
+	r.HandleFunc("/api/v1/clusters/{id}/freeze", h.GetFreezeProgress).Methods("GET")
+
+	// Middleware only runs for matched routes, so preflights need a route of their own
+	if h.cors != nil {
+		r.PathPrefix("/").Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		})
+	}
 }
 
-// HealthCheck returns the health status
+// HealthCheck returns the health status, reporting degraded when too many
+// recent API requests failed with a server error or a cluster is unreachable
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{
-		"status": "ok",
+	errorRate := h.requestMetrics.ErrorRate()
+	unreachable := h.unreachableClusters()
+
+	status := "ok"
+	if errorRate >= degradedErrorRate || len(unreachable) > 0 {
+		status = "degraded"
+	}
+
+	response := map[string]interface{}{
+		"status":               status,
+		"error_rate":           errorRate,
+		"unreachable_clusters": unreachable,
 	}
 	h.respondJSON(w, http.StatusOK, response)
 }
 
-// ReadinessCheck checks if the service is ready
+// ReadinessCheck checks if the service is ready, which needs at least one
+// reachable cluster
 func (h *Handler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
 	clusters := h.pool.GetAllClusters()
+	unreachable := h.unreachableClusters()
 
-	ready := len(clusters) > 0
+	ready := len(clusters) > len(unreachable)
 	status := "ready"
 	if !ready {
 		status = "not_ready"
 	}
 
 	response := map[string]interface{}{
-		"status":   status,
-		"clusters": len(clusters),
+		"status":               status,
+		"clusters":             len(clusters),
+		"unreachable_clusters": unreachable,
 	}
 
 	statusCode := http.StatusOK
@@ -93,6 +196,18 @@ func (h *Handler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, statusCode, response)
 }
 
+// unreachableClusters returns the sorted IDs of clusters that are not reachable
+func (h *Handler) unreachableClusters() []string {
+	unreachable := make([]string, 0)
+	for _, clusterID := range h.pool.GetAllClusters() {
+		if state, err := h.pool.GetClusterState(clusterID); err == nil && state != db.ClusterStateReachable {
+			unreachable = append(unreachable, clusterID)
+		}
+	}
+	sort.Strings(unreachable)
+	return unreachable
+}
+
 // ListClusters returns list of all clusters
 func (h *Handler) ListClusters(w http.ResponseWriter, r *http.Request) {
 	clusters := h.clusterCollector.GetAllClusters()
@@ -113,28 +228,28 @@ func (h *Handler) GetCluster(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, cluster)
 }
 
-// GetClusterMetrics returns metrics for a specific cluster
+// GetClusterMetrics returns the metrics of a cluster's last collection
 func (h *Handler) GetClusterMetrics(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
 
-	metrics, err := h.metricsCollector.GetMetricsSnapshot(r.Context(), clusterID)
+	metrics, err := h.metricsCollector.GetMetricsSnapshot(clusterID)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, err.Error())
+		h.respondError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
 	h.respondJSON(w, http.StatusOK, metrics)
 }
 
-// GetClusterHealth returns health status for a cluster
+// GetClusterHealth returns health status for a cluster from its last collection
 func (h *Handler) GetClusterHealth(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
 
-	metrics, err := h.metricsCollector.GetMetricsSnapshot(r.Context(), clusterID)
+	metrics, err := h.metricsCollector.GetMetricsSnapshot(clusterID)
 	if err != nil {
-		h.respondError(w, http.StatusInternalServerError, err.Error())
+		h.respondError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -144,9 +259,60 @@ func (h *Handler) GetClusterHealth(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, health)
 }
 
+// GetPoolRecommendation returns a connection pool sizing recommendation for a cluster
+func (h *Handler) GetPoolRecommendation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	recommendation, err := h.pool.RecommendPoolSize(clusterID)
+	if err != nil {
+		h.respondError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, recommendation)
+}
+
+// GetPoolStats returns the connection pool statistics of a cluster
+func (h *Handler) GetPoolStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	stats, err := h.pool.GetPoolStats(clusterID)
+	if err != nil {
+		h.respondError(w, http.StatusNotFound, "Cluster not found")
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, stats)
+}
+
+// GetAllPoolStats returns the connection pool statistics of every cluster, keyed by cluster ID
+func (h *Handler) GetAllPoolStats(w http.ResponseWriter, r *http.Request) {
+	pools := make(map[string]map[string]interface{})
+	for _, clusterID := range h.pool.GetAllClusters() {
+		// Clusters removed by a reload since listing them are skipped
+		if stats, err := h.pool.GetPoolStats(clusterID); err == nil {
+			pools[clusterID] = stats
+		}
+	}
+
+	h.respondJSON(w, http.StatusOK, pools)
+}
+
 // AnalyzeQueryRequest represents a query analysis request
 type AnalyzeQueryRequest struct {
-	Query string `json:"query"`
+	Query     string `json:"query"`
+	ClusterID string `json:"cluster_id,omitempty"` // estimate the query's cost on this cluster with EXPLAIN
+}
+
+// SyntaxErrorResponse locates the syntax error of a query that failed to
+// parse, for clients to highlight
+type SyntaxErrorResponse struct {
+	Error    string `json:"error"`
+	Position int    `json:"position"` // 1-based character offset into the query
+	Line     int    `json:"line"`
+	Near     string `json:"near"`
 }
 
 // AnalyzeQuery analyzes a SQL query
@@ -162,7 +328,21 @@ func (h *Handler) AnalyzeQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	analysis, err := h.queryAnalyzer.Analyze(req.Query)
+	var analysis *models.QueryAnalysis
+	var err error
+	if req.ClusterID != "" {
+		pool, poolErr := h.pool.GetPool(req.ClusterID)
+		if poolErr != nil {
+			h.respondError(w, http.StatusNotFound, poolErr.Error())
+			return
+		}
+		analysis, err = h.queryAnalyzer.AnalyzeWithCost(r.Context(), pool, req.Query)
+	} else {
+		analysis, err = h.queryAnalyzer.AnalyzeContext(r.Context(), req.Query)
+	}
+	if h.respondQueryError(w, err) {
+		return
+	}
 	if err != nil {
 		h.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -171,24 +351,310 @@ func (h *Handler) AnalyzeQuery(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, analysis)
 }
 
-// GetSlowQueries returns slow queries for a cluster
+// maxBatchQueries is the most queries a batch analysis request may contain
+const maxBatchQueries = 1000
+
+// AnalyzeBatchRequest represents a request to analyze several queries
+type AnalyzeBatchRequest struct {
+	Queries []string `json:"queries"`
+}
+
+// AnalyzeBatch analyzes several SQL queries, returning their analyses in the
+// order of the request with an inline error for each query that failed
+func (h *Handler) AnalyzeBatch(w http.ResponseWriter, r *http.Request) {
+	var req AnalyzeBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if len(req.Queries) == 0 {
+		h.respondError(w, http.StatusBadRequest, "Queries are required")
+		return
+	}
+	maxQueries := maxBatchQueries
+	if h.analyzeLimiter != nil {
+		maxQueries = min(maxQueries, h.analyzeLimiter.Burst())
+	}
+	if len(req.Queries) > maxQueries {
+		h.respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d queries can be analyzed at once", maxQueries))
+		return
+	}
+
+	// Each query counts as one analysis against the rate limit
+	if !h.allowRequest(w, r, h.analyzeLimiter, len(req.Queries)) {
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, h.queryAnalyzer.AnalyzeBatch(r.Context(), req.Queries))
+}
+
+// DiffQueriesRequest represents a request to compare two versions of a query
+type DiffQueriesRequest struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// DiffQueries compares the analyses of two versions of a query
+func (h *Handler) DiffQueries(w http.ResponseWriter, r *http.Request) {
+	var req DiffQueriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Before == "" || req.After == "" {
+		h.respondError(w, http.StatusBadRequest, "Both before and after queries are required")
+		return
+	}
+
+	diff, err := h.queryAnalyzer.Diff(req.Before, req.After)
+	if h.respondQueryError(w, err) {
+		return
+	}
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, diff)
+}
+
+// ParseExplainRequest represents a request to analyze pasted text EXPLAIN output
+type ParseExplainRequest struct {
+	Plan  string `json:"plan"`
+	Query string `json:"query"` // optional, identifies the plan by its fingerprint
+}
+
+// ParseExplain parses text EXPLAIN or EXPLAIN ANALYZE output and checks the plan
+func (h *Handler) ParseExplain(w http.ResponseWriter, r *http.Request) {
+	var req ParseExplainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Plan == "" {
+		h.respondError(w, http.StatusBadRequest, "Plan is required")
+		return
+	}
+
+	plan, err := h.queryAnalyzer.ParseExplainText(req.Query, req.Plan)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, plan)
+}
+
+// ExplainQueryRequest represents a request to capture a query plan on a cluster
+type ExplainQueryRequest struct {
+	Query   string `json:"query"`
+	Analyze bool   `json:"analyze"`
+	Force   bool   `json:"force"` // allow ANALYZE of statements other than plain SELECTs
+}
+
+// ExplainQuery runs EXPLAIN for a query on a cluster and returns the parsed plan
+func (h *Handler) ExplainQuery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	var req ExplainQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Query == "" {
+		h.respondError(w, http.StatusBadRequest, "Query is required")
+		return
+	}
+
+	pool, err := h.pool.GetPool(clusterID)
+	if err != nil {
+		h.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	plan, err := h.queryAnalyzer.Explain(r.Context(), pool, req.Query, req.Analyze, req.Force)
+	if errors.Is(err, analyzer.ErrAnalyzeNotReadOnly) {
+		h.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.respondQueryError(w, err) {
+		return
+	}
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, plan)
+}
+
+// GetAnalyzerCacheStats returns query analysis cache statistics
+func (h *Handler) GetAnalyzerCacheStats(w http.ResponseWriter, r *http.Request) {
+	h.respondJSON(w, http.StatusOK, h.queryAnalyzer.CacheStats())
+}
+
+const (
+	// defaultSlowQueryLimit is the number of slow queries returned when no limit is requested
+	defaultSlowQueryLimit = 20
+
+	// maxSlowQueryLimit is the most slow queries a request may ask for
+	maxSlowQueryLimit = 100
+)
+
+// GetSlowQueries returns a cluster's slowest statements by mean execution
+// time from pg_stat_statements. ?limit= (default 20, up to 100) caps how many
+// are returned, ?min_duration_ms= skips faster ones, and ?analyze=true
+// attaches each statement's query analysis.
 func (h *Handler) GetSlowQueries(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
+	params := r.URL.Query()
+
+	limit := defaultSlowQueryLimit
+	if param := params.Get("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 || parsed > maxSlowQueryLimit {
+			h.respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %s, must be between 1 and %d", param, maxSlowQueryLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	minDuration := 0.0
+	if param := params.Get("min_duration_ms"); param != "" {
+		parsed, err := strconv.ParseFloat(param, 64)
+		if err != nil || parsed < 0 || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			h.respondError(w, http.StatusBadRequest, "invalid min_duration_ms: "+param)
+			return
+		}
+		minDuration = parsed
+	}
+
+	analyze := false
+	if param := params.Get("analyze"); param != "" {
+		parsed, err := strconv.ParseBool(param)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "invalid analyze: "+param)
+			return
+		}
+		analyze = parsed
+	}
+
+	if _, err := h.pool.GetPool(clusterID); err != nil {
+		h.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	slowQueries, err := h.metricsCollector.CollectSlowQueries(r.Context(), clusterID, params.Get("database"), minDuration, limit)
+	if errors.Is(err, collector.ErrStatStatementsMissing) {
+		h.respondError(w, http.StatusNotFound, fmt.Sprintf("%v on cluster %s", err, clusterID))
+		return
+	}
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	// This would typically query the database for slow query logs
-	_ = clusterID
+	if analyze {
+		queries := make([]string, len(slowQueries))
+		for i, slowQuery := range slowQueries {
+			queries[i] = slowQuery.Query
+		}
+		// Statements that don't parse, like ones hidden from the user as
+		// <insufficient privilege>, are returned without an analysis
+		for i, result := range h.queryAnalyzer.AnalyzeBatch(r.Context(), queries) {
+			slowQueries[i].Analysis = result.Analysis
+		}
+	}
 
-	slowQueries := make([]*models.SlowQuery, 0)
 	h.respondJSON(w, http.StatusOK, slowQueries)
 }
 
-// GetTableMetrics returns table metrics for a cluster
+// GetRoleQueryStats returns query execution time aggregated by role
+func (h *Handler) GetRoleQueryStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	roleStats, err := h.metricsCollector.CollectRoleQueryStats(r.Context(), clusterID, r.URL.Query().Get("database"))
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, roleStats)
+}
+
+// GetQueryIOStats returns the statements causing the most physical reads with their cache hit ratio
+func (h *Handler) GetQueryIOStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	queryMetrics, err := h.metricsCollector.CollectQueryIOMetrics(r.Context(), clusterID, r.URL.Query().Get("database"))
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, queryMetrics)
+}
+
+// GetFreezeProgress returns database and table transaction ID ages relative to the freeze thresholds
+func (h *Handler) GetFreezeProgress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	progress, err := h.metricsCollector.CollectFreezeProgress(r.Context(), clusterID)
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, progress)
+}
+
+// GetTableMetrics returns table metrics for a cluster, sorted by ?sort= (one
+// of collector.TableSortKeys, most scanned first by default) in ?order=asc or
+// desc, and filtered by ?schema= and ?min_dead_tuples=
 func (h *Handler) GetTableMetrics(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
+	params := r.URL.Query()
+
+	opts := collector.TableMetricsOptions{
+		Schema: params.Get("schema"),
+		SortBy: params.Get("sort"),
+	}
+
+	if opts.SortBy != "" && !slices.Contains(collector.TableSortKeys(), opts.SortBy) {
+		h.respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid sort: %s, must be one of %s",
+			opts.SortBy, strings.Join(collector.TableSortKeys(), ", ")))
+		return
+	}
+
+	switch order := params.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		opts.Ascending = true
+	default:
+		h.respondError(w, http.StatusBadRequest, "invalid order: "+order+", must be asc or desc")
+		return
+	}
 
-	tableMetrics, err := h.metricsCollector.CollectTableMetrics(r.Context(), clusterID, "")
+	if param := params.Get("min_dead_tuples"); param != "" {
+		parsed, err := strconv.ParseInt(param, 10, 64)
+		if err != nil || parsed < 0 {
+			h.respondError(w, http.StatusBadRequest, "invalid min_dead_tuples: "+param)
+			return
+		}
+		opts.MinDeadTuples = parsed
+	}
+
+	tableMetrics, err := h.metricsCollector.CollectTableMetrics(r.Context(), clusterID, "", opts)
 	if err != nil {
 		h.respondError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -197,19 +663,168 @@ func (h *Handler) GetTableMetrics(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, tableMetrics)
 }
 
-// GetAlerts returns active alerts for a cluster
+// GetTableRecommendations returns ANALYZE recommendations for a cluster's
+// tables with stale planner statistics, checking the most modified tables
+// since their last ANALYZE
+func (h *Handler) GetTableRecommendations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	tableMetrics, err := h.metricsCollector.CollectTableMetrics(r.Context(), clusterID, "", collector.TableMetricsOptions{SortBy: "mods_since_analyze"})
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, h.performanceAnalyzer.RecommendAnalyze(clusterID, tableMetrics))
+}
+
+// GetIndexMetrics returns index usage for a cluster, largest first, flagging unused indexes
+func (h *Handler) GetIndexMetrics(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	indexMetrics, err := h.metricsCollector.CollectIndexMetrics(r.Context(), clusterID, r.URL.Query().Get("database"))
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, indexMetrics)
+}
+
+// GetToastMetrics returns TOAST storage statistics for a cluster
+func (h *Handler) GetToastMetrics(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	toastMetrics, err := h.metricsCollector.CollectToastMetrics(r.Context(), clusterID)
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, toastMetrics)
+}
+
+// GetAlerts returns a cluster's active alerts. They are raised and cleared
+// by the collection loop, so reading them doesn't change their status or
+// send notifications.
 func (h *Handler) GetAlerts(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	clusterID := vars["id"]
 
-	metrics, err := h.metricsCollector.GetMetricsSnapshot(r.Context(), clusterID)
+	h.respondJSON(w, http.StatusOK, h.alertManager.Alerts(clusterID))
+}
+
+// GetAlertHistory returns a cluster's cleared alerts, most recent first
+func (h *Handler) GetAlertHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	h.respondJSON(w, http.StatusOK, h.alertManager.History(clusterID))
+}
+
+// AcknowledgeAlertRequest represents a request to acknowledge an alert
+type AcknowledgeAlertRequest struct {
+	AcknowledgedBy string `json:"acknowledged_by"`
+}
+
+// AcknowledgeAlert marks an alert as acknowledged so it stays acknowledged
+// while the condition persists
+func (h *Handler) AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+	alertID := vars["alertID"]
+
+	var req AcknowledgeAlertRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+	if req.AcknowledgedBy == "" {
+		req.AcknowledgedBy = "api"
+	}
+
+	alert, err := h.alertManager.Acknowledge(clusterID, alertID, req.AcknowledgedBy)
+	if err != nil {
+		h.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, alert)
+}
+
+// ResolveAlert marks an alert as resolved
+func (h *Handler) ResolveAlert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+	alertID := vars["alertID"]
+
+	alert, err := h.alertManager.Resolve(clusterID, alertID)
+	if err != nil {
+		h.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, alert)
+}
+
+// GetTempSchemas returns the temp schemas of a cluster, flagging the ones
+// orphaned by backends that are gone
+func (h *Handler) GetTempSchemas(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	tempSchemas, err := h.metricsCollector.CollectTempSchemas(r.Context(), clusterID)
 	if err != nil {
 		h.respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	alerts := h.performanceAnalyzer.AnalyzeMetrics(metrics)
-	h.respondJSON(w, http.StatusOK, alerts)
+	h.respondJSON(w, http.StatusOK, tempSchemas)
+}
+
+// GetLockWaits returns lock waits for a cluster grouped by lock type and mode
+func (h *Handler) GetLockWaits(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	lockWaits, err := h.metricsCollector.CollectLockWaits(r.Context(), clusterID)
+	if err != nil {
+		h.respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, lockWaits)
+}
+
+// defaultWaitWindow is the wait event window used when none is requested
+const defaultWaitWindow = 15 * time.Minute
+
+// GetWaitEvents returns the wait event profile of a cluster's active sessions over ?window= (default 15m)
+func (h *Handler) GetWaitEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	clusterID := vars["id"]
+
+	window := defaultWaitWindow
+	if param := r.URL.Query().Get("window"); param != "" {
+		parsed, err := time.ParseDuration(param)
+		if err != nil || parsed <= 0 {
+			h.respondError(w, http.StatusBadRequest, "invalid window: "+param)
+			return
+		}
+		window = parsed
+	}
+
+	if _, err := h.pool.GetPool(clusterID); err != nil {
+		h.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, h.metricsCollector.GetWaitEventProfile(clusterID, window))
 }
 
 // respondJSON sends a JSON response
@@ -221,6 +836,26 @@ func (h *Handler) respondJSON(w http.ResponseWriter, statusCode int, data interf
 	}
 }
 
+// respondQueryError sends a 400 response for an error in a submitted query,
+// locating syntax errors, and reports whether err was one
+func (h *Handler) respondQueryError(w http.ResponseWriter, err error) bool {
+	var syntaxErr *analyzer.SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		h.respondJSON(w, http.StatusBadRequest, SyntaxErrorResponse{
+			Error:    err.Error(),
+			Position: syntaxErr.Position,
+			Line:     syntaxErr.Line,
+			Near:     syntaxErr.Near,
+		})
+	case errors.Is(err, analyzer.ErrMultipleStatements):
+		h.respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		return false
+	}
+	return true
+}
+
 // respondError sends an error response
 func (h *Handler) respondError(w http.ResponseWriter, statusCode int, message string) {
 	response := map[string]string{
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/zvdy/pgao/src/analyzer"
+	"github.com/zvdy/pgao/src/collector"
+	"github.com/zvdy/pgao/src/db"
+	"github.com/zvdy/pgao/src/pgtest"
+)
+
+// newTestHandler returns a handler without clusters, whose request metrics
+// have a registry of their own
+func newTestHandler() *Handler {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	pool := db.NewConnectionPool(log)
+	performanceAnalyzer := analyzer.NewPerformanceAnalyzer()
+	h := NewHandler(
+		pool,
+		analyzer.NewQueryAnalyzer(),
+		performanceAnalyzer,
+		analyzer.NewAlertManager(performanceAnalyzer),
+		collector.NewMetricsCollector(pool, log, time.Minute),
+		collector.NewClusterCollector(pool, log, time.Minute),
+		nil,
+		log,
+	)
+	h.requestMetrics = NewRequestMetrics(prometheus.NewRegistry(), nil)
+
+	return h
+}
+
+// newTestRouter registers the routes of h on a new router, under basePath
+// when it is set
+func newTestRouter(h *Handler, basePath string) *mux.Router {
+	router := mux.NewRouter()
+	routes := router
+	if basePath != "" {
+		routes = router.PathPrefix(basePath).Subrouter()
+	}
+	h.RegisterRoutes(router, routes)
+
+	return router
+}
+
+func TestAnalyzeQuerySyntaxError(t *testing.T) {
+	h := &Handler{queryAnalyzer: analyzer.NewQueryAnalyzer(), log: logrus.New()}
+	query := "SELECT id FROM users WHERE id = = 1"
+
+	body, err := json.Marshal(AnalyzeQueryRequest{Query: query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.AnalyzeQuery(w, httptest.NewRequest("POST", "/api/v1/analyze", strings.NewReader(string(body))))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	var resp SyntaxErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second = is the offending token
+	want := strings.LastIndex(query, "=") + 1
+	if resp.Position != want || resp.Line != 1 || resp.Near != "=" {
+		t.Errorf("response = %+v, want position %d on line 1 near \"=\"", resp, want)
+	}
+	if !strings.Contains(resp.Error, "syntax error") {
+		t.Errorf("error = %q, want the parser's message", resp.Error)
+	}
+}
+
+func TestGetSlowQueriesRejectsInvalidParams(t *testing.T) {
+	h := &Handler{log: logrus.New()}
+
+	for _, params := range []string{"limit=0", "limit=101", "limit=ten", "min_duration_ms=-1", "min_duration_ms=NaN", "analyze=maybe"} {
+		w := httptest.NewRecorder()
+		h.GetSlowQueries(w, httptest.NewRequest("GET", "/api/v1/clusters/main/queries?"+params, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", params, w.Code)
+		}
+	}
+}
+
+func TestGetTableMetricsRejectsInvalidParams(t *testing.T) {
+	h := &Handler{log: logrus.New()}
+
+	for _, params := range []string{"sort=bogus", "sort=relname", "order=sideways", "min_dead_tuples=-1", "min_dead_tuples=many"} {
+		w := httptest.NewRecorder()
+		h.GetTableMetrics(w, httptest.NewRequest("GET", "/api/v1/clusters/main/tables?"+params, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", params, w.Code)
+		}
+	}
+}
+
+func TestDiffQueriesSyntaxError(t *testing.T) {
+	h := &Handler{queryAnalyzer: analyzer.NewQueryAnalyzer(), log: logrus.New()}
+
+	body, err := json.Marshal(DiffQueriesRequest{Before: "SELECT 1", After: "SELEC 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.DiffQueries(w, httptest.NewRequest("POST", "/api/v1/analyze/diff", strings.NewReader(string(body))))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	var resp SyntaxErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(resp.Error, "after: ") || resp.Near != "SELEC" {
+		t.Errorf("response = %+v, want the after query's syntax error near SELEC", resp)
+	}
+}
+
+func TestRoutesUnderBasePath(t *testing.T) {
+	router := newTestRouter(newTestHandler(), "/pgao")
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/pgao/health", http.StatusOK},
+		// Without clusters pgao isn't ready, but the route is matched
+		{"GET", "/pgao/ready", http.StatusServiceUnavailable},
+		{"GET", "/pgao/api/v1/clusters", http.StatusOK},
+		{"GET", "/pgao/api/v1/debug/analyzer/cache", http.StatusOK},
+		{"POST", "/pgao/api/v1/analyze", http.StatusOK},
+		{"GET", "/health", http.StatusNotFound},
+		{"GET", "/ready", http.StatusNotFound},
+		{"GET", "/api/v1/clusters", http.StatusNotFound},
+		{"POST", "/api/v1/analyze", http.StatusNotFound},
+		{"GET", "/pgaox/health", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"query": "SELECT 1"}`)))
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+		}
+	}
+}
+
+func TestGetPoolStats(t *testing.T) {
+	h := newTestHandler()
+	t.Cleanup(h.pool.Close)
+	server := pgtest.NewServer(t)
+	if err := h.pool.AddCluster(context.Background(), "main", db.ConnectionConfig{
+		Host:           server.Host(),
+		Port:           server.Port(),
+		User:           "pgao",
+		Database:       "app",
+		SSLMode:        "disable",
+		MinConnections: 1,
+		MaxConnections: 4,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	router := newTestRouter(h, "")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/clusters/missing/pool", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown cluster: status = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/clusters/main/pool", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var stats map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	keys := slices.Sorted(maps.Keys(stats))
+	want := []string{
+		"acquired_conns", "canceled_acquire_count", "constructing_conns", "empty_acquire_count", "idle_conns",
+		"max_conns", "max_idle_destroy_count", "max_lifetime_destroy_count", "new_conns_count", "total_conns",
+	}
+	if !slices.Equal(keys, want) {
+		t.Errorf("keys = %q, want %q", keys, want)
+	}
+	if stats["max_conns"] != 4.0 {
+		t.Errorf("max_conns = %v, want the configured 4", stats["max_conns"])
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/pools", nil))
+	var pools map[string]map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&pools); err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 1 || len(pools["main"]) != len(want) {
+		t.Errorf("pools = %v, want the stats of main", pools)
+	}
+}
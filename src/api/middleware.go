@@ -0,0 +1,365 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// errorRateWindow is the number of recent requests the error rate is computed over
+	errorRateWindow = 200
+
+	// degradedErrorRate is the share of recent 5xx responses that marks pgao as degraded
+	degradedErrorRate = 0.1
+
+	// requestIDHeader carries the ID a request is logged with
+	requestIDHeader = "X-Request-ID"
+
+	// maxRequestIDLength bounds request IDs passed in by clients
+	maxRequestIDLength = 128
+)
+
+// RequestMetrics tracks request counts, errors and latency per API endpoint
+type RequestMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+
+	inFlightCount atomic.Int64
+
+	mu       sync.Mutex
+	outcomes []bool // ring buffer of recent requests, true for 5xx
+	next     int
+	filled   bool
+}
+
+// NewRequestMetrics creates request metrics registered with reg, with
+// latency histogram buckets, or the default buckets when none are given
+func NewRequestMetrics(reg prometheus.Registerer, buckets []float64) *RequestMetrics {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	rm := &RequestMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pgao_http_requests_total",
+			Help: "HTTP requests served by pgao, by route, method and status code.",
+		}, []string{"path", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pgao_http_request_duration_seconds",
+			Help:    "HTTP request latency by route and method.",
+			Buckets: buckets,
+		}, []string{"path", "method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "pgao_http_requests_in_flight",
+			Help: "HTTP requests currently being served.",
+		}),
+		outcomes: make([]bool, errorRateWindow),
+	}
+
+	rm.requests = registerOrExisting(reg, rm.requests)
+	rm.duration = registerOrExisting(reg, rm.duration)
+	rm.inFlight = registerOrExisting(reg, rm.inFlight)
+
+	return rm
+}
+
+// registerOrExisting registers a collector, reusing an identical one that is already registered
+func registerOrExisting[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var already prometheus.AlreadyRegisteredError
+		if errors.As(err, &already) {
+			if existing, ok := already.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
+// Middleware records every request against its route template, so path
+// parameters like cluster IDs don't create new series
+func (rm *RequestMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		rm.inFlightCount.Add(1)
+		rm.inFlight.Inc()
+		defer func() {
+			rm.inFlightCount.Add(-1)
+			rm.inFlight.Dec()
+		}()
+
+		next.ServeHTTP(recorder, r)
+
+		path := routeTemplate(r)
+
+		rm.requests.WithLabelValues(path, r.Method, strconv.Itoa(recorder.status)).Inc()
+		rm.duration.WithLabelValues(path, r.Method).Observe(time.Since(start).Seconds())
+		rm.recordOutcome(recorder.status >= http.StatusInternalServerError)
+	})
+}
+
+// loggingMiddleware logs every request with its status, duration and an ID
+// that is returned in the X-Request-ID header. A client's own request ID is
+// kept, so its logs can be matched with pgao's.
+func loggingMiddleware(log *logrus.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(requestIDHeader)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, requestID)
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			entry := log.WithFields(logrus.Fields{
+				"request_id":  requestID,
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"status":      recorder.status,
+				"duration_ms": float64(time.Since(start).Nanoseconds()) / 1e6,
+				"remote_addr": r.RemoteAddr,
+			})
+
+			// Probes hit the health endpoints constantly, so they're only logged at debug
+			switch path := routeTemplate(r); {
+			case recorder.status >= http.StatusInternalServerError:
+				entry.Error("Request failed")
+			case strings.HasSuffix(path, "/health") || strings.HasSuffix(path, "/ready"):
+				entry.Debug("Request handled")
+			default:
+				entry.Info("Request handled")
+			}
+		})
+	}
+}
+
+// methodNotAllowed answers a request for a known path with a method it
+// doesn't accept
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// apiKeyMiddleware requires one of keys as a bearer token on /api/v1 routes,
+// leaving the health endpoints and /metrics open for probes and scrapers
+func (h *Handler) apiKeyMiddleware(keys []string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(routeTemplate(r), "/api/v1/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				h.respondError(w, http.StatusUnauthorized, "Missing API key")
+				return
+			}
+			if !validAPIKey(keys, token) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				h.respondError(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CORSOptions are the cross-origin requests browsers are allowed to make
+type CORSOptions struct {
+	AllowedOrigins []string // "*" allows every origin
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         time.Duration
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a
+// request's origin, or "" when the origin isn't allowed
+func (co CORSOptions) allowedOrigin(origin string) string {
+	for _, allowed := range co.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if allowed == origin {
+			return origin
+		}
+	}
+	return ""
+}
+
+// corsMiddleware answers preflight requests and adds the CORS headers to
+// responses for allowed origins. Preflights are answered before
+// authentication, since browsers never send credentials with them.
+func corsMiddleware(options CORSOptions) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			allowed := options.allowedOrigin(origin)
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				if allowed != "" {
+					w.Header().Set("Access-Control-Allow-Origin", allowed)
+					w.Header().Set("Access-Control-Allow-Methods", strings.Join(options.AllowedMethods, ", "))
+					if len(options.AllowedHeaders) > 0 {
+						w.Header().Set("Access-Control-Allow-Headers", strings.Join(options.AllowedHeaders, ", "))
+					}
+					if options.MaxAge > 0 {
+						w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(options.MaxAge.Seconds())))
+					}
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if allowed != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowed)
+				w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validAPIKey compares a token against every key in constant time, so the
+// response time doesn't reveal how much of a key matched
+func validAPIKey(keys []string, token string) bool {
+	valid := 0
+	for _, key := range keys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), []byte(token))
+	}
+	return valid == 1
+}
+
+// routeTemplate returns the template of the route a request matched
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
+
+// tracingMiddleware wraps every request in a span named after its route,
+// continuing the trace of the caller when it sends trace context
+func tracingMiddleware(next http.Handler) http.Handler {
+	tracer := otel.Tracer("github.com/zvdy/pgao/src/api")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		path := routeTemplate(r)
+
+		ctx, span := tracer.Start(ctx, r.Method+" "+path, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", path),
+		)
+		if clusterID := mux.Vars(r)["id"]; clusterID != "" {
+			span.SetAttributes(attribute.String("pgao.cluster_id", clusterID))
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// InFlight returns the number of requests currently being served
+func (rm *RequestMetrics) InFlight() int64 {
+	return rm.inFlightCount.Load()
+}
+
+// recordOutcome adds a request to the error rate window
+func (rm *RequestMetrics) recordOutcome(failed bool) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.outcomes[rm.next] = failed
+	rm.next = (rm.next + 1) % len(rm.outcomes)
+	if rm.next == 0 {
+		rm.filled = true
+	}
+}
+
+// ErrorRate returns the share of 5xx responses among the most recent requests
+func (rm *RequestMetrics) ErrorRate() float64 {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	count := rm.next
+	if rm.filled {
+		count = len(rm.outcomes)
+	}
+	if count == 0 {
+		return 0
+	}
+
+	failed := 0
+	for _, outcome := range rm.outcomes[:count] {
+		if outcome {
+			failed++
+		}
+	}
+
+	return float64(failed) / float64(count)
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code before writing it
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
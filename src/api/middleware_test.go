@@ -0,0 +1,305 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestUnmatchedRequestsLogged(t *testing.T) {
+	tests := []struct {
+		basePath     string
+		method, path string
+		status       int
+	}{
+		{"", "GET", "/unknown", http.StatusNotFound},
+		{"", "DELETE", "/health", http.StatusMethodNotAllowed},
+		{"/pgao", "GET", "/unknown", http.StatusNotFound},
+		{"/pgao", "GET", "/pgao/unknown", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		log, hook := test.NewNullLogger()
+		h := &Handler{log: log, requestMetrics: NewRequestMetrics(prometheus.NewRegistry(), nil)}
+		router := mux.NewRouter()
+		routes := router
+		if tt.basePath != "" {
+			routes = router.PathPrefix(tt.basePath).Subrouter()
+		}
+		h.RegisterRoutes(router, routes)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+		}
+		if w.Header().Get(requestIDHeader) == "" {
+			t.Errorf("%s %s: response has no request ID", tt.method, tt.path)
+		}
+		entry := hook.LastEntry()
+		if entry == nil || entry.Data["status"] != tt.status || entry.Data["path"] != tt.path {
+			t.Fatalf("%s %s: logged %v, want the request with status %d", tt.method, tt.path, entry, tt.status)
+		}
+		if duration, _ := entry.Data["duration_ms"].(float64); duration <= 0 {
+			t.Errorf("%s %s: logged duration %v, want it above zero", tt.method, tt.path, entry.Data["duration_ms"])
+		}
+		if entry.Data["request_id"] != w.Header().Get(requestIDHeader) {
+			t.Errorf("%s %s: logged request ID %v, returned %q", tt.method, tt.path, entry.Data["request_id"], w.Header().Get(requestIDHeader))
+		}
+	}
+}
+
+func TestClientRequestIDKept(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		kept      bool
+	}{
+		{"client ID", "client-1234", true},
+		{"too long", strings.Repeat("x", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(newTestHandler(), "")
+			r := httptest.NewRequest("GET", "/unknown", nil)
+			r.Header.Set(requestIDHeader, tt.requestID)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			got := w.Header().Get(requestIDHeader)
+			if (got == tt.requestID) != tt.kept || got == "" {
+				t.Errorf("%s = %q, want the client's ID kept: %v", requestIDHeader, got, tt.kept)
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	const key = "0123456789abcdef0123"
+
+	tests := []struct {
+		name             string
+		keys             []string
+		path             string
+		authorization    string
+		wantUnauthorized bool
+	}{
+		{"health open", []string{key}, "/health", "", false},
+		{"ready open", []string{key}, "/ready", "", false},
+		{"missing key", []string{key}, "/api/v1/debug/analyzer/cache", "", true},
+		{"invalid key", []string{key}, "/api/v1/debug/analyzer/cache", "Bearer fedcba9876543210fedc", true},
+		{"not a bearer token", []string{key}, "/api/v1/debug/analyzer/cache", key, true},
+		{"valid key", []string{key}, "/api/v1/debug/analyzer/cache", "Bearer " + key, false},
+		{"auth disabled", nil, "/api/v1/debug/analyzer/cache", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler()
+			h.RequireAPIKeys(tt.keys)
+			router := newTestRouter(h, "")
+
+			r := httptest.NewRequest("GET", tt.path, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if unauthorized := w.Code == http.StatusUnauthorized; unauthorized != tt.wantUnauthorized {
+				t.Fatalf("status = %d, want unauthorized %v", w.Code, tt.wantUnauthorized)
+			}
+			if !tt.wantUnauthorized {
+				return
+			}
+
+			var resp map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("401 body isn't JSON: %v", err)
+			}
+			if resp["error"] == nil || w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("401 response = %v, want a JSON error and WWW-Authenticate", resp)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	options := CORSOptions{
+		AllowedOrigins: []string{"https://dash.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	tests := []struct {
+		name        string
+		cors        *CORSOptions
+		method      string
+		origin      string
+		wantStatus  int
+		wantAllowed string
+	}{
+		{"preflight from allowed origin", &options, "OPTIONS", "https://dash.example.com", http.StatusNoContent, "https://dash.example.com"},
+		{"preflight from other origin", &options, "OPTIONS", "https://evil.example.com", http.StatusNoContent, ""},
+		{"GET from allowed origin", &options, "GET", "https://dash.example.com", http.StatusOK, "https://dash.example.com"},
+		{"GET from other origin", &options, "GET", "https://evil.example.com", http.StatusOK, ""},
+		{"CORS not configured", nil, "GET", "https://dash.example.com", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler()
+			if tt.cors != nil {
+				h.AllowCORS(*tt.cors)
+			}
+			router := newTestRouter(h, "")
+
+			r := httptest.NewRequest(tt.method, "/api/v1/debug/analyzer/cache", nil)
+			r.Header.Set("Origin", tt.origin)
+			if tt.method == "OPTIONS" {
+				r.Header.Set("Access-Control-Request-Method", "GET")
+				r.Header.Set("Access-Control-Request-Headers", "Authorization")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowed {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowed)
+			}
+
+			preflightAllowed := tt.method == "OPTIONS" && tt.wantAllowed != ""
+			if got := w.Header().Get("Access-Control-Allow-Methods"); (got == "GET, POST") != preflightAllowed {
+				t.Errorf("Access-Control-Allow-Methods = %q", got)
+			}
+			if got := w.Header().Get("Access-Control-Max-Age"); (got == "600") != preflightAllowed {
+				t.Errorf("Access-Control-Max-Age = %q", got)
+			}
+		})
+	}
+}
+
+// histogramBounds returns the bucket upper bounds of the first series of a
+// histogram gathered from reg
+func histogramBounds(t *testing.T, reg *prometheus.Registry, name string) []float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name || len(family.GetMetric()) == 0 {
+			continue
+		}
+		bounds := make([]float64, 0)
+		for _, bucket := range family.GetMetric()[0].GetHistogram().GetBucket() {
+			bounds = append(bounds, bucket.GetUpperBound())
+		}
+		return bounds
+	}
+
+	t.Fatalf("no %s series gathered", name)
+	return nil
+}
+
+func TestRequestLatencyBuckets(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		buckets []float64
+		want    []float64
+	}{
+		{"custom", []float64{0.005, 0.05, 0.5, 5}, []float64{0.005, 0.05, 0.5, 5}},
+		{"default", nil, prometheus.DefBuckets},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			rm := NewRequestMetrics(reg, tt.buckets)
+			handler := rm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+			if got := histogramBounds(t, reg, "pgao_http_request_duration_seconds"); !slices.Equal(got, tt.want) {
+				t.Errorf("bucket bounds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestMetricsCountRequests(t *testing.T) {
+	h := newTestHandler()
+	router := newTestRouter(h, "")
+
+	for _, path := range []string{"/health", "/health", "/api/v1/clusters/missing/metrics"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v1/analyze", strings.NewReader("not json")))
+
+	// Series are labeled with the route template, not the requested path
+	for _, tt := range []struct {
+		path, method, status string
+		want                 float64
+	}{
+		{"/health", "GET", "200", 2},
+		{"/api/v1/clusters/{id}/metrics", "GET", "404", 1},
+		{"/api/v1/analyze", "POST", "400", 1},
+	} {
+		if got := testutil.ToFloat64(h.requestMetrics.requests.WithLabelValues(tt.path, tt.method, tt.status)); got != tt.want {
+			t.Errorf("pgao_http_requests_total{path=%q,method=%q,status=%q} = %g, want %g", tt.path, tt.method, tt.status, got, tt.want)
+		}
+	}
+	if got := testutil.CollectAndCount(h.requestMetrics.requests); got != 3 {
+		t.Errorf("got %d request series, want 3", got)
+	}
+
+	// Client errors don't count towards the error rate
+	if rate := h.requestMetrics.ErrorRate(); rate != 0 {
+		t.Errorf("error rate = %g, want 0", rate)
+	}
+}
+
+func TestServerErrorsDegradeHealth(t *testing.T) {
+	h := newTestHandler()
+	router := newTestRouter(h, "")
+	router.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	health := func() map[string]any {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	if body := health(); body["status"] != "ok" {
+		t.Fatalf("health = %v, want ok", body)
+	}
+
+	// One failure in the two requests so far
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fail", nil))
+	if got := testutil.ToFloat64(h.requestMetrics.requests.WithLabelValues("/fail", "GET", "500")); got != 1 {
+		t.Errorf("failed requests counted %g times, want 1", got)
+	}
+
+	body := health()
+	if body["status"] != "degraded" || body["error_rate"] != 0.5 {
+		t.Errorf("health = %v, want degraded at an error rate of 0.5", body)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiterSweepInterval is how often buckets of clients that went quiet are dropped
+const rateLimiterSweepInterval = time.Minute
+
+// tokenBucket holds the tokens left to a client and when they were last refilled
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// rateLimiter is a token bucket rate limiter per client. Each client may
+// make burst requests at once, refilled at rate requests per second.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket // client key -> bucket
+	lastSweep time.Time
+}
+
+// newRateLimiter creates a rate limiter allowing rate requests per second
+// with bursts of up to burst requests
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes n tokens from a client's bucket at now. When the bucket has
+// fewer it returns false with how long until n tokens are available.
+func (rl *rateLimiter) Allow(key string, n int, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if now.Sub(rl.lastSweep) >= rateLimiterSweepInterval {
+		rl.sweep(now)
+	}
+
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: rl.burst, at: now}
+		rl.buckets[key] = bucket
+	}
+
+	bucket.tokens = rl.refill(bucket, now)
+	bucket.at = now
+
+	cost := float64(n)
+	if bucket.tokens < cost {
+		return false, time.Duration((cost - bucket.tokens) / rl.rate * float64(time.Second))
+	}
+
+	bucket.tokens -= cost
+	return true, 0
+}
+
+// Burst returns the most tokens a single request can take
+func (rl *rateLimiter) Burst() int {
+	return int(rl.burst)
+}
+
+// refill returns the tokens of a bucket at now
+func (rl *rateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(bucket.at).Seconds()
+	if elapsed <= 0 {
+		return bucket.tokens
+	}
+	return math.Min(rl.burst, bucket.tokens+elapsed*rl.rate)
+}
+
+// sweep drops the buckets that have refilled completely, which behave
+// exactly like a new bucket, so idle clients don't accumulate
+func (rl *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range rl.buckets {
+		if rl.refill(bucket, now) >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// rateLimited rejects requests over the limiter's limit with 429 Too Many
+// Requests and a Retry-After header, passing the others to next
+func (h *Handler) rateLimited(limiter *rateLimiter, next http.HandlerFunc) http.Handler {
+	if limiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.allowRequest(w, r, limiter, 1) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowRequest charges a request n tokens of the limiter, for requests doing
+// the work of n. It responds 429 Too Many Requests with a Retry-After header
+// and returns false when the client's bucket has fewer tokens.
+func (h *Handler) allowRequest(w http.ResponseWriter, r *http.Request, limiter *rateLimiter, n int) bool {
+	if limiter == nil {
+		return true
+	}
+
+	allowed, retryAfter := limiter.Allow(h.rateLimitKey(r), n, time.Now())
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		h.respondError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+		return false
+	}
+
+	return true
+}
+
+// rateLimitKey identifies the client of a request for rate limiting. When
+// API keys are required the middleware has checked the key, so clients are
+// told apart by it. Otherwise any bearer token is ignored, since clients
+// could send a new one with every request to get a fresh bucket.
+func (h *Handler) rateLimitKey(r *http.Request) string {
+	if len(h.apiKeys) > 0 {
+		if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found && token != "" {
+			return "key:" + token
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
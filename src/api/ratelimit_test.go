@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zvdy/pgao/src/analyzer"
+)
+
+func TestRateLimiterAllowTakesTokens(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(2, 5)
+
+	if allowed, _ := limiter.Allow("a", 3, now); !allowed {
+		t.Fatal("3 of 5 tokens refused")
+	}
+	allowed, retryAfter := limiter.Allow("a", 3, now)
+	if allowed {
+		t.Fatal("3 tokens taken from a bucket holding 2")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Errorf("retry after %s, want 500ms to refill the missing token", retryAfter)
+	}
+	if allowed, _ := limiter.Allow("a", 2, now); !allowed {
+		t.Error("refused request didn't leave its tokens in the bucket")
+	}
+	if allowed, _ := limiter.Allow("b", 5, now); !allowed {
+		t.Error("clients share a bucket")
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiKeys []string
+		header  string
+		want    string
+	}{
+		{"no keys configured, no token", nil, "", "addr:192.0.2.1"},
+		{"no keys configured, token ignored", nil, "Bearer made-up", "addr:192.0.2.1"},
+		{"keys configured", []string{"0123456789abcdef"}, "Bearer 0123456789abcdef", "key:0123456789abcdef"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{apiKeys: tt.apiKeys}
+			r := httptest.NewRequest("POST", "/api/v1/analyze", nil)
+			r.RemoteAddr = "192.0.2.1:51234"
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+
+			if got := h.rateLimitKey(r); got != tt.want {
+				t.Errorf("rateLimitKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeBatchChargesEveryQuery(t *testing.T) {
+	log := logrus.New()
+	h := &Handler{queryAnalyzer: analyzer.NewQueryAnalyzer(), log: log}
+	h.LimitAnalyzeRate(1, 5)
+
+	batch := func(queries int) *httptest.ResponseRecorder {
+		body := `{"queries": [` + strings.TrimSuffix(strings.Repeat(`"SELECT 1",`, queries), ",") + `]}`
+		r := httptest.NewRequest("POST", "/api/v1/analyze/batch", strings.NewReader(body))
+		r.RemoteAddr = "192.0.2.1:51234"
+		w := httptest.NewRecorder()
+		h.AnalyzeBatch(w, r)
+		return w
+	}
+
+	if w := batch(6); w.Code != http.StatusBadRequest {
+		t.Errorf("batch larger than the burst: status %d, want 400", w.Code)
+	}
+	if w := batch(4); w.Code != http.StatusOK {
+		t.Fatalf("first batch: status %d, want 200", w.Code)
+	}
+	w := batch(2)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("batch over the remaining tokens: status %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+	if w := batch(1); w.Code != http.StatusOK {
+		t.Errorf("batch within the remaining token: status %d, want 200", w.Code)
+	}
+}
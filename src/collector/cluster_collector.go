@@ -2,7 +2,13 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -10,21 +16,75 @@ import (
 	"github.com/zvdy/pgao/src/models"
 )
 
+// defaultSettings are the server settings reported for every cluster
+var defaultSettings = []string{
+	"max_connections",
+	"shared_buffers",
+	"effective_cache_size",
+	"maintenance_work_mem",
+	"work_mem",
+	"max_worker_processes",
+	"max_parallel_workers",
+	"wal_level",
+	"max_wal_senders",
+	"max_replication_slots",
+}
+
+// StatusObserver is told when a probe finds that a cluster's status changed,
+// with the health check error unless the cluster is healthy
+type StatusObserver interface {
+	ClusterStatusChanged(clusterID, status string, err error)
+}
+
+// StartTimeSource provides server start times that are already collected
+type StartTimeSource interface {
+	ServerStartTime(clusterID string) (time.Time, bool)
+}
+
 // ClusterCollector collects cluster information and status
 type ClusterCollector struct {
-	pool     *db.ConnectionPool
-	log      *logrus.Logger
-	clusters map[string]*models.Cluster
-	interval time.Duration
+	pool       *db.ConnectionPool
+	log        *logrus.Logger
+	clusters   map[string]*models.Cluster
+	mu         sync.RWMutex
+	interval   time.Duration
+	settings   []string
+	freshness  *freshnessTracker
+	observers  []StatusObserver
+	startTimes StartTimeSource
 }
 
 // NewClusterCollector creates a new ClusterCollector instance
 func NewClusterCollector(pool *db.ConnectionPool, log *logrus.Logger, interval time.Duration) *ClusterCollector {
 	return &ClusterCollector{
-		pool:     pool,
-		log:      log,
-		clusters: make(map[string]*models.Cluster),
-		interval: interval,
+		pool:      pool,
+		log:       log,
+		clusters:  make(map[string]*models.Cluster),
+		interval:  interval,
+		settings:  append([]string(nil), defaultSettings...),
+		freshness: newFreshnessTracker(2 * interval),
+	}
+}
+
+// AddStatusObserver registers an observer of cluster status changes.
+// Observers must be added before Start and StartProbing.
+func (cc *ClusterCollector) AddStatusObserver(observer StatusObserver) {
+	cc.observers = append(cc.observers, observer)
+}
+
+// UseStartTimes makes the collector report uptime from the start times of
+// source instead of querying them itself. It must be called before Start.
+func (cc *ClusterCollector) UseStartTimes(source StartTimeSource) {
+	cc.startTimes = source
+}
+
+// AddSettings adds server settings to report alongside the defaults.
+// Settings must be added before Start.
+func (cc *ClusterCollector) AddSettings(names ...string) {
+	for _, name := range names {
+		if !slices.Contains(cc.settings, name) {
+			cc.settings = append(cc.settings, name)
+		}
 	}
 }
 
@@ -60,235 +120,510 @@ func (cc *ClusterCollector) collectAllClusters(ctx context.Context) {
 	}
 }
 
-// CollectClusterInfo collects information about a specific cluster
-func (cc *ClusterCollector) CollectClusterInfo(ctx context.Context, clusterID string) error {
-	pool, err := cc.pool.GetPool(clusterID)
-	if err != nil {
-		return err
-	}
+// StartProbing checks the health of every cluster on its own interval,
+// usually shorter than the collection interval, so status changes are
+// noticed between collections
+func (cc *ClusterCollector) StartProbing(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	_ = pool
+	cc.log.Infof("Cluster prober started with interval %s", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			cc.log.Info("Cluster prober stopped")
+			return
+		case <-ticker.C:
+			for _, clusterID := range cc.pool.GetAllClusters() {
+				_ = cc.Probe(clusterID)
+			}
+		}
+	}
+}
 
+// Probe checks a cluster's health and updates its status, without
+// collecting any other information
+func (cc *ClusterCollector) Probe(clusterID string) error {
 	// Create or update cluster information
+	cc.mu.Lock()
 	cluster, exists := cc.clusters[clusterID]
 	if !exists {
 		cluster = models.NewCluster(clusterID, clusterID, "unknown", make(map[string]interface{}))
 		cc.clusters[clusterID] = cluster
 	}
+	cc.mu.Unlock()
+
+	err := cc.pool.HealthCheck(clusterID)
+
+	status := "healthy"
+	switch {
+	case errors.Is(err, db.ErrClusterUnreachable):
+		status = string(db.ClusterStateUnreachable)
+	case err != nil:
+		status = "unhealthy"
+		if state, _ := cc.pool.GetClusterState(clusterID); state == db.ClusterStateUnreachable {
+			status = string(db.ClusterStateUnreachable)
+		}
+	}
+
+	if previous := cc.updateStatus(cluster, status); previous != status {
+		// The pool logs reachability changes, so backoff skips are not logged here
+		switch {
+		case err == nil && previous != "unknown":
+			cc.log.Infof("Cluster %s is healthy again", clusterID)
+		case err != nil && !errors.Is(err, db.ErrClusterUnreachable):
+			cc.log.Warnf("Cluster %s is %s: %v", clusterID, status, err)
+		}
+
+		for _, observer := range cc.observers {
+			observer.ClusterStatusChanged(clusterID, status, err)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	cc.freshness.Record(clusterID, "status", time.Now())
+
+	return nil
+}
+
+// updateStatus sets a cluster's status, returning the previous one. The
+// prober and the collector both update it, so it changes under the lock.
+func (cc *ClusterCollector) updateStatus(cluster *models.Cluster, status string) string {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	previous := cluster.Status
+	cluster.UpdateStatus(status)
+	return previous
+}
+
+// setConfiguration sets a part of a cluster's configuration under the lock,
+// since API requests copy it concurrently
+func (cc *ClusterCollector) setConfiguration(cluster *models.Cluster, key string, value interface{}) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cluster.Configuration[key] = value
+}
+
+// CollectClusterInfo collects information about a specific cluster
+func (cc *ClusterCollector) CollectClusterInfo(ctx context.Context, clusterID string) error {
+	if _, err := cc.pool.GetPool(clusterID); err != nil {
+		return err
+	}
 
-	// Check cluster health
-	if err := cc.pool.HealthCheck(clusterID); err != nil {
-		cluster.UpdateStatus("unhealthy")
-		cc.log.Warnf("Cluster %s is unhealthy: %v", clusterID, err)
+	if err := cc.Probe(clusterID); err != nil {
+		if errors.Is(err, db.ErrClusterUnreachable) {
+			return nil
+		}
 		return err
 	}
 
-	cluster.UpdateStatus("healthy")
+	cc.mu.RLock()
+	cluster := cc.clusters[clusterID]
+	cc.mu.RUnlock()
+	now := time.Now()
 
 	// Collect PostgreSQL version
 	version, err := cc.collectVersion(ctx, clusterID)
 	if err == nil {
-		cluster.Configuration["version"] = version
+		cc.setConfiguration(cluster, "version", version)
+		cc.freshness.Record(clusterID, "version", now)
+	} else {
+		cc.log.Warnf("Failed to collect version for cluster %s: %v", clusterID, err)
+	}
+
+	// Collect server uptime
+	uptime, err := cc.collectUptime(ctx, clusterID)
+	if err == nil {
+		cc.setConfiguration(cluster, "uptime", uptime)
+		cc.freshness.Record(clusterID, "uptime", now)
 	}
 
 	// Collect server settings
 	settings, err := cc.collectSettings(ctx, clusterID)
 	if err == nil {
-		cluster.Configuration["settings"] = settings
+		cc.setConfiguration(cluster, "settings", settings)
+		cc.freshness.Record(clusterID, "settings", now)
 	}
 
 	// Collect database list
 	databases, err := cc.collectDatabases(ctx, clusterID)
 	if err == nil {
-		cluster.Configuration["databases"] = databases
+		cc.setConfiguration(cluster, "databases", databases)
+		cc.freshness.Record(clusterID, "databases", now)
 	}
 
 	// Collect replication status
 	replStatus, err := cc.collectReplicationStatus(ctx, clusterID)
 	if err == nil {
-		cluster.Configuration["replication"] = replStatus
+		cc.setConfiguration(cluster, "replication", replStatus)
+		cc.freshness.Record(clusterID, "replication", now)
 	}
 
 	// Collect extension list
 	extensions, err := cc.collectExtensions(ctx, clusterID)
 	if err == nil {
-		cluster.Configuration["extensions"] = extensions
+		cc.setConfiguration(cluster, "extensions", extensions)
+		cc.freshness.Record(clusterID, "extensions", now)
 	}
 
 	cc.log.Debugf("Collected cluster info for %s", clusterID)
 	return nil
 }
 
-// collectVersion retrieves PostgreSQL version
-func (cc *ClusterCollector) collectVersion(ctx context.Context, clusterID string) (string, error) {
+// collectVersion retrieves and parses the PostgreSQL version
+func (cc *ClusterCollector) collectVersion(ctx context.Context, clusterID string) (models.PGVersion, error) {
 	pool, err := cc.pool.GetPool(clusterID)
 	if err != nil {
-		return "", err
+		return models.PGVersion{}, err
 	}
 
-	_ = pool
-
 	query := "SELECT version()"
-	_ = query
 
-	// Placeholder
-	return "PostgreSQL 15.3", nil
+	var full string
+	if err := pool.QueryRow(ctx, query).Scan(&full); err != nil {
+		return models.PGVersion{}, err
+	}
+
+	return models.ParsePGVersion(full)
+}
+
+// collectUptime retrieves when the server was started
+func (cc *ClusterCollector) collectUptime(ctx context.Context, clusterID string) (models.ServerUptime, error) {
+	startedAt, err := cc.startTime(ctx, clusterID)
+	if err != nil {
+		return models.ServerUptime{}, err
+	}
+
+	return models.ServerUptime{
+		StartedAt:     startedAt,
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+	}, nil
 }
 
-// collectSettings retrieves important PostgreSQL settings
+// startTime returns when the server was started, from the start time source
+// when there is one
+func (cc *ClusterCollector) startTime(ctx context.Context, clusterID string) (time.Time, error) {
+	if cc.startTimes != nil {
+		startedAt, ok := cc.startTimes.ServerStartTime(clusterID)
+		if !ok {
+			return time.Time{}, fmt.Errorf("start time of cluster %s not collected yet", clusterID)
+		}
+		return startedAt, nil
+	}
+
+	pool, err := cc.pool.GetPool(clusterID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	query := "SELECT pg_postmaster_start_time()"
+
+	var startedAt time.Time
+	if err := pool.QueryRow(ctx, query).Scan(&startedAt); err != nil {
+		return time.Time{}, err
+	}
+
+	return startedAt, nil
+}
+
+// collectSettings retrieves the configured PostgreSQL settings. Settings the
+// server doesn't know are left out of the map.
 func (cc *ClusterCollector) collectSettings(ctx context.Context, clusterID string) (map[string]string, error) {
 	pool, err := cc.pool.GetPool(clusterID)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = pool
-
 	query := `
-		SELECT name, setting, unit
+		SELECT name, setting, COALESCE(unit, '')
 		FROM pg_settings
-		WHERE name IN (
-			'max_connections',
-			'shared_buffers',
-			'effective_cache_size',
-			'maintenance_work_mem',
-			'work_mem',
-			'max_worker_processes',
-			'max_parallel_workers',
-			'wal_level',
-			'max_wal_senders',
-			'max_replication_slots'
-		)
+		WHERE name = ANY($1)
 	`
 
-	_ = query
+	rows, err := queryWithFallback(ctx, cc.log, pool, query, cc.settings)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
 
-	// Placeholder
-	settings := map[string]string{
-		"max_connections":      "100",
-		"shared_buffers":       "128MB",
-		"effective_cache_size": "4GB",
-		"work_mem":             "4MB",
+	for rows.Next() {
+		var name, setting, unit string
+		if err := rows.Scan(&name, &setting, &unit); err != nil {
+			return nil, err
+		}
+		settings[name] = formatSetting(setting, unit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	return settings, nil
 }
 
-// collectDatabases retrieves list of databases
-func (cc *ClusterCollector) collectDatabases(ctx context.Context, clusterID string) ([]string, error) {
+// memoryUnits are the pg_settings memory units in bytes, largest first
+var memoryUnits = []struct {
+	name  string
+	bytes int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"kB", 1 << 10},
+	{"B", 1},
+}
+
+// formatSetting appends a setting's unit to its value. Memory settings are
+// stored in multiples like "8kB", so they are converted to the largest unit
+// that represents them exactly, e.g. 16384 with unit 8kB becomes "128MB".
+func formatSetting(setting, unit string) string {
+	if unit == "" {
+		return setting
+	}
+
+	multiplier := int64(1)
+	baseUnit := strings.TrimLeft(unit, "0123456789")
+	if prefix := strings.TrimSuffix(unit, baseUnit); prefix != "" {
+		multiplier, _ = strconv.ParseInt(prefix, 10, 64)
+	}
+
+	value, err := strconv.ParseInt(setting, 10, 64)
+	if err != nil {
+		return setting + unit
+	}
+	if value < 0 {
+		// -1 means disabled or "use the default", which has no size
+		return setting
+	}
+
+	for _, base := range memoryUnits {
+		if base.name != baseUnit {
+			continue
+		}
+		bytes := value * multiplier * base.bytes
+		for _, u := range memoryUnits {
+			if bytes%u.bytes == 0 {
+				return strconv.FormatInt(bytes/u.bytes, 10) + u.name
+			}
+		}
+	}
+
+	return strconv.FormatInt(value*multiplier, 10) + baseUnit
+}
+
+// collectDatabases retrieves the non-template databases and their sizes, sorted by name
+func (cc *ClusterCollector) collectDatabases(ctx context.Context, clusterID string) ([]models.DatabaseInfo, error) {
 	pool, err := cc.pool.GetPool(clusterID)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = pool
-
+	// pg_database_size requires CONNECT, so sizes of inaccessible databases report 0
 	query := `
-		SELECT datname
+		SELECT 
+			datname,
+			COALESCE(CASE WHEN has_database_privilege(datname, 'CONNECT') THEN pg_database_size(datname) END, 0) as size_bytes
 		FROM pg_database
 		WHERE datistemplate = false
 		ORDER BY datname
 	`
 
-	_ = query
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	// Placeholder
-	databases := []string{"postgres", "myapp"}
+	databases := make([]models.DatabaseInfo, 0)
+
+	for rows.Next() {
+		var database models.DatabaseInfo
+		if err := rows.Scan(&database.Name, &database.SizeBytes); err != nil {
+			return nil, err
+		}
+		databases = append(databases, database)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return databases, nil
 }
 
-// collectReplicationStatus retrieves replication status
-func (cc *ClusterCollector) collectReplicationStatus(ctx context.Context, clusterID string) (map[string]interface{}, error) {
+// collectReplicationStatus retrieves the node's role and, on a primary, its replicas
+func (cc *ClusterCollector) collectReplicationStatus(ctx context.Context, clusterID string) (*models.ReplicationStatus, error) {
 	pool, err := cc.pool.GetPool(clusterID)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = pool
+	var inRecovery bool
+	if err := pool.QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&inRecovery); err != nil {
+		return nil, err
+	}
+
+	replStatus := &models.ReplicationStatus{
+		IsPrimary: !inRecovery,
+		Replicas:  make([]models.ReplicaInfo, 0),
+	}
+
+	// Standbys only list cascading replicas here; report them from the primary
+	if inRecovery {
+		return replStatus, nil
+	}
 
 	query := `
 		SELECT 
-			application_name,
-			client_addr,
-			state,
-			sync_state,
-			sent_lsn,
-			write_lsn,
-			flush_lsn,
-			replay_lsn,
-			sync_priority,
-			EXTRACT(EPOCH FROM (NOW() - backend_start))::int as uptime_seconds
+			COALESCE(application_name, ''),
+			COALESCE(host(client_addr), ''),
+			COALESCE(state, ''),
+			COALESCE(sync_state, ''),
+			COALESCE(sent_lsn::text, ''),
+			COALESCE(write_lsn::text, ''),
+			COALESCE(flush_lsn::text, ''),
+			COALESCE(replay_lsn::text, ''),
+			COALESCE(sync_priority, 0),
+			EXTRACT(EPOCH FROM (NOW() - backend_start))::int as uptime_seconds,
+			COALESCE(pg_wal_lsn_diff(sent_lsn, replay_lsn), 0)::bigint as lag_bytes
 		FROM pg_stat_replication
+		ORDER BY application_name
 	`
 
-	_ = query
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var replica models.ReplicaInfo
+		if err := rows.Scan(
+			&replica.ApplicationName,
+			&replica.ClientAddr,
+			&replica.State,
+			&replica.SyncState,
+			&replica.SentLSN,
+			&replica.WriteLSN,
+			&replica.FlushLSN,
+			&replica.ReplayLSN,
+			&replica.SyncPriority,
+			&replica.UptimeSeconds,
+			&replica.LagBytes,
+		); err != nil {
+			return nil, err
+		}
+		replStatus.Replicas = append(replStatus.Replicas, replica)
+	}
 
-	// Placeholder
-	replStatus := map[string]interface{}{
-		"is_primary": true,
-		"replicas":   []interface{}{},
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	return replStatus, nil
 }
 
-// collectExtensions retrieves list of installed extensions
-func (cc *ClusterCollector) collectExtensions(ctx context.Context, clusterID string) ([]string, error) {
+// collectExtensions retrieves the installed extensions and their versions
+func (cc *ClusterCollector) collectExtensions(ctx context.Context, clusterID string) ([]models.ExtensionInfo, error) {
 	pool, err := cc.pool.GetPool(clusterID)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = pool
-
 	query := `
-		SELECT extname
+		SELECT extname, extversion
 		FROM pg_extension
 		ORDER BY extname
 	`
 
-	_ = query
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	// Placeholder
-	extensions := []string{"pg_stat_statements", "pgcrypto"}
+	extensions := make([]models.ExtensionInfo, 0)
+
+	for rows.Next() {
+		var extension models.ExtensionInfo
+		if err := rows.Scan(&extension.Name, &extension.Version); err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, extension)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return extensions, nil
 }
 
-// GetCluster returns cluster information
+// GetCluster returns a copy of a cluster's information with its current freshness
 func (cc *ClusterCollector) GetCluster(clusterID string) (*models.Cluster, error) {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
 	cluster, exists := cc.clusters[clusterID]
 	if !exists {
 		return nil, fmt.Errorf("cluster %s not found", clusterID)
 	}
 
-	return cluster, nil
+	return cc.snapshot(cluster, time.Now()), nil
 }
 
-// GetAllClusters returns all cluster information
+// GetAllClusters returns copies of all cluster information with its current freshness
 func (cc *ClusterCollector) GetAllClusters() []*models.Cluster {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
+	now := time.Now()
 	clusters := make([]*models.Cluster, 0, len(cc.clusters))
 	for _, cluster := range cc.clusters {
-		clusters = append(clusters, cluster)
+		clusters = append(clusters, cc.snapshot(cluster, now))
 	}
 
 	return clusters
 }
 
+// snapshot copies a cluster's information with its freshness at now, so
+// callers can read it while collection goes on. It must be called with the
+// lock held.
+func (cc *ClusterCollector) snapshot(cluster *models.Cluster, now time.Time) *models.Cluster {
+	copied := *cluster
+	copied.Configuration = maps.Clone(cluster.Configuration)
+	copied.Metrics = maps.Clone(cluster.Metrics)
+	copied.Freshness = cc.freshness.Freshness(cluster.ID, now)
+	return &copied
+}
+
 // RegisterCluster registers a new cluster for monitoring
 func (cc *ClusterCollector) RegisterCluster(cluster *models.Cluster) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
 	cc.clusters[cluster.ID] = cluster
 	cc.log.Infof("Registered cluster %s for monitoring", cluster.ID)
 }
 
 // UnregisterCluster removes a cluster from monitoring
 func (cc *ClusterCollector) UnregisterCluster(clusterID string) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
 	if _, exists := cc.clusters[clusterID]; !exists {
 		return fmt.Errorf("cluster %s not found", clusterID)
 	}
 
 	delete(cc.clusters, clusterID)
+	cc.freshness.Reset(clusterID)
 	cc.log.Infof("Unregistered cluster %s from monitoring", clusterID)
 
 	return nil
@@ -0,0 +1,269 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zvdy/pgao/src/db"
+	"github.com/zvdy/pgao/src/models"
+	"github.com/zvdy/pgao/src/pgtest"
+)
+
+// newTestClusterCollector returns a cluster collector with a cluster named
+// main, whose queries are answered by the returned server
+func newTestClusterCollector(t *testing.T) (*ClusterCollector, *pgtest.Server) {
+	t.Helper()
+
+	mc, server := newTestCollector(t)
+	return NewClusterCollector(mc.pool, mc.log, time.Minute), server
+}
+
+// statusChanges records the status changes a collector reports
+type statusChanges []string
+
+func (sc *statusChanges) ClusterStatusChanged(clusterID, status string, err error) {
+	*sc = append(*sc, clusterID+" "+status)
+}
+
+func TestProbeReportsStatusChanges(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cc := NewClusterCollector(db.NewConnectionPool(log), log, time.Hour)
+	changes := &statusChanges{}
+	cc.AddStatusObserver(changes)
+
+	// The pool has no connection to the cluster, so every probe fails
+	for i := 0; i < 3; i++ {
+		if err := cc.Probe("main"); err == nil {
+			t.Fatal("probe of a cluster without a pool succeeded")
+		}
+	}
+
+	cluster, err := cc.GetCluster("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.Status != "unhealthy" {
+		t.Errorf("status = %s, want unhealthy without waiting for a collection", cluster.Status)
+	}
+	if len(*changes) != 1 || (*changes)[0] != "main unhealthy" {
+		t.Errorf("changes = %q, want the one change to unhealthy", *changes)
+	}
+}
+
+func TestGetClusterReturnsCopy(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cc := NewClusterCollector(nil, log, time.Minute)
+
+	cluster := models.NewCluster("main", "main", "healthy", map[string]interface{}{"version": "16.2"})
+	cc.RegisterCluster(cluster)
+	cc.freshness.Record("main", "status", time.Now())
+
+	got, err := cc.GetCluster("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == cluster {
+		t.Fatal("GetCluster returned the collector's own cluster")
+	}
+	if _, ok := got.Freshness["status"]; !ok {
+		t.Errorf("freshness = %v, want the status group", got.Freshness)
+	}
+
+	got.Configuration["version"] = "changed"
+	got.Status = "changed"
+	if cluster.Configuration["version"] != "16.2" || cluster.Status != "healthy" {
+		t.Error("changing the copy changed the collector's cluster")
+	}
+	if len(cluster.Freshness) != 0 {
+		t.Error("GetCluster wrote freshness to the collector's cluster")
+	}
+}
+
+func TestGetAllClustersWhileCollecting(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cc := NewClusterCollector(nil, log, time.Minute)
+
+	cluster := models.NewCluster("main", "main", "healthy", make(map[string]interface{}))
+	cc.RegisterCluster(cluster)
+
+	// Run with -race to catch readers and the collector sharing the maps
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			cc.setConfiguration(cluster, "uptime", i)
+			cc.freshness.Record("main", "uptime", time.Now())
+			cc.updateStatus(cluster, "healthy")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if _, err := json.Marshal(cc.GetAllClusters()); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestFormatSetting(t *testing.T) {
+	tests := []struct {
+		setting, unit, want string
+	}{
+		{"100", "", "100"},
+		{"16384", "8kB", "128MB"},
+		{"4096", "kB", "4MB"},
+		{"1000", "kB", "1000kB"},
+		{"2097152", "kB", "2GB"},
+		{"64", "MB", "64MB"},
+		{"-1", "kB", "-1"},
+		{"30000", "ms", "30000ms"},
+		{"on", "", "on"},
+	}
+
+	for _, tt := range tests {
+		if got := formatSetting(tt.setting, tt.unit); got != tt.want {
+			t.Errorf("formatSetting(%q, %q) = %q, want %q", tt.setting, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestCollectSettings(t *testing.T) {
+	cc, server := newTestClusterCollector(t)
+	cc.AddSettings("pg_stat_statements.track")
+	server.Handle("FROM pg_settings", pgtest.Result{
+		Columns: []string{"name", "setting", "unit"},
+		Rows: [][]any{
+			{"max_connections", "100", ""},
+			{"shared_buffers", "16384", "8kB"},
+			{"work_mem", "4096", "kB"},
+		},
+	})
+
+	settings, err := cc.collectSettings(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"max_connections": "100", "shared_buffers": "128MB", "work_mem": "4MB"}
+	if !maps.Equal(settings, want) {
+		t.Errorf("settings = %v, want %v", settings, want)
+	}
+
+	// Settings the server doesn't know are still asked for, but left out
+	queries := server.Queries()
+	if args := queries[len(queries)-1].Args; len(args) != 1 || !strings.Contains(args[0], "pg_stat_statements.track") {
+		t.Errorf("args = %q, want the added setting among the names", args)
+	}
+	if _, ok := settings["pg_stat_statements.track"]; ok {
+		t.Error("a setting the server didn't return was reported")
+	}
+}
+
+func TestCollectDatabases(t *testing.T) {
+	cc, server := newTestClusterCollector(t)
+	server.Handle("FROM pg_database", pgtest.Result{
+		Columns: []string{"datname", "size_bytes"},
+		Rows: [][]any{
+			{"app", int64(512 << 20)},
+			{"postgres", int64(8 << 20)},
+			// Sizes of databases pgao can't connect to are 0
+			{"restricted", int64(0)},
+		},
+	})
+
+	databases, err := cc.collectDatabases(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.DatabaseInfo{{Name: "app", SizeBytes: 512 << 20}, {Name: "postgres", SizeBytes: 8 << 20}, {Name: "restricted"}}
+	if !slices.Equal(databases, want) {
+		t.Errorf("databases = %+v, want %+v", databases, want)
+	}
+
+	queries := server.Queries()
+	sql := queries[len(queries)-1].SQL
+	if !strings.Contains(sql, "datistemplate = false") || !strings.Contains(sql, "ORDER BY datname") {
+		t.Errorf("query %q, want non-template databases sorted by name", sql)
+	}
+}
+
+func TestCollectReplicationStatus(t *testing.T) {
+	cc, server := newTestClusterCollector(t)
+	server.Handle("SELECT pg_is_in_recovery()", pgtest.Result{Columns: []string{"pg_is_in_recovery"}, Rows: [][]any{{false}}})
+	server.Handle("FROM pg_stat_replication", pgtest.Result{
+		Columns: []string{
+			"application_name", "client_addr", "state", "sync_state", "sent_lsn", "write_lsn",
+			"flush_lsn", "replay_lsn", "sync_priority", "uptime_seconds", "lag_bytes",
+		},
+		Rows: [][]any{
+			{"replica-a", "10.0.0.2", "streaming", "sync", "0/3000060", "0/3000060", "0/3000060", "0/3000060", int32(1), int32(3600), int64(0)},
+			{"replica-b", "10.0.0.3", "streaming", "async", "0/3000060", "0/3000000", "0/3000000", "0/2FFFF00", int32(0), int32(120), int64(352)},
+		},
+	})
+
+	status, err := cc.collectReplicationStatus(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsPrimary || len(status.Replicas) != 2 {
+		t.Fatalf("status = %+v, want a primary with two replicas", status)
+	}
+	want := []models.ReplicaInfo{
+		{ApplicationName: "replica-a", ClientAddr: "10.0.0.2", State: "streaming", SyncState: "sync", SentLSN: "0/3000060", WriteLSN: "0/3000060", FlushLSN: "0/3000060", ReplayLSN: "0/3000060", SyncPriority: 1, UptimeSeconds: 3600},
+		{ApplicationName: "replica-b", ClientAddr: "10.0.0.3", State: "streaming", SyncState: "async", SentLSN: "0/3000060", WriteLSN: "0/3000000", FlushLSN: "0/3000000", ReplayLSN: "0/2FFFF00", UptimeSeconds: 120, LagBytes: 352},
+	}
+	if !slices.Equal(status.Replicas, want) {
+		t.Errorf("replicas = %+v, want %+v", status.Replicas, want)
+	}
+
+	// Standbys don't list their cascading replicas
+	server.Handle("SELECT pg_is_in_recovery()", pgtest.Result{Columns: []string{"pg_is_in_recovery"}, Rows: [][]any{{true}}})
+	status, err = cc.collectReplicationStatus(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.IsPrimary || status.Replicas == nil || len(status.Replicas) != 0 {
+		t.Errorf("standby status = %+v, want no replicas", status)
+	}
+}
+
+func TestCollectExtensions(t *testing.T) {
+	cc, server := newTestClusterCollector(t)
+	server.Handle("FROM pg_extension", pgtest.Result{Columns: []string{"extname", "extversion"}})
+
+	// No extensions marshal as an empty list rather than null
+	extensions, err := cc.collectExtensions(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extensions == nil || len(extensions) != 0 {
+		t.Errorf("extensions = %#v, want an empty slice", extensions)
+	}
+
+	server.Handle("FROM pg_extension", pgtest.Result{
+		Columns: []string{"extname", "extversion"},
+		Rows:    [][]any{{"pg_stat_statements", "1.10"}, {"plpgsql", "1.0"}},
+	})
+	extensions, err = cc.collectExtensions(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.ExtensionInfo{{Name: "pg_stat_statements", Version: "1.10"}, {Name: "plpgsql", Version: "1.0"}}
+	if !slices.Equal(extensions, want) {
+		t.Errorf("extensions = %+v, want %+v", extensions, want)
+	}
+}
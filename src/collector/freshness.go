@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// freshnessTracker remembers when each metric group of a cluster was last
+// collected successfully, so values can be reported with their age
+type freshnessTracker struct {
+	mu          sync.Mutex
+	collectedAt map[string]map[string]time.Time // clusterID -> group -> last success
+	staleAfter  time.Duration
+}
+
+// newFreshnessTracker creates a freshnessTracker that reports groups not
+// collected within staleAfter as stale
+func newFreshnessTracker(staleAfter time.Duration) *freshnessTracker {
+	return &freshnessTracker{
+		collectedAt: make(map[string]map[string]time.Time),
+		staleAfter:  staleAfter,
+	}
+}
+
+// Record marks a metric group of a cluster as collected at a point in time
+func (ft *freshnessTracker) Record(clusterID, group string, at time.Time) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	groups, exists := ft.collectedAt[clusterID]
+	if !exists {
+		groups = make(map[string]time.Time)
+		ft.collectedAt[clusterID] = groups
+	}
+	groups[group] = at
+}
+
+// Freshness returns the last collection time of every group of a cluster
+// that was ever collected, flagging the ones older than staleAfter at now
+func (ft *freshnessTracker) Freshness(clusterID string, now time.Time) map[string]models.Freshness {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	freshness := make(map[string]models.Freshness, len(ft.collectedAt[clusterID]))
+	for group, at := range ft.collectedAt[clusterID] {
+		freshness[group] = models.Freshness{
+			LastCollectedAt: at,
+			Stale:           now.Sub(at) > ft.staleAfter,
+		}
+	}
+
+	return freshness
+}
+
+// Reset forgets the collection times of a cluster
+func (ft *freshnessTracker) Reset(clusterID string) {
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+
+	delete(ft.collectedAt, clusterID)
+}
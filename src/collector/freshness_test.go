@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/zvdy/pgao/src/models"
+	"github.com/zvdy/pgao/src/pgtest"
+)
+
+func TestFreshnessPerGroup(t *testing.T) {
+	ft := newFreshnessTracker(2 * time.Minute)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ft.Record("main", models.MetricGroupCache, start)
+	ft.Record("main", models.MetricGroupLocks, start.Add(2*time.Minute))
+	ft.Record("other", models.MetricGroupCache, start)
+
+	freshness := ft.Freshness("main", start.Add(3*time.Minute))
+	if len(freshness) != 2 {
+		t.Fatalf("freshness = %v, want the cache and lock groups of main", freshness)
+	}
+	if cache := freshness[models.MetricGroupCache]; !cache.LastCollectedAt.Equal(start) || !cache.Stale {
+		t.Errorf("cache = %+v, want stale after 3 minutes", cache)
+	}
+	if locks := freshness[models.MetricGroupLocks]; !locks.LastCollectedAt.Equal(start.Add(2*time.Minute)) || locks.Stale {
+		t.Errorf("locks = %+v, want fresh after a minute", locks)
+	}
+
+	ft.Reset("main")
+	if freshness := ft.Freshness("main", start); len(freshness) != 0 {
+		t.Errorf("freshness after reset = %v, want none", freshness)
+	}
+	if freshness := ft.Freshness("other", start); len(freshness) != 1 {
+		t.Errorf("freshness of other = %v, want its cache group kept", freshness)
+	}
+}
+
+func TestFailedSubCollectorKeepsItsFreshness(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("as cache_hit_ratio", pgtest.Result{Columns: []string{"cache_hit_ratio"}, Rows: [][]any{{99.5}}})
+
+	first, err := mc.CollectClusterMetrics(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, ok := first.Freshness[models.MetricGroupCache]
+	if !ok || !cache.LastCollectedAt.Equal(first.Timestamp) {
+		t.Fatalf("freshness = %v, want the cache group collected now", first.Freshness)
+	}
+	if _, ok := first.Freshness[models.MetricGroupBloat]; ok {
+		t.Error("the failed bloat collection has a freshness")
+	}
+
+	// The cache collection fails from now on
+	server.Handle("as cache_hit_ratio", pgtest.Result{Err: &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}})
+	second, err := mc.CollectClusterMetrics(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache := second.Freshness[models.MetricGroupCache]; !cache.LastCollectedAt.Equal(first.Timestamp) {
+		t.Errorf("cache collected at %v, want the previous collection at %v", cache.LastCollectedAt, first.Timestamp)
+	}
+	if pool := second.Freshness[models.MetricGroupPool]; !pool.LastCollectedAt.Equal(second.Timestamp) {
+		t.Errorf("pool collected at %v, want this collection at %v", pool.LastCollectedAt, second.Timestamp)
+	}
+}
@@ -2,31 +2,102 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 	"github.com/zvdy/pgao/src/db"
 	"github.com/zvdy/pgao/src/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates the spans of metric collection
+var tracer = otel.Tracer("github.com/zvdy/pgao/src/collector")
+
+// MetricsSink receives the metrics of each cluster after every collection
+type MetricsSink interface {
+	Export(ctx context.Context, metrics *models.Metrics) error
+}
+
 // MetricsCollector gathers performance metrics from PostgreSQL clusters
 type MetricsCollector struct {
-	pool     *db.ConnectionPool
-	log      *logrus.Logger
-	interval time.Duration
+	pool      *db.ConnectionPool
+	log       *logrus.Logger
+	interval  time.Duration
+	sinks     []MetricsSink
+	rates     *rateTracker
+	restarts  *restartTracker
+	waits     *waitHistory
+	freshness *freshnessTracker
+	versions  *versionCache
+	latest    *latestMetrics
+	duration  *prometheus.HistogramVec
+	gauges    *clusterGauges
 }
 
 // NewMetricsCollector creates a new MetricsCollector instance
 func NewMetricsCollector(pool *db.ConnectionPool, log *logrus.Logger, interval time.Duration) *MetricsCollector {
 	return &MetricsCollector{
-		pool:     pool,
-		log:      log,
-		interval: interval,
+		pool:      pool,
+		log:       log,
+		interval:  interval,
+		rates:     newRateTracker(),
+		restarts:  newRestartTracker(),
+		waits:     newWaitHistory(),
+		freshness: newFreshnessTracker(2 * interval),
+		versions:  newVersionCache(),
+		latest:    newLatestMetrics(),
 	}
 }
 
+// AddSink registers a sink that receives metrics collected by the background loop.
+// Sinks must be added before Start.
+func (mc *MetricsCollector) AddSink(sink MetricsSink) {
+	mc.sinks = append(mc.sinks, sink)
+}
+
+// RegisterDurationMetrics registers a histogram of how long collecting each
+// cluster takes, with the given buckets or the defaults when none are given.
+// It must be called before Start.
+func (mc *MetricsCollector) RegisterDurationMetrics(reg prometheus.Registerer, buckets []float64) {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	mc.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pgao_collect_duration_seconds",
+		Help:    "Time taken to collect a cluster's metrics, by cluster.",
+		Buckets: buckets,
+	}, []string{"cluster"})
+	reg.MustRegister(mc.duration)
+}
+
+// ResetBaseline clears the stored counter samples and start time of a
+// cluster, so the next collection reports zero rates instead of a delta
+// across a stats reset, and doesn't take a new server for a restart
+func (mc *MetricsCollector) ResetBaseline(clusterID string) {
+	mc.rates.Reset(clusterID)
+	mc.restarts.Reset(clusterID)
+	mc.versions.Reset(clusterID)
+}
+
+// ServerStartTime returns the postmaster start time of a cluster from its
+// last collection
+func (mc *MetricsCollector) ServerStartTime(clusterID string) (time.Time, bool) {
+	return mc.restarts.StartedAt(clusterID)
+}
+
 // Start begins collecting metrics for all clusters
 func (mc *MetricsCollector) Start(ctx context.Context) {
 	ticker := time.NewTicker(mc.interval)
@@ -50,14 +121,52 @@ func (mc *MetricsCollector) collectAllMetrics(ctx context.Context) {
 	clusters := mc.pool.GetAllClusters()
 
 	for _, clusterID := range clusters {
-		if _, err := mc.CollectClusterMetrics(ctx, clusterID); err != nil {
+		// Unreachable clusters are left to the health checks until they recover
+		if state, err := mc.pool.GetClusterState(clusterID); err == nil && state != db.ClusterStateReachable {
+			mc.log.Debugf("Skipping metrics collection for %s cluster %s", state, clusterID)
+			if mc.gauges != nil {
+				mc.gauges.down(clusterID)
+			}
+			continue
+		}
+
+		// Pool stats are recorded first so this cycle's pool pressure is part of the metrics
+		if err := mc.pool.RecordPoolStats(clusterID); err != nil {
+			mc.log.Warnf("Failed to record pool stats for cluster %s: %v", clusterID, err)
+		}
+
+		start := time.Now()
+		metrics, err := mc.CollectClusterMetrics(ctx, clusterID)
+		if mc.duration != nil {
+			mc.duration.WithLabelValues(clusterID).Observe(time.Since(start).Seconds())
+		}
+		if err != nil {
 			mc.log.Errorf("Failed to collect metrics for cluster %s: %v", clusterID, err)
+			if mc.gauges != nil {
+				mc.gauges.down(clusterID)
+			}
+		} else {
+			mc.latest.Set(metrics)
+			if mc.gauges != nil {
+				mc.gauges.observe(metrics)
+			}
+			if metrics.IsCollected(models.MetricGroupWaitEvents) {
+				mc.waits.Record(clusterID, metrics.Timestamp, metrics.WaitEvents)
+			}
+			for _, sink := range mc.sinks {
+				if err := sink.Export(ctx, metrics); err != nil {
+					mc.log.Warnf("Failed to export metrics for cluster %s: %v", clusterID, err)
+				}
+			}
 		}
 	}
 }
 
 // CollectClusterMetrics collects metrics for a specific cluster and returns them
 func (mc *MetricsCollector) CollectClusterMetrics(ctx context.Context, clusterID string) (*models.Metrics, error) {
+	ctx, span := tracer.Start(ctx, "CollectClusterMetrics", trace.WithAttributes(attribute.String("pgao.cluster_id", clusterID)))
+	defer span.End()
+
 	metrics := models.NewMetrics(clusterID)
 
 	pool, err := mc.pool.GetPool(clusterID)
@@ -65,43 +174,77 @@ func (mc *MetricsCollector) CollectClusterMetrics(ctx context.Context, clusterID
 		return nil, err
 	}
 
-	// Collect connection metrics
-	if err := mc.collectConnectionMetrics(ctx, pool, metrics); err != nil {
-		mc.log.Warnf("Failed to collect connection metrics: %v", err)
+	subCollectors := []struct {
+		name    string
+		group   string
+		collect func(context.Context, *pgxpool.Pool, *models.Metrics) error
+	}{
+		{"uptime", models.MetricGroupUptime, mc.collectUptimeMetrics},
+		{"connection", models.MetricGroupConnections, mc.collectConnectionMetrics},
+		{"cache", models.MetricGroupCache, mc.collectCacheMetrics},
+		{"transaction", models.MetricGroupTransactions, mc.collectTransactionMetrics},
+		{"lock", models.MetricGroupLocks, mc.collectLockMetrics},
+		{"replication", models.MetricGroupReplication, mc.collectReplicationMetrics},
+		{"replication slot", models.MetricGroupReplicationSlots, mc.collectReplicationSlotMetrics},
+		{"bloat", models.MetricGroupBloat, mc.collectBloatMetrics},
+		{"disk I/O", models.MetricGroupDiskIO, mc.collectDiskIOMetrics},
+		{"wait event", models.MetricGroupWaitEvents, mc.collectWaitEvents},
+		{"temp schema", models.MetricGroupTempSchemas, mc.collectTempSchemaMetrics},
 	}
 
-	// Collect cache metrics
-	if err := mc.collectCacheMetrics(ctx, pool, metrics); err != nil {
-		mc.log.Warnf("Failed to collect cache metrics: %v", err)
-	}
+	for _, sub := range subCollectors {
+		// Each sub-collector gets a span, so slow catalog queries stand out
+		subCtx, subSpan := tracer.Start(ctx, "collect "+sub.name+" metrics")
+		err := sub.collect(subCtx, pool, metrics)
+		if err != nil {
+			subSpan.SetStatus(codes.Error, err.Error())
+		}
+		subSpan.End()
 
-	// Collect transaction metrics
-	if err := mc.collectTransactionMetrics(ctx, pool, metrics); err != nil {
-		mc.log.Warnf("Failed to collect transaction metrics: %v", err)
+		if err != nil {
+			mc.log.Warnf("Failed to collect %s metrics: %v", sub.name, err)
+			continue
+		}
+		metrics.MarkCollected(sub.group)
+		mc.freshness.Record(clusterID, sub.group, metrics.Timestamp)
 	}
 
-	// Collect lock metrics
-	if err := mc.collectLockMetrics(ctx, pool, metrics); err != nil {
-		mc.log.Warnf("Failed to collect lock metrics: %v", err)
+	if pressure, err := mc.pool.PoolPressure(clusterID); err == nil {
+		metrics.PoolEmptyAcquireStreak = pressure.EmptyAcquireStreak
+		metrics.PoolAcquireWaitMs = pressure.AcquireWaitMs
+		metrics.MarkCollected(models.MetricGroupPool)
+		mc.freshness.Record(clusterID, models.MetricGroupPool, metrics.Timestamp)
 	}
+	metrics.Freshness = mc.freshness.Freshness(clusterID, metrics.Timestamp)
 
-	// Collect replication metrics
-	if err := mc.collectReplicationMetrics(ctx, pool, metrics); err != nil {
-		mc.log.Warnf("Failed to collect replication metrics: %v", err)
-	}
+	mc.log.Debugf("Collected metrics for cluster %s", clusterID)
+	return metrics, nil
+}
+
+// collectUptimeMetrics collects the server start time and uptime, flagging
+// a restart since the previous collection. A restart also resets the
+// cumulative statistics counters.
+func (mc *MetricsCollector) collectUptimeMetrics(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
+	query := "SELECT pg_postmaster_start_time()"
 
-	// Collect table bloat metrics
-	if err := mc.collectBloatMetrics(ctx, pool, metrics); err != nil {
-		mc.log.Warnf("Failed to collect bloat metrics: %v", err)
+	var startedAt time.Time
+	if err := pool.QueryRow(ctx, query).Scan(&startedAt); err != nil {
+		return err
 	}
 
-	// Collect disk I/O metrics
-	if err := mc.collectDiskIOMetrics(ctx, pool, metrics); err != nil {
-		mc.log.Warnf("Failed to collect disk I/O metrics: %v", err)
+	metrics.ServerStartTime = startedAt
+	metrics.UptimeSeconds = int64(metrics.Timestamp.Sub(startedAt).Seconds())
+	metrics.Restarted = mc.restarts.Observe(metrics.ClusterID, startedAt)
+	if metrics.Restarted {
+		// Counters may have grown past their old values since the restart,
+		// so a drop alone wouldn't reveal the reset
+		mc.log.Warnf("Cluster %s restarted at %s, resetting counter baselines", metrics.ClusterID, startedAt.Format(time.RFC3339))
+		mc.rates.Reset(metrics.ClusterID)
+		// The server may have been upgraded while it was down
+		mc.versions.Reset(metrics.ClusterID)
 	}
 
-	mc.log.Debugf("Collected metrics for cluster %s", clusterID)
-	return metrics, nil
+	return nil
 }
 
 // collectConnectionMetrics collects connection-related metrics
@@ -159,28 +302,23 @@ func (mc *MetricsCollector) collectTransactionMetrics(ctx context.Context, pool
 		return err
 	}
 
-	// Calculate TPS (simplified - real implementation would track delta over time)
-	metrics.TransactionsPerSec = float64(totalTxn) / 60.0 // Rough estimate
+	metrics.TransactionsPerSec = mc.rates.Rate(metrics.ClusterID, "transactions", totalTxn, metrics.Timestamp)
 
 	return nil
 }
 
 // collectLockMetrics collects lock-related metrics
 func (mc *MetricsCollector) collectLockMetrics(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
-	query := `
-		SELECT 
-			COUNT(*) as lock_waits
-		FROM pg_locks
-		WHERE NOT granted
-	`
-
-	var lockWaits int
-
-	if err := pool.QueryRow(ctx, query).Scan(&lockWaits); err != nil {
+	lockWaits, err := mc.queryLockWaits(ctx, metrics.ClusterID, pool)
+	if err != nil {
 		return err
 	}
 
-	metrics.LockWaits = lockWaits
+	metrics.LockWaitsByType = make(map[string]int)
+	for _, summary := range lockWaits {
+		metrics.LockWaits += summary.Count
+		metrics.LockWaitsByType[summary.LockType] += summary.Count
+	}
 
 	deadlocksQuery := `
 		SELECT 
@@ -189,15 +327,82 @@ func (mc *MetricsCollector) collectLockMetrics(ctx context.Context, pool *pgxpoo
 		WHERE datname = current_database()
 	`
 
-	var deadlocks int
+	var deadlocks int64
 
 	if err := pool.QueryRow(ctx, deadlocksQuery).Scan(&deadlocks); err == nil {
-		metrics.DeadlockCount = deadlocks
+		metrics.DeadlockCount = int(mc.rates.Delta(metrics.ClusterID, "deadlocks", deadlocks, metrics.Timestamp))
 	}
 
 	return nil
 }
 
+// queryLockWaits returns ungranted locks grouped by lock type and mode
+func (mc *MetricsCollector) queryLockWaits(ctx context.Context, clusterID string, pool *pgxpool.Pool) ([]models.LockWaitSummary, error) {
+	version, err := mc.serverVersion(ctx, clusterID, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	// pg_locks.waitstart was added in PostgreSQL 14
+	waitExpr := "0"
+	if version.AtLeast(14, 0) {
+		waitExpr = "COALESCE(EXTRACT(EPOCH FROM (NOW() - waitstart)) * 1000, 0)"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT 
+			locktype,
+			mode,
+			COUNT(*) as waiting,
+			COALESCE(MAX(%[1]s), 0)::float8 as max_wait_ms,
+			COALESCE(AVG(%[1]s), 0)::float8 as avg_wait_ms
+		FROM pg_locks
+		WHERE NOT granted
+		GROUP BY locktype, mode
+		ORDER BY waiting DESC
+	`, waitExpr)
+
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockWaits := make([]models.LockWaitSummary, 0)
+
+	for rows.Next() {
+		var summary models.LockWaitSummary
+
+		if err := rows.Scan(
+			&summary.LockType,
+			&summary.Mode,
+			&summary.Count,
+			&summary.MaxWaitMs,
+			&summary.AvgWaitMs,
+		); err != nil {
+			return nil, err
+		}
+
+		lockWaits = append(lockWaits, summary)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lockWaits, nil
+}
+
+// CollectLockWaits collects ungranted locks for a cluster grouped by lock type and mode
+func (mc *MetricsCollector) CollectLockWaits(ctx context.Context, clusterID string) ([]models.LockWaitSummary, error) {
+	pool, err := mc.pool.GetPool(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return mc.queryLockWaits(ctx, clusterID, pool)
+}
+
 // collectReplicationMetrics collects replication lag metrics
 func (mc *MetricsCollector) collectReplicationMetrics(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
 	// Check if this is a replica
@@ -221,6 +426,162 @@ func (mc *MetricsCollector) collectReplicationMetrics(ctx context.Context, pool
 	return nil
 }
 
+// collectReplicationSlotMetrics collects per-slot WAL retention and logical slot lag
+func (mc *MetricsCollector) collectReplicationSlotMetrics(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
+	query := `
+		WITH current AS (
+			SELECT CASE 
+				WHEN pg_is_in_recovery() THEN pg_last_wal_receive_lsn()
+				ELSE pg_current_wal_lsn()
+			END as lsn
+		)
+		SELECT 
+			slot_name,
+			slot_type,
+			COALESCE(database, '') as database,
+			active,
+			COALESCE(pg_wal_lsn_diff(current.lsn, restart_lsn), 0)::bigint as retained_bytes,
+			COALESCE(pg_wal_lsn_diff(current.lsn, confirmed_flush_lsn), 0)::bigint as confirmed_lag_bytes
+		FROM pg_replication_slots, current
+		ORDER BY slot_name
+	`
+
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	slots := make([]models.ReplicationSlot, 0)
+
+	for rows.Next() {
+		var slot models.ReplicationSlot
+		var confirmedLag int64
+
+		if err := rows.Scan(
+			&slot.SlotName,
+			&slot.SlotType,
+			&slot.Database,
+			&slot.Active,
+			&slot.RetainedWALBytes,
+			&confirmedLag,
+		); err != nil {
+			return err
+		}
+
+		// Logical slots are held back by the consumer's confirmed position,
+		// physical slots by the WAL they still retain
+		if slot.SlotType == "logical" {
+			slot.LagBytes = confirmedLag
+		} else {
+			slot.LagBytes = slot.RetainedWALBytes
+		}
+
+		slots = append(slots, slot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	metrics.ReplicationSlots = slots
+
+	return nil
+}
+
+// collectTempSchemaMetrics collects the temp schemas of the connected database
+func (mc *MetricsCollector) collectTempSchemaMetrics(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
+	tempSchemas, err := mc.queryTempSchemas(ctx, metrics.ClusterID, pool)
+	if err != nil {
+		return err
+	}
+
+	metrics.TempSchemas = tempSchemas
+
+	return nil
+}
+
+// queryTempSchemas returns the temp schemas holding temporary tables, with
+// their size and whether the backend that owns them is still running
+func (mc *MetricsCollector) queryTempSchemas(ctx context.Context, clusterID string, pool *pgxpool.Pool) ([]models.TempSchema, error) {
+	version, err := mc.serverVersion(ctx, clusterID, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	// A temp schema is named after the backend ID of its owner. Before
+	// PostgreSQL 16 pg_stat_get_backend_idset() returned local indexes rather
+	// than backend IDs, so orphans can't be told apart from live schemas.
+	orphanedExpr := "false"
+	if version.AtLeast(16, 0) {
+		orphanedExpr = "NOT EXISTS (SELECT 1 FROM pg_stat_get_backend_idset() AS b(id) WHERE b.id = s.backend_id)"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT 
+			s.nspname,
+			s.backend_id,
+			%s as orphaned,
+			s.tables,
+			s.size_bytes,
+			s.oldest_xid_age
+		FROM (
+			SELECT 
+				n.nspname,
+				substring(n.nspname from 'pg_temp_(\d+)')::int as backend_id,
+				COUNT(*)::int as tables,
+				COALESCE(SUM(pg_total_relation_size(c.oid)), 0)::bigint as size_bytes,
+				COALESCE(MAX(age(c.relfrozenxid)), 0)::bigint as oldest_xid_age
+			FROM pg_namespace n
+			JOIN pg_class c ON c.relnamespace = n.oid AND c.relkind = 'r'
+			WHERE n.nspname ~ '^pg_temp_\d+$'
+			GROUP BY n.nspname
+		) s
+		ORDER BY s.size_bytes DESC
+	`, orphanedExpr)
+
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tempSchemas := make([]models.TempSchema, 0)
+
+	for rows.Next() {
+		var schema models.TempSchema
+
+		if err := rows.Scan(
+			&schema.Schema,
+			&schema.BackendID,
+			&schema.Orphaned,
+			&schema.Tables,
+			&schema.SizeBytes,
+			&schema.OldestXIDAge,
+		); err != nil {
+			return nil, err
+		}
+
+		tempSchemas = append(tempSchemas, schema)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tempSchemas, nil
+}
+
+// CollectTempSchemas collects the temp schemas of a cluster's database with their temporary tables
+func (mc *MetricsCollector) CollectTempSchemas(ctx context.Context, clusterID string) ([]models.TempSchema, error) {
+	pool, err := mc.pool.GetPool(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return mc.queryTempSchemas(ctx, clusterID, pool)
+}
+
 // collectBloatMetrics collects table bloat metrics
 func (mc *MetricsCollector) collectBloatMetrics(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
 	query := `
@@ -244,80 +605,408 @@ func (mc *MetricsCollector) collectBloatMetrics(ctx context.Context, pool *pgxpo
 	return nil
 }
 
-// collectDiskIOMetrics collects disk I/O metrics
+// collectDiskIOMetrics collects disk read/write rates in KB/sec since the previous collection
 func (mc *MetricsCollector) collectDiskIOMetrics(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
+	version, err := mc.serverVersion(ctx, metrics.ClusterID, pool)
+	if err != nil {
+		return err
+	}
+
+	// pg_stat_io gives a real per-backend breakdown on PostgreSQL 16+
+	if version.AtLeast(16, 0) {
+		return mc.collectIOStats(ctx, pool, metrics)
+	}
+
 	query := `
 		SELECT 
-			COALESCE(sum(blks_read), 0) as blocks_read,
-			COALESCE(sum(tup_inserted + tup_updated + tup_deleted), 0) as blocks_written
-		FROM pg_stat_database
+			(SELECT COALESCE(sum(blks_read), 0) FROM pg_stat_database) as blocks_read,
+			(SELECT COALESCE(buffers_checkpoint + buffers_clean + buffers_backend, 0) FROM pg_stat_bgwriter) as blocks_written,
+			current_setting('block_size')::bigint as block_size
 	`
 
-	var blocksRead, blocksWritten int64
+	var blocksRead, blocksWritten, blockSize int64
 
-	if err := pool.QueryRow(ctx, query).Scan(&blocksRead, &blocksWritten); err != nil {
+	if err := pool.QueryRow(ctx, query).Scan(&blocksRead, &blocksWritten, &blockSize); err != nil {
 		return err
 	}
 
-	// Convert blocks to KB (assuming 8KB blocks)
-	metrics.DiskIORead = float64(blocksRead) * 8.0
-	metrics.DiskIOWrite = float64(blocksWritten) * 8.0
+	mc.setDiskIORates(metrics, blocksRead*blockSize, blocksWritten*blockSize)
 
 	return nil
 }
 
-// CollectQueryMetrics collects query-level metrics
+// setDiskIORates converts cumulative bytes read and written into KB/sec rates
+func (mc *MetricsCollector) setDiskIORates(metrics *models.Metrics, readBytes, writeBytes int64) {
+	metrics.DiskIORead = mc.rates.Rate(metrics.ClusterID, "disk_read_bytes", readBytes, metrics.Timestamp) / 1024.0
+	metrics.DiskIOWrite = mc.rates.Rate(metrics.ClusterID, "disk_write_bytes", writeBytes, metrics.Timestamp) / 1024.0
+}
+
+// collectIOStats collects IO statistics from pg_stat_io (PostgreSQL 16+)
+func (mc *MetricsCollector) collectIOStats(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
+	// op_bytes was dropped in PostgreSQL 18 but always equalled the block size
+	query := `
+		SELECT 
+			backend_type,
+			object,
+			context,
+			COALESCE(reads, 0) as reads,
+			COALESCE(writes, 0) as writes,
+			COALESCE(extends, 0) as extends,
+			current_setting('block_size')::bigint as block_size
+		FROM pg_stat_io
+		WHERE COALESCE(reads, 0) + COALESCE(writes, 0) + COALESCE(extends, 0) > 0
+		ORDER BY backend_type, object, context
+	`
+
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ioStats := make([]models.IOStat, 0)
+	var readBytes, writeBytes int64
+
+	for rows.Next() {
+		var stat models.IOStat
+		var blockSize int64
+
+		if err := rows.Scan(
+			&stat.BackendType,
+			&stat.Object,
+			&stat.Context,
+			&stat.Reads,
+			&stat.Writes,
+			&stat.Extends,
+			&blockSize,
+		); err != nil {
+			return err
+		}
+
+		stat.ReadBytes = stat.Reads * blockSize
+		stat.WriteBytes = stat.Writes * blockSize
+		stat.ExtendBytes = stat.Extends * blockSize
+
+		readBytes += stat.ReadBytes
+		writeBytes += stat.WriteBytes + stat.ExtendBytes
+
+		ioStats = append(ioStats, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Per-backend stats stay cumulative; the totals become rates
+	metrics.IOStats = ioStats
+	mc.setDiskIORates(metrics, readBytes, writeBytes)
+
+	return nil
+}
+
+// queryWithFallback runs a parameterized query, retrying it once over the
+// simple protocol when the server-side prepared statement path fails, as it
+// does behind transaction-pooling proxies. Collector queries without
+// parameters don't need this.
+func queryWithFallback(ctx context.Context, log *logrus.Logger, pool *pgxpool.Pool, query string, args ...any) (pgx.Rows, error) {
+	rows, err := pool.Query(ctx, query, args...)
+	if err == nil || !isPreparedStatementError(err) {
+		return rows, err
+	}
+
+	log.Debugf("Prepared statement failed (%v), retrying with simple protocol", err)
+
+	return pool.Query(ctx, query, append([]any{pgx.QueryExecModeSimpleProtocol}, args...)...)
+}
+
+// isPreparedStatementError reports whether an error comes from prepared statements
+// being unavailable on the connection rather than from the query itself
+func isPreparedStatementError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "26000", "42P05": // invalid_sql_statement_name, duplicate_prepared_statement
+			return true
+		}
+	}
+
+	return strings.Contains(err.Error(), "prepared statement")
+}
+
+// CollectQueryMetrics collects query-level metrics from pg_stat_statements,
+// attributing each statement to the role that ran it. An empty database
+// returns statements from every database.
 func (mc *MetricsCollector) CollectQueryMetrics(ctx context.Context, clusterID, database string) ([]*models.QueryMetrics, error) {
+	return mc.collectStatements(ctx, clusterID, statementFilter{
+		database: database,
+		orderBy:  "s.mean_exec_time",
+		limit:    maxStatements,
+	})
+}
+
+// CollectQueryIOMetrics collects the statements causing the most physical
+// reads, ranked by shared blocks read rather than execution time
+func (mc *MetricsCollector) CollectQueryIOMetrics(ctx context.Context, clusterID, database string) ([]*models.QueryMetrics, error) {
+	return mc.collectStatements(ctx, clusterID, statementFilter{
+		database: database,
+		orderBy:  "s.shared_blks_read",
+		limit:    maxStatements,
+	})
+}
+
+// maxStatements is the number of statements collected for query metrics
+const maxStatements = 100
+
+// statementFilter selects and ranks the pg_stat_statements entries read by
+// collectStatements
+type statementFilter struct {
+	database        string  // only statements run in this database, every database when empty
+	orderBy         string  // column the statements are ranked by, highest first
+	minMeanExecTime float64 // only statements taking at least this long on average, in ms
+	limit           int
+}
+
+// collectStatements reads the top pg_stat_statements entries matching filter
+func (mc *MetricsCollector) collectStatements(ctx context.Context, clusterID string, filter statementFilter) ([]*models.QueryMetrics, error) {
 	pool, err := mc.pool.GetPool(clusterID)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = pool
+	query := fmt.Sprintf(`
+		SELECT 
+			COALESCE(s.queryid, 0)::text as queryid,
+			s.query,
+			COALESCE(d.datname, '') as database,
+			COALESCE(r.rolname, s.userid::text) as rolname,
+			s.calls,
+			s.total_exec_time,
+			s.mean_exec_time,
+			s.max_exec_time,
+			s.stddev_exec_time,
+			s.rows,
+			s.shared_blks_hit,
+			s.shared_blks_read,
+			s.shared_blks_read * current_setting('block_size')::bigint as shared_bytes_read,
+			s.temp_blks_read,
+			s.temp_blks_written
+		FROM pg_stat_statements s
+		LEFT JOIN pg_roles r ON r.oid = s.userid
+		LEFT JOIN pg_database d ON d.oid = s.dbid
+		WHERE ($1 = '' OR d.datname = $1) AND s.mean_exec_time >= $2
+		ORDER BY %s DESC
+		LIMIT $3
+	`, filter.orderBy)
+
+	rows, err := queryWithFallback(ctx, mc.log, pool, query, filter.database, filter.minMeanExecTime, filter.limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_stat_statements: %w", err)
+	}
+	defer rows.Close()
+
+	queryMetrics := make([]*models.QueryMetrics, 0)
+
+	for rows.Next() {
+		metrics := models.NewQueryMetrics("", "", clusterID, "")
+
+		if err := rows.Scan(
+			&metrics.QueryID,
+			&metrics.Query,
+			&metrics.Database,
+			&metrics.User,
+			&metrics.CallCount,
+			&metrics.TotalExecTime,
+			&metrics.MeanExecTime,
+			&metrics.MaxExecTime,
+			&metrics.StddevExecTime,
+			&metrics.RowsReturned,
+			&metrics.SharedBlocksHit,
+			&metrics.SharedBlocksRead,
+			&metrics.SharedBytesRead,
+			&metrics.TempBlocksRead,
+			&metrics.TempBlocksWritten,
+		); err != nil {
+			return nil, err
+		}
+
+		metrics.ExecutionTime = metrics.MeanExecTime
+		metrics.CacheHitRatio = metrics.ComputeCacheHitRatio()
+
+		queryMetrics = append(queryMetrics, metrics)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return queryMetrics, nil
+}
+
+// CollectRoleQueryStats aggregates pg_stat_statements execution time by
+// role over every statement, busiest role first. An empty database
+// aggregates statements from every database.
+func (mc *MetricsCollector) CollectRoleQueryStats(ctx context.Context, clusterID, database string) ([]*models.RoleQueryStats, error) {
+	pool, err := mc.pool.GetPool(clusterID)
+	if err != nil {
+		return nil, err
+	}
 
 	query := `
 		SELECT 
-			queryid,
-			query,
-			calls,
-			total_exec_time,
-			mean_exec_time,
-			stddev_exec_time,
-			rows,
-			shared_blks_hit,
-			shared_blks_read,
-			temp_blks_read,
-			temp_blks_written
-		FROM pg_stat_statements
-		ORDER BY mean_exec_time DESC
-		LIMIT 100
+			COALESCE(r.rolname, s.userid::text) as rolname,
+			count(*) as queries,
+			sum(s.calls)::bigint as calls,
+			sum(s.total_exec_time) as total_exec_time
+		FROM pg_stat_statements s
+		LEFT JOIN pg_roles r ON r.oid = s.userid
+		LEFT JOIN pg_database d ON d.oid = s.dbid
+		WHERE $1 = '' OR d.datname = $1
+		GROUP BY s.userid, r.rolname
+		ORDER BY total_exec_time DESC
 	`
 
-	_ = query
+	rows, err := queryWithFallback(ctx, mc.log, pool, query, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_stat_statements: %w", err)
+	}
+	defer rows.Close()
 
-	// Placeholder - in real implementation, scan query results
-	queryMetrics := make([]*models.QueryMetrics, 0)
+	roles := make([]*models.RoleQueryStats, 0)
 
-	return queryMetrics, nil
+	for rows.Next() {
+		stats := &models.RoleQueryStats{}
+		if err := rows.Scan(&stats.Role, &stats.Queries, &stats.Calls, &stats.TotalExecTime); err != nil {
+			return nil, err
+		}
+		if stats.Calls > 0 {
+			stats.MeanExecTime = stats.TotalExecTime / float64(stats.Calls)
+		}
+
+		roles = append(roles, stats)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
 }
 
-// CollectTableMetrics collects table-level statistics
-func (mc *MetricsCollector) CollectTableMetrics(ctx context.Context, clusterID, database string) ([]*models.TableMetrics, error) {
+// ErrStatStatementsMissing is returned when a cluster's database doesn't
+// have the pg_stat_statements extension installed
+var ErrStatStatementsMissing = errors.New("pg_stat_statements extension is not installed")
+
+// CollectSlowQueries returns the pg_stat_statements entries whose mean
+// execution time is at least minDurationMs, slowest first and at most limit
+// of them. An empty database returns statements from every database.
+func (mc *MetricsCollector) CollectSlowQueries(ctx context.Context, clusterID, database string, minDurationMs float64, limit int) ([]*models.SlowQuery, error) {
 	pool, err := mc.pool.GetPool(clusterID)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = pool
+	var installed bool
+	if err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_stat_statements')").Scan(&installed); err != nil {
+		return nil, fmt.Errorf("failed to check for pg_stat_statements: %w", err)
+	}
+	if !installed {
+		return nil, ErrStatStatementsMissing
+	}
 
-	query := `
+	statements, err := mc.collectStatements(ctx, clusterID, statementFilter{
+		database:        database,
+		orderBy:         "s.mean_exec_time",
+		minMeanExecTime: minDurationMs,
+		limit:           limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slowQueries := make([]*models.SlowQuery, 0, len(statements))
+	for _, statement := range statements {
+		slowQueries = append(slowQueries, slowQueryFromStatement(statement))
+	}
+
+	return slowQueries, nil
+}
+
+// slowQueryFromStatement builds a SlowQuery from a pg_stat_statements entry
+func slowQueryFromStatement(statement *models.QueryMetrics) *models.SlowQuery {
+	// The statistics are aggregated, so the typical duration is the mean
+	slowQuery := models.NewSlowQuery(statement.QueryID, statement.Query, statement.ClusterID, statement.Database, statement.User, statement.MeanExecTime)
+	slowQuery.Frequency = int(statement.CallCount)
+	slowQuery.AvgDuration = statement.MeanExecTime
+	slowQuery.MaxDuration = statement.MaxExecTime
+	return slowQuery
+}
+
+// tableSortExpressions maps the keys table metrics can be sorted by to the
+// pg_stat_user_tables expressions ordering them
+var tableSortExpressions = map[string]string{
+	"scans":              "seq_scan + COALESCE(idx_scan, 0)",
+	"seq_scan":           "seq_scan",
+	"idx_scan":           "COALESCE(idx_scan, 0)",
+	"live_tuples":        "n_live_tup",
+	"dead_tuples":        "n_dead_tup",
+	"mods_since_analyze": "n_mod_since_analyze",
+	"size":               "pg_total_relation_size(relid)",
+}
+
+// defaultTableSort is the key tables are sorted by when none is given
+const defaultTableSort = "scans"
+
+// TableSortKeys returns the keys table metrics can be sorted by
+func TableSortKeys() []string {
+	return slices.Sorted(maps.Keys(tableSortExpressions))
+}
+
+// TableMetricsOptions filters and orders the tables of CollectTableMetrics.
+// The zero value returns the most scanned tables of every schema.
+type TableMetricsOptions struct {
+	Schema        string // only tables of this schema, when set
+	MinDeadTuples int64
+	SortBy        string // one of TableSortKeys, "scans" when empty
+	Ascending     bool
+}
+
+// CollectTableMetrics collects table-level statistics, at most 100 tables
+// filtered and ordered by opts. pg_stat_user_tables only covers the database
+// the cluster's pool is connected to, so a non-empty database must name that
+// database.
+func (mc *MetricsCollector) CollectTableMetrics(ctx context.Context, clusterID, database string, opts TableMetricsOptions) ([]*models.TableMetrics, error) {
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = defaultTableSort
+	}
+	orderBy, ok := tableSortExpressions[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown table sort key: %s", sortBy)
+	}
+	direction := "DESC"
+	if opts.Ascending {
+		direction = "ASC"
+	}
+
+	pool, err := mc.pool.GetPool(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := connectedDatabase(ctx, pool, database)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ties are broken by name so results are stable
+	query := fmt.Sprintf(`
 		SELECT 
 			schemaname,
 			relname,
 			seq_scan,
 			seq_tup_read,
-			idx_scan,
-			idx_tup_fetch,
+			COALESCE(idx_scan, 0),
+			COALESCE(idx_tup_fetch, 0),
 			n_tup_ins,
 			n_tup_upd,
 			n_tup_del,
@@ -329,26 +1018,318 @@ func (mc *MetricsCollector) CollectTableMetrics(ctx context.Context, clusterID,
 			analyze_count,
 			last_vacuum,
 			last_autovacuum,
-			last_analyze
+			last_analyze,
+			last_autoanalyze,
+			n_mod_since_analyze,
+			pg_total_relation_size(relid)
 		FROM pg_stat_user_tables
-		ORDER BY seq_scan + idx_scan DESC
+		WHERE ($1 = '' OR schemaname = $1) AND n_dead_tup >= $2
+		ORDER BY %s %s, schemaname, relname
 		LIMIT 100
-	`
+	`, orderBy, direction)
 
-	_ = query
+	rows, err := queryWithFallback(ctx, mc.log, pool, query, opts.Schema, opts.MinDeadTuples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_stat_user_tables: %w", err)
+	}
+	defer rows.Close()
 
-	// Placeholder
 	tableMetrics := make([]*models.TableMetrics, 0)
 
+	for rows.Next() {
+		table := models.NewTableMetrics(clusterID, current, "", "")
+
+		// Vacuum and analyze timestamps are NULL for tables never processed
+		// and scan into nil pointers
+		if err := rows.Scan(
+			&table.Schema,
+			&table.Table,
+			&table.SeqScan,
+			&table.SeqTupRead,
+			&table.IdxScan,
+			&table.IdxTupFetch,
+			&table.TupInserted,
+			&table.TupUpdated,
+			&table.TupDeleted,
+			&table.TupHotUpdated,
+			&table.LiveTuples,
+			&table.DeadTuples,
+			&table.VacuumCount,
+			&table.AutovacuumCount,
+			&table.AnalyzeCount,
+			&table.LastVacuum,
+			&table.LastAutovacuum,
+			&table.LastAnalyze,
+			&table.LastAutoanalyze,
+			&table.ModsSinceAnalyze,
+			&table.SizeBytes,
+		); err != nil {
+			return nil, err
+		}
+		table.StatsStaleness = table.StalenessRatio()
+
+		tableMetrics = append(tableMetrics, table)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return tableMetrics, nil
 }
 
-// GetMetricsSnapshot returns current metrics snapshot for a cluster
-func (mc *MetricsCollector) GetMetricsSnapshot(ctx context.Context, clusterID string) (*models.Metrics, error) {
-	metrics, err := mc.CollectClusterMetrics(ctx, clusterID)
+// connectedDatabase returns the database the pool is connected to, failing
+// when a different database was requested. Per-relation statistics views
+// only cover the connected database.
+func connectedDatabase(ctx context.Context, pool *pgxpool.Pool, database string) (string, error) {
+	var current string
+	if err := pool.QueryRow(ctx, "SELECT current_database()").Scan(&current); err != nil {
+		return "", fmt.Errorf("failed to get current database: %w", err)
+	}
+	if database != "" && database != current {
+		return "", fmt.Errorf("statistics are only available for the connected database %s, not %s", current, database)
+	}
+	return current, nil
+}
+
+// CollectIndexMetrics collects index usage and size for the connected
+// database, largest indexes first
+func (mc *MetricsCollector) CollectIndexMetrics(ctx context.Context, clusterID, database string) ([]*models.IndexMetrics, error) {
+	pool, err := mc.pool.GetPool(clusterID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to collect metrics: %w", err)
+		return nil, err
 	}
 
-	return metrics, nil
+	current, err := connectedDatabase(ctx, pool, database)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT 
+			s.schemaname,
+			s.relname,
+			s.indexrelname,
+			s.idx_scan,
+			s.idx_tup_read,
+			s.idx_tup_fetch,
+			pg_relation_size(s.indexrelid) as size_bytes,
+			i.indisunique,
+			i.indisprimary,
+			EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = s.indexrelid) as backs_constraint
+		FROM pg_stat_user_indexes s
+		JOIN pg_index i ON i.indexrelid = s.indexrelid
+		ORDER BY size_bytes DESC
+		LIMIT 500
+	`
+
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pg_stat_user_indexes: %w", err)
+	}
+	defer rows.Close()
+
+	indexMetrics := make([]*models.IndexMetrics, 0)
+
+	for rows.Next() {
+		index := &models.IndexMetrics{
+			ClusterID: clusterID,
+			Database:  current,
+			Timestamp: time.Now(),
+		}
+
+		if err := rows.Scan(
+			&index.Schema,
+			&index.Table,
+			&index.Index,
+			&index.IdxScan,
+			&index.IdxTupRead,
+			&index.IdxTupFetch,
+			&index.SizeBytes,
+			&index.IsUnique,
+			&index.IsPrimary,
+			&index.BacksConstraint,
+		); err != nil {
+			return nil, err
+		}
+
+		index.Unused = index.IsUnused()
+		indexMetrics = append(indexMetrics, index)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return indexMetrics, nil
+}
+
+// toastDominantRatio is the TOAST share of a table's storage above which TOAST dominates
+const toastDominantRatio = 0.5
+
+// CollectToastMetrics collects TOAST storage sizes and dead tuples for the largest TOAST relations
+func (mc *MetricsCollector) CollectToastMetrics(ctx context.Context, clusterID string) ([]*models.ToastMetrics, error) {
+	pool, err := mc.pool.GetPool(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT 
+			n.nspname,
+			c.relname,
+			pg_relation_size(c.oid) as table_bytes,
+			pg_relation_size(c.reltoastrelid) as toast_bytes,
+			COALESCE(t.n_live_tup, 0) as toast_live_tup,
+			COALESCE(t.n_dead_tup, 0) as toast_dead_tup
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_stat_all_tables t ON t.relid = c.reltoastrelid
+		WHERE c.relkind IN ('r', 'm')
+			AND c.reltoastrelid <> 0
+			AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		ORDER BY toast_bytes DESC
+		LIMIT 100
+	`
+
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	toastMetrics := make([]*models.ToastMetrics, 0)
+
+	for rows.Next() {
+		tm := &models.ToastMetrics{
+			ClusterID: clusterID,
+			Timestamp: time.Now(),
+		}
+
+		if err := rows.Scan(
+			&tm.Schema,
+			&tm.Table,
+			&tm.TableSizeBytes,
+			&tm.ToastSizeBytes,
+			&tm.ToastLiveTuples,
+			&tm.ToastDeadTuples,
+		); err != nil {
+			return nil, err
+		}
+
+		if total := tm.TableSizeBytes + tm.ToastSizeBytes; total > 0 {
+			tm.ToastRatio = float64(tm.ToastSizeBytes) / float64(total)
+		}
+		tm.ToastDominant = tm.ToastRatio > toastDominantRatio
+
+		toastMetrics = append(toastMetrics, tm)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return toastMetrics, nil
+}
+
+// freezeTopTables is the number of oldest tables reported by CollectFreezeProgress
+const freezeTopTables = 20
+
+// CollectFreezeProgress collects the transaction ID age of every database and
+// of the oldest tables in the connected database, relative to
+// vacuum_freeze_table_age and autovacuum_freeze_max_age
+func (mc *MetricsCollector) CollectFreezeProgress(ctx context.Context, clusterID string) (*models.FreezeProgress, error) {
+	pool, err := mc.pool.GetPool(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	var freezeTableAge, freezeMaxAge int64
+	var current string
+	settingsQuery := `
+		SELECT 
+			current_setting('vacuum_freeze_table_age')::bigint,
+			current_setting('autovacuum_freeze_max_age')::bigint,
+			current_database()
+	`
+	if err := pool.QueryRow(ctx, settingsQuery).Scan(&freezeTableAge, &freezeMaxAge, &current); err != nil {
+		return nil, fmt.Errorf("failed to read freeze settings: %w", err)
+	}
+
+	progress := models.NewFreezeProgress(clusterID, freezeTableAge, freezeMaxAge)
+
+	databasesQuery := `
+		SELECT datname, age(datfrozenxid)
+		FROM pg_database
+		WHERE datallowconn
+		ORDER BY 2 DESC
+	`
+
+	rows, err := pool.Query(ctx, databasesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query database ages: %w", err)
+	}
+	for rows.Next() {
+		var database string
+		var age int64
+		if err := rows.Scan(&database, &age); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		progress.Databases = append(progress.Databases, progress.NewFreezeAge(database, "", "", age))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// relfrozenxid is only visible for the connected database
+	tablesQuery := fmt.Sprintf(`
+		SELECT n.nspname, c.relname, age(c.relfrozenxid)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'm', 't')
+		ORDER BY 3 DESC
+		LIMIT %d
+	`, freezeTopTables)
+
+	rows, err = pool.Query(ctx, tablesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table ages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, table string
+		var age int64
+		if err := rows.Scan(&schema, &table, &age); err != nil {
+			return nil, err
+		}
+		progress.Tables = append(progress.Tables, progress.NewFreezeAge(current, schema, table, age))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
+
+// ErrNoMetrics is returned for a cluster that wasn't collected yet
+var ErrNoMetrics = errors.New("no metrics collected")
+
+// GetMetricsSnapshot returns the metrics of a cluster's last background
+// collection, with the freshness of each group as of now. Collecting on
+// every API request would move the counter baselines the background loop
+// computes rates and deadlocks from.
+func (mc *MetricsCollector) GetMetricsSnapshot(clusterID string) (*models.Metrics, error) {
+	metrics, exists := mc.latest.Get(clusterID)
+	if !exists {
+		return nil, fmt.Errorf("%w for cluster %s yet", ErrNoMetrics, clusterID)
+	}
+
+	snapshot := *metrics
+	snapshot.Freshness = mc.freshness.Freshness(clusterID, time.Now())
+
+	return &snapshot, nil
 }
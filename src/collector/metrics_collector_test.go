@@ -0,0 +1,689 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/zvdy/pgao/src/db"
+	"github.com/zvdy/pgao/src/models"
+	"github.com/zvdy/pgao/src/pgtest"
+)
+
+// newTestCollector returns a collector with a cluster named main, whose
+// queries are answered by the returned server
+func newTestCollector(t *testing.T) (*MetricsCollector, *pgtest.Server) {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	server := pgtest.NewServer(t)
+	server.Handle("SELECT version()", pgtest.Result{
+		Columns: []string{"version"},
+		Rows:    [][]any{{"PostgreSQL 16.2 on x86_64-pc-linux-gnu, compiled by gcc, 64-bit"}},
+	})
+
+	pool := db.NewConnectionPool(log)
+	t.Cleanup(pool.Close)
+	if err := pool.AddCluster(context.Background(), "main", db.ConnectionConfig{
+		Host:           server.Host(),
+		Port:           server.Port(),
+		User:           "pgao",
+		Database:       "app",
+		SSLMode:        "disable",
+		MinConnections: 1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewMetricsCollector(pool, log, time.Minute), server
+}
+
+func TestSlowQueryFromStatement(t *testing.T) {
+	statement := models.NewQueryMetrics("42", "SELECT * FROM orders WHERE id = $1", "main", "shop")
+	statement.User = "app"
+	statement.CallCount = 1200
+	statement.MeanExecTime = 350
+	statement.MaxExecTime = 2100
+
+	got := slowQueryFromStatement(statement)
+	if got.QueryID != "42" || got.Query != statement.Query || got.ClusterID != "main" || got.Database != "shop" || got.User != "app" {
+		t.Errorf("slow query = %+v, want the statement's identity", got)
+	}
+	if got.Frequency != 1200 {
+		t.Errorf("frequency = %d, want the call count", got.Frequency)
+	}
+	if got.Duration != 350 || got.AvgDuration != 350 || got.MaxDuration != 2100 {
+		t.Errorf("durations = %g, %g, %g, want mean 350 and max 2100", got.Duration, got.AvgDuration, got.MaxDuration)
+	}
+}
+
+func TestServerVersionCachedUntilReset(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	mc := NewMetricsCollector(nil, log, time.Minute)
+	mc.versions.Set("main", models.PGVersion{Major: 16, Minor: 2})
+
+	// Without a pool, only a cached version can be returned
+	version, err := mc.serverVersion(context.Background(), "main", nil)
+	if err != nil || !version.AtLeast(16, 0) {
+		t.Fatalf("serverVersion() = %+v, %v, want the cached 16.2", version, err)
+	}
+
+	mc.ResetBaseline("main")
+	if _, cached := mc.versions.Get("main"); cached {
+		t.Error("ResetBaseline kept the cached version")
+	}
+}
+
+func TestSnapshotsDontMoveCounterBaselines(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("FROM pg_locks", pgtest.Result{Columns: []string{"locktype", "mode", "waiting", "max_wait_ms", "avg_wait_ms"}})
+	deadlocks := func(count int64) {
+		server.Handle("as deadlocks", pgtest.Result{Columns: []string{"deadlocks"}, Rows: [][]any{{count}}})
+	}
+
+	if _, err := mc.GetMetricsSnapshot("main"); !errors.Is(err, ErrNoMetrics) {
+		t.Errorf("snapshot before the first collection: %v, want ErrNoMetrics", err)
+	}
+
+	deadlocks(3)
+	mc.collectAllMetrics(context.Background())
+
+	// API reads between collections must not take the new deadlocks
+	deadlocks(5)
+	for i := 0; i < 3; i++ {
+		if _, err := mc.GetMetricsSnapshot("main"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mc.collectAllMetrics(context.Background())
+
+	metrics, err := mc.GetMetricsSnapshot("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.DeadlockCount != 2 {
+		t.Errorf("deadlocks = %d, want the 2 since the previous collection", metrics.DeadlockCount)
+	}
+}
+
+func TestCollectDurationBuckets(t *testing.T) {
+	mc, _ := newTestCollector(t)
+	reg := prometheus.NewRegistry()
+	mc.RegisterDurationMetrics(reg, []float64{0.1, 1, 10})
+
+	// Failed collections are timed as well
+	mc.collectAllMetrics(context.Background())
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetName() != "pgao_collect_duration_seconds" {
+		t.Fatalf("gathered %v, want the collection duration histogram", families)
+	}
+
+	series := families[0].GetMetric()
+	if len(series) != 1 || series[0].GetLabel()[0].GetValue() != "main" || series[0].GetHistogram().GetSampleCount() != 1 {
+		t.Fatalf("series = %v, want one collection of main", series)
+	}
+	bounds := make([]float64, 0)
+	for _, bucket := range series[0].GetHistogram().GetBucket() {
+		bounds = append(bounds, bucket.GetUpperBound())
+	}
+	if !slices.Equal(bounds, []float64{0.1, 1, 10}) {
+		t.Errorf("bucket bounds = %v, want [0.1 1 10]", bounds)
+	}
+}
+
+// tableColumns are the columns CollectTableMetrics scans
+var tableColumns = []string{
+	"schemaname", "relname", "seq_scan", "seq_tup_read", "idx_scan", "idx_tup_fetch",
+	"n_tup_ins", "n_tup_upd", "n_tup_del", "n_tup_hot_upd", "n_live_tup", "n_dead_tup",
+	"vacuum_count", "autovacuum_count", "analyze_count",
+	"last_vacuum", "last_autovacuum", "last_analyze", "last_autoanalyze",
+	"n_mod_since_analyze", "pg_total_relation_size",
+}
+
+// tableRow returns a pg_stat_user_tables row of schema.table with the given
+// vacuum and analyze timestamps
+func tableRow(schema, table string, vacuumed *time.Time) []any {
+	var last any
+	if vacuumed != nil {
+		last = *vacuumed
+	}
+	return []any{
+		schema, table, int64(10), int64(1000), int64(90), int64(900),
+		int64(5), int64(4), int64(3), int64(2), int64(500), int64(20),
+		int64(1), int64(2), int64(3),
+		last, last, last, last,
+		int64(40), int64(8192),
+	}
+}
+
+func TestCollectTableMetricsSortKeys(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("SELECT current_database()", pgtest.Result{Columns: []string{"current_database"}, Rows: [][]any{{"app"}}})
+	vacuumed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server.Handle("FROM pg_stat_user_tables", pgtest.Result{
+		Columns: tableColumns,
+		Rows:    [][]any{tableRow("public", "orders", &vacuumed)},
+	})
+
+	for _, key := range TableSortKeys() {
+		for _, ascending := range []bool{false, true} {
+			direction := "DESC"
+			if ascending {
+				direction = "ASC"
+			}
+			tables, err := mc.CollectTableMetrics(context.Background(), "main", "", TableMetricsOptions{SortBy: key, Ascending: ascending})
+			if err != nil {
+				t.Fatalf("sort %s %s: %v", key, direction, err)
+			}
+			if len(tables) != 1 || tables[0].Table != "orders" || tables[0].Database != "app" {
+				t.Fatalf("sort %s %s: tables = %+v, want orders of app", key, direction, tables)
+			}
+
+			queries := server.Queries()
+			sql := queries[len(queries)-1].SQL
+			want := "ORDER BY " + tableSortExpressions[key] + " " + direction + ", schemaname, relname"
+			if !strings.Contains(sql, want) {
+				t.Errorf("sort %s %s: query %q does not contain %q", key, direction, sql, want)
+			}
+		}
+	}
+}
+
+func TestCollectTableMetricsFilters(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("SELECT current_database()", pgtest.Result{Columns: []string{"current_database"}, Rows: [][]any{{"app"}}})
+	server.Handle("FROM pg_stat_user_tables", pgtest.Result{Columns: tableColumns})
+
+	if _, err := mc.CollectTableMetrics(context.Background(), "main", "app", TableMetricsOptions{Schema: "billing", MinDeadTuples: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	queries := server.Queries()
+	last := queries[len(queries)-1]
+	if !strings.Contains(last.SQL, "ORDER BY seq_scan + COALESCE(idx_scan, 0) DESC") {
+		t.Errorf("query %q, want the most scanned tables first by default", last.SQL)
+	}
+	if !slices.Equal(last.Args, []string{"billing", "1000"}) {
+		t.Errorf("args = %q, want the schema and the dead tuple minimum", last.Args)
+	}
+
+	if _, err := mc.CollectTableMetrics(context.Background(), "main", "other", TableMetricsOptions{}); err == nil {
+		t.Error("a database other than the connected one was accepted")
+	}
+
+	before := len(server.Queries())
+	_, err := mc.CollectTableMetrics(context.Background(), "main", "", TableMetricsOptions{SortBy: "bogus"})
+	if err == nil || !strings.Contains(err.Error(), "unknown table sort key: bogus") {
+		t.Errorf("unknown sort key: %v, want an unknown table sort key error", err)
+	}
+	if len(server.Queries()) != before {
+		t.Error("an unknown sort key still queried the server")
+	}
+}
+
+// ioColumns are the columns collectIOStats scans
+var ioColumns = []string{"backend_type", "object", "context", "reads", "writes", "extends", "block_size"}
+
+func TestCollectIOStats(t *testing.T) {
+	mc, server := newTestCollector(t)
+	pool, err := mc.pool.GetPool("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioRows := func(clientReads int64) {
+		server.Handle("FROM pg_stat_io", pgtest.Result{Columns: ioColumns, Rows: [][]any{
+			{"checkpointer", "relation", "normal", int64(0), int64(100), int64(0), int64(8192)},
+			{"client backend", "relation", "normal", clientReads, int64(10), int64(5), int64(8192)},
+		}})
+	}
+
+	ioRows(1000)
+	first := models.NewMetrics("main")
+	if err := mc.collectDiskIOMetrics(context.Background(), pool, first); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.IOStats) != 2 {
+		t.Fatalf("io stats = %+v, want a row per backend type", first.IOStats)
+	}
+	client := first.IOStats[1]
+	if client.BackendType != "client backend" || client.ReadBytes != 1000*8192 || client.WriteBytes != 10*8192 || client.ExtendBytes != 5*8192 {
+		t.Errorf("client backend = %+v, want its blocks in bytes", client)
+	}
+	if first.DiskIORead != 0 || first.DiskIOWrite != 0 {
+		t.Errorf("first collection rates = %g, %g, want none without a baseline", first.DiskIORead, first.DiskIOWrite)
+	}
+
+	// 128 more blocks read in a second are 1024 KB/s
+	ioRows(1128)
+	second := models.NewMetrics("main")
+	second.Timestamp = first.Timestamp.Add(time.Second)
+	if err := mc.collectDiskIOMetrics(context.Background(), pool, second); err != nil {
+		t.Fatal(err)
+	}
+	if second.DiskIORead != 1024 || second.DiskIOWrite != 0 {
+		t.Errorf("rates = %g, %g KB/s, want 1024 read and nothing written", second.DiskIORead, second.DiskIOWrite)
+	}
+}
+
+func TestCollectIOStatsSkippedBeforePG16(t *testing.T) {
+	mc, server := newTestCollector(t)
+	mc.versions.Set("main", models.PGVersion{Major: 15, Minor: 6})
+	pool, err := mc.pool.GetPool("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Handle("FROM pg_stat_io", pgtest.Result{Columns: ioColumns})
+	server.Handle("FROM pg_stat_bgwriter", pgtest.Result{
+		Columns: []string{"blocks_read", "blocks_written", "block_size"},
+		Rows:    [][]any{{int64(100), int64(50), int64(8192)}},
+	})
+
+	metrics := models.NewMetrics("main")
+	if err := mc.collectDiskIOMetrics(context.Background(), pool, metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.IOStats != nil {
+		t.Errorf("io stats = %+v, want none before PostgreSQL 16", metrics.IOStats)
+	}
+	for _, query := range server.Queries() {
+		if strings.Contains(query.SQL, "pg_stat_io") {
+			t.Errorf("queried pg_stat_io on PostgreSQL 15: %q", query.SQL)
+		}
+	}
+}
+
+func TestLockWaitsGroupedByLockType(t *testing.T) {
+	mc, server := newTestCollector(t)
+	pool, err := mc.pool.GetPool("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Handle("FROM pg_locks", pgtest.Result{
+		Columns: []string{"locktype", "mode", "waiting", "max_wait_ms", "avg_wait_ms"},
+		Rows: [][]any{
+			{"transactionid", "ShareLock", int64(4), 1500.0, 900.0},
+			{"relation", "AccessExclusiveLock", int64(3), 200.0, 120.0},
+			{"relation", "RowExclusiveLock", int64(2), 50.0, 40.0},
+		},
+	})
+	server.Handle("as deadlocks", pgtest.Result{Columns: []string{"deadlocks"}, Rows: [][]any{{int64(0)}}})
+
+	metrics := models.NewMetrics("main")
+	if err := mc.collectLockMetrics(context.Background(), pool, metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.LockWaits != 9 {
+		t.Errorf("lock waits = %d, want 9", metrics.LockWaits)
+	}
+	want := map[string]int{"transactionid": 4, "relation": 5}
+	if !maps.Equal(metrics.LockWaitsByType, want) {
+		t.Errorf("lock waits by type = %v, want %v", metrics.LockWaitsByType, want)
+	}
+
+	waits, err := mc.CollectLockWaits(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(waits) != 3 || waits[0].LockType != "transactionid" || waits[0].Mode != "ShareLock" || waits[0].MaxWaitMs != 1500 || waits[0].AvgWaitMs != 900 {
+		t.Errorf("lock waits = %+v, want each type and mode with its wait times", waits)
+	}
+}
+
+func TestLockWaitTimesNeedPG14(t *testing.T) {
+	mc, server := newTestCollector(t)
+	mc.versions.Set("main", models.PGVersion{Major: 13, Minor: 14})
+	server.Handle("FROM pg_locks", pgtest.Result{Columns: []string{"locktype", "mode", "waiting", "max_wait_ms", "avg_wait_ms"}})
+
+	if _, err := mc.CollectLockWaits(context.Background(), "main"); err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range server.Queries() {
+		if strings.Contains(query.SQL, "waitstart") {
+			t.Errorf("queried pg_locks.waitstart on PostgreSQL 13: %q", query.SQL)
+		}
+	}
+}
+
+// statementColumns are the columns collectStatements scans
+var statementColumns = []string{
+	"queryid", "query", "database", "rolname", "calls", "total_exec_time", "mean_exec_time",
+	"max_exec_time", "stddev_exec_time", "rows", "shared_blks_hit", "shared_blks_read",
+	"shared_bytes_read", "temp_blks_read", "temp_blks_written",
+}
+
+// statementRow returns a pg_stat_statements row of query run by role, with
+// the given shared blocks hit and read
+func statementRow(queryID, query, role string, hit, read int64) []any {
+	return []any{
+		queryID, query, "app", role, int64(10), 500.0, 50.0,
+		120.0, 8.0, int64(10), hit, read,
+		read * 8192, int64(0), int64(0),
+	}
+}
+
+func TestStatementsAttributedToRoles(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("FROM pg_stat_statements", pgtest.Result{Columns: statementColumns, Rows: [][]any{
+		statementRow("1", "SELECT * FROM orders", "app", 90, 10),
+		// Statements of dropped roles keep their OID
+		statementRow("2", "DELETE FROM sessions", "16384", 0, 0),
+	}})
+	server.Handle("GROUP BY s.userid", pgtest.Result{
+		Columns: []string{"rolname", "queries", "calls", "total_exec_time"},
+		Rows: [][]any{
+			{"app", int64(12), int64(400), 2000.0},
+			{"reporting", int64(3), int64(0), 0.0},
+		},
+	})
+
+	statements, err := mc.CollectQueryMetrics(context.Background(), "main", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 2 || statements[0].User != "app" || statements[1].User != "16384" {
+		t.Fatalf("statements = %+v, want one run by app and one by a dropped role", statements)
+	}
+	queries := server.Queries()
+	if args := queries[len(queries)-1].Args; len(args) == 0 || args[0] != "app" {
+		t.Errorf("args = %q, want the database filter first", args)
+	}
+
+	roles, err := mc.CollectRoleQueryStats(context.Background(), "main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 {
+		t.Fatalf("roles = %+v, want app and reporting", roles)
+	}
+	if app := roles[0]; app.Role != "app" || app.Queries != 12 || app.Calls != 400 || app.MeanExecTime != 5 {
+		t.Errorf("app = %+v, want 12 queries averaging 5ms over 400 calls", app)
+	}
+	if reporting := roles[1]; reporting.Role != "reporting" || reporting.MeanExecTime != 0 {
+		t.Errorf("reporting = %+v, want no mean without calls", reporting)
+	}
+}
+
+func TestCollectToastMetrics(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("FROM pg_class c", pgtest.Result{
+		Columns: []string{"nspname", "relname", "table_bytes", "toast_bytes", "toast_live_tup", "toast_dead_tup"},
+		Rows: [][]any{
+			{"public", "documents", int64(1 << 20), int64(3 << 20), int64(4000), int64(800)},
+			{"public", "orders", int64(3 << 20), int64(1 << 20), int64(100), int64(0)},
+			{"public", "empty", int64(0), int64(0), int64(0), int64(0)},
+		},
+	})
+
+	toast, err := mc.CollectToastMetrics(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toast) != 3 {
+		t.Fatalf("toast metrics = %+v, want a row per table", toast)
+	}
+	if documents := toast[0]; documents.ToastRatio != 0.75 || !documents.ToastDominant || documents.ToastDeadTuples != 800 {
+		t.Errorf("documents = %+v, want a dominant TOAST at 0.75 with 800 dead tuples", documents)
+	}
+	if orders := toast[1]; orders.ToastRatio != 0.25 || orders.ToastDominant {
+		t.Errorf("orders = %+v, want a TOAST share of 0.25 that doesn't dominate", orders)
+	}
+	if empty := toast[2]; empty.ToastRatio != 0 || empty.ToastDominant {
+		t.Errorf("empty = %+v, want no ratio without storage", empty)
+	}
+}
+
+func TestFailedSubCollectorNotMarkedCollected(t *testing.T) {
+	mc, server := newTestCollector(t)
+
+	metrics, err := mc.CollectClusterMetrics(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.IsCollected(models.MetricGroupCache) || metrics.CacheHitRatio != 0 {
+		t.Errorf("failed cache collection: collected = %v, ratio = %g, want neither", metrics.IsCollected(models.MetricGroupCache), metrics.CacheHitRatio)
+	}
+
+	server.Handle("as cache_hit_ratio", pgtest.Result{Columns: []string{"cache_hit_ratio"}, Rows: [][]any{{99.5}}})
+	metrics, err = mc.CollectClusterMetrics(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metrics.IsCollected(models.MetricGroupCache) || metrics.CacheHitRatio != 99.5 {
+		t.Errorf("cache collection: collected = %v, ratio = %g, want 99.5", metrics.IsCollected(models.MetricGroupCache), metrics.CacheHitRatio)
+	}
+}
+
+func TestStatementCacheHitRatio(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("FROM pg_stat_statements", pgtest.Result{Columns: statementColumns, Rows: [][]any{
+		statementRow("1", "SELECT * FROM orders", "app", 0, 250),
+		statementRow("2", "SELECT * FROM users", "app", 75, 25),
+		statementRow("3", "SELECT now()", "app", 0, 0),
+	}})
+
+	statements, err := mc.CollectQueryIOMetrics(context.Background(), "main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratios := make([]float64, 0, len(statements))
+	for _, statement := range statements {
+		ratios = append(ratios, statement.CacheHitRatio)
+	}
+	if !slices.Equal(ratios, []float64{0, 75, 100}) {
+		t.Errorf("cache hit ratios = %v, want [0 75 100]", ratios)
+	}
+	if statements[0].SharedBytesRead != 250*8192 {
+		t.Errorf("shared bytes read = %d, want 250 blocks", statements[0].SharedBytesRead)
+	}
+}
+
+func TestNullVacuumTimestampsAreNil(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("SELECT current_database()", pgtest.Result{Columns: []string{"current_database"}, Rows: [][]any{{"app"}}})
+	vacuumed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server.Handle("FROM pg_stat_user_tables", pgtest.Result{
+		Columns: tableColumns,
+		Rows: [][]any{
+			tableRow("public", "orders", &vacuumed),
+			tableRow("public", "imports", nil),
+		},
+	})
+
+	tables, err := mc.CollectTableMetrics(context.Background(), "main", "", TableMetricsOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 2 {
+		t.Fatalf("tables = %+v, want orders and imports", tables)
+	}
+
+	orders, imports := tables[0], tables[1]
+	for _, last := range []*time.Time{orders.LastVacuum, orders.LastAutovacuum, orders.LastAnalyze, orders.LastAutoanalyze} {
+		if last == nil || !last.Equal(vacuumed) {
+			t.Errorf("orders maintenance timestamp = %v, want %v", last, vacuumed)
+		}
+	}
+	if imports.LastVacuum != nil || imports.LastAutovacuum != nil || imports.LastAnalyze != nil || imports.LastAutoanalyze != nil {
+		t.Errorf("imports = %+v, want nil timestamps for a table never vacuumed or analyzed", imports)
+	}
+}
+
+func TestQueryWithFallback(t *testing.T) {
+	mc, server := newTestCollector(t)
+	pool, err := mc.pool.GetPool("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Handle("FROM pg_stat_user_tables", pgtest.Result{Columns: []string{"relname"}, Rows: [][]any{{"orders"}}})
+
+	// Errors from the query itself aren't retried
+	if _, err := queryWithFallback(context.Background(), mc.log, pool, "SELECT 1 FROM missing WHERE id = $1", 1); err == nil {
+		t.Fatal("queryWithFallback() succeeded for an unknown query")
+	}
+	if sent := len(server.Queries()); sent != 1 {
+		t.Errorf("sent %d queries for a failing query, want 1", sent)
+	}
+
+	server.RefusePreparedStatements()
+
+	rows, err := queryWithFallback(context.Background(), mc.log, pool, "SELECT relname FROM pg_stat_user_tables WHERE schemaname = $1", "billing")
+	if err != nil {
+		t.Fatalf("queryWithFallback() = %v, want a retry over the simple protocol", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tables, []string{"orders"}) {
+		t.Errorf("tables = %v, want orders", tables)
+	}
+
+	queries := server.Queries()[1:]
+	if len(queries) != 2 {
+		t.Fatalf("queries = %+v, want the prepared attempt and its retry", queries)
+	}
+	if retry := queries[1].SQL; !strings.Contains(retry, "schemaname = 'billing'") {
+		t.Errorf("retry = %q, want the argument inlined by the simple protocol", retry)
+	}
+}
+
+func TestCollectFreezeProgress(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("vacuum_freeze_table_age", pgtest.Result{
+		Columns: []string{"vacuum_freeze_table_age", "autovacuum_freeze_max_age", "current_database"},
+		Rows:    [][]any{{int64(150_000_000), int64(200_000_000), "app"}},
+	})
+	server.Handle("age(datfrozenxid)", pgtest.Result{
+		Columns: []string{"datname", "age"},
+		Rows:    [][]any{{"app", int64(75_000_000)}, {"postgres", int64(15_000_000)}},
+	})
+	server.Handle("age(c.relfrozenxid)", pgtest.Result{
+		Columns: []string{"nspname", "relname", "age"},
+		Rows:    [][]any{{"public", "events", int64(300_000_000)}},
+	})
+
+	progress, err := mc.CollectFreezeProgress(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.VacuumFreezeTableAge != 150_000_000 || progress.AutovacuumFreezeMaxAge != 200_000_000 {
+		t.Errorf("settings = %d, %d, want 150M and 200M", progress.VacuumFreezeTableAge, progress.AutovacuumFreezeMaxAge)
+	}
+
+	want := []models.FreezeAge{
+		{Database: "app", Age: 75_000_000, FreezeTableAgePct: 50, FreezeMaxAgePct: 37.5},
+		{Database: "postgres", Age: 15_000_000, FreezeTableAgePct: 10, FreezeMaxAgePct: 7.5},
+	}
+	if !slices.Equal(progress.Databases, want) {
+		t.Errorf("databases = %+v, want %+v", progress.Databases, want)
+	}
+
+	// Tables past autovacuum_freeze_max_age are over 100%
+	want = []models.FreezeAge{
+		{Database: "app", Schema: "public", Table: "events", Age: 300_000_000, FreezeTableAgePct: 200, FreezeMaxAgePct: 150},
+	}
+	if !slices.Equal(progress.Tables, want) {
+		t.Errorf("tables = %+v, want %+v", progress.Tables, want)
+	}
+}
+
+func TestPrimaryKeyIndexNeverUnused(t *testing.T) {
+	mc, server := newTestCollector(t)
+	server.Handle("SELECT current_database()", pgtest.Result{Columns: []string{"current_database"}, Rows: [][]any{{"app"}}})
+	server.Handle("FROM pg_stat_user_indexes", pgtest.Result{
+		Columns: []string{"schemaname", "relname", "indexrelname", "idx_scan", "idx_tup_read", "idx_tup_fetch", "size_bytes", "indisunique", "indisprimary", "backs_constraint"},
+		Rows: [][]any{
+			{"public", "audit_log", "audit_log_pkey", int64(0), int64(0), int64(0), int64(1 << 20), true, true, true},
+			{"public", "audit_log", "audit_log_email_key", int64(0), int64(0), int64(0), int64(1 << 19), true, false, true},
+			{"public", "audit_log", "audit_log_period_excl", int64(0), int64(0), int64(0), int64(1 << 18), false, false, true},
+			{"public", "audit_log", "audit_log_created_at_idx", int64(0), int64(0), int64(0), int64(1 << 17), false, false, false},
+			{"public", "audit_log", "audit_log_user_id_idx", int64(40), int64(400), int64(40), int64(1 << 16), false, false, false},
+		},
+	})
+
+	indexes, err := mc.CollectIndexMetrics(context.Background(), "main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unused := make([]string, 0)
+	for _, index := range indexes {
+		if index.Unused {
+			unused = append(unused, index.Index)
+		}
+	}
+	if !slices.Equal(unused, []string{"audit_log_created_at_idx"}) {
+		t.Errorf("unused indexes = %v, want only the unscanned index without a constraint", unused)
+	}
+}
+
+// tempSchemaColumns are the columns queryTempSchemas scans
+var tempSchemaColumns = []string{"nspname", "backend_id", "orphaned", "tables", "size_bytes", "oldest_xid_age"}
+
+func TestCollectTempSchemas(t *testing.T) {
+	mc, server := newTestCollector(t)
+	pool, err := mc.pool.GetPool("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Handle("FROM pg_namespace n", pgtest.Result{Columns: tempSchemaColumns, Rows: [][]any{
+		{"pg_temp_7", int32(7), true, int32(12), int64(96 << 20), int64(180_000_000)},
+		{"pg_temp_3", int32(3), false, int32(2), int64(16 << 10), int64(1200)},
+	}})
+
+	metrics := models.NewMetrics("main")
+	if err := mc.collectTempSchemaMetrics(context.Background(), pool, metrics); err != nil {
+		t.Fatal(err)
+	}
+	want := []models.TempSchema{
+		{Schema: "pg_temp_7", BackendID: 7, Orphaned: true, Tables: 12, SizeBytes: 96 << 20, OldestXIDAge: 180_000_000},
+		{Schema: "pg_temp_3", BackendID: 3, Tables: 2, SizeBytes: 16 << 10, OldestXIDAge: 1200},
+	}
+	if !slices.Equal(metrics.TempSchemas, want) {
+		t.Errorf("temp schemas = %+v, want %+v", metrics.TempSchemas, want)
+	}
+	if tables, size := metrics.OrphanedTempTables(); tables != 12 || size != 96<<20 {
+		t.Errorf("orphaned = %d tables of %d bytes, want only those of pg_temp_7", tables, size)
+	}
+
+	queries := server.Queries()
+	if sql := queries[len(queries)-1].SQL; !strings.Contains(sql, "pg_stat_get_backend_idset()") {
+		t.Errorf("query %q, want orphans told apart by backend ID on PostgreSQL 16", sql)
+	}
+}
+
+func TestTempSchemasNeverOrphanedBeforePG16(t *testing.T) {
+	mc, server := newTestCollector(t)
+	mc.versions.Set("main", models.PGVersion{Major: 15, Minor: 6})
+	server.Handle("FROM pg_namespace n", pgtest.Result{Columns: tempSchemaColumns})
+
+	if _, err := mc.CollectTempSchemas(context.Background(), "main"); err != nil {
+		t.Fatal(err)
+	}
+	queries := server.Queries()
+	sql := queries[len(queries)-1].SQL
+	if strings.Contains(sql, "pg_stat_get_backend_idset()") || !strings.Contains(sql, "false as orphaned") {
+		t.Errorf("query %q, want no temp schema orphaned on PostgreSQL 15", sql)
+	}
+}
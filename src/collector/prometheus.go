@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zvdy/pgao/src/models"
+)
+
+// clusterGauges are the Prometheus gauges of the latest metrics of each cluster
+type clusterGauges struct {
+	up                *prometheus.GaugeVec
+	connectionsActive *prometheus.GaugeVec
+	cacheHitRatio     *prometheus.GaugeVec
+	replicationLag    *prometheus.GaugeVec
+	tableBloat        *prometheus.GaugeVec
+}
+
+// newClusterGauges creates the cluster gauges, labelled by cluster
+func newClusterGauges() *clusterGauges {
+	gauge := func(name, help string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, []string{"cluster"})
+	}
+
+	return &clusterGauges{
+		up:                gauge("pgao_up", "Whether the last metrics collection of a cluster succeeded."),
+		connectionsActive: gauge("pgao_connections_active", "Active backends of a cluster."),
+		cacheHitRatio:     gauge("pgao_cache_hit_ratio", "Buffer cache hit ratio of a cluster, in percent."),
+		replicationLag:    gauge("pgao_replication_lag_ms", "Replay lag of a replica cluster, in milliseconds."),
+		tableBloat:        gauge("pgao_table_bloat_pct", "Average dead tuple percentage of a cluster's tables."),
+	}
+}
+
+// vecs returns every gauge
+func (cg *clusterGauges) vecs() []*prometheus.GaugeVec {
+	return []*prometheus.GaugeVec{cg.up, cg.connectionsActive, cg.cacheHitRatio, cg.replicationLag, cg.tableBloat}
+}
+
+// observe updates the gauges of the groups collected in a cycle, keeping the
+// previous values of groups that failed
+func (cg *clusterGauges) observe(metrics *models.Metrics) {
+	cluster := metrics.ClusterID
+	cg.up.WithLabelValues(cluster).Set(1)
+
+	if metrics.IsCollected(models.MetricGroupConnections) {
+		cg.connectionsActive.WithLabelValues(cluster).Set(float64(metrics.ConnectionsActive))
+	}
+	if metrics.IsCollected(models.MetricGroupCache) {
+		cg.cacheHitRatio.WithLabelValues(cluster).Set(metrics.CacheHitRatio)
+	}
+	if metrics.IsCollected(models.MetricGroupReplication) {
+		cg.replicationLag.WithLabelValues(cluster).Set(float64(metrics.ReplicationLag))
+	}
+	if metrics.IsCollected(models.MetricGroupBloat) {
+		cg.tableBloat.WithLabelValues(cluster).Set(metrics.TableBloat)
+	}
+}
+
+// down marks a cluster whose metrics couldn't be collected
+func (cg *clusterGauges) down(clusterID string) {
+	cg.up.WithLabelValues(clusterID).Set(0)
+}
+
+// forget drops the series of a cluster
+func (cg *clusterGauges) forget(clusterID string) {
+	for _, vec := range cg.vecs() {
+		vec.DeleteLabelValues(clusterID)
+	}
+}
+
+// RegisterClusterMetrics registers gauges of each cluster's latest metrics,
+// updated after every collection. It must be called before Start.
+func (mc *MetricsCollector) RegisterClusterMetrics(reg prometheus.Registerer) {
+	mc.gauges = newClusterGauges()
+	for _, vec := range mc.gauges.vecs() {
+		reg.MustRegister(vec)
+	}
+}
+
+// ForgetCluster drops the last metrics and Prometheus series of a cluster
+// that was removed
+func (mc *MetricsCollector) ForgetCluster(clusterID string) {
+	mc.latest.Reset(clusterID)
+	if mc.gauges != nil {
+		mc.gauges.forget(clusterID)
+	}
+	if mc.duration != nil {
+		mc.duration.DeleteLabelValues(clusterID)
+	}
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// counterSample is a cumulative counter value and when it was read
+type counterSample struct {
+	value int64
+	at    time.Time
+}
+
+// rateTracker turns cumulative PostgreSQL counters into per-second rates by
+// remembering the previous sample of each counter per cluster
+type rateTracker struct {
+	mu      sync.Mutex
+	samples map[string]map[string]counterSample // clusterID -> counter -> sample
+}
+
+// newRateTracker creates an empty rateTracker
+func newRateTracker() *rateTracker {
+	return &rateTracker{
+		samples: make(map[string]map[string]counterSample),
+	}
+}
+
+// Rate records a counter value and returns its per-second rate since the
+// previous sample. The first sample has no baseline and a counter that went
+// backwards was reset, so both report 0.
+func (rt *rateTracker) Rate(clusterID, counter string, value int64, at time.Time) float64 {
+	increase, elapsed, ok := rt.advance(clusterID, counter, value, at)
+	if !ok || elapsed <= 0 {
+		return 0
+	}
+
+	return float64(increase) / elapsed.Seconds()
+}
+
+// Delta records a counter value and returns its increase since the previous
+// sample, reporting 0 like Rate for the first sample and after a reset
+func (rt *rateTracker) Delta(clusterID, counter string, value int64, at time.Time) int64 {
+	increase, _, ok := rt.advance(clusterID, counter, value, at)
+	if !ok {
+		return 0
+	}
+
+	return increase
+}
+
+// advance replaces the sample of a counter and returns the increase and time
+// elapsed since the previous one. When there is no previous sample, or the
+// counter is below it because the statistics were reset, the interval is
+// discarded and the new value only becomes the baseline.
+func (rt *rateTracker) advance(clusterID, counter string, value int64, at time.Time) (int64, time.Duration, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	counters, exists := rt.samples[clusterID]
+	if !exists {
+		counters = make(map[string]counterSample)
+		rt.samples[clusterID] = counters
+	}
+
+	previous, hasPrevious := counters[counter]
+	counters[counter] = counterSample{value: value, at: at}
+
+	if !hasPrevious || value < previous.value {
+		return 0, 0, false
+	}
+
+	return value - previous.value, at.Sub(previous.at), true
+}
+
+// Reset forgets every counter sample of a cluster
+func (rt *rateTracker) Reset(clusterID string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	delete(rt.samples, clusterID)
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateTrackerRate(t *testing.T) {
+	rt := newRateTracker()
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if rate := rt.Rate("main", "transactions", 1000, start); rate != 0 {
+		t.Errorf("first sample rate = %g, want 0 without a baseline", rate)
+	}
+	if rate := rt.Rate("main", "transactions", 1600, start.Add(30*time.Second)); rate != 20 {
+		t.Errorf("second sample rate = %g, want 600 transactions over 30s = 20/s", rate)
+	}
+	if rate := rt.Rate("replica", "transactions", 50, start.Add(30*time.Second)); rate != 0 {
+		t.Errorf("rate of another cluster = %g, want 0 without its own baseline", rate)
+	}
+
+	// pg_stat_reset() or a restart sets the counter back
+	if rate := rt.Rate("main", "transactions", 100, start.Add(60*time.Second)); rate != 0 {
+		t.Errorf("rate after a counter reset = %g, want 0", rate)
+	}
+	if rate := rt.Rate("main", "transactions", 400, start.Add(90*time.Second)); rate != 10 {
+		t.Errorf("rate after the reset = %g, want 300 transactions over 30s = 10/s", rate)
+	}
+}
+
+func TestRateTrackerDeltaCounterDecreases(t *testing.T) {
+	rt := newRateTracker()
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	rt.Delta("main", "deadlocks", 7, start)
+	if delta := rt.Delta("main", "deadlocks", 2, start.Add(time.Minute)); delta != 0 {
+		t.Errorf("delta of a decreasing counter = %d, want 0 for the reset", delta)
+	}
+	if delta := rt.Delta("main", "deadlocks", 5, start.Add(2*time.Minute)); delta != 3 {
+		t.Errorf("delta after the reset = %d, want 3 from the new baseline", delta)
+	}
+}
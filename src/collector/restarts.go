@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// restartTracker detects server restarts by remembering the postmaster start
+// time last seen for each cluster
+type restartTracker struct {
+	mu        sync.Mutex
+	startedAt map[string]time.Time // clusterID -> postmaster start time
+}
+
+// newRestartTracker creates an empty restartTracker
+func newRestartTracker() *restartTracker {
+	return &restartTracker{
+		startedAt: make(map[string]time.Time),
+	}
+}
+
+// Observe records a cluster's postmaster start time and reports whether it
+// differs from the previous one, meaning the server restarted in between.
+// The first observation has nothing to compare with and isn't a restart.
+func (rt *restartTracker) Observe(clusterID string, startedAt time.Time) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	previous, exists := rt.startedAt[clusterID]
+	rt.startedAt[clusterID] = startedAt
+
+	return exists && !previous.Equal(startedAt)
+}
+
+// StartedAt returns the last start time observed for a cluster
+func (rt *restartTracker) StartedAt(clusterID string) (time.Time, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	startedAt, exists := rt.startedAt[clusterID]
+	return startedAt, exists
+}
+
+// Reset forgets the start time of a cluster
+func (rt *restartTracker) Reset(clusterID string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	delete(rt.startedAt, clusterID)
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRestartTrackerDetectsStartTimeChange(t *testing.T) {
+	rt := newRestartTracker()
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if rt.Observe("main", started) {
+		t.Error("first observation reported as a restart")
+	}
+	if rt.Observe("main", started) {
+		t.Error("unchanged start time reported as a restart")
+	}
+	if !rt.Observe("main", started.Add(time.Hour)) {
+		t.Error("changed start time not reported as a restart")
+	}
+	if rt.Observe("replica", started) {
+		t.Error("clusters share start times")
+	}
+}
+
+func TestResetBaselineForgetsStartTime(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	mc := NewMetricsCollector(nil, log, time.Minute)
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mc.restarts.Observe("main", started)
+	mc.ResetBaseline("main")
+
+	if _, ok := mc.ServerStartTime("main"); ok {
+		t.Error("start time kept across ResetBaseline")
+	}
+	if mc.restarts.Observe("main", started.Add(time.Hour)) {
+		t.Error("new server after ResetBaseline reported as a restart")
+	}
+}
+
+func TestClusterUptimeFromStartTimeSource(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	mc := NewMetricsCollector(nil, log, time.Minute)
+	cc := NewClusterCollector(nil, log, time.Minute)
+	cc.UseStartTimes(mc)
+
+	if _, err := cc.collectUptime(context.Background(), "main"); err == nil {
+		t.Error("uptime reported before the start time was collected")
+	}
+
+	started := time.Now().Add(-time.Hour)
+	mc.restarts.Observe("main", started)
+
+	uptime, err := cc.collectUptime(context.Background(), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !uptime.StartedAt.Equal(started) || uptime.UptimeSeconds < 3600 {
+		t.Errorf("uptime = %+v, want started an hour ago", uptime)
+	}
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// latestMetrics keeps the metrics of each cluster's last background
+// collection, so the API can serve them without collecting on its own
+type latestMetrics struct {
+	mu      sync.RWMutex
+	metrics map[string]*models.Metrics
+}
+
+// newLatestMetrics creates an empty latestMetrics
+func newLatestMetrics() *latestMetrics {
+	return &latestMetrics{
+		metrics: make(map[string]*models.Metrics),
+	}
+}
+
+// Set stores the metrics of a cluster's last collection
+func (lm *latestMetrics) Set(metrics *models.Metrics) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.metrics[metrics.ClusterID] = metrics
+}
+
+// Get returns the metrics of a cluster's last collection
+func (lm *latestMetrics) Get(clusterID string) (*models.Metrics, bool) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	metrics, exists := lm.metrics[clusterID]
+	return metrics, exists
+}
+
+// Reset forgets the metrics of a cluster
+func (lm *latestMetrics) Reset(clusterID string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	delete(lm.metrics, clusterID)
+}
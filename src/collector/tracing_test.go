@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/zvdy/pgao/src/pgtest"
+)
+
+func TestSubCollectorSpans(t *testing.T) {
+	// The collector's tracer delegates to the first global provider set, so
+	// no other test of this package may set one
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	otel.SetTracerProvider(provider)
+
+	mc, server := newTestCollector(t)
+	server.Handle("as cache_hit_ratio", pgtest.Result{Columns: []string{"cache_hit_ratio"}, Rows: [][]any{{99.5}}})
+	if _, err := mc.CollectClusterMetrics(context.Background(), "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	root, ok := spans["CollectClusterMetrics"]
+	if !ok {
+		t.Fatalf("spans = %v, want a CollectClusterMetrics span", spans)
+	}
+
+	for _, name := range []string{"uptime", "connection", "cache", "transaction", "lock", "replication", "replication slot", "bloat", "disk I/O", "wait event", "temp schema"} {
+		span, ok := spans["collect "+name+" metrics"]
+		if !ok {
+			t.Errorf("no span for the %s sub-collector", name)
+			continue
+		}
+		if span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("%s span isn't a child of CollectClusterMetrics", name)
+		}
+	}
+
+	// Only the cache query is answered, so the other sub-collectors fail
+	if status := spans["collect cache metrics"].Status(); status.Code != codes.Unset {
+		t.Errorf("cache span status = %+v, want unset", status)
+	}
+	if status := spans["collect bloat metrics"].Status(); status.Code != codes.Error || status.Description == "" {
+		t.Errorf("bloat span status = %+v, want the error", status)
+	}
+}
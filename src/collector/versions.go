@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zvdy/pgao/src/models"
+)
+
+// versionCache remembers the server version of each cluster, so queries
+// gated on the version don't look it up every collection. A version only
+// changes across a restart, which resets the cluster's entry.
+type versionCache struct {
+	mu       sync.Mutex
+	versions map[string]models.PGVersion // clusterID -> server version
+}
+
+// newVersionCache creates an empty versionCache
+func newVersionCache() *versionCache {
+	return &versionCache{
+		versions: make(map[string]models.PGVersion),
+	}
+}
+
+// Get returns the cached version of a cluster
+func (vc *versionCache) Get(clusterID string) (models.PGVersion, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	version, exists := vc.versions[clusterID]
+	return version, exists
+}
+
+// Set caches the version of a cluster
+func (vc *versionCache) Set(clusterID string, version models.PGVersion) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	vc.versions[clusterID] = version
+}
+
+// Reset forgets the version of a cluster
+func (vc *versionCache) Reset(clusterID string) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	delete(vc.versions, clusterID)
+}
+
+// serverVersion returns a cluster's server version, querying it only when
+// it isn't cached yet
+func (mc *MetricsCollector) serverVersion(ctx context.Context, clusterID string, pool *pgxpool.Pool) (models.PGVersion, error) {
+	if version, ok := mc.versions.Get(clusterID); ok {
+		return version, nil
+	}
+
+	var full string
+	if err := pool.QueryRow(ctx, "SELECT version()").Scan(&full); err != nil {
+		return models.PGVersion{}, err
+	}
+
+	version, err := models.ParsePGVersion(full)
+	if err != nil {
+		return models.PGVersion{}, err
+	}
+
+	mc.versions.Set(clusterID, version)
+	return version, nil
+}
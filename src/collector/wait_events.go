@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/zvdy/pgao/src/models"
+)
+
+// waitHistoryRetention is how long wait event samples are kept per cluster
+const waitHistoryRetention = time.Hour
+
+// waitSample is the wait events of a cluster's active sessions at one point in time
+type waitSample struct {
+	at     time.Time
+	events []models.WaitEventCount
+}
+
+// waitHistory keeps recent wait event samples per cluster, like an
+// active session history
+type waitHistory struct {
+	mu      sync.RWMutex
+	samples map[string][]waitSample
+}
+
+// newWaitHistory creates an empty waitHistory
+func newWaitHistory() *waitHistory {
+	return &waitHistory{
+		samples: make(map[string][]waitSample),
+	}
+}
+
+// Record stores a sample and drops samples older than the retention
+func (wh *waitHistory) Record(clusterID string, at time.Time, events []models.WaitEventCount) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	samples := append(wh.samples[clusterID], waitSample{at: at, events: events})
+
+	cutoff := at.Add(-waitHistoryRetention)
+	first := 0
+	for first < len(samples) && samples[first].at.Before(cutoff) {
+		first++
+	}
+
+	wh.samples[clusterID] = samples[first:]
+}
+
+// Profile aggregates the samples taken within window before now
+func (wh *waitHistory) Profile(clusterID string, window time.Duration, now time.Time) *models.WaitEventProfile {
+	wh.mu.RLock()
+	defer wh.mu.RUnlock()
+
+	profile := &models.WaitEventProfile{
+		ClusterID:     clusterID,
+		WindowSeconds: window.Seconds(),
+		Events:        make([]models.WaitEventCount, 0),
+		Timestamp:     now,
+	}
+
+	type waitKey struct{ waitType, event string }
+	totals := make(map[waitKey]int)
+	total := 0
+
+	cutoff := now.Add(-window)
+	for _, sample := range wh.samples[clusterID] {
+		if sample.at.Before(cutoff) {
+			continue
+		}
+		profile.Samples++
+		for _, event := range sample.events {
+			totals[waitKey{event.WaitEventType, event.WaitEvent}] += event.Count
+			total += event.Count
+		}
+	}
+
+	for key, count := range totals {
+		profile.Events = append(profile.Events, models.WaitEventCount{
+			WaitEventType:     key.waitType,
+			WaitEvent:         key.event,
+			Count:             count,
+			Percent:           float64(count) / float64(total) * 100,
+			AvgActiveSessions: float64(count) / float64(profile.Samples),
+		})
+	}
+
+	sort.Slice(profile.Events, func(i, j int) bool {
+		if profile.Events[i].Count != profile.Events[j].Count {
+			return profile.Events[i].Count > profile.Events[j].Count
+		}
+		if profile.Events[i].WaitEventType != profile.Events[j].WaitEventType {
+			return profile.Events[i].WaitEventType < profile.Events[j].WaitEventType
+		}
+		return profile.Events[i].WaitEvent < profile.Events[j].WaitEvent
+	})
+
+	return profile
+}
+
+// collectWaitEvents samples what active client sessions are currently waiting on.
+// Sessions not waiting on anything are running on CPU.
+func (mc *MetricsCollector) collectWaitEvents(ctx context.Context, pool *pgxpool.Pool, metrics *models.Metrics) error {
+	query := `
+		SELECT 
+			COALESCE(wait_event_type, 'CPU') as wait_event_type,
+			COALESCE(wait_event, 'CPU') as wait_event,
+			count(*) as sessions
+		FROM pg_stat_activity
+		WHERE state = 'active'
+			AND backend_type = 'client backend'
+			AND pid <> pg_backend_pid()
+		GROUP BY 1, 2
+		ORDER BY sessions DESC
+	`
+
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	events := make([]models.WaitEventCount, 0)
+
+	for rows.Next() {
+		var event models.WaitEventCount
+		if err := rows.Scan(&event.WaitEventType, &event.WaitEvent, &event.Count); err != nil {
+			return err
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	metrics.WaitEvents = events
+
+	return nil
+}
+
+// GetWaitEventProfile returns the wait event breakdown of a cluster's active
+// sessions sampled by the background collector over the given window
+func (mc *MetricsCollector) GetWaitEventProfile(clusterID string, window time.Duration) *models.WaitEventProfile {
+	return mc.waits.Profile(clusterID, window, time.Now())
+}
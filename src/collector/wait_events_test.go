@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestWaitHistoryProfile(t *testing.T) {
+	wh := newWaitHistory()
+	now := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	// Outside the 5 minute window
+	wh.Record("main", now.Add(-10*time.Minute), []models.WaitEventCount{{WaitEventType: "IO", WaitEvent: "DataFileRead", Count: 50}})
+
+	wh.Record("main", now.Add(-4*time.Minute), []models.WaitEventCount{
+		{WaitEventType: "Lock", WaitEvent: "transactionid", Count: 3},
+		{WaitEventType: "CPU", WaitEvent: "CPU", Count: 1},
+	})
+	wh.Record("main", now.Add(-2*time.Minute), []models.WaitEventCount{
+		{WaitEventType: "Lock", WaitEvent: "transactionid", Count: 5},
+		{WaitEventType: "IO", WaitEvent: "DataFileRead", Count: 1},
+	})
+	wh.Record("main", now, []models.WaitEventCount{})
+	wh.Record("replica", now, []models.WaitEventCount{{WaitEventType: "IO", WaitEvent: "WALWrite", Count: 9}})
+
+	profile := wh.Profile("main", 5*time.Minute, now)
+	if profile.Samples != 3 || profile.WindowSeconds != 300 {
+		t.Fatalf("profile covers %d samples over %gs, want 3 over 300s", profile.Samples, profile.WindowSeconds)
+	}
+
+	// 10 sessions were seen waiting across 3 samples, most on the lock
+	want := []models.WaitEventCount{
+		{WaitEventType: "Lock", WaitEvent: "transactionid", Count: 8, Percent: 80, AvgActiveSessions: 8.0 / 3},
+		{WaitEventType: "CPU", WaitEvent: "CPU", Count: 1, Percent: 10, AvgActiveSessions: 1.0 / 3},
+		{WaitEventType: "IO", WaitEvent: "DataFileRead", Count: 1, Percent: 10, AvgActiveSessions: 1.0 / 3},
+	}
+	if len(profile.Events) != len(want) {
+		t.Fatalf("events = %+v, want %+v", profile.Events, want)
+	}
+	for i := range want {
+		if profile.Events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, profile.Events[i], want[i])
+		}
+	}
+
+	if empty := wh.Profile("other", 5*time.Minute, now); empty.Samples != 0 || empty.Events == nil || len(empty.Events) != 0 {
+		t.Errorf("profile of a cluster without samples = %+v, want an empty one", empty)
+	}
+}
+
+func TestWaitHistoryRetention(t *testing.T) {
+	wh := newWaitHistory()
+	now := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	wh.Record("main", now.Add(-waitHistoryRetention-time.Minute), []models.WaitEventCount{{WaitEventType: "CPU", WaitEvent: "CPU", Count: 1}})
+	wh.Record("main", now, []models.WaitEventCount{{WaitEventType: "CPU", WaitEvent: "CPU", Count: 1}})
+
+	if n := len(wh.samples["main"]); n != 1 {
+		t.Errorf("kept %d samples, want the expired one dropped", n)
+	}
+}
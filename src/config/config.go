@@ -2,49 +2,152 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/zvdy/pgao/src/models"
 	"gopkg.in/yaml.v3"
 )
 
+// minAPIKeyLength is the shortest API key accepted, so keys can't be guessed
+const minAPIKeyLength = 16
+
 // Config represents the application configuration
 type Config struct {
-	Server   ServerConfig    `yaml:"server"`
-	Clusters []ClusterConfig `yaml:"clusters"`
-	Logging  LoggingConfig   `yaml:"logging"`
-	Metrics  MetricsConfig   `yaml:"metrics"`
-	AWS      AWSConfig       `yaml:"aws"`
+	Server        ServerConfig        `yaml:"server"`
+	Clusters      []ClusterConfig     `yaml:"clusters"`
+	Logging       LoggingConfig       `yaml:"logging"`
+	Metrics       MetricsConfig       `yaml:"metrics"`
+	Alerting      AlertingConfig      `yaml:"alerting"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Analysis      AnalysisConfig      `yaml:"analysis"`
+	AWS           AWSConfig           `yaml:"aws"`
+	OTel          OTelConfig          `yaml:"otel"`
 }
 
 // ServerConfig represents HTTP server configuration
 type ServerConfig struct {
-	Host         string        `yaml:"host"`
-	Port         int           `yaml:"port"`
-	ReadTimeout  time.Duration `yaml:"read_timeout"`
-	WriteTimeout time.Duration `yaml:"write_timeout"`
-	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	Host            string          `yaml:"host"`
+	Port            int             `yaml:"port"`
+	ReadTimeout     time.Duration   `yaml:"read_timeout"`
+	WriteTimeout    time.Duration   `yaml:"write_timeout"`
+	IdleTimeout     time.Duration   `yaml:"idle_timeout"`
+	BasePath        string          `yaml:"base_path"` // URL prefix when served behind a proxy subpath
+	ShutdownTimeout time.Duration   `yaml:"shutdown_timeout"`
+	APIKeys         []string        `yaml:"api_keys"` // bearer tokens required by /api/v1 routes; empty disables auth
+	CORS            CORSConfig      `yaml:"cors"`
+	RateLimit       RateLimitConfig `yaml:"rate_limit"`
+}
+
+// RateLimitConfig represents the per-client limit on query analysis requests
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"` // 0 disables rate limiting
+	Burst             int     `yaml:"burst"`
+}
+
+// CORSConfig represents the cross-origin requests browsers are allowed to make
+type CORSConfig struct {
+	AllowedOrigins []string      `yaml:"allowed_origins"` // scheme://host[:port] or "*"; empty disables CORS
+	AllowedMethods []string      `yaml:"allowed_methods"`
+	AllowedHeaders []string      `yaml:"allowed_headers"`
+	MaxAge         time.Duration `yaml:"max_age"` // how long browsers may cache a preflight response
+}
+
+// RoutePrefix returns the base path without a trailing slash, or "" when serving at the root
+func (s ServerConfig) RoutePrefix() string {
+	return strings.TrimRight(s.BasePath, "/")
 }
 
 // ClusterConfig represents a PostgreSQL cluster configuration
 type ClusterConfig struct {
-	ID              string            `yaml:"id"`
-	Name            string            `yaml:"name"`
-	Host            string            `yaml:"host"`
-	Port            int               `yaml:"port"`
-	User            string            `yaml:"user"`
-	Password        string            `yaml:"password"`
-	Database        string            `yaml:"database"`
-	SSLMode         string            `yaml:"ssl_mode"`
-	MaxConnections  int               `yaml:"max_connections"`
-	MinConnections  int               `yaml:"min_connections"`
-	ConnMaxLifetime time.Duration     `yaml:"conn_max_lifetime"`
-	ConnMaxIdleTime time.Duration     `yaml:"conn_max_idle_time"`
-	Region          string            `yaml:"region"`
-	Environment     string            `yaml:"environment"`
-	Tags            map[string]string `yaml:"tags"`
+	ID                 string            `yaml:"id"`
+	Name               string            `yaml:"name"`
+	Host               string            `yaml:"host"`
+	Hosts              []string          `yaml:"hosts"` // host[:port] list for multi-host failover, IPv6 as [addr]:port
+	Port               int               `yaml:"port"`
+	User               string            `yaml:"user"`
+	Password           string            `yaml:"password"`
+	PasswordFile       string            `yaml:"password_file"` // file holding the password, re-read for new connections
+	Auth               string            `yaml:"auth"`          // password (default) or iam for RDS IAM authentication
+	Database           string            `yaml:"database"`
+	SSLMode            string            `yaml:"ssl_mode"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"` // skip TLS certificate verification, never in production
+	MaxConnections     int               `yaml:"max_connections"`
+	MinConnections     int               `yaml:"min_connections"`
+	ConnMaxLifetime    time.Duration     `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime    time.Duration     `yaml:"conn_max_idle_time"`
+	ConnectAttempts    int               `yaml:"connect_attempts"`      // initial connection attempts, defaults to 5
+	ConnectRetryDelay  time.Duration     `yaml:"connect_retry_delay"`   // wait before the first retry, doubled each time; defaults to 1s
+	HealthQuery        string            `yaml:"health_query"`          // defaults to SELECT 1
+	HealthExpected     string            `yaml:"health_query_expected"` // optional expected first column
+	TargetSessionAttrs string            `yaml:"target_session_attrs"`  // any, read-write, read-only, primary, standby, prefer-standby
+	Region             string            `yaml:"region"`
+	Environment        string            `yaml:"environment"`
+	Primary            string            `yaml:"primary"` // ID of the cluster this one replicates from
+	Thresholds         ThresholdsConfig  `yaml:"thresholds"`
+	Tags               map[string]string `yaml:"tags"`
+}
+
+// ThresholdsConfig overrides alert thresholds for a single cluster. Unset
+// fields fall back to the defaults.
+type ThresholdsConfig struct {
+	MaxConnectionsPercent  *float64 `yaml:"max_connections_percent"`
+	MinCacheHitRatio       *float64 `yaml:"min_cache_hit_ratio"`
+	MaxCPUPercent          *float64 `yaml:"max_cpu_percent"`
+	MaxMemoryPercent       *float64 `yaml:"max_memory_percent"`
+	MaxReplicationLagMs    *int64   `yaml:"max_replication_lag_ms"`
+	MaxLogicalSlotLagBytes *int64   `yaml:"max_logical_slot_lag_bytes"`
+	MaxSlowQueryTimeMs     *float64 `yaml:"max_slow_query_time_ms"`
+	MaxTableBloatPercent   *float64 `yaml:"max_table_bloat_percent"`
+	MaxPoolWaitStreak      *int     `yaml:"max_pool_wait_streak"`
+	MaxPoolAcquireWaitMs   *float64 `yaml:"max_pool_acquire_wait_ms"`
+	MaxStatsStaleness      *float64 `yaml:"max_stats_staleness"`
+	MaxOrphanedTempTables  *int     `yaml:"max_orphaned_temp_tables"`
+}
+
+// Validate rejects thresholds that can never or would always fire
+func (t ThresholdsConfig) Validate() error {
+	percents := map[string]*float64{
+		"max_connections_percent": t.MaxConnectionsPercent,
+		"min_cache_hit_ratio":     t.MinCacheHitRatio,
+		"max_cpu_percent":         t.MaxCPUPercent,
+		"max_memory_percent":      t.MaxMemoryPercent,
+		"max_table_bloat_percent": t.MaxTableBloatPercent,
+	}
+	for name, value := range percents {
+		if value != nil && (*value < 0 || *value > 100) {
+			return fmt.Errorf("%s must be between 0 and 100, got %g", name, *value)
+		}
+	}
+
+	if t.MaxReplicationLagMs != nil && *t.MaxReplicationLagMs < 0 {
+		return fmt.Errorf("max_replication_lag_ms must not be negative, got %d", *t.MaxReplicationLagMs)
+	}
+	if t.MaxLogicalSlotLagBytes != nil && *t.MaxLogicalSlotLagBytes < 0 {
+		return fmt.Errorf("max_logical_slot_lag_bytes must not be negative, got %d", *t.MaxLogicalSlotLagBytes)
+	}
+	if t.MaxSlowQueryTimeMs != nil && *t.MaxSlowQueryTimeMs <= 0 {
+		return fmt.Errorf("max_slow_query_time_ms must be positive, got %g", *t.MaxSlowQueryTimeMs)
+	}
+	if t.MaxPoolWaitStreak != nil && *t.MaxPoolWaitStreak < 1 {
+		return fmt.Errorf("max_pool_wait_streak must be at least 1, got %d", *t.MaxPoolWaitStreak)
+	}
+	if t.MaxPoolAcquireWaitMs != nil && *t.MaxPoolAcquireWaitMs <= 0 {
+		return fmt.Errorf("max_pool_acquire_wait_ms must be positive, got %g", *t.MaxPoolAcquireWaitMs)
+	}
+	if t.MaxStatsStaleness != nil && *t.MaxStatsStaleness <= 0 {
+		return fmt.Errorf("max_stats_staleness must be positive, got %g", *t.MaxStatsStaleness)
+	}
+	if t.MaxOrphanedTempTables != nil && *t.MaxOrphanedTempTables < 0 {
+		return fmt.Errorf("max_orphaned_temp_tables must not be negative, got %d", *t.MaxOrphanedTempTables)
+	}
+
+	return nil
 }
 
 // LoggingConfig represents logging configuration
@@ -57,9 +160,78 @@ type LoggingConfig struct {
 // MetricsConfig represents metrics collection configuration
 type MetricsConfig struct {
 	CollectionInterval time.Duration `yaml:"collection_interval"`
+	ProbeInterval      time.Duration `yaml:"probe_interval"` // cluster health checks between collections, 0 disables
 	RetentionDays      int           `yaml:"retention_days"`
 	EnablePrometheus   bool          `yaml:"enable_prometheus"`
 	PrometheusPort     int           `yaml:"prometheus_port"`
+	Influx             InfluxConfig  `yaml:"influx"`
+	Settings           []string      `yaml:"settings"` // extra pg_settings to report per cluster
+	Buckets            BucketsConfig `yaml:"buckets"`
+}
+
+// BucketsConfig overrides the upper bounds, in seconds, of pgao's Prometheus
+// latency histograms. Empty lists use the client library defaults.
+type BucketsConfig struct {
+	HTTPLatency     []float64 `yaml:"http_latency"`
+	CollectDuration []float64 `yaml:"collect_duration"`
+}
+
+// InfluxConfig represents InfluxDB line protocol export configuration
+type InfluxConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	WriteURL string        `yaml:"write_url"` // InfluxDB write endpoint to push to; empty only serves the scrape endpoint
+	Token    string        `yaml:"token"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// AlertingConfig represents alert rule configuration
+type AlertingConfig struct {
+	CompositeRules []CompositeRuleConfig `yaml:"composite_rules"`
+}
+
+// CompositeRuleConfig represents an alert raised when several metric conditions hold together
+type CompositeRuleConfig struct {
+	Name       string            `yaml:"name"`
+	Operator   string            `yaml:"operator"`  // and, or or score
+	MinScore   float64           `yaml:"min_score"` // weight the matched conditions must reach with score
+	Severity   string            `yaml:"severity"`  // defaults to high
+	Conditions []ConditionConfig `yaml:"conditions"`
+}
+
+// ConditionConfig represents a single metric comparison in a composite rule
+type ConditionConfig struct {
+	Metric    string  `yaml:"metric"`
+	Operator  string  `yaml:"operator"` // >, >=, <, <=
+	Threshold float64 `yaml:"threshold"`
+	Weight    float64 `yaml:"weight"` // counted towards min_score, defaults to 1
+}
+
+// NotificationsConfig represents where new alerts are sent
+type NotificationsConfig struct {
+	Webhooks    []WebhookConfig `yaml:"webhooks"`
+	Slack       SlackConfig     `yaml:"slack"`
+	MaxAttempts int             `yaml:"max_attempts"` // deliveries are dropped after this many failures
+	Timeout     time.Duration   `yaml:"timeout"`
+}
+
+// WebhookConfig represents a webhook that receives alert JSON
+type WebhookConfig struct {
+	URL         string `yaml:"url"`
+	MinSeverity string `yaml:"min_severity"` // lowest severity sent, defaults to all
+	Secret      string `yaml:"secret"`       // optional HMAC-SHA256 key for X-PGAO-Signature
+}
+
+// SlackConfig represents a Slack incoming webhook that receives formatted alerts
+type SlackConfig struct {
+	WebhookURL  string `yaml:"webhook_url"`
+	MinSeverity string `yaml:"min_severity"`
+}
+
+// AnalysisConfig represents query analysis configuration
+type AnalysisConfig struct {
+	BaselineFingerprints []string `yaml:"baseline_fingerprints"` // accepted query shapes
+	BaselineFile         string   `yaml:"baseline_file"`         // one fingerprint per line
+	CacheSize            int      `yaml:"cache_size"`            // max cached analyses
 }
 
 // AWSConfig represents AWS configuration
@@ -72,6 +244,36 @@ type AWSConfig struct {
 	Accounts        []string `yaml:"accounts"`
 }
 
+// OTelConfig represents OpenTelemetry tracing configuration
+type OTelConfig struct {
+	Endpoint    string  `yaml:"endpoint"`     // OTLP/HTTP collector host:port; empty disables tracing
+	SampleRatio float64 `yaml:"sample_ratio"` // share of traces started by pgao that are recorded
+	Insecure    bool    `yaml:"insecure"`     // export over plain HTTP
+}
+
+// validate checks the allowed origins, which browsers compare verbatim
+// with their Origin header
+func (cc CORSConfig) validate() error {
+	if cc.MaxAge < 0 {
+		return fmt.Errorf("invalid server cors max age: %s", cc.MaxAge)
+	}
+	if len(cc.AllowedOrigins) > 0 && len(cc.AllowedMethods) == 0 {
+		return fmt.Errorf("server cors allowed methods must not be empty when origins are allowed")
+	}
+
+	for _, origin := range cc.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+			return fmt.Errorf("invalid server cors origin %q: must be scheme://host[:port] or *", origin)
+		}
+	}
+
+	return nil
+}
+
 // LoadConfig loads configuration from file or environment variables
 func LoadConfig(configPath string) (*Config, error) {
 	cfg := defaultConfig()
@@ -115,7 +317,7 @@ func expandEnvVars(input string) string {
 			// $VAR format
 			varName = match[1:]
 		}
-		
+
 		// Get value from environment
 		if val := os.Getenv(varName); val != "" {
 			return val
@@ -129,11 +331,21 @@ func expandEnvVars(input string) string {
 func defaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host:         "0.0.0.0",
-			Port:         8080,
-			ReadTimeout:  15 * time.Second,
-			WriteTimeout: 15 * time.Second,
-			IdleTimeout:  60 * time.Second,
+			Host:            "0.0.0.0",
+			Port:            8080,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    15 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+			CORS: CORSConfig{
+				AllowedMethods: []string{"GET", "POST"},
+				AllowedHeaders: []string{"Authorization", "Content-Type"},
+				MaxAge:         10 * time.Minute,
+			},
+			RateLimit: RateLimitConfig{
+				RequestsPerSecond: 10,
+				Burst:             20,
+			},
 		},
 		Clusters: []ClusterConfig{},
 		Logging: LoggingConfig{
@@ -143,14 +355,29 @@ func defaultConfig() *Config {
 		},
 		Metrics: MetricsConfig{
 			CollectionInterval: 60 * time.Second,
+			ProbeInterval:      15 * time.Second,
 			RetentionDays:      30,
 			EnablePrometheus:   true,
 			PrometheusPort:     9090,
+			Influx: InfluxConfig{
+				Timeout: 10 * time.Second,
+			},
+		},
+		Analysis: AnalysisConfig{
+			CacheSize: 1000,
+		},
+		Notifications: NotificationsConfig{
+			Webhooks:    []WebhookConfig{},
+			MaxAttempts: 3,
+			Timeout:     10 * time.Second,
 		},
 		AWS: AWSConfig{
 			Region:   "us-east-1",
 			Accounts: []string{},
 		},
+		OTel: OTelConfig{
+			SampleRatio: 1.0,
+		},
 	}
 }
 
@@ -165,6 +392,9 @@ func (c *Config) overrideFromEnv() {
 			c.Server.Port = p
 		}
 	}
+	if basePath := os.Getenv("SERVER_BASE_PATH"); basePath != "" {
+		c.Server.BasePath = basePath
+	}
 
 	// Logging configuration
 	if level := os.Getenv("LOG_LEVEL"); level != "" {
@@ -217,6 +447,35 @@ func (c *Config) Validate() error {
 	if c.Server.Port < 1 || c.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
+	if c.Server.ShutdownTimeout <= 0 {
+		return fmt.Errorf("invalid server shutdown timeout: %s", c.Server.ShutdownTimeout)
+	}
+	if c.Server.BasePath != "" && !strings.HasPrefix(c.Server.BasePath, "/") {
+		return fmt.Errorf("invalid server base path %q: must start with /", c.Server.BasePath)
+	}
+	if strings.ContainsAny(c.Server.BasePath, "?#{}") {
+		return fmt.Errorf("invalid server base path %q: must be a plain path", c.Server.BasePath)
+	}
+	for i, key := range c.Server.APIKeys {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("server api key %d is empty", i)
+		}
+		if strings.Contains(key, "${") {
+			return fmt.Errorf("server api key %d references an environment variable that isn't set", i)
+		}
+		if len(key) < minAPIKeyLength {
+			return fmt.Errorf("server api key %d is shorter than %d characters", i, minAPIKeyLength)
+		}
+	}
+	if err := c.Server.CORS.validate(); err != nil {
+		return err
+	}
+	if c.Server.RateLimit.RequestsPerSecond < 0 {
+		return fmt.Errorf("invalid server rate limit: %g requests per second", c.Server.RateLimit.RequestsPerSecond)
+	}
+	if c.Server.RateLimit.RequestsPerSecond > 0 && c.Server.RateLimit.Burst < 1 {
+		return fmt.Errorf("invalid server rate limit burst: %d", c.Server.RateLimit.Burst)
+	}
 
 	// Validate logging configuration
 	validLevels := map[string]bool{
@@ -227,6 +486,10 @@ func (c *Config) Validate() error {
 	}
 
 	// Validate clusters
+	validSessionAttrs := map[string]bool{
+		"": true, "any": true, "read-write": true, "read-only": true,
+		"primary": true, "standby": true, "prefer-standby": true,
+	}
 	if len(c.Clusters) == 0 {
 		return fmt.Errorf("at least one cluster must be configured")
 	}
@@ -235,9 +498,12 @@ func (c *Config) Validate() error {
 		if cluster.ID == "" {
 			return fmt.Errorf("cluster %d: ID is required", i)
 		}
-		if cluster.Host == "" {
+		if cluster.Host == "" && len(cluster.Hosts) == 0 {
 			return fmt.Errorf("cluster %s: host is required", cluster.ID)
 		}
+		if !validSessionAttrs[cluster.TargetSessionAttrs] {
+			return fmt.Errorf("cluster %s: invalid target_session_attrs: %s", cluster.ID, cluster.TargetSessionAttrs)
+		}
 		if cluster.Port < 1 || cluster.Port > 65535 {
 			return fmt.Errorf("cluster %s: invalid port: %d", cluster.ID, cluster.Port)
 		}
@@ -247,11 +513,184 @@ func (c *Config) Validate() error {
 		if cluster.Database == "" {
 			return fmt.Errorf("cluster %s: database is required", cluster.ID)
 		}
+		if cluster.Password != "" && cluster.PasswordFile != "" {
+			return fmt.Errorf("cluster %s: password and password_file are mutually exclusive", cluster.ID)
+		}
+		if cluster.Auth == "iam" && (cluster.Password != "" || cluster.PasswordFile != "") {
+			return fmt.Errorf("cluster %s: iam auth doesn't use password or password_file", cluster.ID)
+		}
+		if cluster.Auth != "" && cluster.Auth != "password" && cluster.Auth != "iam" {
+			return fmt.Errorf("cluster %s: invalid auth: %s", cluster.ID, cluster.Auth)
+		}
+		if cluster.Auth == "iam" {
+			if err := c.validateIAMAuth(cluster); err != nil {
+				return fmt.Errorf("cluster %s: %w", cluster.ID, err)
+			}
+		}
+		if cluster.ConnectAttempts < 0 {
+			return fmt.Errorf("cluster %s: invalid connect_attempts: %d", cluster.ID, cluster.ConnectAttempts)
+		}
+		if cluster.ConnectRetryDelay < 0 {
+			return fmt.Errorf("cluster %s: invalid connect_retry_delay: %s", cluster.ID, cluster.ConnectRetryDelay)
+		}
+		if cluster.InsecureSkipVerify && cluster.Environment == "production" {
+			return fmt.Errorf("cluster %s: insecure_skip_verify is not allowed in production", cluster.ID)
+		}
+		if err := cluster.Thresholds.Validate(); err != nil {
+			return fmt.Errorf("cluster %s: invalid thresholds: %w", cluster.ID, err)
+		}
 	}
 
+	// Validate primary/replica relationships, which must form chains ending at a primary
+	primaries := make(map[string]string, len(c.Clusters))
+	for _, cluster := range c.Clusters {
+		primaries[cluster.ID] = cluster.Primary
+	}
+	for _, cluster := range c.Clusters {
+		if cluster.Primary == "" {
+			continue
+		}
+		if _, exists := primaries[cluster.Primary]; !exists {
+			return fmt.Errorf("cluster %s: unknown primary cluster: %s", cluster.ID, cluster.Primary)
+		}
+		current := cluster.ID
+		for steps := 0; primaries[current] != ""; steps++ {
+			if steps >= len(c.Clusters) {
+				return fmt.Errorf("cluster %s: primary relationship forms a cycle", cluster.ID)
+			}
+			current = primaries[current]
+		}
+	}
+
+	if c.OTel.SampleRatio < 0 || c.OTel.SampleRatio > 1 {
+		return fmt.Errorf("otel sample ratio must be between 0 and 1, got %g", c.OTel.SampleRatio)
+	}
+
+	if c.Metrics.PrometheusPort < 0 || c.Metrics.PrometheusPort > 65535 {
+		return fmt.Errorf("invalid prometheus port: %d", c.Metrics.PrometheusPort)
+	}
+	if c.Metrics.EnablePrometheus && c.Metrics.PrometheusPort == c.Server.Port {
+		return fmt.Errorf("prometheus port %d is the server port; use 0 to serve metrics on the API server", c.Metrics.PrometheusPort)
+	}
+
+	if c.Metrics.Influx.WriteURL != "" && !strings.HasPrefix(c.Metrics.Influx.WriteURL, "http://") && !strings.HasPrefix(c.Metrics.Influx.WriteURL, "https://") {
+		return fmt.Errorf("invalid influx write URL: %s", c.Metrics.Influx.WriteURL)
+	}
+
+	if c.Metrics.ProbeInterval < 0 {
+		return fmt.Errorf("probe interval must not be negative")
+	}
+
+	if err := validateBuckets(c.Metrics.Buckets.HTTPLatency); err != nil {
+		return fmt.Errorf("invalid http_latency buckets: %w", err)
+	}
+	if err := validateBuckets(c.Metrics.Buckets.CollectDuration); err != nil {
+		return fmt.Errorf("invalid collect_duration buckets: %w", err)
+	}
+
+	if c.Analysis.CacheSize < 1 {
+		return fmt.Errorf("invalid analysis cache size: %d", c.Analysis.CacheSize)
+	}
+
+	// Validate composite alert rules
+	validSeverities := map[string]bool{
+		"": true, "critical": true, "high": true, "medium": true, "low": true, "info": true,
+	}
+	for i, rule := range c.Alerting.CompositeRules {
+		if rule.Name == "" {
+			return fmt.Errorf("composite rule %d: name is required", i)
+		}
+		switch rule.Operator {
+		case "and", "or":
+		case "score":
+			if rule.MinScore <= 0 {
+				return fmt.Errorf("composite rule %s: min_score must be positive with the score operator", rule.Name)
+			}
+		default:
+			return fmt.Errorf("composite rule %s: operator must be and, or or score", rule.Name)
+		}
+		if !validSeverities[rule.Severity] {
+			return fmt.Errorf("composite rule %s: invalid severity: %s", rule.Name, rule.Severity)
+		}
+		if len(rule.Conditions) == 0 {
+			return fmt.Errorf("composite rule %s: at least one condition is required", rule.Name)
+		}
+		for _, cond := range rule.Conditions {
+			if !models.IsNamedMetric(cond.Metric) {
+				return fmt.Errorf("composite rule %s: unknown metric: %s", rule.Name, cond.Metric)
+			}
+			switch cond.Operator {
+			case ">", ">=", "<", "<=":
+			default:
+				return fmt.Errorf("composite rule %s: invalid operator %q for metric %s", rule.Name, cond.Operator, cond.Metric)
+			}
+			if cond.Weight < 0 {
+				return fmt.Errorf("composite rule %s: weight for metric %s must not be negative", rule.Name, cond.Metric)
+			}
+		}
+	}
+
+	// Validate notifications
+	if c.Notifications.MaxAttempts < 1 {
+		return fmt.Errorf("invalid notification max attempts: %d", c.Notifications.MaxAttempts)
+	}
+	if c.Notifications.Timeout <= 0 {
+		return fmt.Errorf("invalid notification timeout: %s", c.Notifications.Timeout)
+	}
+	for i, webhook := range c.Notifications.Webhooks {
+		if !strings.HasPrefix(webhook.URL, "http://") && !strings.HasPrefix(webhook.URL, "https://") {
+			return fmt.Errorf("webhook %d: invalid URL: %s", i, webhook.URL)
+		}
+		if !validSeverities[webhook.MinSeverity] {
+			return fmt.Errorf("webhook %d: invalid min_severity: %s", i, webhook.MinSeverity)
+		}
+	}
+	if c.Notifications.Slack.WebhookURL != "" && !strings.HasPrefix(c.Notifications.Slack.WebhookURL, "https://") {
+		return fmt.Errorf("invalid slack webhook URL: must use https")
+	}
+	if !validSeverities[c.Notifications.Slack.MinSeverity] {
+		return fmt.Errorf("invalid slack min_severity: %s", c.Notifications.Slack.MinSeverity)
+	}
+
+	return nil
+}
+
+// validateBuckets checks that histogram bucket bounds are positive and increasing
+func validateBuckets(buckets []float64) error {
+	for i, bound := range buckets {
+		if bound <= 0 {
+			return fmt.Errorf("bucket %g must be positive", bound)
+		}
+		if i > 0 && bound <= buckets[i-1] {
+			return fmt.Errorf("buckets must be sorted in increasing order, %g follows %g", bound, buckets[i-1])
+		}
+	}
 	return nil
 }
 
+// validateIAMAuth checks that a cluster using IAM authentication has
+// everything needed to sign tokens
+func (c *Config) validateIAMAuth(cluster ClusterConfig) error {
+	if c.AWSRegion(cluster) == "" {
+		return fmt.Errorf("iam auth requires a region on the cluster or in the aws section")
+	}
+	if len(cluster.Hosts) > 0 {
+		return fmt.Errorf("iam auth tokens are bound to one host and can't be used with hosts")
+	}
+	if cluster.SSLMode == "disable" {
+		return fmt.Errorf("iam auth requires SSL, ssl_mode can't be disable")
+	}
+	return nil
+}
+
+// AWSRegion returns the AWS region of a cluster, defaulting to the aws section's region
+func (c *Config) AWSRegion(cluster ClusterConfig) string {
+	if cluster.Region != "" {
+		return cluster.Region
+	}
+	return c.AWS.Region
+}
+
 // GetCluster returns configuration for a specific cluster
 func (c *Config) GetCluster(clusterID string) (*ClusterConfig, error) {
 	for _, cluster := range c.Clusters {
@@ -262,6 +701,94 @@ func (c *Config) GetCluster(clusterID string) (*ClusterConfig, error) {
 	return nil, fmt.Errorf("cluster %s not found in configuration", clusterID)
 }
 
+// Diff describes what changed between c and other, without exposing secrets
+func (c *Config) Diff(other *Config) []string {
+	changes := make([]string, 0)
+
+	oldClusters := make(map[string]ClusterConfig, len(c.Clusters))
+	for _, cluster := range c.Clusters {
+		oldClusters[cluster.ID] = cluster
+	}
+
+	newClusters := make(map[string]ClusterConfig, len(other.Clusters))
+	for _, cluster := range other.Clusters {
+		newClusters[cluster.ID] = cluster
+
+		oldCluster, exists := oldClusters[cluster.ID]
+		if !exists {
+			changes = append(changes, fmt.Sprintf("cluster %s added (%s:%d)", cluster.ID, cluster.Host, cluster.Port))
+			continue
+		}
+		if oldCluster.Password != cluster.Password {
+			changes = append(changes, fmt.Sprintf("cluster %s: password changed", cluster.ID))
+		}
+		oldCluster.Password, cluster.Password = "", ""
+		if !reflect.DeepEqual(oldCluster, cluster) {
+			changes = append(changes, fmt.Sprintf("cluster %s: settings changed", cluster.ID))
+		}
+	}
+
+	for _, cluster := range c.Clusters {
+		if _, exists := newClusters[cluster.ID]; !exists {
+			changes = append(changes, fmt.Sprintf("cluster %s removed", cluster.ID))
+		}
+	}
+
+	if c.Logging.Level != other.Logging.Level {
+		changes = append(changes, fmt.Sprintf("logging level: %s -> %s", c.Logging.Level, other.Logging.Level))
+	}
+	if !reflect.DeepEqual(c.Server, other.Server) {
+		changes = append(changes, "server settings changed")
+	}
+	if !reflect.DeepEqual(c.Metrics, other.Metrics) {
+		changes = append(changes, "metrics settings changed")
+	}
+	if !reflect.DeepEqual(c.Alerting, other.Alerting) {
+		changes = append(changes, "alerting rules changed")
+	}
+	if !reflect.DeepEqual(c.Notifications, other.Notifications) {
+		changes = append(changes, "notification settings changed")
+	}
+
+	return changes
+}
+
+// ClusterChanged reports whether a cluster's configuration differs between c and other
+func (c *Config) ClusterChanged(other *Config, clusterID string) bool {
+	oldCluster, errOld := c.GetCluster(clusterID)
+	newCluster, errNew := other.GetCluster(clusterID)
+	if errOld != nil || errNew != nil {
+		return true
+	}
+	return !reflect.DeepEqual(oldCluster, newCluster)
+}
+
+// ConnectionChanged reports whether a cluster was added or removed, or had
+// a setting changed that requires reconnecting to it. Names, tags, the
+// environment, the primary and thresholds apply without a reconnect.
+func (c *Config) ConnectionChanged(other *Config, clusterID string) bool {
+	oldCluster, errOld := c.GetCluster(clusterID)
+	newCluster, errNew := other.GetCluster(clusterID)
+	if errOld != nil || errNew != nil {
+		return true
+	}
+	if newCluster.Auth == "iam" && (c.AWSRegion(*oldCluster) != other.AWSRegion(*newCluster) || !reflect.DeepEqual(c.AWS, other.AWS)) {
+		return true
+	}
+	return !reflect.DeepEqual(oldCluster.connectionSettings(), newCluster.connectionSettings())
+}
+
+// connectionSettings returns the cluster's configuration without the
+// settings that don't affect its connections
+func (cc ClusterConfig) connectionSettings() ClusterConfig {
+	cc.Name = ""
+	cc.Environment = ""
+	cc.Primary = ""
+	cc.Thresholds = ThresholdsConfig{}
+	cc.Tags = nil
+	return cc
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testConfig returns the default configuration with one valid cluster
+func testConfig() *Config {
+	cfg := defaultConfig()
+	cfg.Clusters = []ClusterConfig{{
+		ID:       "main",
+		Host:     "localhost",
+		Port:     5432,
+		User:     "pgao",
+		Database: "postgres",
+	}}
+	return cfg
+}
+
+func TestValidateAPIKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		err  string
+	}{
+		{"none", nil, ""},
+		{"long enough", []string{"0123456789abcdef"}, ""},
+		{"empty", []string{"0123456789abcdef", " "}, "api key 1 is empty"},
+		{"unexpanded", []string{"${PGAO_API_KEY}"}, "environment variable"},
+		{"too short", []string{"secret"}, "shorter than 16"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Server.APIKeys = tt.keys
+
+			err := cfg.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRejectsUnsetAPIKeyVariable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+server:
+  api_keys: ["${PGAO_TEST_UNSET_API_KEY}"]
+clusters:
+  - id: main
+    host: localhost
+    port: 5432
+    user: pgao
+    database: postgres
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Unsetenv("PGAO_TEST_UNSET_API_KEY")
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("config with an unset api key variable loaded")
+	}
+
+	t.Setenv("PGAO_TEST_UNSET_API_KEY", "0123456789abcdef0123")
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.APIKeys[0] != "0123456789abcdef0123" {
+		t.Errorf("api key = %q, want the variable's value", cfg.Server.APIKeys[0])
+	}
+}
+
+func TestConnectionChanged(t *testing.T) {
+	lag := int64(60000)
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   bool
+	}{
+		{"thresholds", func(c *Config) { c.Clusters[0].Thresholds.MaxReplicationLagMs = &lag }, false},
+		{"primary and tags", func(c *Config) {
+			c.Clusters[0].Primary = "other"
+			c.Clusters[0].Tags = map[string]string{"team": "db"}
+		}, false},
+		{"host", func(c *Config) { c.Clusters[0].Host = "replica" }, true},
+		{"password", func(c *Config) { c.Clusters[0].Password = "changed" }, true},
+		{"removed", func(c *Config) { c.Clusters = nil }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldCfg, newCfg := testConfig(), testConfig()
+			tt.change(newCfg)
+
+			if !oldCfg.ClusterChanged(newCfg, "main") {
+				t.Fatal("ClusterChanged() = false for a changed cluster")
+			}
+			if got := oldCfg.ConnectionChanged(newCfg, "main"); got != tt.want {
+				t.Errorf("ConnectionChanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCompositeRuleConditions(t *testing.T) {
+	tests := []struct {
+		name string
+		rule CompositeRuleConfig
+		err  string
+	}{
+		{"valid", CompositeRuleConfig{Name: "r", Operator: "and", Conditions: []ConditionConfig{{Metric: "lock_waits", Operator: ">", Threshold: 10}}}, ""},
+		{"unknown metric", CompositeRuleConfig{Name: "r", Operator: "and", Conditions: []ConditionConfig{{Metric: "lock_wait", Operator: ">"}}}, "unknown metric"},
+		{"unknown operator", CompositeRuleConfig{Name: "r", Operator: "and", Conditions: []ConditionConfig{{Metric: "lock_waits", Operator: "=>"}}}, "invalid operator"},
+		{"score without min_score", CompositeRuleConfig{Name: "r", Operator: "score", Conditions: []ConditionConfig{{Metric: "lock_waits", Operator: ">"}}}, "min_score"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Alerting.CompositeRules = []CompositeRuleConfig{tt.rule}
+
+			err := cfg.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Validate() = %v, want an error about %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateBuckets(t *testing.T) {
+	tests := []struct {
+		name            string
+		httpLatency     []float64
+		collectDuration []float64
+		err             string
+	}{
+		{"defaults", nil, nil, ""},
+		{"increasing", []float64{0.01, 0.1, 1}, []float64{1, 5, 30}, ""},
+		{"not positive", []float64{0, 0.1}, nil, "invalid http_latency buckets: bucket 0 must be positive"},
+		{"unsorted", nil, []float64{5, 1}, "invalid collect_duration buckets: buckets must be sorted"},
+		{"duplicate", []float64{0.1, 0.1}, nil, "buckets must be sorted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Metrics.Buckets = BucketsConfig{HTTPLatency: tt.httpLatency, CollectDuration: tt.collectDuration}
+
+			err := cfg.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRoutePrefix(t *testing.T) {
+	for basePath, want := range map[string]string{"": "", "/": "", "/pgao": "/pgao", "/pgao/": "/pgao", "/tools/pgao/": "/tools/pgao"} {
+		if got := (ServerConfig{BasePath: basePath}).RoutePrefix(); got != want {
+			t.Errorf("RoutePrefix() of %q = %q, want %q", basePath, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// unreachableAfterFailures is the number of consecutive failed health
+	// checks after which a cluster is marked unreachable
+	unreachableAfterFailures = 3
+
+	// initialReconnectBackoff is the wait before the first reconnection attempt
+	// to an unreachable cluster, doubled after every failed attempt
+	initialReconnectBackoff = 30 * time.Second
+
+	// maxReconnectBackoff caps the wait between reconnection attempts
+	maxReconnectBackoff = 10 * time.Minute
+)
+
+// ErrClusterUnreachable is returned by HealthCheck while an unreachable
+// cluster is waiting for its next reconnection attempt
+var ErrClusterUnreachable = errors.New("cluster is unreachable")
+
+// ClusterState is the reachability of a cluster as seen by its health checks
+type ClusterState string
+
+const (
+	// ClusterStateReachable means recent health checks passed, or failed fewer
+	// than unreachableAfterFailures times in a row
+	ClusterStateReachable ClusterState = "reachable"
+	// ClusterStateUnreachable means health checks kept failing and the cluster
+	// is backing off until its next reconnection attempt
+	ClusterStateUnreachable ClusterState = "unreachable"
+	// ClusterStateRecovering means the backoff has elapsed and the next health
+	// check decides whether the cluster is reachable again
+	ClusterStateRecovering ClusterState = "recovering"
+)
+
+// circuitBreaker tracks consecutive health check failures of a cluster
+type circuitBreaker struct {
+	failures int
+	open     bool
+	backoff  time.Duration
+	retryAt  time.Time
+}
+
+// state returns the cluster state the breaker represents at a point in time
+func (b *circuitBreaker) state(now time.Time) ClusterState {
+	switch {
+	case !b.open:
+		return ClusterStateReachable
+	case now.Before(b.retryAt):
+		return ClusterStateUnreachable
+	default:
+		return ClusterStateRecovering
+	}
+}
+
+// recordFailure counts a failed health check, opening the breaker once the
+// failures reach the threshold and doubling the backoff of a failed retry.
+// It reports whether the breaker opened.
+func (b *circuitBreaker) recordFailure(now time.Time) bool {
+	b.failures++
+
+	if b.open {
+		b.backoff = min(b.backoff*2, maxReconnectBackoff)
+		b.retryAt = now.Add(b.backoff)
+		return false
+	}
+
+	if b.failures < unreachableAfterFailures {
+		return false
+	}
+
+	b.open = true
+	b.backoff = initialReconnectBackoff
+	b.retryAt = now.Add(b.backoff)
+	return true
+}
+
+// recordSuccess closes the breaker, reporting whether it was open
+func (b *circuitBreaker) recordSuccess() bool {
+	wasOpen := b.open
+	*b = circuitBreaker{}
+	return wasOpen
+}
+
+// GetClusterState returns the reachability of a cluster
+func (cp *ConnectionPool) GetClusterState(clusterID string) (ClusterState, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	breaker, exists := cp.breakers[clusterID]
+	if !exists {
+		return "", fmt.Errorf("no connection pool found for cluster %s", clusterID)
+	}
+
+	return breaker.state(time.Now()), nil
+}
+
+// checkBreaker returns ErrClusterUnreachable while a cluster's reconnection
+// backoff is running, so health checks don't hit a cluster that is down
+func (cp *ConnectionPool) checkBreaker(clusterID string) error {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	breaker, exists := cp.breakers[clusterID]
+	if exists && breaker.state(time.Now()) == ClusterStateUnreachable {
+		return fmt.Errorf("%w, next reconnection attempt at %s", ErrClusterUnreachable, breaker.retryAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// recordHealth updates a cluster's breaker with the result of a health check
+func (cp *ConnectionPool) recordHealth(clusterID string, healthErr error) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	breaker, exists := cp.breakers[clusterID]
+	if !exists {
+		return
+	}
+
+	if healthErr == nil {
+		if breaker.recordSuccess() {
+			cp.log.Infof("Cluster %s is reachable again", clusterID)
+		}
+		return
+	}
+
+	if breaker.recordFailure(time.Now()) {
+		cp.log.Errorf("Cluster %s is unreachable after %d failed health checks, retrying in %s", clusterID, breaker.failures, breaker.backoff)
+	} else if breaker.open {
+		cp.log.Warnf("Reconnection to cluster %s failed, retrying in %s: %v", clusterID, breaker.backoff, healthErr)
+	}
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var b circuitBreaker
+
+	for i := 1; i < unreachableAfterFailures; i++ {
+		if b.recordFailure(now) {
+			t.Fatalf("breaker opened after %d failures", i)
+		}
+		if got := b.state(now); got != ClusterStateReachable {
+			t.Fatalf("state after %d failures = %s, want %s", i, got, ClusterStateReachable)
+		}
+	}
+
+	if !b.recordFailure(now) {
+		t.Fatalf("breaker didn't open after %d failures", unreachableAfterFailures)
+	}
+	if got := b.state(now); got != ClusterStateUnreachable {
+		t.Errorf("state after opening = %s, want %s", got, ClusterStateUnreachable)
+	}
+	if got := b.state(now.Add(initialReconnectBackoff - time.Second)); got != ClusterStateUnreachable {
+		t.Errorf("state before the backoff elapsed = %s, want %s", got, ClusterStateUnreachable)
+	}
+
+	now = now.Add(initialReconnectBackoff)
+	if got := b.state(now); got != ClusterStateRecovering {
+		t.Errorf("state after the backoff elapsed = %s, want %s", got, ClusterStateRecovering)
+	}
+
+	// Every failed retry doubles the backoff up to the cap
+	want := initialReconnectBackoff
+	for i := 0; i < 10; i++ {
+		if b.recordFailure(now) {
+			t.Fatal("recordFailure reported opening an open breaker")
+		}
+		want = min(want*2, maxReconnectBackoff)
+		if b.backoff != want {
+			t.Fatalf("backoff after %d failed retries = %s, want %s", i+1, b.backoff, want)
+		}
+		now = now.Add(b.backoff)
+	}
+	if b.backoff != maxReconnectBackoff {
+		t.Errorf("backoff = %s, want it capped at %s", b.backoff, maxReconnectBackoff)
+	}
+
+	if !b.recordSuccess() {
+		t.Error("recordSuccess didn't report closing an open breaker")
+	}
+	if got := b.state(now); got != ClusterStateReachable {
+		t.Errorf("state after a successful check = %s, want %s", got, ClusterStateReachable)
+	}
+	if b.recordFailure(now) {
+		t.Error("breaker opened on the first failure after closing")
+	}
+}
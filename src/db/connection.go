@@ -2,10 +2,18 @@ package db
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
@@ -13,14 +21,19 @@ import (
 
 // ConnectionPool manages database connections
 type ConnectionPool struct {
-	pools map[string]*pgxpool.Pool
-	mu    sync.RWMutex
-	log   *logrus.Logger
+	pools       map[string]*pgxpool.Pool
+	configs     map[string]ConnectionConfig
+	poolHistory map[string][]PoolSample
+	usage       map[string]*poolUsage
+	breakers    map[string]*circuitBreaker
+	mu          sync.RWMutex
+	log         *logrus.Logger
 }
 
 // ConnectionConfig holds database connection configuration
 type ConnectionConfig struct {
 	Host            string
+	Hosts           []string // optional host[:port] list for multi-host failover
 	Port            int
 	User            string
 	Password        string
@@ -30,41 +43,200 @@ type ConnectionConfig struct {
 	ConnMaxLifetime time.Duration
 	ConnMaxIdleTime time.Duration
 	SSLMode         string
+	HealthQuery     string
+	HealthExpected  string
+	// TargetSessionAttrs selects which host of a multi-host config to use:
+	// any, read-write, read-only, primary, standby, prefer-standby
+	TargetSessionAttrs string
+	// InsecureSkipVerify disables server certificate verification for self-signed
+	// test environments. It is refused for production clusters.
+	InsecureSkipVerify bool
+	Environment        string
+	// ConnectAttempts and ConnectRetryDelay bound the initial connection: the
+	// delay doubles after every failed attempt
+	ConnectAttempts   int
+	ConnectRetryDelay time.Duration
+	// AuthTokens, when set, generates the password of every new connection
+	// for RDS IAM authentication
+	AuthTokens *RDSAuthTokens
+	// PasswordFile, when set, is read for the password of every new
+	// connection, so rotated secrets are used without a restart
+	PasswordFile string
 }
 
+const (
+	// defaultHealthQuery is the canary query used when a cluster doesn't define one
+	defaultHealthQuery = "SELECT 1"
+
+	// maxConnectRetryDelay caps the wait between initial connection attempts
+	maxConnectRetryDelay = 30 * time.Second
+)
+
 // NewConnectionPool creates a new connection pool manager
 func NewConnectionPool(log *logrus.Logger) *ConnectionPool {
 	return &ConnectionPool{
-		pools: make(map[string]*pgxpool.Pool),
-		log:   log,
+		pools:       make(map[string]*pgxpool.Pool),
+		configs:     make(map[string]ConnectionConfig),
+		poolHistory: make(map[string][]PoolSample),
+		usage:       make(map[string]*poolUsage),
+		breakers:    make(map[string]*circuitBreaker),
+		log:         log,
 	}
 }
 
-// AddCluster adds a new cluster connection to the pool
-func (cp *ConnectionPool) AddCluster(clusterID string, config ConnectionConfig) error {
-	cp.mu.Lock()
-	defer cp.mu.Unlock()
+// redactedPassword replaces passwords in error messages, matching the mask
+// net/url and pgconn use
+const redactedPassword = "xxxxx"
+
+// connString builds the connection URL, listing every host for multi-host configs
+func (c ConnectionConfig) connString() string {
+	connURL := c.connURL()
+	return connURL.String()
+}
+
+// SafeDSN returns the connection URL with the password masked, for logs and errors
+func (c ConnectionConfig) SafeDSN() string {
+	connURL := c.connURL()
+	return connURL.Redacted()
+}
+
+// passwordSetting matches the password of a connection string in key=value
+// form, quoted or not
+var passwordSetting = regexp.MustCompile(`password=('(?:[^'\\]|\\.)*'|\S*)`)
+
+// redactedError is an error whose message has the password of a connection
+// string masked. It wraps the original error, so errors.Is and errors.As
+// still see through it.
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redact masks the password component of connection strings an error
+// quotes, since errors from parsing or connecting may include them. The
+// rest of the message is left as is.
+func (c ConnectionConfig) redact(err error) error {
+	if err == nil || c.Password == "" {
+		return err
+	}
+
+	message := err.Error()
+	userinfo := url.UserPassword(c.User, c.Password).String() + "@"
+	redacted := strings.ReplaceAll(message, userinfo, url.UserPassword(c.User, redactedPassword).String()+"@")
+	redacted = passwordSetting.ReplaceAllString(redacted, "password="+redactedPassword)
+	if redacted == message {
+		return err
+	}
+
+	return &redactedError{err: err, message: redacted}
+}
+
+// connURL builds the connection URL of the config
+func (c ConnectionConfig) connURL() url.URL {
+	// url.URL escapes the credentials and database name, so characters such
+	// as @, / and ? in a password don't break the connection string
+	query := url.Values{}
+	query.Set("sslmode", c.SSLMode)
+	if c.TargetSessionAttrs != "" {
+		query.Set("target_session_attrs", c.TargetSessionAttrs)
+	}
+
+	connURL := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.User, c.Password),
+		Path:   "/" + c.Database,
+	}
+
+	port := strconv.Itoa(c.Port)
+	if len(c.Hosts) > 0 {
+		// A URL can't list several IPv6 addresses as its host, so multiple
+		// hosts are passed as host and port parameters, as libpq accepts them
+		hosts := make([]string, 0, len(c.Hosts))
+		ports := make([]string, 0, len(c.Hosts))
+		for _, entry := range c.Hosts {
+			host, hostPort := splitHost(entry, port)
+			hosts = append(hosts, host)
+			ports = append(ports, hostPort)
+		}
+		query.Set("host", strings.Join(hosts, ","))
+		query.Set("port", strings.Join(ports, ","))
+	} else {
+		connURL.Host = net.JoinHostPort(c.Host, port)
+	}
+
+	connURL.RawQuery = query.Encode()
+	return connURL
+}
 
+// splitHost splits a host[:port] entry, using the default port when it has
+// none. IPv6 addresses may be given bare, as ::1, or in brackets, as [::1]
+// or [::1]:5433.
+func splitHost(entry, defaultPort string) (string, string) {
+	if host, port, err := net.SplitHostPort(entry); err == nil {
+		return host, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(entry, "["), "]"), defaultPort
+}
+
+// skipTLSVerify disables server certificate verification on every TLS config
+// of a pool, including the fallbacks of multi-host configs
+func skipTLSVerify(poolConfig *pgxpool.Config) {
+	tlsConfigs := []*tls.Config{poolConfig.ConnConfig.TLSConfig}
+	for _, fallback := range poolConfig.ConnConfig.Fallbacks {
+		tlsConfigs = append(tlsConfigs, fallback.TLSConfig)
+	}
+
+	for _, tlsConfig := range tlsConfigs {
+		if tlsConfig == nil {
+			continue
+		}
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = nil
+		tlsConfig.VerifyConnection = nil
+	}
+}
+
+// AddCluster adds a new cluster connection to the pool. A cluster that is
+// slow to come up is retried with exponential backoff until ctx is cancelled.
+func (cp *ConnectionPool) AddCluster(ctx context.Context, clusterID string, config ConnectionConfig) error {
 	// Check if already exists
-	if _, exists := cp.pools[clusterID]; exists {
+	cp.mu.RLock()
+	_, exists := cp.pools[clusterID]
+	cp.mu.RUnlock()
+	if exists {
 		return fmt.Errorf("cluster %s already exists in pool", clusterID)
 	}
 
 	// Build connection string
-	connString := fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
-		config.User,
-		config.Password,
-		config.Host,
-		config.Port,
-		config.Database,
-		config.SSLMode,
-	)
+	connString := config.connString()
 
 	// Parse connection string and create pool config
 	poolConfig, err := pgxpool.ParseConfig(connString)
 	if err != nil {
-		return fmt.Errorf("failed to parse connection string: %w", err)
+		return fmt.Errorf("failed to parse connection string %s: %w", config.SafeDSN(), config.redact(err))
+	}
+
+	if config.InsecureSkipVerify {
+		if config.Environment == "production" {
+			return fmt.Errorf("insecure_skip_verify is not allowed for production cluster %s", clusterID)
+		}
+		skipTLSVerify(poolConfig)
+		cp.log.Warnf("TLS CERTIFICATE VERIFICATION DISABLED for cluster %s (%s environment): connections are open to man-in-the-middle attacks", clusterID, config.Environment)
+	}
+
+	switch {
+	case config.AuthTokens != nil:
+		poolConfig.BeforeConnect = iamPassword(config.AuthTokens)
+	case config.PasswordFile != "":
+		poolConfig.BeforeConnect = filePassword(config.PasswordFile)
 	}
 
 	// Configure pool
@@ -92,27 +264,113 @@ func (cp *ConnectionPool) AddCluster(clusterID string, config ConnectionConfig)
 		poolConfig.MaxConnIdleTime = 30 * time.Minute
 	}
 
+	usage := newPoolUsage()
+	poolConfig.BeforeAcquire = usage.beforeAcquire
+
 	// Create pool
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create connection pool: %w", err)
+		return fmt.Errorf("failed to create connection pool: %w", config.redact(err))
 	}
+	usage.start(pool)
 
 	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	if err := cp.connect(ctx, clusterID, pool, config); err != nil {
+		usage.stop()
+		pool.Close()
+		return err
+	}
 
-	if err := pool.Ping(ctx); err != nil {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if _, exists := cp.pools[clusterID]; exists {
+		usage.stop()
 		pool.Close()
-		return fmt.Errorf("failed to ping database: %w", err)
+		return fmt.Errorf("cluster %s already exists in pool", clusterID)
 	}
 
 	cp.pools[clusterID] = pool
+	cp.usage[clusterID] = usage
+	cp.configs[clusterID] = config
+	cp.breakers[clusterID] = &circuitBreaker{}
 	cp.log.Infof("Successfully connected to cluster %s", clusterID)
+	cp.log.Debugf("Cluster %s connection string: %s", clusterID, config.SafeDSN())
 
 	return nil
 }
 
+// iamPassword returns a BeforeConnect hook that sets a fresh IAM
+// authentication token as the connection password. Tokens are bound to a
+// host, so IAM authentication doesn't support multi-host configs.
+func iamPassword(tokens *RDSAuthTokens) func(context.Context, *pgx.ConnConfig) error {
+	return func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+		token, err := tokens.Token(ctx, connConfig.Host, connConfig.Port)
+		if err != nil {
+			return fmt.Errorf("failed to generate IAM auth token: %w", err)
+		}
+		connConfig.Password = token
+		return nil
+	}
+}
+
+// filePassword returns a BeforeConnect hook that reads the connection
+// password from a file, such as a mounted Kubernetes secret
+func filePassword(path string) func(context.Context, *pgx.ConnConfig) error {
+	return func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read password file: %w", err)
+		}
+		// Secret files usually end with a newline that isn't part of the password
+		connConfig.Password = strings.TrimRight(string(data), "\r\n")
+		return nil
+	}
+}
+
+// pinger is the part of a pool connect needs, so retries can be tested without a server
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// connect pings a new pool until it answers, retrying with exponential backoff
+func (cp *ConnectionPool) connect(ctx context.Context, clusterID string, pool pinger, config ConnectionConfig) error {
+	attempts := config.ConnectAttempts
+	if attempts <= 0 {
+		attempts = 5 // default
+	}
+	delay := config.ConnectRetryDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = pool.Ping(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("connecting to cluster %s cancelled: %w", clusterID, ctx.Err())
+		}
+		if attempt == attempts {
+			break
+		}
+
+		cp.log.Warnf("Connection attempt %d/%d to cluster %s failed, retrying in %s: %v", attempt, attempts, clusterID, delay, config.redact(err))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("connecting to cluster %s cancelled: %w", clusterID, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxConnectRetryDelay)
+	}
+
+	return fmt.Errorf("failed to ping database after %d attempts: %w", attempts, config.redact(err))
+}
+
 // GetPool returns the connection pool for a cluster
 func (cp *ConnectionPool) GetPool(clusterID string) (*pgxpool.Pool, error) {
 	cp.mu.RLock()
@@ -126,17 +384,53 @@ func (cp *ConnectionPool) GetPool(clusterID string) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
-// HealthCheck performs a health check on a cluster connection
+// HealthCheck performs a health check on a cluster connection. Beyond a ping
+// it runs the cluster's canary query so a server that accepts connections but
+// can't serve queries is reported as unhealthy. After repeated failures the
+// cluster is marked unreachable and checked again with exponential backoff,
+// returning ErrClusterUnreachable in between.
 func (cp *ConnectionPool) HealthCheck(clusterID string) error {
 	pool, err := cp.GetPool(clusterID)
 	if err != nil {
 		return err
 	}
+	if err := cp.checkBreaker(clusterID); err != nil {
+		return err
+	}
+
+	err = cp.healthCheck(clusterID, pool)
+	cp.recordHealth(clusterID, err)
+	return err
+}
+
+// healthCheck pings a cluster and runs its canary query
+func (cp *ConnectionPool) healthCheck(clusterID string, pool *pgxpool.Pool) error {
+	cp.mu.RLock()
+	config := cp.configs[clusterID]
+	cp.mu.RUnlock()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return pool.Ping(ctx)
+	if err := pool.Ping(ctx); err != nil {
+		return err
+	}
+
+	healthQuery := config.HealthQuery
+	if healthQuery == "" {
+		healthQuery = defaultHealthQuery
+	}
+
+	var result interface{}
+	if err := pool.QueryRow(ctx, healthQuery).Scan(&result); err != nil {
+		return fmt.Errorf("health query failed: %w", err)
+	}
+
+	if config.HealthExpected != "" && fmt.Sprint(result) != config.HealthExpected {
+		return fmt.Errorf("health query returned %v, expected %s", result, config.HealthExpected)
+	}
+
+	return nil
 }
 
 // GetAllClusters returns a list of all cluster IDs
@@ -162,8 +456,13 @@ func (cp *ConnectionPool) RemoveCluster(clusterID string) error {
 		return fmt.Errorf("cluster %s not found in pool", clusterID)
 	}
 
+	cp.usage[clusterID].stop()
 	pool.Close()
 	delete(cp.pools, clusterID)
+	delete(cp.configs, clusterID)
+	delete(cp.poolHistory, clusterID)
+	delete(cp.usage, clusterID)
+	delete(cp.breakers, clusterID)
 	cp.log.Infof("Removed cluster %s from pool", clusterID)
 
 	return nil
@@ -175,11 +474,16 @@ func (cp *ConnectionPool) Close() {
 	defer cp.mu.Unlock()
 
 	for clusterID, pool := range cp.pools {
+		cp.usage[clusterID].stop()
 		pool.Close()
 		cp.log.Infof("Closed connection pool for cluster %s", clusterID)
 	}
 
 	cp.pools = make(map[string]*pgxpool.Pool)
+	cp.configs = make(map[string]ConnectionConfig)
+	cp.poolHistory = make(map[string][]PoolSample)
+	cp.usage = make(map[string]*poolUsage)
+	cp.breakers = make(map[string]*circuitBreaker)
 }
 
 // GetPoolStats returns statistics for a cluster's connection pool
@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+
+	"github.com/zvdy/pgao/src/pgtest"
+)
+
+func TestConnURLHosts(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ConnectionConfig
+		hosts  []string
+		ports  []uint16
+	}{
+		{"host", ConnectionConfig{Host: "db.internal", Port: 5432}, []string{"db.internal"}, []uint16{5432}},
+		{"ipv6 host", ConnectionConfig{Host: "::1", Port: 5432}, []string{"::1"}, []uint16{5432}},
+		{"hosts", ConnectionConfig{Hosts: []string{"primary", "replica:5433"}, Port: 5432}, []string{"primary", "replica"}, []uint16{5432, 5433}},
+		{"ipv6 hosts", ConnectionConfig{Hosts: []string{"fd00::1", "[fd00::2]", "[fd00::3]:5433"}, Port: 5432}, []string{"fd00::1", "fd00::2", "fd00::3"}, []uint16{5432, 5432, 5433}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.SSLMode = "disable"
+			poolConfig, err := pgxpool.ParseConfig(tt.config.connString())
+			if err != nil {
+				t.Fatalf("connection string doesn't parse: %v", err)
+			}
+
+			connConfig := poolConfig.ConnConfig
+			hosts, ports := []string{connConfig.Host}, []uint16{connConfig.Port}
+			for _, fallback := range connConfig.Fallbacks {
+				hosts = append(hosts, fallback.Host)
+				ports = append(ports, fallback.Port)
+			}
+			if !slices.Equal(hosts, tt.hosts) || !slices.Equal(ports, tt.ports) {
+				t.Errorf("hosts = %v on ports %v, want %v on %v", hosts, ports, tt.hosts, tt.ports)
+			}
+		})
+	}
+}
+
+func TestRedactMasksOnlyThePassword(t *testing.T) {
+	config := ConnectionConfig{Host: "db.internal", Port: 5432, User: "pgao", Password: "p@ss word/postgres", Database: "postgres", SSLMode: "require"}
+	cause := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"url", "dial " + config.connString() + ": connection refused", "dial " + config.SafeDSN() + ": connection refused"},
+		{"key value", "cannot connect with user=pgao password=secret host=db.internal", "cannot connect with user=pgao password=xxxxx host=db.internal"},
+		{"quoted key value", "cannot connect with password='it\\'s secret' host=db.internal", "cannot connect with password=xxxxx host=db.internal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := config.redact(fmt.Errorf("%s: %w", tt.message, cause))
+			if got := err.Error(); got != tt.want+": connection refused" {
+				t.Errorf("redact() = %q, want %q", got, tt.want+": connection refused")
+			}
+			if !errors.Is(err, cause) {
+				t.Error("redacted error doesn't wrap the original")
+			}
+		})
+	}
+
+	// Messages without a connection string are returned as they are
+	err := fmt.Errorf("database postgres: %w", cause)
+	if got := config.redact(err); got != err {
+		t.Errorf("redact() = %v, want the original error", got)
+	}
+}
+
+func TestFilePassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("s3cret \n\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the trailing line breaks are trimmed, not spaces that may be part of the password
+	connConfig := &pgx.ConnConfig{}
+	if err := filePassword(path)(context.Background(), connConfig); err != nil {
+		t.Fatal(err)
+	}
+	if connConfig.Password != "s3cret " {
+		t.Errorf("password = %q, want %q", connConfig.Password, "s3cret ")
+	}
+
+	err := filePassword(filepath.Join(t.TempDir(), "missing"))(context.Background(), connConfig)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing password file error = %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestConnStringSpecialPasswordCharacters(t *testing.T) {
+	for _, password := range []string{"p@ss", "a/b", "user:pass", "100%", "p@ss/w:rd%20?#&="} {
+		t.Run(password, func(t *testing.T) {
+			config := ConnectionConfig{Host: "db.internal", Port: 5432, User: "pgao", Password: password, Database: "app", SSLMode: "disable"}
+			poolConfig, err := pgxpool.ParseConfig(config.connString())
+			if err != nil {
+				t.Fatalf("connection string doesn't parse: %v", err)
+			}
+
+			connConfig := poolConfig.ConnConfig
+			if connConfig.Password != password {
+				t.Errorf("password = %q, want %q", connConfig.Password, password)
+			}
+			if connConfig.Host != "db.internal" || connConfig.Port != 5432 || connConfig.User != "pgao" || connConfig.Database != "app" {
+				t.Errorf("connected to %s@%s:%d/%s, want pgao@db.internal:5432/app", connConfig.User, connConfig.Host, connConfig.Port, connConfig.Database)
+			}
+		})
+	}
+}
+
+func TestSkipTLSVerify(t *testing.T) {
+	config := ConnectionConfig{Hosts: []string{"primary", "replica"}, Port: 5432, User: "pgao", Database: "app", SSLMode: "verify-full"}
+	poolConfig, err := pgxpool.ParseConfig(config.connString())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tlsConfigs := []*tls.Config{poolConfig.ConnConfig.TLSConfig}
+	for _, fallback := range poolConfig.ConnConfig.Fallbacks {
+		tlsConfigs = append(tlsConfigs, fallback.TLSConfig)
+	}
+	if tlsConfigs[0].InsecureSkipVerify {
+		t.Fatal("verify-full config already skips verification")
+	}
+
+	skipTLSVerify(poolConfig)
+	for i, tlsConfig := range tlsConfigs {
+		if !tlsConfig.InsecureSkipVerify || tlsConfig.VerifyPeerCertificate != nil || tlsConfig.VerifyConnection != nil {
+			t.Errorf("TLS config %d still verifies certificates", i)
+		}
+	}
+}
+
+func TestInsecureSkipVerifyRejectedInProduction(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cp := NewConnectionPool(log)
+	defer cp.Close()
+
+	config := ConnectionConfig{Host: "db.internal", Port: 5432, User: "pgao", Database: "app", SSLMode: "require", InsecureSkipVerify: true, Environment: "production"}
+	err := cp.AddCluster(context.Background(), "prod", config)
+	if err == nil || !strings.Contains(err.Error(), "insecure_skip_verify is not allowed") {
+		t.Errorf("AddCluster() = %v, want insecure_skip_verify rejected", err)
+	}
+	if _, err := cp.GetPool("prod"); err == nil {
+		t.Error("rejected cluster was added to the pool")
+	}
+}
+
+// flakyPinger fails its first pings
+type flakyPinger struct {
+	failures int
+	pings    int
+}
+
+func (p *flakyPinger) Ping(ctx context.Context) error {
+	p.pings++
+	if p.pings <= p.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestConnectRetries(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cp := NewConnectionPool(log)
+	config := ConnectionConfig{ConnectAttempts: 3, ConnectRetryDelay: time.Millisecond}
+
+	pinger := &flakyPinger{failures: 2}
+	if err := cp.connect(context.Background(), "main", pinger, config); err != nil {
+		t.Fatalf("connect() = %v, want success on the third attempt", err)
+	}
+	if pinger.pings != 3 {
+		t.Errorf("pinged %d times, want 3", pinger.pings)
+	}
+
+	pinger = &flakyPinger{failures: 3}
+	err := cp.connect(context.Background(), "main", pinger, config)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("connect() = %v, want failure after 3 attempts", err)
+	}
+	if pinger.pings != 3 {
+		t.Errorf("pinged %d times, want 3", pinger.pings)
+	}
+}
+
+func TestHealthCheckCanary(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	cp := NewConnectionPool(log)
+	t.Cleanup(cp.Close)
+
+	server := pgtest.NewServer(t)
+	server.Handle("SELECT 1", pgtest.Result{Columns: []string{"?column?"}, Rows: [][]any{{int32(1)}}})
+	server.Handle("FROM canary", pgtest.Result{Columns: []string{"state"}, Rows: [][]any{{"ready"}}})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+		wantErr  string
+	}{
+		{name: "default"},
+		{name: "expected", query: "SELECT state FROM canary", expected: "ready"},
+		{name: "unexpected", query: "SELECT state FROM canary", expected: "open", wantErr: "returned ready, expected open"},
+		{name: "failing", query: "SELECT state FROM missing", wantErr: "health query failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := cp.AddCluster(context.Background(), tt.name, ConnectionConfig{
+				Host:           server.Host(),
+				Port:           server.Port(),
+				User:           "pgao",
+				Database:       "app",
+				SSLMode:        "disable",
+				MinConnections: 1,
+				HealthQuery:    tt.query,
+				HealthExpected: tt.expected,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := cp.HealthCheck(tt.name)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("HealthCheck() = %v, want a passing canary", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("HealthCheck() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
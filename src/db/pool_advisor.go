@@ -0,0 +1,316 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// poolStatsHistorySize is the number of pool samples kept per cluster
+	poolStatsHistorySize = 60
+
+	// minPoolSamples is the number of samples needed before recommending
+	minPoolSamples = 5
+
+	// emptyAcquireRatioHigh is the share of acquires that had to wait which indicates starvation
+	emptyAcquireRatioHigh = 0.05
+
+	// acquireWaitHigh is the average acquire time which indicates starvation
+	acquireWaitHigh = 10 * time.Millisecond
+
+	// pressureWindow is the number of recent sampling intervals acquire wait is averaged over
+	pressureWindow = 3
+
+	// usageReadInterval is how often a pool's acquired connections are read
+	// between two samples
+	usageReadInterval = time.Second
+)
+
+// PoolSample is a snapshot of a cluster's connection pool. AcquiredConns is
+// the count at the time of the sample, the peak and average cover the
+// interval since the previous sample.
+type PoolSample struct {
+	Timestamp         time.Time
+	AcquiredConns     int32
+	PeakAcquiredConns int32
+	AvgAcquiredConns  float64
+	IdleConns         int32
+	TotalConns        int32
+	MaxConns          int32
+	AcquireCount      int64
+	EmptyAcquireCount int64
+	AcquireDuration   time.Duration
+}
+
+// PoolRecommendation is a sizing recommendation for a cluster's connection pool
+type PoolRecommendation struct {
+	ClusterID          string  `json:"cluster_id"`
+	Action             string  `json:"action"` // increase, decrease, keep, insufficient_data
+	Reason             string  `json:"reason"`
+	CurrentMaxConns    int32   `json:"current_max_conns"`
+	CurrentMinConns    int32   `json:"current_min_conns"`
+	RecommendedMax     int32   `json:"recommended_max_conns"`
+	RecommendedMin     int32   `json:"recommended_min_conns"`
+	PeakAcquiredConns  int32   `json:"peak_acquired_conns"`
+	AvgAcquiredConns   float64 `json:"avg_acquired_conns"`
+	EmptyAcquireRatio  float64 `json:"empty_acquire_ratio"`
+	AvgAcquireWaitMs   float64 `json:"avg_acquire_wait_ms"`
+	Samples            int     `json:"samples"`
+	ObservationSeconds float64 `json:"observation_seconds"`
+}
+
+// PoolPressure summarizes recent contention on a cluster's connection pool
+type PoolPressure struct {
+	// EmptyAcquireStreak is the number of consecutive recent intervals in
+	// which acquires found no idle connection and had to wait
+	EmptyAcquireStreak int
+	// AcquireWaitMs is the average acquire time over the last pressureWindow intervals
+	AcquireWaitMs float64
+}
+
+// poolUsage tracks the acquired connections of a pool between two samples.
+// Connections are held for milliseconds and samples are taken once per
+// collection, so a single reading mostly finds every connection idle.
+type poolUsage struct {
+	pool *pgxpool.Pool
+	done chan struct{}
+
+	mu       sync.Mutex
+	peak     int32
+	sum      int64
+	readings int64
+}
+
+// newPoolUsage creates a poolUsage whose pool is set by start
+func newPoolUsage() *poolUsage {
+	return &poolUsage{done: make(chan struct{})}
+}
+
+// beforeAcquire is a BeforeAcquire hook recording the acquired connections
+// when they peak, right as one more is handed out
+func (pu *poolUsage) beforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	acquired := pu.pool.Stat().AcquiredConns()
+
+	pu.mu.Lock()
+	pu.peak = max(pu.peak, acquired)
+	pu.mu.Unlock()
+
+	return true
+}
+
+// start reads the pool's acquired connections every usageReadInterval,
+// for their average, until stop
+func (pu *poolUsage) start(pool *pgxpool.Pool) {
+	pu.pool = pool
+
+	go func() {
+		ticker := time.NewTicker(usageReadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-pu.done:
+				return
+			case <-ticker.C:
+				pu.observe(pool.Stat().AcquiredConns())
+			}
+		}
+	}()
+}
+
+// stop ends the periodic reads
+func (pu *poolUsage) stop() {
+	close(pu.done)
+}
+
+// observe records a periodic reading of the acquired connections
+func (pu *poolUsage) observe(acquired int32) {
+	pu.mu.Lock()
+	defer pu.mu.Unlock()
+
+	pu.peak = max(pu.peak, acquired)
+	pu.sum += int64(acquired)
+	pu.readings++
+}
+
+// take returns the peak and average acquired connections since the previous
+// call, including the current count, and starts over
+func (pu *poolUsage) take(current int32) (int32, float64) {
+	pu.mu.Lock()
+	defer pu.mu.Unlock()
+
+	peak := max(pu.peak, current)
+	avg := float64(pu.sum+int64(current)) / float64(pu.readings+1)
+	pu.peak, pu.sum, pu.readings = 0, 0, 0
+
+	return peak, avg
+}
+
+// RecordPoolStats stores a snapshot of a cluster's pool statistics
+func (cp *ConnectionPool) RecordPoolStats(clusterID string) error {
+	cp.mu.RLock()
+	pool, exists := cp.pools[clusterID]
+	usage := cp.usage[clusterID]
+	cp.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("no connection pool found for cluster %s", clusterID)
+	}
+
+	stat := pool.Stat()
+	peak, avg := stat.AcquiredConns(), float64(stat.AcquiredConns())
+	if usage != nil {
+		peak, avg = usage.take(stat.AcquiredConns())
+	}
+
+	sample := PoolSample{
+		Timestamp:         time.Now(),
+		AcquiredConns:     stat.AcquiredConns(),
+		PeakAcquiredConns: peak,
+		AvgAcquiredConns:  avg,
+		IdleConns:         stat.IdleConns(),
+		TotalConns:        stat.TotalConns(),
+		MaxConns:          stat.MaxConns(),
+		AcquireCount:      stat.AcquireCount(),
+		EmptyAcquireCount: stat.EmptyAcquireCount(),
+		AcquireDuration:   stat.AcquireDuration(),
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	history := append(cp.poolHistory[clusterID], sample)
+	if len(history) > poolStatsHistorySize {
+		history = history[len(history)-poolStatsHistorySize:]
+	}
+	cp.poolHistory[clusterID] = history
+
+	return nil
+}
+
+// PoolPressure returns the recent contention on a cluster's pool from its recorded history
+func (cp *ConnectionPool) PoolPressure(clusterID string) (PoolPressure, error) {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+
+	if _, exists := cp.pools[clusterID]; !exists {
+		return PoolPressure{}, fmt.Errorf("no connection pool found for cluster %s", clusterID)
+	}
+
+	return poolPressure(cp.poolHistory[clusterID]), nil
+}
+
+// poolPressure derives pool contention from a series of pool samples. A
+// streak of waiting acquires separates sustained starvation from a single spike.
+func poolPressure(history []PoolSample) PoolPressure {
+	var pressure PoolPressure
+
+	for i := len(history) - 1; i > 0; i-- {
+		if history[i].EmptyAcquireCount <= history[i-1].EmptyAcquireCount {
+			break
+		}
+		pressure.EmptyAcquireStreak++
+	}
+
+	if len(history) < 2 {
+		return pressure
+	}
+
+	first := history[max(0, len(history)-1-pressureWindow)]
+	last := history[len(history)-1]
+	if acquires := last.AcquireCount - first.AcquireCount; acquires > 0 {
+		waited := last.AcquireDuration - first.AcquireDuration
+		pressure.AcquireWaitMs = float64(waited) / float64(time.Millisecond) / float64(acquires)
+	}
+
+	return pressure
+}
+
+// RecommendPoolSize recommends MaxConns/MinConns for a cluster from its recorded pool history
+func (cp *ConnectionPool) RecommendPoolSize(clusterID string) (*PoolRecommendation, error) {
+	pool, err := cp.GetPool(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	cp.mu.RLock()
+	history := make([]PoolSample, len(cp.poolHistory[clusterID]))
+	copy(history, cp.poolHistory[clusterID])
+	cp.mu.RUnlock()
+
+	config := pool.Config()
+	rec := recommendPoolSize(history, config.MaxConns, config.MinConns)
+	rec.ClusterID = clusterID
+
+	return rec, nil
+}
+
+// recommendPoolSize derives a sizing recommendation from a series of pool samples
+func recommendPoolSize(history []PoolSample, maxConns, minConns int32) *PoolRecommendation {
+	rec := &PoolRecommendation{
+		Action:          "insufficient_data",
+		CurrentMaxConns: maxConns,
+		CurrentMinConns: minConns,
+		RecommendedMax:  maxConns,
+		RecommendedMin:  minConns,
+		Samples:         len(history),
+	}
+
+	if len(history) < minPoolSamples {
+		rec.Reason = fmt.Sprintf("need at least %d samples, have %d", minPoolSamples, len(history))
+		return rec
+	}
+
+	first, last := history[0], history[len(history)-1]
+	rec.ObservationSeconds = last.Timestamp.Sub(first.Timestamp).Seconds()
+
+	var acquiredSum float64
+	for _, sample := range history {
+		if sample.PeakAcquiredConns > rec.PeakAcquiredConns {
+			rec.PeakAcquiredConns = sample.PeakAcquiredConns
+		}
+		acquiredSum += sample.AvgAcquiredConns
+	}
+	rec.AvgAcquiredConns = acquiredSum / float64(len(history))
+
+	if acquires := last.AcquireCount - first.AcquireCount; acquires > 0 {
+		rec.EmptyAcquireRatio = float64(last.EmptyAcquireCount-first.EmptyAcquireCount) / float64(acquires)
+		waited := last.AcquireDuration - first.AcquireDuration
+		rec.AvgAcquireWaitMs = float64(waited) / float64(time.Millisecond) / float64(acquires)
+	}
+
+	avgWait := time.Duration(rec.AvgAcquireWaitMs * float64(time.Millisecond))
+	recommendedMin := int32(math.Ceil(rec.AvgAcquiredConns))
+	if recommendedMin < 1 {
+		recommendedMin = 1
+	}
+
+	switch {
+	case rec.PeakAcquiredConns >= maxConns && (rec.EmptyAcquireRatio > emptyAcquireRatioHigh || avgWait > acquireWaitHigh):
+		rec.Action = "increase"
+		rec.RecommendedMax = int32(math.Ceil(float64(maxConns) * 1.5))
+		rec.Reason = fmt.Sprintf("pool hit its limit of %d and %.1f%% of acquires had to wait", maxConns, rec.EmptyAcquireRatio*100)
+	case rec.PeakAcquiredConns*4 < maxConns && maxConns > 5:
+		rec.Action = "decrease"
+		rec.RecommendedMax = rec.PeakAcquiredConns * 2
+		if rec.RecommendedMax < 5 {
+			rec.RecommendedMax = 5
+		}
+		rec.Reason = fmt.Sprintf("peak usage of %d connections is well below the limit of %d", rec.PeakAcquiredConns, maxConns)
+	default:
+		rec.Action = "keep"
+		rec.Reason = "pool size matches observed demand"
+	}
+
+	if recommendedMin > rec.RecommendedMax {
+		recommendedMin = rec.RecommendedMax
+	}
+	rec.RecommendedMin = recommendedMin
+
+	return rec
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPoolUsageTake(t *testing.T) {
+	usage := newPoolUsage()
+	usage.observe(4)
+	usage.observe(0)
+	usage.observe(2)
+
+	peak, avg := usage.take(0)
+	if peak != 4 || avg != 1.5 {
+		t.Errorf("take() = %d, %g, want peak 4 and average 1.5", peak, avg)
+	}
+
+	// The next interval starts over from the current count
+	peak, avg = usage.take(1)
+	if peak != 1 || avg != 1 {
+		t.Errorf("take() after reset = %d, %g, want 1 and 1", peak, avg)
+	}
+}
+
+func TestRecommendPoolSizeUsesPeakBetweenSamples(t *testing.T) {
+	start := time.Now()
+	history := make([]PoolSample, 0, minPoolSamples)
+	for i := 0; i < minPoolSamples; i++ {
+		history = append(history, PoolSample{
+			Timestamp: start.Add(time.Duration(i) * time.Minute),
+			// Every connection is back in the pool when the sample is taken
+			AcquiredConns:     0,
+			PeakAcquiredConns: 10,
+			AvgAcquiredConns:  6,
+			AcquireCount:      int64(i) * 1000,
+			EmptyAcquireCount: int64(i) * 200,
+			AcquireDuration:   time.Duration(i) * time.Second,
+		})
+	}
+
+	rec := recommendPoolSize(history, 10, 2)
+	if rec.Action != "increase" {
+		t.Errorf("action = %s (%s), want increase", rec.Action, rec.Reason)
+	}
+	if rec.PeakAcquiredConns != 10 || rec.AvgAcquiredConns != 6 {
+		t.Errorf("usage = peak %d, average %g, want 10 and 6", rec.PeakAcquiredConns, rec.AvgAcquiredConns)
+	}
+	if rec.RecommendedMin != 6 {
+		t.Errorf("recommended min = %d, want 6", rec.RecommendedMin)
+	}
+}
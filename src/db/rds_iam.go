@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const (
+	// rdsTokenLifetime is how long RDS accepts an IAM authentication token
+	rdsTokenLifetime = 15 * time.Minute
+
+	// rdsTokenRefreshMargin is how long before expiry a cached token is replaced
+	rdsTokenRefreshMargin = 5 * time.Minute
+
+	// emptyPayloadHash is the SHA-256 of an empty request body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// AWSCredentials configure the credentials IAM authentication tokens are
+// signed with. Without static keys the SDK's default chain is used, which
+// covers environment variables, shared config, IRSA and instance profiles.
+// When AssumeRoleARN is set those credentials are only used to assume that
+// role, and tokens are signed with the temporary role credentials.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	AssumeRoleARN   string
+}
+
+// rdsToken is a generated authentication token for one endpoint
+type rdsToken struct {
+	token   string
+	expires time.Time
+}
+
+// RDSAuthTokens generates RDS IAM authentication tokens, which are used as
+// the password of new connections. Tokens are valid for 15 minutes and are
+// cached per endpoint until shortly before they expire.
+type RDSAuthTokens struct {
+	region string
+	user   string
+	config AWSCredentials
+	now    func() time.Time
+
+	mu          sync.Mutex
+	credentials aws.CredentialsProvider // loaded on the first token
+	tokens      map[string]rdsToken     // host:port -> token
+}
+
+// NewRDSAuthTokens creates a token generator for a database user in a region
+func NewRDSAuthTokens(region, user string, config AWSCredentials) *RDSAuthTokens {
+	return &RDSAuthTokens{
+		region: region,
+		user:   user,
+		config: config,
+		now:    time.Now,
+		tokens: make(map[string]rdsToken),
+	}
+}
+
+// Token returns an authentication token for the database at host and port
+func (rt *RDSAuthTokens) Token(ctx context.Context, host string, port uint16) (string, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	endpoint := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	now := rt.now()
+
+	if cached, exists := rt.tokens[endpoint]; exists && now.Before(cached.expires.Add(-rdsTokenRefreshMargin)) {
+		return cached.token, nil
+	}
+
+	if rt.credentials == nil {
+		provider, err := loadCredentials(ctx, rt.region, rt.config)
+		if err != nil {
+			return "", fmt.Errorf("failed to load AWS credentials: %w", err)
+		}
+		rt.credentials = provider
+	}
+
+	creds, err := rt.credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	token, err := buildAuthToken(ctx, endpoint, rt.region, rt.user, creds, now)
+	if err != nil {
+		return "", err
+	}
+
+	// A token signed with temporary credentials stops working with them
+	expires := now.Add(rdsTokenLifetime)
+	if creds.CanExpire && creds.Expires.Before(expires) {
+		expires = creds.Expires
+	}
+	rt.tokens[endpoint] = rdsToken{token: token, expires: expires}
+
+	return token, nil
+}
+
+// loadCredentials builds the credentials provider tokens are signed with
+func loadCredentials(ctx context.Context, region string, config AWSCredentials) (aws.CredentialsProvider, error) {
+	options := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(region)}
+	if config.AccessKeyID != "" && config.SecretAccessKey != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(config.AccessKeyID, config.SecretAccessKey, config.SessionToken),
+		))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AssumeRoleARN == "" {
+		return cfg.Credentials, nil
+	}
+
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), config.AssumeRoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = "pgao"
+	})
+	return aws.NewCredentialsCache(provider), nil
+}
+
+// buildAuthToken presigns an RDS connect request for a database user, the
+// same way the SDK's feature/rds/auth BuildAuthToken does
+func buildAuthToken(ctx context.Context, endpoint, region, user string, creds aws.Credentials, at time.Time) (string, error) {
+	params := url.Values{}
+	params.Set("Action", "connect")
+	params.Set("DBUser", user)
+	params.Set("X-Amz-Expires", strconv.Itoa(int(rdsTokenLifetime.Seconds())))
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+endpoint+"/?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	signed, _, err := v4.NewSigner().PresignHTTP(ctx, creds, req, emptyPayloadHash, "rds-db", region, at.UTC())
+	if err != nil {
+		return "", fmt.Errorf("failed to sign auth token: %w", err)
+	}
+
+	return strings.TrimPrefix(signed, "https://"), nil
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// testAuthTokens returns a token generator signing with static credentials
+// at a clock the test controls
+func testAuthTokens(provider aws.CredentialsProvider, now *time.Time) *RDSAuthTokens {
+	tokens := NewRDSAuthTokens("eu-west-1", "pgao_monitor", AWSCredentials{})
+	tokens.credentials = provider
+	tokens.now = func() time.Time { return *now }
+	return tokens
+}
+
+func TestRDSAuthTokenFormat(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tokens := testAuthTokens(credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", ""), &now)
+
+	token, err := tokens.Token(context.Background(), "db.example.rds.amazonaws.com", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint, query, ok := strings.Cut(token, "/?")
+	if !ok || endpoint != "db.example.rds.amazonaws.com:5432" {
+		t.Fatalf("token = %q, want the endpoint followed by a query", token)
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"Action":           "connect",
+		"DBUser":           "pgao_monitor",
+		"X-Amz-Algorithm":  "AWS4-HMAC-SHA256",
+		"X-Amz-Credential": "AKIDEXAMPLE/20260102/eu-west-1/rds-db/aws4_request",
+		"X-Amz-Date":       "20260102T030405Z",
+		"X-Amz-Expires":    "900",
+	}
+	for key, value := range want {
+		if got := params.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if params.Get("X-Amz-Signature") == "" {
+		t.Error("token isn't signed")
+	}
+}
+
+func TestRDSAuthTokenIPv6Endpoint(t *testing.T) {
+	now := time.Now()
+	tokens := testAuthTokens(credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", ""), &now)
+
+	token, err := tokens.Token(context.Background(), "2001:db8::1", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "[2001:db8::1]:5432/?") {
+		t.Errorf("token = %q, want a bracketed IPv6 endpoint", token)
+	}
+}
+
+func TestRDSAuthTokenCachedUntilRefreshMargin(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tokens := testAuthTokens(credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", ""), &now)
+	ctx := context.Background()
+
+	first, err := tokens.Token(ctx, "db.example.rds.amazonaws.com", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(rdsTokenLifetime - rdsTokenRefreshMargin - time.Second)
+	cached, err := tokens.Token(ctx, "db.example.rds.amazonaws.com", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != first {
+		t.Error("token was regenerated before the refresh margin")
+	}
+
+	other, err := tokens.Token(ctx, "replica.example.rds.amazonaws.com", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Error("endpoints share a token")
+	}
+
+	now = now.Add(2 * time.Second)
+	refreshed, err := tokens.Token(ctx, "db.example.rds.amazonaws.com", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed == first {
+		t.Error("token wasn't regenerated within the refresh margin")
+	}
+}
+
+func TestRDSAuthTokenExpiresWithCredentials(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	provider := aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{
+			AccessKeyID:     "ASIAEXAMPLE",
+			SecretAccessKey: "secret",
+			SessionToken:    "session",
+			CanExpire:       true,
+			Expires:         now.Add(7 * time.Minute),
+		}, nil
+	})
+	tokens := testAuthTokens(provider, &now)
+	ctx := context.Background()
+
+	first, err := tokens.Token(ctx, "db.example.rds.amazonaws.com", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(first, "X-Amz-Security-Token=session") {
+		t.Errorf("token = %q, want the session token", first)
+	}
+
+	// The credentials expire in 7 minutes, so the token is replaced 5 minutes earlier
+	now = now.Add(3 * time.Minute)
+	refreshed, err := tokens.Token(ctx, "db.example.rds.amazonaws.com", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed == first {
+		t.Error("token outlived the credentials it was signed with")
+	}
+}
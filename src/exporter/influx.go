@@ -0,0 +1,198 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zvdy/pgao/src/models"
+)
+
+// influxMeasurement is the measurement name used for cluster metrics
+const influxMeasurement = "pgao_metrics"
+
+// InfluxExporter formats collected metrics as InfluxDB line protocol, serving
+// the latest sample per cluster for Telegraf and optionally pushing each
+// sample to an InfluxDB write endpoint
+type InfluxExporter struct {
+	writeURL     string
+	token        string
+	client       *http.Client
+	log          *logrus.Logger
+	mu           sync.RWMutex
+	environments map[string]string
+	latest       map[string]*models.Metrics
+}
+
+// NewInfluxExporter creates a new InfluxExporter. An empty writeURL disables pushing.
+func NewInfluxExporter(writeURL, token string, timeout time.Duration, log *logrus.Logger) *InfluxExporter {
+	return &InfluxExporter{
+		writeURL:     writeURL,
+		token:        token,
+		client:       &http.Client{Timeout: timeout},
+		log:          log,
+		environments: make(map[string]string),
+		latest:       make(map[string]*models.Metrics),
+	}
+}
+
+// SetEnvironment sets the environment tag reported for a cluster
+func (ie *InfluxExporter) SetEnvironment(clusterID, environment string) {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	ie.environments[clusterID] = environment
+}
+
+// Export records a cluster's metrics and pushes them when a write URL is configured
+func (ie *InfluxExporter) Export(ctx context.Context, metrics *models.Metrics) error {
+	ie.mu.Lock()
+	ie.latest[metrics.ClusterID] = metrics
+	environment := ie.environments[metrics.ClusterID]
+	ie.mu.Unlock()
+
+	if ie.writeURL == "" {
+		return nil
+	}
+
+	line := FormatLineProtocol(metrics, environment)
+	if line == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ie.writeURL, strings.NewReader(line+"\n"))
+	if err != nil {
+		return fmt.Errorf("failed to build influx write request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if ie.token != "" {
+		req.Header.Set("Authorization", "Token "+ie.token)
+	}
+
+	resp, err := ie.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write metrics to influx: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("influx write returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ServeHTTP serves the latest metrics of every cluster in line protocol
+func (ie *InfluxExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ie.mu.RLock()
+	clusterIDs := make([]string, 0, len(ie.latest))
+	for clusterID := range ie.latest {
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+	sort.Strings(clusterIDs)
+
+	var buf bytes.Buffer
+	for _, clusterID := range clusterIDs {
+		if line := FormatLineProtocol(ie.latest[clusterID], ie.environments[clusterID]); line != "" {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	ie.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// influxField is a single line protocol field
+type influxField struct {
+	key   string
+	value string
+}
+
+// FormatLineProtocol formats metrics as a single pgao_metrics line tagged with
+// the cluster and environment. Only groups collected this cycle become fields;
+// an empty string is returned when nothing was collected.
+func FormatLineProtocol(metrics *models.Metrics, environment string) string {
+	fields := make([]influxField, 0)
+	intField := func(key string, v int64) {
+		fields = append(fields, influxField{key, strconv.FormatInt(v, 10) + "i"})
+	}
+	floatField := func(key string, v float64) {
+		fields = append(fields, influxField{key, strconv.FormatFloat(v, 'f', -1, 64)})
+	}
+
+	if metrics.IsCollected(models.MetricGroupConnections) {
+		intField("connections_active", int64(metrics.ConnectionsActive))
+		intField("connections_total", int64(metrics.ConnectionsTotal))
+	}
+	if metrics.IsCollected(models.MetricGroupCache) {
+		floatField("cache_hit_ratio", metrics.CacheHitRatio)
+	}
+	if metrics.IsCollected(models.MetricGroupTransactions) {
+		floatField("transactions_per_sec", metrics.TransactionsPerSec)
+	}
+	if metrics.IsCollected(models.MetricGroupLocks) {
+		intField("lock_waits", int64(metrics.LockWaits))
+		intField("deadlock_count", int64(metrics.DeadlockCount))
+	}
+	if metrics.IsCollected(models.MetricGroupReplication) {
+		intField("replication_lag_ms", metrics.ReplicationLag)
+	}
+	if metrics.IsCollected(models.MetricGroupBloat) {
+		floatField("table_bloat_pct", metrics.TableBloat)
+	}
+	if metrics.IsCollected(models.MetricGroupDiskIO) {
+		floatField("disk_io_read", metrics.DiskIORead)
+		floatField("disk_io_write", metrics.DiskIOWrite)
+	}
+	if metrics.IsCollected(models.MetricGroupResources) {
+		floatField("cpu_usage", metrics.CPUUsage)
+		floatField("memory_usage", metrics.MemoryUsage)
+	}
+
+	if len(fields) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(influxMeasurement)
+	b.WriteString(",cluster=")
+	b.WriteString(escapeTag(metrics.ClusterID))
+	if environment != "" {
+		b.WriteString(",environment=")
+		b.WriteString(escapeTag(environment))
+	}
+
+	for i, field := range fields {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(field.key)
+		b.WriteByte('=')
+		b.WriteString(field.value)
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(metrics.Timestamp.UnixNano(), 10))
+
+	return b.String()
+}
+
+// tagEscaper escapes the characters line protocol reserves in tag values
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// escapeTag escapes a tag value for line protocol
+func escapeTag(value string) string {
+	return tagEscaper.Replace(value)
+}
@@ -0,0 +1,44 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestFormatLineProtocol(t *testing.T) {
+	metrics := models.NewMetrics("eu west,db=1")
+	metrics.Timestamp = time.Unix(1700000000, 123456789)
+	metrics.ConnectionsActive = 5
+	metrics.ConnectionsTotal = 20
+	metrics.CacheHitRatio = 0.995
+	metrics.ReplicationLag = 1500
+	metrics.MarkCollected(models.MetricGroupConnections)
+	metrics.MarkCollected(models.MetricGroupCache)
+	metrics.MarkCollected(models.MetricGroupReplication)
+
+	// Tag values escape commas, equals signs and spaces; integer fields get
+	// an i suffix; the timestamp is in nanoseconds
+	want := `pgao_metrics,cluster=eu\ west\,db\=1,environment=prod\ eu ` +
+		`connections_active=5i,connections_total=20i,cache_hit_ratio=0.995,replication_lag_ms=1500i ` +
+		`1700000000123456789`
+	if got := FormatLineProtocol(metrics, "prod eu"); got != want {
+		t.Errorf("FormatLineProtocol() =\n%s\nwant\n%s", got, want)
+	}
+
+	// Without an environment the tag is left out
+	if got, want := FormatLineProtocol(metrics, ""), `pgao_metrics,cluster=eu\ west\,db\=1 connections_active=5i`; !strings.HasPrefix(got, want) {
+		t.Errorf("FormatLineProtocol() without environment = %s", got)
+	}
+}
+
+func TestFormatLineProtocolNothingCollected(t *testing.T) {
+	metrics := models.NewMetrics("main")
+	metrics.CacheHitRatio = 0.5
+
+	if got := FormatLineProtocol(metrics, "prod"); got != "" {
+		t.Errorf("FormatLineProtocol() = %q, want an empty line when no group was collected", got)
+	}
+}
@@ -6,16 +6,25 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"github.com/zvdy/pgao/src/analyzer"
 	"github.com/zvdy/pgao/src/api"
 	"github.com/zvdy/pgao/src/collector"
 	"github.com/zvdy/pgao/src/config"
 	"github.com/zvdy/pgao/src/db"
+	"github.com/zvdy/pgao/src/exporter"
+	"github.com/zvdy/pgao/src/models"
+	"github.com/zvdy/pgao/src/notifier"
+	"github.com/zvdy/pgao/src/tracing"
 )
 
 func main() {
@@ -45,42 +54,124 @@ func main() {
 
 	log.Infof("Loaded configuration with %d clusters", len(cfg.Clusters))
 
+	// Tracing stays a no-op unless an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.OTel.Endpoint, cfg.OTel.SampleRatio, cfg.OTel.Insecure)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	if cfg.OTel.Endpoint != "" {
+		log.Infof("Exporting traces to %s", cfg.OTel.Endpoint)
+	}
+
 	// Initialize connection pool
 	pool := db.NewConnectionPool(log)
 	defer pool.Close()
 
-	// Connect to all configured clusters
+	// Connect to all configured clusters. Clusters that are slow to start are
+	// retried, and an interrupt while waiting for them aborts startup.
+	startupCtx, stopStartup := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	for _, clusterCfg := range cfg.Clusters {
-		connConfig := db.ConnectionConfig{
-			Host:            clusterCfg.Host,
-			Port:            clusterCfg.Port,
-			User:            clusterCfg.User,
-			Password:        clusterCfg.Password,
-			Database:        clusterCfg.Database,
-			SSLMode:         clusterCfg.SSLMode,
-			MaxConnections:  clusterCfg.MaxConnections,
-			MinConnections:  clusterCfg.MinConnections,
-			ConnMaxLifetime: clusterCfg.ConnMaxLifetime,
-			ConnMaxIdleTime: clusterCfg.ConnMaxIdleTime,
-		}
-
-		if err := pool.AddCluster(clusterCfg.ID, connConfig); err != nil {
+		if err := pool.AddCluster(startupCtx, clusterCfg.ID, connectionConfig(cfg, clusterCfg)); err != nil {
+			if startupCtx.Err() != nil {
+				break
+			}
 			log.Errorf("Failed to connect to cluster %s: %v", clusterCfg.ID, err)
 			continue
 		}
 
 		log.Infof("Connected to cluster: %s (%s:%d)", clusterCfg.ID, clusterCfg.Host, clusterCfg.Port)
 	}
+	interrupted := startupCtx.Err() != nil
+	stopStartup()
+	if interrupted {
+		log.Info("Interrupted while connecting to clusters, exiting")
+		return
+	}
 
 	// Initialize analyzers
-	queryAnalyzer := analyzer.NewQueryAnalyzer()
+	queryAnalyzer := analyzer.NewQueryAnalyzerWithCacheSize(cfg.Analysis.CacheSize)
+	queryAnalyzer.AddBaselineFingerprints(cfg.Analysis.BaselineFingerprints...)
+
+	if cfg.Analysis.BaselineFile != "" {
+		fingerprints, err := analyzer.LoadBaselineFile(cfg.Analysis.BaselineFile)
+		if err != nil {
+			log.Fatalf("Failed to load analysis baseline: %v", err)
+		}
+		queryAnalyzer.AddBaselineFingerprints(fingerprints...)
+		log.Infof("Loaded %d baselined query fingerprints", len(fingerprints))
+	}
 	performanceAnalyzer := analyzer.NewPerformanceAnalyzer()
 
+	for _, ruleCfg := range cfg.Alerting.CompositeRules {
+		rule := analyzer.CompositeRule{
+			Name:     ruleCfg.Name,
+			Operator: ruleCfg.Operator,
+			MinScore: ruleCfg.MinScore,
+			Severity: models.AlertSeverity(ruleCfg.Severity),
+		}
+		for _, condCfg := range ruleCfg.Conditions {
+			rule.Conditions = append(rule.Conditions, analyzer.Condition{
+				Metric:    condCfg.Metric,
+				Operator:  condCfg.Operator,
+				Threshold: condCfg.Threshold,
+				Weight:    condCfg.Weight,
+			})
+		}
+
+		if err := performanceAnalyzer.AddCompositeRule(rule); err != nil {
+			log.Fatalf("Invalid composite alert rule: %v", err)
+		}
+	}
+
+	for _, clusterCfg := range cfg.Clusters {
+		performanceAnalyzer.SetClusterThresholds(clusterCfg.ID, clusterThresholds(performanceAnalyzer.Thresholds(), clusterCfg.Thresholds))
+	}
+
+	alertManager := analyzer.NewAlertManager(performanceAnalyzer)
+	for _, clusterCfg := range cfg.Clusters {
+		alertManager.SetPrimary(clusterCfg.ID, clusterCfg.Primary)
+	}
+
+	webhooks := make([]notifier.Webhook, 0, len(cfg.Notifications.Webhooks)+1)
+	for _, webhookCfg := range cfg.Notifications.Webhooks {
+		webhooks = append(webhooks, notifier.Webhook{
+			URL:         webhookCfg.URL,
+			MinSeverity: models.AlertSeverity(webhookCfg.MinSeverity),
+			Secret:      webhookCfg.Secret,
+		})
+	}
+	if cfg.Notifications.Slack.WebhookURL != "" {
+		webhooks = append(webhooks, notifier.SlackWebhook(cfg.Notifications.Slack.WebhookURL, models.AlertSeverity(cfg.Notifications.Slack.MinSeverity)))
+	}
+
+	var webhookNotifier *notifier.WebhookNotifier
+	if len(webhooks) > 0 {
+		webhookNotifier = notifier.NewWebhookNotifier(webhooks, cfg.Notifications.MaxAttempts, cfg.Notifications.Timeout, log)
+		alertManager.AddNotifier(webhookNotifier)
+		log.Infof("Sending alert notifications to %d webhooks", len(webhooks))
+	}
+
 	log.Info("Initialized analyzers")
 
 	// Initialize collectors
 	metricsCollector := collector.NewMetricsCollector(pool, log, cfg.Metrics.CollectionInterval)
 	clusterCollector := collector.NewClusterCollector(pool, log, cfg.Metrics.CollectionInterval*2)
+	clusterCollector.AddSettings(cfg.Metrics.Settings...)
+	metricsCollector.AddSink(alertManager)
+	clusterCollector.AddStatusObserver(alertManager)
+	clusterCollector.UseStartTimes(metricsCollector)
+	metricsCollector.RegisterDurationMetrics(prometheus.DefaultRegisterer, cfg.Metrics.Buckets.CollectDuration)
+	metricsCollector.RegisterClusterMetrics(prometheus.DefaultRegisterer)
+
+	var influxExporter *exporter.InfluxExporter
+	if cfg.Metrics.Influx.Enabled {
+		influxExporter = exporter.NewInfluxExporter(cfg.Metrics.Influx.WriteURL, cfg.Metrics.Influx.Token, cfg.Metrics.Influx.Timeout, log)
+		for _, clusterCfg := range cfg.Clusters {
+			influxExporter.SetEnvironment(clusterCfg.ID, clusterCfg.Environment)
+		}
+		metricsCollector.AddSink(influxExporter)
+		log.Info("Enabled InfluxDB line protocol export")
+	}
 
 	log.Info("Initialized collectors")
 
@@ -88,8 +179,30 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go metricsCollector.Start(ctx)
-	go clusterCollector.Start(ctx)
+	var collectors sync.WaitGroup
+	collectors.Add(2)
+	go func() {
+		defer collectors.Done()
+		metricsCollector.Start(ctx)
+	}()
+	go func() {
+		defer collectors.Done()
+		clusterCollector.Start(ctx)
+	}()
+	if cfg.Metrics.ProbeInterval > 0 {
+		collectors.Add(1)
+		go func() {
+			defer collectors.Done()
+			clusterCollector.StartProbing(ctx, cfg.Metrics.ProbeInterval)
+		}()
+	}
+	if webhookNotifier != nil {
+		collectors.Add(1)
+		go func() {
+			defer collectors.Done()
+			webhookNotifier.Start(ctx)
+		}()
+	}
 
 	log.Info("Started background collectors")
 
@@ -98,14 +211,19 @@ func main() {
 		pool,
 		queryAnalyzer,
 		performanceAnalyzer,
+		alertManager,
 		metricsCollector,
 		clusterCollector,
+		cfg.Metrics.Buckets.HTTPLatency,
 		log,
 	)
 
-	// Setup HTTP router
-	router := mux.NewRouter()
-	handler.RegisterRoutes(router)
+	router, routes := newRouter(cfg, handler, log)
+	metricsServer := newMetricsServer(cfg, routes)
+
+	if influxExporter != nil {
+		routes.Handle("/api/v1/export/influx", influxExporter).Methods("GET")
+	}
 
 	// Setup HTTP server
 	serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -125,25 +243,363 @@ func main() {
 		}
 	}()
 
+	if metricsServer != nil {
+		go func() {
+			log.Infof("Serving Prometheus metrics on %s", metricsServer.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start metrics server: %v", err)
+			}
+		}()
+	}
+
 	log.Info("PGAO is ready to accept requests")
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal, reloading configuration on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	reloader := &configReloader{
+		ctx:              ctx,
+		path:             configPath,
+		current:          cfg,
+		pool:             pool,
+		clusterCollector: clusterCollector,
+		metricsCollector: metricsCollector,
+		analyzer:         performanceAnalyzer,
+		alertManager:     alertManager,
+		influxExporter:   influxExporter,
+		log:              log,
+		connecting:       make(map[string]*pendingConnection),
+	}
+
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reloader.Reload()
+	}
 
 	log.Info("Shutting down gracefully...")
 
+	// Collectors and in-flight requests share one shutdown deadline
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer shutdownCancel()
+
 	// Cancel context for collectors
 	cancel()
 
-	// Shutdown HTTP server
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer shutdownCancel()
+	// Shutdown HTTP server, waiting for in-flight requests
+	shutdownServer(shutdownCtx, server, handler, cfg.Server.ShutdownTimeout, log)
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			_ = metricsServer.Close()
+		}
+	}
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Errorf("Server shutdown error: %v", err)
+	// Wait for collectors to finish their current cycle
+	collectorsDone := make(chan struct{})
+	go func() {
+		collectors.Wait()
+		reloader.Wait()
+		close(collectorsDone)
+	}()
+
+	select {
+	case <-collectorsDone:
+	case <-shutdownCtx.Done():
+		log.Warn("Shutdown timeout reached before collectors stopped")
+	}
+
+	// Flush the spans of the last requests and collections once nothing
+	// creates new ones
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Warnf("Failed to flush traces: %v", err)
 	}
 
 	log.Info("PostgreSQL Analytics Observer stopped")
 }
+
+// newRouter sets up the HTTP router serving the API of handler, and returns
+// it with the router the routes are registered on, which is mounted under
+// the base path when running behind a proxy subpath
+func newRouter(cfg *config.Config, handler *api.Handler, log *logrus.Logger) (router, routes *mux.Router) {
+	router = mux.NewRouter()
+	routes = router
+	if prefix := cfg.Server.RoutePrefix(); prefix != "" {
+		routes = router.PathPrefix(prefix).Subrouter()
+		log.Infof("Serving API under base path %s", prefix)
+	}
+	if len(cfg.Server.APIKeys) > 0 {
+		handler.RequireAPIKeys(cfg.Server.APIKeys)
+		log.Infof("Requiring one of %d API keys on /api/v1 routes", len(cfg.Server.APIKeys))
+	}
+	if cors := cfg.Server.CORS; len(cors.AllowedOrigins) > 0 {
+		handler.AllowCORS(api.CORSOptions{
+			AllowedOrigins: cors.AllowedOrigins,
+			AllowedMethods: cors.AllowedMethods,
+			AllowedHeaders: cors.AllowedHeaders,
+			MaxAge:         cors.MaxAge,
+		})
+		log.Infof("Allowing cross-origin requests from %s", strings.Join(cors.AllowedOrigins, ", "))
+	}
+	if limit := cfg.Server.RateLimit; limit.RequestsPerSecond > 0 {
+		handler.LimitAnalyzeRate(limit.RequestsPerSecond, limit.Burst)
+	}
+	handler.RegisterRoutes(router, routes)
+
+	return router, routes
+}
+
+// newMetricsServer serves Prometheus metrics on the API routes when the
+// metrics port is 0, and otherwise returns a server of their own on that port
+func newMetricsServer(cfg *config.Config, routes *mux.Router) *http.Server {
+	if !cfg.Metrics.EnablePrometheus {
+		return nil
+	}
+	if cfg.Metrics.PrometheusPort == 0 {
+		routes.Handle("/metrics", promhttp.Handler()).Methods("GET")
+		return nil
+	}
+
+	metricsRouter := mux.NewRouter()
+	metricsRouter.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	return &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Metrics.PrometheusPort),
+		Handler:      metricsRouter,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+}
+
+// shutdownServer stops the API server, waiting for in-flight requests until
+// ctx is done and then forcing the remaining ones closed
+func shutdownServer(ctx context.Context, server *http.Server, handler *api.Handler, timeout time.Duration, log *logrus.Logger) {
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("Server shutdown error: %v", err)
+		if inFlight := handler.InFlightRequests(); inFlight > 0 {
+			log.Warnf("Shutdown timeout of %s reached with %d requests in flight, forcing them closed", timeout, inFlight)
+		}
+		_ = server.Close()
+	}
+}
+
+// connectionConfig builds the database connection settings for a cluster
+func connectionConfig(cfg *config.Config, clusterCfg config.ClusterConfig) db.ConnectionConfig {
+	connCfg := db.ConnectionConfig{
+		Host:               clusterCfg.Host,
+		Hosts:              clusterCfg.Hosts,
+		Port:               clusterCfg.Port,
+		User:               clusterCfg.User,
+		Password:           clusterCfg.Password,
+		PasswordFile:       clusterCfg.PasswordFile,
+		Database:           clusterCfg.Database,
+		SSLMode:            clusterCfg.SSLMode,
+		MaxConnections:     clusterCfg.MaxConnections,
+		MinConnections:     clusterCfg.MinConnections,
+		ConnMaxLifetime:    clusterCfg.ConnMaxLifetime,
+		ConnMaxIdleTime:    clusterCfg.ConnMaxIdleTime,
+		HealthQuery:        clusterCfg.HealthQuery,
+		HealthExpected:     clusterCfg.HealthExpected,
+		TargetSessionAttrs: clusterCfg.TargetSessionAttrs,
+		InsecureSkipVerify: clusterCfg.InsecureSkipVerify,
+		Environment:        clusterCfg.Environment,
+		ConnectAttempts:    clusterCfg.ConnectAttempts,
+		ConnectRetryDelay:  clusterCfg.ConnectRetryDelay,
+	}
+
+	if clusterCfg.Auth == "iam" {
+		connCfg.AuthTokens = db.NewRDSAuthTokens(cfg.AWSRegion(clusterCfg), clusterCfg.User, db.AWSCredentials{
+			AccessKeyID:     cfg.AWS.AccessKeyID,
+			SecretAccessKey: cfg.AWS.SecretAccessKey,
+			SessionToken:    cfg.AWS.SessionToken,
+			AssumeRoleARN:   cfg.AWS.AssumeRoleARN,
+		})
+	}
+
+	return connCfg
+}
+
+// clusterThresholds applies a cluster's threshold overrides to the defaults
+func clusterThresholds(defaults analyzer.PerformanceThresholds, overrides config.ThresholdsConfig) analyzer.PerformanceThresholds {
+	thresholds := defaults
+	if overrides.MaxConnectionsPercent != nil {
+		thresholds.MaxConnectionsPercent = *overrides.MaxConnectionsPercent
+	}
+	if overrides.MinCacheHitRatio != nil {
+		thresholds.MinCacheHitRatio = *overrides.MinCacheHitRatio
+	}
+	if overrides.MaxCPUPercent != nil {
+		thresholds.MaxCPUPercent = *overrides.MaxCPUPercent
+	}
+	if overrides.MaxMemoryPercent != nil {
+		thresholds.MaxMemoryPercent = *overrides.MaxMemoryPercent
+	}
+	if overrides.MaxReplicationLagMs != nil {
+		thresholds.MaxReplicationLagMs = *overrides.MaxReplicationLagMs
+	}
+	if overrides.MaxLogicalSlotLagBytes != nil {
+		thresholds.MaxLogicalSlotLagBytes = *overrides.MaxLogicalSlotLagBytes
+	}
+	if overrides.MaxSlowQueryTimeMs != nil {
+		thresholds.MaxSlowQueryTimeMs = *overrides.MaxSlowQueryTimeMs
+	}
+	if overrides.MaxTableBloatPercent != nil {
+		thresholds.MaxTableBloatPercent = *overrides.MaxTableBloatPercent
+	}
+	if overrides.MaxPoolWaitStreak != nil {
+		thresholds.MaxPoolWaitStreak = *overrides.MaxPoolWaitStreak
+	}
+	if overrides.MaxPoolAcquireWaitMs != nil {
+		thresholds.MaxPoolAcquireWaitMs = *overrides.MaxPoolAcquireWaitMs
+	}
+	if overrides.MaxStatsStaleness != nil {
+		thresholds.MaxStatsStaleness = *overrides.MaxStatsStaleness
+	}
+	if overrides.MaxOrphanedTempTables != nil {
+		thresholds.MaxOrphanedTempTables = *overrides.MaxOrphanedTempTables
+	}
+	return thresholds
+}
+
+// configReloader applies configuration changes on SIGHUP without a restart
+type configReloader struct {
+	mu               sync.Mutex
+	ctx              context.Context // cancelled on shutdown to abort pending connections
+	path             string
+	current          *config.Config
+	pool             *db.ConnectionPool
+	clusterCollector *collector.ClusterCollector
+	metricsCollector *collector.MetricsCollector
+	analyzer         *analyzer.PerformanceAnalyzer
+	alertManager     *analyzer.AlertManager
+	influxExporter   *exporter.InfluxExporter
+	log              *logrus.Logger
+	connecting       map[string]*pendingConnection
+	connections      sync.WaitGroup
+}
+
+// pendingConnection is a cluster connection a reload started in the background
+type pendingConnection struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Reload re-reads the configuration file and applies cluster and logging
+// changes. Reloads are serialized so overlapping signals can't interleave,
+// while clusters are connected in the background so a cluster that is slow
+// to answer doesn't hold up the next reload or shutdown.
+func (cr *configReloader) Reload() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.log.Info("Received SIGHUP, reloading configuration...")
+
+	newCfg, err := config.LoadConfig(cr.path)
+	if err != nil {
+		cr.log.Errorf("Configuration reload failed, keeping current configuration: %v", err)
+		return
+	}
+
+	changes := cr.current.Diff(newCfg)
+	if len(changes) == 0 {
+		cr.log.Info("Configuration reloaded, no changes detected")
+		return
+	}
+	for _, change := range changes {
+		cr.log.Infof("Configuration change: %s", change)
+	}
+
+	// Drop clusters that were removed or whose connection settings changed
+	for _, clusterCfg := range cr.current.Clusters {
+		if !cr.current.ConnectionChanged(newCfg, clusterCfg.ID) {
+			continue
+		}
+		if pending, ok := cr.connecting[clusterCfg.ID]; ok {
+			pending.cancel()
+		}
+		if err := cr.pool.RemoveCluster(clusterCfg.ID); err != nil {
+			cr.log.Warnf("Failed to remove cluster %s: %v", clusterCfg.ID, err)
+		}
+		_ = cr.clusterCollector.UnregisterCluster(clusterCfg.ID)
+		cr.alertManager.Forget(clusterCfg.ID)
+		cr.analyzer.ClearClusterThresholds(clusterCfg.ID)
+		cr.metricsCollector.ForgetCluster(clusterCfg.ID)
+		cr.metricsCollector.ResetBaseline(clusterCfg.ID)
+	}
+
+	// Connect clusters that were added or whose connection settings changed,
+	// and apply the other setting changes in place so alerts and baselines
+	// survive them
+	for _, clusterCfg := range newCfg.Clusters {
+		if !cr.current.ClusterChanged(newCfg, clusterCfg.ID) {
+			continue
+		}
+		if cr.current.ConnectionChanged(newCfg, clusterCfg.ID) {
+			cr.connect(clusterCfg, connectionConfig(newCfg, clusterCfg))
+		}
+		cr.alertManager.SetPrimary(clusterCfg.ID, clusterCfg.Primary)
+		cr.analyzer.SetClusterThresholds(clusterCfg.ID, clusterThresholds(cr.analyzer.Thresholds(), clusterCfg.Thresholds))
+		if cr.influxExporter != nil {
+			cr.influxExporter.SetEnvironment(clusterCfg.ID, clusterCfg.Environment)
+		}
+	}
+
+	if level, err := logrus.ParseLevel(newCfg.Logging.Level); err == nil {
+		cr.log.SetLevel(level)
+	}
+
+	if !reflect.DeepEqual(cr.current.Server, newCfg.Server) || !reflect.DeepEqual(cr.current.Metrics, newCfg.Metrics) ||
+		!reflect.DeepEqual(cr.current.Alerting, newCfg.Alerting) || !reflect.DeepEqual(cr.current.Notifications, newCfg.Notifications) {
+		cr.log.Warn("Server, metrics, alerting and notification changes take effect after a restart")
+	}
+
+	cr.current = newCfg
+	cr.log.Infof("Configuration reloaded with %d clusters", len(newCfg.Clusters))
+}
+
+// connect adds a cluster to the pool in the background. A newer reload of
+// the same cluster cancels the attempt and waits for it to give up before
+// connecting with its own settings. Must be called with cr.mu held.
+func (cr *configReloader) connect(clusterCfg config.ClusterConfig, connCfg db.ConnectionConfig) {
+	previous := cr.connecting[clusterCfg.ID]
+	ctx, cancel := context.WithCancel(cr.ctx)
+	pending := &pendingConnection{cancel: cancel, done: make(chan struct{})}
+	cr.connecting[clusterCfg.ID] = pending
+
+	cr.connections.Add(1)
+	go func() {
+		defer cr.connections.Done()
+		defer close(pending.done)
+		defer cancel()
+
+		if previous != nil {
+			<-previous.done
+		}
+		err := cr.pool.AddCluster(ctx, clusterCfg.ID, connCfg)
+
+		cr.mu.Lock()
+		defer cr.mu.Unlock()
+
+		if cr.connecting[clusterCfg.ID] == pending {
+			delete(cr.connecting, clusterCfg.ID)
+		}
+		if ctx.Err() != nil {
+			// Superseded by a newer reload or shutdown
+			if err == nil {
+				_ = cr.pool.RemoveCluster(clusterCfg.ID)
+			}
+			return
+		}
+		if err != nil {
+			cr.log.Errorf("Failed to connect to cluster %s: %v", clusterCfg.ID, err)
+			return
+		}
+		cr.log.Infof("Connected to cluster: %s (%s:%d)", clusterCfg.ID, clusterCfg.Host, clusterCfg.Port)
+	}()
+}
+
+// Wait blocks until the connections started by reloads have finished
+func (cr *configReloader) Wait() {
+	cr.connections.Wait()
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zvdy/pgao/src/analyzer"
+	"github.com/zvdy/pgao/src/api"
+	"github.com/zvdy/pgao/src/collector"
+	"github.com/zvdy/pgao/src/config"
+	"github.com/zvdy/pgao/src/db"
+	"github.com/zvdy/pgao/src/pgtest"
+)
+
+// newTestHandler returns an API handler without clusters
+func newTestHandler(log *logrus.Logger) *api.Handler {
+	pool := db.NewConnectionPool(log)
+	performanceAnalyzer := analyzer.NewPerformanceAnalyzer()
+	return api.NewHandler(
+		pool,
+		analyzer.NewQueryAnalyzer(),
+		performanceAnalyzer,
+		analyzer.NewAlertManager(performanceAnalyzer),
+		collector.NewMetricsCollector(pool, log, time.Minute),
+		collector.NewClusterCollector(pool, log, time.Minute),
+		nil,
+		log,
+	)
+}
+
+// scrape requests path from h and returns the response body, failing the
+// test unless the status is 200
+func scrape(t *testing.T, h http.Handler, path string) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status = %d, want 200", path, w.Code)
+	}
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	t.Run("API port", func(t *testing.T) {
+		cfg := &config.Config{
+			Server:  config.ServerConfig{BasePath: "/pgao/"},
+			Metrics: config.MetricsConfig{EnablePrometheus: true},
+		}
+		router, routes := newRouter(cfg, newTestHandler(log), log)
+		if server := newMetricsServer(cfg, routes); server != nil {
+			t.Fatalf("metrics server on %s, want /metrics served by the API", server.Addr)
+		}
+
+		scrape(t, router, "/pgao/health")
+		body := scrape(t, router, "/pgao/metrics")
+		if !strings.Contains(body, "pgao_http_requests_total{") || !strings.Contains(body, "pgao_http_requests_in_flight") {
+			t.Errorf("/pgao/metrics doesn't expose the pgao_ request series:\n%s", body)
+		}
+	})
+
+	t.Run("own port", func(t *testing.T) {
+		cfg := &config.Config{
+			Server:  config.ServerConfig{Host: "127.0.0.1"},
+			Metrics: config.MetricsConfig{EnablePrometheus: true, PrometheusPort: 9187},
+		}
+		router, routes := newRouter(cfg, newTestHandler(log), log)
+		server := newMetricsServer(cfg, routes)
+		if server == nil || server.Addr != "127.0.0.1:9187" {
+			t.Fatalf("metrics server = %+v, want one on 127.0.0.1:9187", server)
+		}
+
+		scrape(t, router, "/health")
+		if body := scrape(t, server.Handler, "/metrics"); !strings.Contains(body, "pgao_http_requests_total{") {
+			t.Errorf("/metrics doesn't expose the pgao_ request series:\n%s", body)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("API /metrics: status = %d, want 404 with a metrics port", w.Code)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := &config.Config{Metrics: config.MetricsConfig{PrometheusPort: 9187}}
+		_, routes := newRouter(cfg, newTestHandler(log), log)
+		if server := newMetricsServer(cfg, routes); server != nil {
+			t.Errorf("metrics server on %s, want none with Prometheus disabled", server.Addr)
+		}
+	})
+}
+
+// slowServer serves the routes of a handler without clusters plus /slow,
+// which answers once release is closed, and reports each /slow request
+// on started
+func slowServer(t *testing.T, log *logrus.Logger) (server *http.Server, handler *api.Handler, url string, started, release chan struct{}) {
+	t.Helper()
+
+	handler = newTestHandler(log)
+	router, routes := newRouter(&config.Config{}, handler, log)
+	started, release = make(chan struct{}, 1), make(chan struct{})
+	routes.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server = &http.Server{Handler: router}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	return server, handler, "http://" + listener.Addr().String() + "/slow", started, release
+}
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	server, handler, url, started, release := slowServer(t, log)
+
+	responses := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("status %d", resp.StatusCode)
+			}
+		}
+		responses <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		shutdownServer(ctx, server, handler, 5*time.Second, log)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("shutdown returned with a request in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-responses; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown didn't return after the last request finished")
+	}
+}
+
+func TestShutdownForcesRequestsClosedAfterTimeout(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	server, handler, url, started, release := slowServer(t, log)
+	defer close(release)
+
+	responses := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		responses <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	shutdownServer(ctx, server, handler, 50*time.Millisecond, log)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("shutdown took %s, want it to give up after the timeout", elapsed)
+	}
+
+	select {
+	case err := <-responses:
+		if err == nil {
+			t.Error("request left in flight at the timeout succeeded, want its connection closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request left in flight at the timeout wasn't closed")
+	}
+}
+
+// writeClusters writes a configuration file with the given clusters section
+func writeClusters(t *testing.T, path, clusters string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte("clusters:\n"+clusters), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// clusterYAML returns the configuration of a cluster on a test server,
+// indented for the clusters section
+func clusterYAML(id string, server *pgtest.Server, extra string) string {
+	cluster := fmt.Sprintf("  - id: %s\n    host: %s\n    port: %d\n    user: pgao\n    database: app\n    ssl_mode: disable\n", id, server.Host(), server.Port())
+	return cluster + extra
+}
+
+func TestReloadClusters(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	before, after := pgtest.NewServer(t), pgtest.NewServer(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	writeClusters(t, path, clusterYAML("kept", before, "")+clusterYAML("removed", before, "")+
+		clusterYAML("moved", before, "")+clusterYAML("retuned", before, ""))
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := db.NewConnectionPool(log)
+	t.Cleanup(pool.Close)
+	for _, clusterCfg := range cfg.Clusters {
+		if err := pool.AddCluster(context.Background(), clusterCfg.ID, connectionConfig(cfg, clusterCfg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept, _ := pool.GetPool("kept")
+	retuned, _ := pool.GetPool("retuned")
+
+	performanceAnalyzer := analyzer.NewPerformanceAnalyzer()
+	reloader := &configReloader{
+		ctx:              context.Background(),
+		path:             path,
+		current:          cfg,
+		pool:             pool,
+		clusterCollector: collector.NewClusterCollector(pool, log, time.Minute),
+		metricsCollector: collector.NewMetricsCollector(pool, log, time.Minute),
+		analyzer:         performanceAnalyzer,
+		alertManager:     analyzer.NewAlertManager(performanceAnalyzer),
+		log:              log,
+		connecting:       make(map[string]*pendingConnection),
+	}
+
+	writeClusters(t, path, clusterYAML("kept", before, "")+clusterYAML("moved", after, "")+
+		clusterYAML("retuned", before, "    thresholds:\n      min_cache_hit_ratio: 80\n")+clusterYAML("added", after, ""))
+	reloader.Reload()
+	reloader.Wait()
+
+	clusters := pool.GetAllClusters()
+	slices.Sort(clusters)
+	if !slices.Equal(clusters, []string{"added", "kept", "moved", "retuned"}) {
+		t.Fatalf("clusters = %v, want removed dropped and added connected", clusters)
+	}
+	for _, id := range []string{"moved", "added"} {
+		if clusterPool, _ := pool.GetPool(id); clusterPool.Config().ConnConfig.Port != uint16(after.Port()) {
+			t.Errorf("%s connected to port %d, want the new server's %d", id, clusterPool.Config().ConnConfig.Port, after.Port())
+		}
+	}
+
+	// Changes that don't affect connections keep them
+	if current, _ := pool.GetPool("kept"); current != kept {
+		t.Error("the unchanged cluster was reconnected")
+	}
+	if current, _ := pool.GetPool("retuned"); current != retuned {
+		t.Error("the cluster with new thresholds was reconnected")
+	}
+	if ratio := performanceAnalyzer.ThresholdsFor("retuned").MinCacheHitRatio; ratio != 80 {
+		t.Errorf("retuned cache hit ratio threshold = %g, want 80", ratio)
+	}
+
+	// A configuration that doesn't load is ignored
+	if err := os.WriteFile(path, []byte("clusters: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	current := reloader.current
+	reloader.Reload()
+	reloader.Wait()
+	if reloader.current != current || len(pool.GetAllClusters()) != 4 {
+		t.Error("an invalid configuration was applied")
+	}
+}
@@ -1,6 +1,11 @@
 package models
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
 
 // AlertSeverity represents the severity level of an alert
 type AlertSeverity string
@@ -13,6 +18,23 @@ const (
 	AlertSeverityInfo     AlertSeverity = "info"
 )
 
+// severityRanks orders severities from least to most severe
+var severityRanks = map[AlertSeverity]int{
+	AlertSeverityInfo:     0,
+	AlertSeverityLow:      1,
+	AlertSeverityMedium:   2,
+	AlertSeverityHigh:     3,
+	AlertSeverityCritical: 4,
+}
+
+// AtLeast reports whether the severity is min or more severe. An empty min matches every severity.
+func (s AlertSeverity) AtLeast(min AlertSeverity) bool {
+	if min == "" {
+		return true
+	}
+	return severityRanks[s] >= severityRanks[min]
+}
+
 // AlertType represents the type of alert
 type AlertType string
 
@@ -30,6 +52,7 @@ const (
 // Alert represents a system alert
 type Alert struct {
 	ID             string                 `json:"id"`
+	CorrelationID  string                 `json:"correlation_id,omitempty"` // shared by related alerts across a primary and its replicas
 	Type           AlertType              `json:"type"`
 	Severity       AlertSeverity          `json:"severity"`
 	ClusterID      string                 `json:"cluster_id"`
@@ -47,12 +70,21 @@ type Alert struct {
 	Actions        []string               `json:"actions,omitempty"`
 }
 
+// AlertID returns a stable ID for an alert condition, so a recurring
+// condition on a cluster is always reported under the same ID
+func AlertID(clusterID string, alertType AlertType, metric, title string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{clusterID, string(alertType), metric, title}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
 // NewAlert creates a new Alert instance
-func NewAlert(alertType AlertType, severity AlertSeverity, clusterID, title, description string) *Alert {
+func NewAlert(alertType AlertType, severity AlertSeverity, clusterID, metric, title, description string) *Alert {
 	return &Alert{
+		ID:          AlertID(clusterID, alertType, metric, title),
 		Type:        alertType,
 		Severity:    severity,
 		ClusterID:   clusterID,
+		Metric:      metric,
 		Title:       title,
 		Description: description,
 		Timestamp:   time.Now(),
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAlertIDStable(t *testing.T) {
+	first := NewAlert(AlertTypePerformance, AlertSeverityHigh, "main", "cpu_usage", "High CPU Usage", "CPU usage at 91.0%")
+	second := NewAlert(AlertTypePerformance, AlertSeverityCritical, "main", "cpu_usage", "High CPU Usage", "CPU usage at 97.0%")
+
+	// Severity and description change as the condition evolves, the ID doesn't
+	if first.ID == "" || first.ID != second.ID {
+		t.Errorf("IDs of the same condition = %q and %q, want equal and non-empty", first.ID, second.ID)
+	}
+
+	for _, other := range []*Alert{
+		NewAlert(AlertTypePerformance, AlertSeverityHigh, "replica", "cpu_usage", "High CPU Usage", ""),
+		NewAlert(AlertTypeAvailability, AlertSeverityHigh, "main", "cpu_usage", "High CPU Usage", ""),
+		NewAlert(AlertTypePerformance, AlertSeverityHigh, "main", "memory_usage", "High CPU Usage", ""),
+		NewAlert(AlertTypePerformance, AlertSeverityHigh, "main", "cpu_usage", "CPU Saturated", ""),
+		// Joining the parts with a separator keeps shifted boundaries apart
+		NewAlert(AlertTypePerformance, AlertSeverityHigh, "mainc", "pu_usage", "High CPU Usage", ""),
+	} {
+		if other.ID == first.ID {
+			t.Errorf("alert for %s/%s/%s/%s has the same ID as a different condition", other.ClusterID, other.Type, other.Metric, other.Title)
+		}
+	}
+
+	body, err := json.Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["id"] != first.ID {
+		t.Errorf("JSON id = %v, want %s", decoded["id"], first.ID)
+	}
+}
@@ -1,11 +1,15 @@
 package models
 
+import "time"
+
 type Cluster struct {
     ID          string `json:"id"`
     Name        string `json:"name"`
     Status      string `json:"status"`
     Configuration map[string]interface{} `json:"configuration"`
     Metrics     map[string]float64 `json:"metrics"`
+    // Freshness tells when each part of the cluster information was last collected
+    Freshness   map[string]Freshness `json:"freshness"`
 }
 
 // NewCluster creates a new Cluster instance
@@ -16,6 +20,7 @@ func NewCluster(id, name, status string, configuration map[string]interface{}) *
         Status:      status,
         Configuration: configuration,
         Metrics:     make(map[string]float64),
+        Freshness:   make(map[string]Freshness),
     }
 }
 
@@ -27,4 +32,42 @@ func (c *Cluster) UpdateStatus(status string) {
 // AddMetric adds a performance metric to the cluster
 func (c *Cluster) AddMetric(key string, value float64) {
     c.Metrics[key] = value
-}
\ No newline at end of file
+}
+// ServerUptime tells when a cluster's server was last started
+type ServerUptime struct {
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+// DatabaseInfo describes a database on a cluster
+type DatabaseInfo struct {
+	Name      string `json:"name"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// ReplicationStatus describes a node's role and, on a primary, its streaming replicas
+type ReplicationStatus struct {
+	IsPrimary bool          `json:"is_primary"`
+	Replicas  []ReplicaInfo `json:"replicas"`
+}
+
+// ReplicaInfo describes a replica streaming from a primary
+type ReplicaInfo struct {
+	ApplicationName string `json:"application_name"`
+	ClientAddr      string `json:"client_addr"`
+	State           string `json:"state"`
+	SyncState       string `json:"sync_state"`
+	SentLSN         string `json:"sent_lsn"`
+	WriteLSN        string `json:"write_lsn"`
+	FlushLSN        string `json:"flush_lsn"`
+	ReplayLSN       string `json:"replay_lsn"`
+	SyncPriority    int    `json:"sync_priority"`
+	UptimeSeconds   int    `json:"uptime_seconds"`
+	LagBytes        int64  `json:"lag_bytes"` // sent_lsn - replay_lsn
+}
+
+// ExtensionInfo describes an installed extension
+type ExtensionInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
@@ -1,52 +1,218 @@
 package models
 
-import "time"
+import (
+	"time"
+)
 
 // Metrics represents database performance metrics
 type Metrics struct {
-	ClusterID          string    `json:"cluster_id"`
-	Timestamp          time.Time `json:"timestamp"`
-	ConnectionsActive  int       `json:"connections_active"`
-	ConnectionsTotal   int       `json:"connections_total"`
-	TransactionsPerSec float64   `json:"transactions_per_sec"`
-	CacheHitRatio      float64   `json:"cache_hit_ratio"`
-	DiskIORead         float64   `json:"disk_io_read"`
-	DiskIOWrite        float64   `json:"disk_io_write"`
-	CPUUsage           float64   `json:"cpu_usage"`
-	MemoryUsage        float64   `json:"memory_usage"`
-	LockWaits          int       `json:"lock_waits"`
-	DeadlockCount      int       `json:"deadlock_count"`
-	ReplicationLag     int64     `json:"replication_lag_ms"`
-	TableBloat         float64   `json:"table_bloat_pct"`
-	IndexSize          int64     `json:"index_size_bytes"`
-	TableSize          int64     `json:"table_size_bytes"`
+	ClusterID          string         `json:"cluster_id"`
+	Timestamp          time.Time      `json:"timestamp"`
+	ConnectionsActive  int            `json:"connections_active"`
+	ConnectionsTotal   int            `json:"connections_total"`
+	TransactionsPerSec float64        `json:"transactions_per_sec"`
+	CacheHitRatio      float64        `json:"cache_hit_ratio"`
+	DiskIORead         float64        `json:"disk_io_read"`  // KB/sec
+	DiskIOWrite        float64        `json:"disk_io_write"` // KB/sec
+	CPUUsage           float64        `json:"cpu_usage"`
+	MemoryUsage        float64        `json:"memory_usage"`
+	LockWaits          int            `json:"lock_waits"`
+	LockWaitsByType    map[string]int `json:"lock_waits_by_type,omitempty"`
+	DeadlockCount      int            `json:"deadlock_count"` // since the previous collection
+	ReplicationLag     int64          `json:"replication_lag_ms"`
+	TableBloat         float64        `json:"table_bloat_pct"`
+	IndexSize          int64          `json:"index_size_bytes"`
+	TableSize          int64          `json:"table_size_bytes"`
+	IOStats            []IOStat       `json:"io_stats,omitempty"`
+
+	// Server uptime, with Restarted set when the server start time changed
+	// since the previous collection
+	ServerStartTime time.Time `json:"server_start_time"`
+	UptimeSeconds   int64     `json:"uptime_seconds"`
+	Restarted       bool      `json:"restarted"`
+
+	// Contention on pgao's own connection pool to the cluster
+	PoolEmptyAcquireStreak int     `json:"pool_empty_acquire_streak"` // consecutive cycles in which acquires had to wait
+	PoolAcquireWaitMs      float64 `json:"pool_acquire_wait_ms"`      // average acquire time over recent cycles
+
+	ReplicationSlots []ReplicationSlot `json:"replication_slots,omitempty"`
+	WaitEvents       []WaitEventCount  `json:"wait_events,omitempty"`
+	TempSchemas      []TempSchema      `json:"temp_schemas,omitempty"`
+
+	// Collected records which metric groups were actually measured this
+	// cycle, so zero values from a failed sub-collector aren't mistaken for data
+	Collected map[string]bool `json:"collected"`
+
+	// Freshness tells when each metric group was last collected successfully,
+	// which is earlier than Timestamp for groups that failed this cycle
+	Freshness map[string]Freshness `json:"freshness"`
 }
 
+// Freshness is the age of a metric group's values
+type Freshness struct {
+	LastCollectedAt time.Time `json:"last_collected_at"`
+	Stale           bool      `json:"stale"` // not collected within the expected interval
+}
+
+// Metric groups filled by the individual sub-collectors
+const (
+	MetricGroupUptime           = "uptime"
+	MetricGroupConnections      = "connections"
+	MetricGroupCache            = "cache"
+	MetricGroupTransactions     = "transactions"
+	MetricGroupLocks            = "locks"
+	MetricGroupReplication      = "replication"
+	MetricGroupReplicationSlots = "replication_slots"
+	MetricGroupBloat            = "bloat"
+	MetricGroupDiskIO           = "disk_io"
+	MetricGroupWaitEvents       = "wait_events"
+	MetricGroupTempSchemas      = "temp_schemas"
+	MetricGroupPool             = "pool"      // pgao's connection pool to the cluster
+	MetricGroupResources        = "resources" // CPU and memory usage
+)
+
 // NewMetrics creates a new Metrics instance
 func NewMetrics(clusterID string) *Metrics {
 	return &Metrics{
 		ClusterID: clusterID,
 		Timestamp: time.Now(),
+		Collected: make(map[string]bool),
+		Freshness: make(map[string]Freshness),
 	}
 }
 
+// MarkCollected records that a metric group was successfully measured
+func (m *Metrics) MarkCollected(group string) {
+	m.Collected[group] = true
+}
+
+// IsCollected reports whether a metric group was measured this cycle
+func (m *Metrics) IsCollected(group string) bool {
+	return m.Collected[group]
+}
+
+// namedMetric is a metric alert rules can reference by name and the group that measures it
+type namedMetric struct {
+	group string
+	value func(*Metrics) float64
+}
+
+// namedMetrics maps the metric names alert rules can reference to their values
+var namedMetrics = map[string]namedMetric{
+	"connections_active": {MetricGroupConnections, func(m *Metrics) float64 { return float64(m.ConnectionsActive) }},
+	"connections_percent": {MetricGroupConnections, func(m *Metrics) float64 {
+		if m.ConnectionsTotal == 0 {
+			return 0
+		}
+		return (float64(m.ConnectionsActive) / float64(m.ConnectionsTotal)) * 100
+	}},
+	"transactions_per_sec": {MetricGroupTransactions, func(m *Metrics) float64 { return m.TransactionsPerSec }},
+	"cache_hit_ratio":      {MetricGroupCache, func(m *Metrics) float64 { return m.CacheHitRatio }},
+	"disk_io_read":         {MetricGroupDiskIO, func(m *Metrics) float64 { return m.DiskIORead }},
+	"disk_io_write":        {MetricGroupDiskIO, func(m *Metrics) float64 { return m.DiskIOWrite }},
+	"cpu_usage":            {MetricGroupResources, func(m *Metrics) float64 { return m.CPUUsage }},
+	"memory_usage":         {MetricGroupResources, func(m *Metrics) float64 { return m.MemoryUsage }},
+	"lock_waits":           {MetricGroupLocks, func(m *Metrics) float64 { return float64(m.LockWaits) }},
+	"deadlock_count":       {MetricGroupLocks, func(m *Metrics) float64 { return float64(m.DeadlockCount) }},
+	"replication_lag":      {MetricGroupReplication, func(m *Metrics) float64 { return float64(m.ReplicationLag) }},
+	"table_bloat":          {MetricGroupBloat, func(m *Metrics) float64 { return m.TableBloat }},
+}
+
+// IsNamedMetric reports whether alert rules can reference a metric by name
+func IsNamedMetric(name string) bool {
+	_, ok := namedMetrics[name]
+	return ok
+}
+
+// NamedMetric returns the value of a metric referenced by name, and whether
+// its group was measured this cycle
+func (m *Metrics) NamedMetric(name string) (float64, bool) {
+	metric, ok := namedMetrics[name]
+	if !ok || !m.IsCollected(metric.group) {
+		return 0, false
+	}
+	return metric.value(m), true
+}
+
+// IOStat represents IO activity for one backend type, object and context
+// as reported by pg_stat_io (PostgreSQL 16+)
+type IOStat struct {
+	BackendType string `json:"backend_type"`
+	Object      string `json:"object"`
+	Context     string `json:"context"`
+	Reads       int64  `json:"reads"`
+	Writes      int64  `json:"writes"`
+	Extends     int64  `json:"extends"`
+	ReadBytes   int64  `json:"read_bytes"`
+	WriteBytes  int64  `json:"write_bytes"`
+	ExtendBytes int64  `json:"extend_bytes"`
+}
+
+// LockWaitSummary represents ungranted locks grouped by lock type and mode
+type LockWaitSummary struct {
+	LockType  string  `json:"lock_type"` // relation, tuple, transactionid, advisory, ...
+	Mode      string  `json:"mode"`
+	Count     int     `json:"count"`
+	MaxWaitMs float64 `json:"max_wait_ms"` // requires PostgreSQL 14+
+	AvgWaitMs float64 `json:"avg_wait_ms"` // requires PostgreSQL 14+
+}
+
+// ReplicationSlot represents the state of a physical or logical replication slot
+type ReplicationSlot struct {
+	SlotName         string `json:"slot_name"`
+	SlotType         string `json:"slot_type"` // physical or logical
+	Database         string `json:"database,omitempty"`
+	Active           bool   `json:"active"`
+	RetainedWALBytes int64  `json:"retained_wal_bytes"`
+	LagBytes         int64  `json:"lag_bytes"` // confirmed_flush_lsn lag for logical slots
+}
+
+// TempSchema is a pg_temp_N schema holding temporary tables, orphaned when
+// the backend that created it is gone, as after a backend crash
+type TempSchema struct {
+	Schema       string `json:"schema"`
+	BackendID    int    `json:"backend_id"`
+	Orphaned     bool   `json:"orphaned"`
+	Tables       int    `json:"tables"`
+	SizeBytes    int64  `json:"size_bytes"`
+	OldestXIDAge int64  `json:"oldest_xid_age"` // age of the oldest relfrozenxid, which holds back wraparound vacuum
+}
+
+// OrphanedTempTables returns the number and total size of the temporary
+// tables in orphaned temp schemas
+func (m *Metrics) OrphanedTempTables() (int, int64) {
+	tables, size := 0, int64(0)
+	for _, schema := range m.TempSchemas {
+		if schema.Orphaned {
+			tables += schema.Tables
+			size += schema.SizeBytes
+		}
+	}
+	return tables, size
+}
+
 // QueryMetrics represents query-level performance metrics
 type QueryMetrics struct {
 	QueryID           string    `json:"query_id"`
 	Query             string    `json:"query"`
 	ClusterID         string    `json:"cluster_id"`
 	Database          string    `json:"database"`
+	User              string    `json:"user"`
 	ExecutionTime     float64   `json:"execution_time_ms"`
+	TotalExecTime     float64   `json:"total_exec_time_ms"`
 	PlanningTime      float64   `json:"planning_time_ms"`
 	RowsReturned      int64     `json:"rows_returned"`
 	RowsAffected      int64     `json:"rows_affected"`
 	SharedBlocksHit   int64     `json:"shared_blocks_hit"`
 	SharedBlocksRead  int64     `json:"shared_blocks_read"`
+	SharedBytesRead   int64     `json:"shared_bytes_read"`
+	CacheHitRatio     float64   `json:"cache_hit_ratio"`
 	TempBlocksRead    int64     `json:"temp_blocks_read"`
 	TempBlocksWritten int64     `json:"temp_blocks_written"`
 	Timestamp         time.Time `json:"timestamp"`
 	CallCount         int64     `json:"call_count"`
 	MeanExecTime      float64   `json:"mean_exec_time_ms"`
+	MaxExecTime       float64   `json:"max_exec_time_ms"`
 	StddevExecTime    float64   `json:"stddev_exec_time_ms"`
 }
 
@@ -61,6 +227,25 @@ func NewQueryMetrics(queryID, query, clusterID, database string) *QueryMetrics {
 	}
 }
 
+// ComputeCacheHitRatio returns the percentage of the statement's shared
+// block accesses served from shared buffers, or 100 when it touched no blocks
+func (qm *QueryMetrics) ComputeCacheHitRatio() float64 {
+	total := qm.SharedBlocksHit + qm.SharedBlocksRead
+	if total == 0 {
+		return 100
+	}
+	return float64(qm.SharedBlocksHit) / float64(total) * 100
+}
+
+// RoleQueryStats represents query load attributed to a single role
+type RoleQueryStats struct {
+	Role          string  `json:"role"`
+	Queries       int     `json:"queries"`
+	Calls         int64   `json:"calls"`
+	TotalExecTime float64 `json:"total_exec_time_ms"`
+	MeanExecTime  float64 `json:"mean_exec_time_ms"`
+}
+
 // TableMetrics represents table-level statistics
 type TableMetrics struct {
 	ClusterID       string     `json:"cluster_id"`
@@ -83,7 +268,41 @@ type TableMetrics struct {
 	LastVacuum      *time.Time `json:"last_vacuum,omitempty"`
 	LastAutovacuum  *time.Time `json:"last_autovacuum,omitempty"`
 	LastAnalyze     *time.Time `json:"last_analyze,omitempty"`
-	Timestamp       time.Time  `json:"timestamp"`
+	LastAutoanalyze *time.Time `json:"last_autoanalyze,omitempty"`
+	// ModsSinceAnalyze is the number of rows modified since statistics were
+	// last gathered; StatsStaleness relates it to the live rows
+	ModsSinceAnalyze int64     `json:"mods_since_analyze"`
+	StatsStaleness   float64   `json:"stats_staleness"`
+	SizeBytes        int64     `json:"size_bytes"` // including indexes and TOAST
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// StalenessRatio returns the rows modified since the last ANALYZE per live row
+func (tm *TableMetrics) StalenessRatio() float64 {
+	return float64(tm.ModsSinceAnalyze) / float64(max(tm.LiveTuples, 1))
+}
+
+// LastAnalyzed returns when statistics were last gathered, manually or by
+// autovacuum, or nil when the table was never analyzed
+func (tm *TableMetrics) LastAnalyzed() *time.Time {
+	if tm.LastAnalyze == nil || (tm.LastAutoanalyze != nil && tm.LastAutoanalyze.After(*tm.LastAnalyze)) {
+		return tm.LastAutoanalyze
+	}
+	return tm.LastAnalyze
+}
+
+// AnalyzeRecommendation recommends a manual ANALYZE for a table whose planner
+// statistics are stale
+type AnalyzeRecommendation struct {
+	ClusterID        string     `json:"cluster_id"`
+	Schema           string     `json:"schema"`
+	Table            string     `json:"table"`
+	ModsSinceAnalyze int64      `json:"mods_since_analyze"`
+	LiveTuples       int64      `json:"live_tuples"`
+	StatsStaleness   float64    `json:"stats_staleness"`
+	LastAnalyzed     *time.Time `json:"last_analyzed,omitempty"`
+	Reason           string     `json:"reason"`
+	Command          string     `json:"command"`
 }
 
 // NewTableMetrics creates a new TableMetrics instance
@@ -96,3 +315,112 @@ func NewTableMetrics(clusterID, database, schema, table string) *TableMetrics {
 		Timestamp: time.Now(),
 	}
 }
+
+// IndexMetrics represents an index's usage and size
+type IndexMetrics struct {
+	ClusterID       string    `json:"cluster_id"`
+	Database        string    `json:"database"`
+	Schema          string    `json:"schema"`
+	Table           string    `json:"table"`
+	Index           string    `json:"index"`
+	IdxScan         int64     `json:"idx_scan"`
+	IdxTupRead      int64     `json:"idx_tup_read"`
+	IdxTupFetch     int64     `json:"idx_tup_fetch"`
+	SizeBytes       int64     `json:"size_bytes"`
+	IsUnique        bool      `json:"is_unique"`
+	IsPrimary       bool      `json:"is_primary"`
+	BacksConstraint bool      `json:"backs_constraint"`
+	Unused          bool      `json:"unused"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// IsUnused reports whether the index was never scanned and could be dropped.
+// Indexes enforcing primary key, unique or exclusion constraints are needed
+// even when never scanned.
+func (im *IndexMetrics) IsUnused() bool {
+	return im.IdxScan == 0 && !im.IsPrimary && !im.IsUnique && !im.BacksConstraint
+}
+
+// ToastMetrics represents a table's TOAST storage and its dead tuples
+type ToastMetrics struct {
+	ClusterID       string    `json:"cluster_id"`
+	Schema          string    `json:"schema"`
+	Table           string    `json:"table"`
+	TableSizeBytes  int64     `json:"table_size_bytes"`
+	ToastSizeBytes  int64     `json:"toast_size_bytes"`
+	ToastRatio      float64   `json:"toast_ratio"` // share of the table's storage held in TOAST
+	ToastLiveTuples int64     `json:"toast_live_tuples"`
+	ToastDeadTuples int64     `json:"toast_dead_tuples"`
+	ToastDominant   bool      `json:"toast_dominant"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// FreezeProgress reports how far databases and tables have aged toward
+// forced anti-wraparound vacuums
+type FreezeProgress struct {
+	ClusterID              string      `json:"cluster_id"`
+	VacuumFreezeTableAge   int64       `json:"vacuum_freeze_table_age"`
+	AutovacuumFreezeMaxAge int64       `json:"autovacuum_freeze_max_age"`
+	Databases              []FreezeAge `json:"databases"`
+	Tables                 []FreezeAge `json:"tables"`
+	Timestamp              time.Time   `json:"timestamp"`
+}
+
+// FreezeAge is the age of a database's datfrozenxid or a table's relfrozenxid
+type FreezeAge struct {
+	Database          string  `json:"database"`
+	Schema            string  `json:"schema,omitempty"`
+	Table             string  `json:"table,omitempty"`
+	Age               int64   `json:"age"`
+	FreezeTableAgePct float64 `json:"freeze_table_age_pct"` // aggressive vacuum starts at 100
+	FreezeMaxAgePct   float64 `json:"freeze_max_age_pct"`   // forced anti-wraparound autovacuum starts at 100
+}
+
+// NewFreezeProgress creates a new FreezeProgress instance for the given freeze settings
+func NewFreezeProgress(clusterID string, freezeTableAge, freezeMaxAge int64) *FreezeProgress {
+	return &FreezeProgress{
+		ClusterID:              clusterID,
+		VacuumFreezeTableAge:   freezeTableAge,
+		AutovacuumFreezeMaxAge: freezeMaxAge,
+		Databases:              make([]FreezeAge, 0),
+		Tables:                 make([]FreezeAge, 0),
+		Timestamp:              time.Now(),
+	}
+}
+
+// NewFreezeAge computes an age's progress toward the freeze thresholds
+func (fp *FreezeProgress) NewFreezeAge(database, schema, table string, age int64) FreezeAge {
+	fa := FreezeAge{
+		Database: database,
+		Schema:   schema,
+		Table:    table,
+		Age:      age,
+	}
+	if fp.VacuumFreezeTableAge > 0 {
+		fa.FreezeTableAgePct = float64(age) / float64(fp.VacuumFreezeTableAge) * 100
+	}
+	if fp.AutovacuumFreezeMaxAge > 0 {
+		fa.FreezeMaxAgePct = float64(age) / float64(fp.AutovacuumFreezeMaxAge) * 100
+	}
+	return fa
+}
+
+// WaitEventCount is the number of active sessions seen on a wait event.
+// Sessions not waiting are reported with type and event "CPU".
+type WaitEventCount struct {
+	WaitEventType     string  `json:"wait_event_type"`
+	WaitEvent         string  `json:"wait_event"`
+	Count             int     `json:"count"`
+	Percent           float64 `json:"percent,omitempty"`
+	AvgActiveSessions float64 `json:"avg_active_sessions,omitempty"`
+}
+
+// WaitEventProfile is the breakdown of what active sessions waited on across
+// the samples taken within a time window
+type WaitEventProfile struct {
+	ClusterID     string           `json:"cluster_id"`
+	WindowSeconds float64          `json:"window_seconds"`
+	Samples       int              `json:"samples"`
+	Events        []WaitEventCount `json:"events"`
+	Timestamp     time.Time        `json:"timestamp"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "testing"
+
+func TestComputeCacheHitRatio(t *testing.T) {
+	tests := []struct {
+		name      string
+		hit, read int64
+		want      float64
+	}{
+		{"all hits", 500, 0, 100},
+		{"mostly hits", 900, 100, 90},
+		{"all reads", 0, 400, 0},
+		{"no blocks", 0, 0, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qm := NewQueryMetrics("1", "SELECT 1", "main", "app")
+			qm.SharedBlocksHit = tt.hit
+			qm.SharedBlocksRead = tt.read
+
+			if got := qm.ComputeCacheHitRatio(); got != tt.want {
+				t.Errorf("ComputeCacheHitRatio() = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
@@ -14,12 +14,15 @@ type QueryAnalysis struct {
 	HasSubquery       bool                   `json:"has_subquery"`
 	HasJoin           bool                   `json:"has_join"`
 	JoinType          string                 `json:"join_type,omitempty"`
+	JoinCount         int                    `json:"join_count"` // explicit joins and tables listed with commas
 	HasAggregate      bool                   `json:"has_aggregate"`
 	HasWindowFunction bool                   `json:"has_window_function"`
 	Complexity        string                 `json:"complexity"`
 	EstimatedCost     float64                `json:"estimated_cost"`
+	ParameterCount    int                    `json:"parameter_count"`
 	Suggestions       []QuerySuggestion      `json:"suggestions"`
 	Warnings          []string               `json:"warnings"`
+	Baselined         bool                   `json:"baselined"`
 	Timestamp         time.Time              `json:"timestamp"`
 }
 
@@ -62,6 +65,29 @@ func (qa *QueryAnalysis) AddWarning(warning string) {
 	qa.Warnings = append(qa.Warnings, warning)
 }
 
+// QueryAnalysisDiff represents the differences between analyses of two query versions
+type QueryAnalysisDiff struct {
+	Before              *QueryAnalysis `json:"before"`
+	After               *QueryAnalysis `json:"after"`
+	ComplexityChange    string         `json:"complexity_change"` // improved, worsened, unchanged
+	TablesAdded         []string       `json:"tables_added"`
+	TablesRemoved       []string       `json:"tables_removed"`
+	WarningsIntroduced  []string       `json:"warnings_introduced"`
+	WarningsResolved    []string       `json:"warnings_resolved"`
+	JoinTypeBefore      string         `json:"join_type_before,omitempty"`
+	JoinTypeAfter       string         `json:"join_type_after,omitempty"`
+	JoinChanged         bool           `json:"join_changed"`
+	SuggestionsResolved int            `json:"suggestions_resolved"`
+	SuggestionsAdded    int            `json:"suggestions_added"`
+}
+
+// BatchAnalysisResult is the analysis of one query of a batch, or the error
+// that kept it from being analyzed
+type BatchAnalysisResult struct {
+	Analysis *QueryAnalysis `json:"analysis,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
 // ExplainPlan represents a PostgreSQL EXPLAIN plan
 type ExplainPlan struct {
 	QueryID           string                 `json:"query_id"`
@@ -77,18 +103,51 @@ type ExplainPlan struct {
 	IndexScans        int                    `json:"index_scans"`
 	BuffersSharedHit  int64                  `json:"buffers_shared_hit"`
 	BuffersSharedRead int64                  `json:"buffers_shared_read"`
+	Misestimates      []PlanMisestimate      `json:"misestimates"`
+	DiskSpills        []PlanDiskSpill        `json:"disk_spills"`
+	Warnings          []string               `json:"warnings"`
 	Timestamp         time.Time              `json:"timestamp"`
 }
 
+// PlanMisestimate is an executed plan node whose actual row count diverged
+// sharply from the planner's estimate
+type PlanMisestimate struct {
+	NodeType      string  `json:"node_type"`
+	Relation      string  `json:"relation,omitempty"`
+	PlannedRows   int64   `json:"planned_rows"`
+	ActualRows    int64   `json:"actual_rows"`
+	Factor        float64 `json:"factor"`        // larger row count divided by the smaller
+	Underestimate bool    `json:"underestimate"` // more rows than planned
+	Suggestion    string  `json:"suggestion"`
+}
+
+// PlanDiskSpill is an executed sort or hash aggregate that ran out of
+// work_mem and spilled to disk
+type PlanDiskSpill struct {
+	NodeType           string `json:"node_type"`
+	Strategy           string `json:"strategy,omitempty"` // sort method, or hash aggregate batches
+	DiskKB             int64  `json:"disk_kb"`
+	SuggestedWorkMemKB int64  `json:"suggested_work_mem_kb"`
+	Suggestion         string `json:"suggestion"`
+}
+
 // NewExplainPlan creates a new ExplainPlan instance
 func NewExplainPlan(queryID, query string) *ExplainPlan {
 	return &ExplainPlan{
-		QueryID:   queryID,
-		Query:     query,
-		Timestamp: time.Now(),
+		QueryID:      queryID,
+		Query:        query,
+		Misestimates: make([]PlanMisestimate, 0),
+		DiskSpills:   make([]PlanDiskSpill, 0),
+		Warnings:     make([]string, 0),
+		Timestamp:    time.Now(),
 	}
 }
 
+// AddWarning adds a plan-level warning
+func (ep *ExplainPlan) AddWarning(warning string) {
+	ep.Warnings = append(ep.Warnings, warning)
+}
+
 // SlowQuery represents a slow query that needs attention
 type SlowQuery struct {
 	QueryID     string         `json:"query_id"`
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// PGVersion is a PostgreSQL server version parsed from version()
+type PGVersion struct {
+	Major int    `json:"major"`
+	Minor int    `json:"minor"` // for releases before 10 this is the second part of the major, e.g. 6 in 9.6
+	Full  string `json:"full"`
+}
+
+// pgVersionPattern matches the leading version number of version() output,
+// including distribution builds like "PostgreSQL 15.3 (Debian 15.3-1.pgdg120+1)"
+// and pre-releases like "PostgreSQL 17beta1"
+var pgVersionPattern = regexp.MustCompile(`^PostgreSQL (\d+)(?:\.(\d+))?`)
+
+// ParsePGVersion parses the output of SELECT version()
+func ParsePGVersion(full string) (PGVersion, error) {
+	match := pgVersionPattern.FindStringSubmatch(full)
+	if match == nil {
+		return PGVersion{}, fmt.Errorf("unrecognized PostgreSQL version string: %q", full)
+	}
+
+	version := PGVersion{Full: full}
+	version.Major, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		version.Minor, _ = strconv.Atoi(match[2])
+	}
+
+	return version, nil
+}
+
+// AtLeast reports whether the version is at least major.minor
+func (v PGVersion) AtLeast(major, minor int) bool {
+	if v.Major != major {
+		return v.Major > major
+	}
+	return v.Minor >= minor
+}
@@ -0,0 +1,52 @@
+package models
+
+import "testing"
+
+func TestParsePGVersion(t *testing.T) {
+	tests := []struct {
+		name         string
+		full         string
+		major, minor int
+		wantErr      bool
+	}{
+		{"vanilla", "PostgreSQL 16.2 on x86_64-pc-linux-gnu, compiled by gcc (GCC) 12.2.0, 64-bit", 16, 2, false},
+		{"Aurora", "PostgreSQL 15.4 on aarch64-unknown-linux-gnu, compiled by aarch64-unknown-linux-gnu-gcc (GCC) 9.5.0, 64-bit", 15, 4, false},
+		{"Debian", "PostgreSQL 15.3 (Debian 15.3-1.pgdg120+1) on x86_64-pc-linux-gnu, compiled by gcc (Debian 12.2.0-14) 12.2.0, 64-bit", 15, 3, false},
+		{"Ubuntu", "PostgreSQL 14.11 (Ubuntu 14.11-0ubuntu0.22.04.1) on x86_64-pc-linux-gnu, compiled by gcc, 64-bit", 14, 11, false},
+		{"before 10", "PostgreSQL 9.6.24 on x86_64-pc-linux-gnu, compiled by gcc, 64-bit", 9, 6, false},
+		{"pre-release", "PostgreSQL 17beta1 on x86_64-pc-linux-gnu, compiled by gcc, 64-bit", 17, 0, false},
+		{"unparseable", "CockroachDB CCL v23.1.11", 0, 0, true},
+		{"empty", "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := ParsePGVersion(tt.full)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParsePGVersion() = %+v, want an error", version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version.Major != tt.major || version.Minor != tt.minor || version.Full != tt.full {
+				t.Errorf("ParsePGVersion() = %d.%d, want %d.%d", version.Major, version.Minor, tt.major, tt.minor)
+			}
+		})
+	}
+}
+
+func TestPGVersionAtLeast(t *testing.T) {
+	version := PGVersion{Major: 15, Minor: 4}
+
+	for _, tt := range []struct {
+		major, minor int
+		want         bool
+	}{{14, 9, true}, {15, 0, true}, {15, 4, true}, {15, 5, false}, {16, 0, false}} {
+		if got := version.AtLeast(tt.major, tt.minor); got != tt.want {
+			t.Errorf("15.4 AtLeast(%d, %d) = %v, want %v", tt.major, tt.minor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+// slackColors maps alert severities to the attachment bar color
+var slackColors = map[models.AlertSeverity]string{
+	models.AlertSeverityCritical: "#d32f2f", // red
+	models.AlertSeverityHigh:     "#f57c00", // orange
+	models.AlertSeverityMedium:   "#fbc02d", // yellow
+	models.AlertSeverityLow:      "#388e3c", // green
+	models.AlertSeverityInfo:     "#9e9e9e", // grey
+}
+
+// SlackMessage is an incoming webhook payload. The text is the notification
+// fallback; the alert details are Block Kit blocks in a color-coded attachment.
+type SlackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments"`
+}
+
+// SlackAttachment is a message attachment holding Block Kit blocks
+type SlackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// SlackBlock is a Block Kit layout block
+type SlackBlock struct {
+	Type   string      `json:"type"`
+	Text   *SlackText  `json:"text,omitempty"`
+	Fields []SlackText `json:"fields,omitempty"`
+}
+
+// SlackText is a Block Kit text object
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SlackWebhook returns a webhook posting alerts to a Slack incoming webhook URL
+func SlackWebhook(url string, minSeverity models.AlertSeverity) Webhook {
+	return Webhook{
+		URL:         url,
+		MinSeverity: minSeverity,
+		Format: func(alert *models.Alert) ([]byte, error) {
+			return json.Marshal(NewSlackMessage(alert))
+		},
+	}
+}
+
+// NewSlackMessage formats an alert as a Slack message with its cluster,
+// metric, current value against the threshold and recommended actions
+func NewSlackMessage(alert *models.Alert) SlackMessage {
+	summary := fmt.Sprintf("[%s] %s on %s", strings.ToUpper(string(alert.Severity)), alert.Title, alert.ClusterID)
+
+	blocks := []SlackBlock{
+		{Type: "header", Text: &SlackText{Type: "plain_text", Text: summary}},
+		{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: alert.Description}},
+		{Type: "section", Fields: []SlackText{
+			{Type: "mrkdwn", Text: "*Cluster*\n" + alert.ClusterID},
+			{Type: "mrkdwn", Text: "*Severity*\n" + string(alert.Severity)},
+			{Type: "mrkdwn", Text: "*Metric*\n" + alert.Metric},
+			{Type: "mrkdwn", Text: fmt.Sprintf("*Current / Threshold*\n%.2f / %.2f", alert.CurrentValue, alert.Threshold)},
+		}},
+	}
+
+	if len(alert.Actions) > 0 {
+		actions := make([]string, 0, len(alert.Actions))
+		for _, action := range alert.Actions {
+			actions = append(actions, "• "+action)
+		}
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: "*Recommended actions*\n" + strings.Join(actions, "\n")},
+		})
+	}
+
+	return SlackMessage{
+		Text: summary,
+		Attachments: []SlackAttachment{
+			{Color: slackColors[alert.Severity], Blocks: blocks},
+		},
+	}
+}
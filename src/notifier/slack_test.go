@@ -0,0 +1,89 @@
+package notifier
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestSlackWebhookBlocks(t *testing.T) {
+	alert := &models.Alert{
+		ID:           "a1",
+		Severity:     models.AlertSeverityCritical,
+		ClusterID:    "main",
+		Title:        "Replication lag high",
+		Description:  "Replica is 120s behind",
+		Metric:       "replication_lag",
+		Threshold:    30,
+		CurrentValue: 120,
+		Actions:      []string{"Check replica I/O", "Check long transactions"},
+	}
+
+	body, err := SlackWebhook("https://hooks.slack.com/services/T/B/x", models.AlertSeverityHigh).Format(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decode into plain maps so the test checks the JSON Slack receives
+	var message struct {
+		Text        string `json:"text"`
+		Attachments []struct {
+			Color  string           `json:"color"`
+			Blocks []map[string]any `json:"blocks"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.Text != "[CRITICAL] Replication lag high on main" {
+		t.Errorf("text = %q", message.Text)
+	}
+	if len(message.Attachments) != 1 || message.Attachments[0].Color != "#d32f2f" {
+		t.Fatalf("attachments = %+v, want one red attachment", message.Attachments)
+	}
+
+	blocks := message.Attachments[0].Blocks
+	wantTypes := []string{"header", "section", "section", "section"}
+	if len(blocks) != len(wantTypes) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(wantTypes))
+	}
+	for i, want := range wantTypes {
+		if blocks[i]["type"] != want {
+			t.Errorf("block %d type = %v, want %s", i, blocks[i]["type"], want)
+		}
+	}
+
+	header := blocks[0]["text"].(map[string]any)
+	if header["type"] != "plain_text" || header["text"] != message.Text {
+		t.Errorf("header text = %v", header)
+	}
+
+	fields := blocks[2]["fields"].([]any)
+	if len(fields) != 4 {
+		t.Fatalf("got %d fields, want 4", len(fields))
+	}
+	if got := fields[3].(map[string]any)["text"]; got != "*Current / Threshold*\n120.00 / 30.00" {
+		t.Errorf("value field = %q", got)
+	}
+	for _, field := range fields {
+		if field.(map[string]any)["type"] != "mrkdwn" {
+			t.Errorf("field %v isn't mrkdwn", field)
+		}
+	}
+
+	actions := blocks[3]["text"].(map[string]any)["text"].(string)
+	if !strings.HasPrefix(actions, "*Recommended actions*\n") || !strings.Contains(actions, "• Check long transactions") {
+		t.Errorf("actions block = %q", actions)
+	}
+
+	// Blocks without fields or text leave them out of the JSON
+	if _, ok := blocks[0]["fields"]; ok {
+		t.Error("header block has a fields key")
+	}
+	if _, ok := blocks[2]["text"]; ok {
+		t.Error("fields block has a text key")
+	}
+}
@@ -0,0 +1,186 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zvdy/pgao/src/models"
+)
+
+const (
+	// queueSize is the number of alerts waiting for delivery before new ones are dropped
+	queueSize = 100
+
+	// initialBackoff is the wait before the first retry, doubled after every failed attempt
+	initialBackoff = time.Second
+
+	// SignatureHeader carries the HMAC-SHA256 signature of the request body
+	SignatureHeader = "X-PGAO-Signature"
+)
+
+// Webhook is an endpoint that receives alerts, as alert JSON unless Format is set
+type Webhook struct {
+	URL         string
+	MinSeverity models.AlertSeverity
+	Secret      string
+	Format      func(alert *models.Alert) ([]byte, error)
+}
+
+// endpoint returns the webhook URL without its path for logging, since paths
+// like Slack's embed the webhook token
+func (w Webhook) endpoint() string {
+	parsed, err := url.Parse(w.URL)
+	if err != nil {
+		return "webhook"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// redact replaces the full URL in a request error with the endpoint, so the
+// webhook token doesn't end up in the logs
+func (w Webhook) redact(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return &url.Error{Op: urlErr.Op, URL: w.endpoint(), Err: urlErr.Err}
+	}
+	return err
+}
+
+// WebhookNotifier POSTs new alerts to webhooks from a background queue, so
+// slow or failing endpoints never hold up metrics collection
+type WebhookNotifier struct {
+	webhooks    []Webhook
+	maxAttempts int
+	client      *http.Client
+	log         *logrus.Logger
+	queue       chan *models.Alert
+}
+
+// NewWebhookNotifier creates a new WebhookNotifier. Deliveries are retried on
+// network errors and 5xx responses, up to maxAttempts in total.
+func NewWebhookNotifier(webhooks []Webhook, maxAttempts int, timeout time.Duration, log *logrus.Logger) *WebhookNotifier {
+	return &WebhookNotifier{
+		webhooks:    webhooks,
+		maxAttempts: maxAttempts,
+		client:      &http.Client{Timeout: timeout},
+		log:         log,
+		queue:       make(chan *models.Alert, queueSize),
+	}
+}
+
+// Notify queues an alert for delivery without blocking
+func (wn *WebhookNotifier) Notify(alert *models.Alert) {
+	select {
+	case wn.queue <- alert:
+	default:
+		wn.log.Errorf("Notification queue full, dropping alert %s (%s) for cluster %s", alert.ID, alert.Title, alert.ClusterID)
+	}
+}
+
+// Start delivers queued alerts until the context is cancelled
+func (wn *WebhookNotifier) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			wn.log.Info("Stopping webhook notifier")
+			return
+		case alert := <-wn.queue:
+			wn.dispatch(ctx, alert)
+		}
+	}
+}
+
+// dispatch sends an alert to every webhook whose minimum severity it meets
+func (wn *WebhookNotifier) dispatch(ctx context.Context, alert *models.Alert) {
+	for _, webhook := range wn.webhooks {
+		if !alert.Severity.AtLeast(webhook.MinSeverity) {
+			continue
+		}
+
+		format := webhook.Format
+		if format == nil {
+			format = func(alert *models.Alert) ([]byte, error) { return json.Marshal(alert) }
+		}
+		body, err := format(alert)
+		if err != nil {
+			wn.log.Errorf("Failed to encode alert %s for webhook %s: %v", alert.ID, webhook.endpoint(), err)
+			continue
+		}
+
+		if err := wn.deliver(ctx, webhook, body); err != nil {
+			wn.log.Errorf("Dropping alert %s for webhook %s: %v", alert.ID, webhook.endpoint(), err)
+		}
+	}
+}
+
+// deliver POSTs a body to a webhook, retrying with exponential backoff
+func (wn *WebhookNotifier) deliver(ctx context.Context, webhook Webhook, body []byte) error {
+	backoff := initialBackoff
+
+	var err error
+	for attempt := 1; attempt <= wn.maxAttempts; attempt++ {
+		var retry bool
+		retry, err = wn.post(ctx, webhook, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == wn.maxAttempts {
+			break
+		}
+
+		wn.log.Warnf("Webhook %s attempt %d/%d failed, retrying in %s: %v", webhook.endpoint(), attempt, wn.maxAttempts, backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return err
+}
+
+// post makes a single delivery attempt, reporting whether a failure is worth retrying
+func (wn *WebhookNotifier) post(ctx context.Context, webhook Webhook, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to build webhook request: %w", webhook.redact(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if webhook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	}
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send webhook: %w", webhook.redact(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return true, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return false, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return false, nil
+}
+
+// Sign returns the X-PGAO-Signature value for a body: "sha256=" followed by
+// the hex HMAC-SHA256 of the body keyed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
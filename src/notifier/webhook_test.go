@@ -0,0 +1,98 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zvdy/pgao/src/models"
+)
+
+func TestPostErrorOmitsWebhookToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	wn := NewWebhookNotifier(nil, 1, time.Second, log)
+
+	for _, webhook := range []Webhook{
+		{URL: url + "/services/T000/B000/secret-token"},
+		{URL: "http://host:bad-port/services/T000/B000/secret-token"},
+	} {
+		_, err := wn.post(context.Background(), webhook, []byte("{}"))
+		if err == nil {
+			t.Fatalf("post to %s succeeded", webhook.URL)
+		}
+		if strings.Contains(err.Error(), "secret-token") {
+			t.Errorf("error %q contains the webhook token", err)
+		}
+	}
+}
+
+// webhookRequest is a request received by a test webhook server
+type webhookRequest struct {
+	path      string
+	signature string
+	body      []byte
+}
+
+func TestDispatch(t *testing.T) {
+	var received []webhookRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, webhookRequest{path: r.URL.Path, signature: r.Header.Get(SignatureHeader), body: body})
+	}))
+	defer server.Close()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	wn := NewWebhookNotifier([]Webhook{
+		{URL: server.URL + "/all", MinSeverity: models.AlertSeverityInfo},
+		{URL: server.URL + "/high", MinSeverity: models.AlertSeverityHigh, Secret: "s3cret"},
+	}, 1, time.Second, log)
+
+	medium := &models.Alert{ID: "a1", Severity: models.AlertSeverityMedium, ClusterID: "main", Title: "Cache hit ratio low", Metric: "cache_hit_ratio", Threshold: 0.9, CurrentValue: 0.8}
+	critical := &models.Alert{ID: "a2", Severity: models.AlertSeverityCritical, ClusterID: "main", Title: "Replication lag high", Metric: "replication_lag"}
+
+	wn.dispatch(context.Background(), medium)
+	wn.dispatch(context.Background(), critical)
+
+	// The medium alert is below the second webhook's minimum severity
+	if len(received) != 3 {
+		t.Fatalf("webhooks received %d requests, want 3", len(received))
+	}
+	for i, want := range []struct{ path, alertID string }{{"/all", "a1"}, {"/all", "a2"}, {"/high", "a2"}} {
+		if received[i].path != want.path {
+			t.Errorf("request %d went to %s, want %s", i, received[i].path, want.path)
+		}
+
+		var alert models.Alert
+		if err := json.Unmarshal(received[i].body, &alert); err != nil {
+			t.Fatalf("request %d body isn't alert JSON: %v", i, err)
+		}
+		if alert.ID != want.alertID || alert.ClusterID != "main" || alert.Metric == "" {
+			t.Errorf("request %d delivered %+v, want alert %s", i, alert, want.alertID)
+		}
+	}
+
+	// Only the webhook with a secret signs its requests
+	if received[0].signature != "" {
+		t.Errorf("unsigned webhook got signature %q", received[0].signature)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(received[2].body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); received[2].signature != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, received[2].signature, want)
+	}
+}
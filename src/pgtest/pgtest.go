@@ -0,0 +1,486 @@
+// Package pgtest runs a fake PostgreSQL server for tests of code that
+// queries clusters. It speaks enough of the wire protocol for pgx, over both
+// the extended and the simple protocol, and answers every query with the
+// canned result of a pattern the query contains.
+package pgtest
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Result is the canned answer to a query
+type Result struct {
+	Columns []string
+	Rows    [][]any // values are encoded by their Go type, nil is NULL
+	// Err, when set, is returned instead of rows
+	Err *pgconn.PgError
+}
+
+// Query is a query the server received, with its arguments in text form
+type Query struct {
+	SQL  string
+	Args []string
+}
+
+// handler answers queries containing pattern
+type handler struct {
+	pattern string
+	result  Result
+}
+
+// Server is a fake PostgreSQL server listening on a local port
+type Server struct {
+	listener net.Listener
+	conns    sync.WaitGroup
+
+	mu            sync.Mutex
+	handlers      []handler
+	queries       []Query
+	open          map[net.Conn]struct{}
+	refusePrepare bool
+}
+
+// NewServer starts a server that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{listener: listener, open: make(map[net.Conn]struct{})}
+	go s.accept()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Host returns the address the server listens on
+func (s *Server) Host() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Handle answers queries containing pattern with result. Patterns
+// registered later take precedence, so a test can replace an answer.
+// Queries without a matching pattern fail, except transaction control and
+// SET statements, which succeed without rows.
+func (s *Server) Handle(pattern string, result Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers = append(s.handlers, handler{pattern: pattern, result: result})
+}
+
+// RefusePreparedStatements makes the extended protocol fail the way it does
+// behind a transaction-pooling proxy, leaving only the simple protocol
+func (s *Server) RefusePreparedStatements() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refusePrepare = true
+}
+
+// Queries returns the queries received so far, oldest first. Pings aren't
+// included.
+func (s *Server) Queries() []Query {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Query(nil), s.queries...)
+}
+
+// Close stops the server and closes its connections
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.open {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.conns.Wait()
+}
+
+// accept serves connections until the listener is closed
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.open[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.open, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.serve(conn)
+		}()
+	}
+}
+
+// lookup returns the result of a query
+func (s *Server) lookup(sql string) (Result, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.handlers) - 1; i >= 0; i-- {
+		if strings.Contains(sql, s.handlers[i].pattern) {
+			return s.handlers[i].result, true
+		}
+	}
+
+	switch strings.ToUpper(strings.Fields(sql + " x")[0]) {
+	case "BEGIN", "COMMIT", "ROLLBACK", "SET":
+		return Result{}, true
+	}
+
+	return Result{}, false
+}
+
+// record stores a received query
+func (s *Server) record(sql string, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queries = append(s.queries, Query{SQL: sql, Args: args})
+}
+
+// conn is the protocol state of one connection
+type conn struct {
+	backend    *pgproto3.Backend
+	typeMap    *pgtype.Map
+	statements map[string]string // prepared statement name -> query
+	portal     portal
+	failed     bool // an error was sent and messages are ignored until Sync
+}
+
+// portal is the bound unnamed portal
+type portal struct {
+	result  Result
+	formats []int16
+}
+
+// serve runs the protocol of a connection
+func (s *Server) serve(netConn net.Conn) {
+	c := &conn{
+		backend:    pgproto3.NewBackend(netConn, netConn),
+		typeMap:    pgtype.NewMap(),
+		statements: make(map[string]string),
+	}
+
+	if !c.startup(netConn) {
+		return
+	}
+
+	for {
+		msg, err := c.backend.Receive()
+		if err != nil {
+			return
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.Terminate:
+			return
+		case *pgproto3.Sync:
+			c.failed = false
+			c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		case *pgproto3.Query:
+			s.simpleQuery(c, msg.String)
+		default:
+			if !c.failed {
+				s.extended(c, msg)
+			}
+		}
+
+		if err := c.backend.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// startup declines encryption and accepts the connection without a password
+func (c *conn) startup(netConn net.Conn) bool {
+	for {
+		msg, err := c.backend.ReceiveStartupMessage()
+		if err != nil {
+			return false
+		}
+
+		switch msg.(type) {
+		case *pgproto3.SSLRequest, *pgproto3.GSSEncRequest:
+			if _, err := netConn.Write([]byte{'N'}); err != nil {
+				return false
+			}
+			continue
+		case *pgproto3.StartupMessage:
+		default:
+			return false
+		}
+		break
+	}
+
+	c.backend.Send(&pgproto3.AuthenticationOk{})
+	for name, value := range map[string]string{
+		"server_version":              "16.2",
+		"server_encoding":             "UTF8",
+		"client_encoding":             "UTF8",
+		"standard_conforming_strings": "on",
+		"DateStyle":                   "ISO, MDY",
+		"integer_datetimes":           "on",
+		"TimeZone":                    "UTC",
+	} {
+		c.backend.Send(&pgproto3.ParameterStatus{Name: name, Value: value})
+	}
+	c.backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+	c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+
+	return c.backend.Flush() == nil
+}
+
+// simpleQuery answers a query sent over the simple protocol, with values in
+// text format
+func (s *Server) simpleQuery(c *conn, sql string) {
+	defer c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+
+	if isEmpty(sql) {
+		c.backend.Send(&pgproto3.EmptyQueryResponse{})
+		return
+	}
+
+	s.record(sql, nil)
+	result, ok := s.lookup(sql)
+	if !ok {
+		c.backend.Send(errorResponse(unknownQuery(sql)))
+		return
+	}
+	if result.Err != nil {
+		c.backend.Send(errorResponse(result.Err))
+		return
+	}
+
+	c.sendRows(result, nil, true)
+}
+
+// extended answers the messages of the extended protocol
+func (s *Server) extended(c *conn, msg pgproto3.FrontendMessage) {
+	switch msg := msg.(type) {
+	case *pgproto3.Parse:
+		s.mu.Lock()
+		refuse := s.refusePrepare
+		s.mu.Unlock()
+		if refuse {
+			s.record(msg.Query, nil)
+			c.fail(&pgconn.PgError{Code: "26000", Message: fmt.Sprintf("prepared statement %q does not exist", msg.Name)})
+			return
+		}
+
+		result, ok := s.lookup(msg.Query)
+		if !ok {
+			s.record(msg.Query, nil)
+			c.fail(unknownQuery(msg.Query))
+			return
+		}
+		if result.Err != nil {
+			s.record(msg.Query, nil)
+			c.fail(result.Err)
+			return
+		}
+		c.statements[msg.Name] = msg.Query
+		c.backend.Send(&pgproto3.ParseComplete{})
+
+	case *pgproto3.Describe:
+		if msg.ObjectType == 'P' {
+			c.sendRowDescription(c.portal.result, c.portal.formats)
+			return
+		}
+		query := c.statements[msg.Name]
+		// Parameters have no type, so the client sends them as text
+		params := make([]uint32, countParams(query))
+		c.backend.Send(&pgproto3.ParameterDescription{ParameterOIDs: params})
+		result, _ := s.lookup(query)
+		c.sendRowDescription(result, nil)
+
+	case *pgproto3.Bind:
+		query := c.statements[msg.PreparedStatement]
+		args := make([]string, len(msg.Parameters))
+		for i, param := range msg.Parameters {
+			if param == nil {
+				args[i] = "NULL"
+				continue
+			}
+			args[i] = string(param)
+		}
+		s.record(query, args)
+
+		result, _ := s.lookup(query)
+		c.portal = portal{result: result, formats: msg.ResultFormatCodes}
+		c.backend.Send(&pgproto3.BindComplete{})
+
+	case *pgproto3.Execute:
+		c.sendRows(c.portal.result, c.portal.formats, false)
+
+	case *pgproto3.Close:
+		delete(c.statements, msg.Name)
+		c.backend.Send(&pgproto3.CloseComplete{})
+	}
+}
+
+// fail sends an error and ignores the extended protocol messages until Sync
+func (c *conn) fail(err *pgconn.PgError) {
+	c.failed = true
+	c.backend.Send(errorResponse(err))
+}
+
+// sendRowDescription describes the columns of a result, or that it has none
+func (c *conn) sendRowDescription(result Result, formats []int16) {
+	if len(result.Columns) == 0 {
+		c.backend.Send(&pgproto3.NoData{})
+		return
+	}
+
+	fields := make([]pgproto3.FieldDescription, len(result.Columns))
+	for i, name := range result.Columns {
+		fields[i] = pgproto3.FieldDescription{
+			Name:         []byte(name),
+			DataTypeOID:  columnOID(result, i),
+			DataTypeSize: -1,
+			TypeModifier: -1,
+			Format:       format(formats, i),
+		}
+	}
+	c.backend.Send(&pgproto3.RowDescription{Fields: fields})
+}
+
+// sendRows sends the rows of a result, described first when the client
+// didn't ask for a description
+func (c *conn) sendRows(result Result, formats []int16, describe bool) {
+	if describe && len(result.Columns) > 0 {
+		c.sendRowDescription(result, formats)
+	}
+
+	for _, row := range result.Rows {
+		values := make([][]byte, len(row))
+		for i, value := range row {
+			if value == nil {
+				continue
+			}
+			// A non-nil buffer keeps empty values such as "" apart from NULL
+			encoded, err := c.typeMap.Encode(columnOID(result, i), format(formats, i), value, []byte{})
+			if err != nil {
+				c.fail(&pgconn.PgError{Code: "XX000", Message: fmt.Sprintf("pgtest: encoding column %s: %v", result.Columns[i], err)})
+				return
+			}
+			values[i] = encoded
+		}
+		c.backend.Send(&pgproto3.DataRow{Values: values})
+	}
+
+	tag := "SELECT " + strconv.Itoa(len(result.Rows))
+	c.backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+}
+
+// columnOID returns the type of a column from the Go type of its first
+// non-NULL value
+func columnOID(result Result, column int) uint32 {
+	for _, row := range result.Rows {
+		switch row[column].(type) {
+		case nil:
+			continue
+		case bool:
+			return pgtype.BoolOID
+		case int32:
+			return pgtype.Int4OID
+		case int, int64:
+			return pgtype.Int8OID
+		case float64:
+			return pgtype.Float8OID
+		case time.Time:
+			return pgtype.TimestamptzOID
+		case []byte:
+			return pgtype.ByteaOID
+		default:
+			return pgtype.TextOID
+		}
+	}
+
+	return pgtype.TextOID
+}
+
+// format returns the format code of a column, given the codes of a Bind:
+// none means text, one applies to every column
+func format(formats []int16, column int) int16 {
+	switch len(formats) {
+	case 0:
+		return pgtype.TextFormatCode
+	case 1:
+		return formats[0]
+	default:
+		return formats[column]
+	}
+}
+
+// paramRef matches the parameter placeholders of a query
+var paramRef = regexp.MustCompile(`\$(\d+)`)
+
+// countParams returns the highest parameter number of a query
+func countParams(query string) int {
+	count := 0
+	for _, match := range paramRef.FindAllStringSubmatch(query, -1) {
+		if n, err := strconv.Atoi(match[1]); err == nil && n > count {
+			count = n
+		}
+	}
+	return count
+}
+
+// isEmpty reports whether a query has no statement, as pings do
+func isEmpty(sql string) bool {
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// unknownQuery is the error returned for a query without a result
+func unknownQuery(sql string) *pgconn.PgError {
+	return &pgconn.PgError{Code: "XX000", Message: "pgtest: no result for query: " + strings.Join(strings.Fields(sql), " ")}
+}
+
+// errorResponse converts an error to its protocol message
+func errorResponse(err *pgconn.PgError) *pgproto3.ErrorResponse {
+	severity := err.Severity
+	if severity == "" {
+		severity = "ERROR"
+	}
+	return &pgproto3.ErrorResponse{Severity: severity, Code: err.Code, Message: err.Message}
+}